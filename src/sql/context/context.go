@@ -5,11 +5,25 @@ import (
 )
 
 type Context struct {
+	connectionID uint32
+	user         string
+	host         string
 	currentDB    string
 	affectedRows uint64
 	lastInsertID uint64
 	status       uint16
-	warningCount uint16
+	warnings     []*Warning
+	// system variables the session set
+	sessionVars map[string]string
+	// global values stored when the session started
+	globalVars map[string]string
+}
+
+// Warning is a note of the last statement, listed by SHOW WARNINGS
+type Warning struct {
+	Level   string
+	Code    uint16
+	Message string
 }
 
 func NewContext() *Context {
@@ -36,7 +50,37 @@ func (ctx *Context) Status() uint16 {
 }
 
 func (ctx *Context) WarningCount() uint16 {
-	return ctx.warningCount
+	return uint16(len(ctx.warnings))
+}
+
+func (ctx *Context) Warnings() []*Warning {
+	return ctx.warnings
+}
+
+func (ctx *Context) AppendWarning(code uint16, message string) {
+	ctx.warnings = append(ctx.warnings, &Warning{Level: "Warning", Code: code, Message: message})
+}
+
+func (ctx *Context) ClearWarnings() {
+	ctx.warnings = nil
+}
+
+func (ctx *Context) ConnectionID() uint32 {
+	return ctx.connectionID
+}
+
+func (ctx *Context) SetConnectionID(id uint32) {
+	ctx.connectionID = id
+}
+
+// User gives the client as user@host.
+func (ctx *Context) User() string {
+	return ctx.user + "@" + ctx.host
+}
+
+func (ctx *Context) SetUser(user string, host string) {
+	ctx.user = user
+	ctx.host = host
 }
 
 func (ctx *Context) GetCurrentDB() string {
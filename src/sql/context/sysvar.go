@@ -1,12 +1,46 @@
 package context
 
 import (
+	"strconv"
 	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/mysql"
+)
+
+// the scopes a system variable has
+const (
+	ScopeGlobal = 1 << iota
+	ScopeSession
+	ScopeBoth = ScopeGlobal | ScopeSession
+)
+
+// the types of the values of system variables
+const (
+	TypeString int = iota
+	TypeInt
+	TypeBool
+	TypeEnum
 )
 
+/*
+ * SysVar is a system variable, Value is its default. A session starts with
+ * the global values, which SET GLOBAL stores in the system records of the
+ * storage so that every node sees them, and SET SESSION changes them for
+ * the session only. A variable of GLOBAL scope only has no session value,
+ * it is read from the storage each time it is used, so a SET GLOBAL on
+ * any node is seen by every session at once.
+ */
 type SysVar struct {
+	Scope int
 	Name  string
 	Value string
+	Type  int
+	// the range of an int
+	Min int64
+	Max int64
+	// the values of an enum
+	Values   []string
+	ReadOnly bool
 }
 
 var SysVars map[string]*SysVar
@@ -23,6 +57,137 @@ func GetSysVar(name string) *SysVar {
 	return SysVars[name]
 }
 
+// Validate gives the value the variable takes for value, in its canonical
+// form, or an error when the variable can't take it
+func (sv *SysVar) Validate(value string) (string, error) {
+	switch sv.Type {
+	case TypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", mysql.NewErrf(mysql.ErrWrongTypeForVar, "Incorrect argument type to variable '%s'", sv.Name)
+		}
+		if n < sv.Min || n > sv.Max {
+			return "", sv.wrongValue(value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case TypeBool:
+		switch strings.ToUpper(value) {
+		case "ON", "TRUE", "1":
+			return "ON", nil
+		case "OFF", "FALSE", "0":
+			return "OFF", nil
+		}
+		return "", sv.wrongValue(value)
+	case TypeEnum:
+		for _, v := range sv.Values {
+			if strings.EqualFold(v, value) {
+				return v, nil
+			}
+		}
+		return "", sv.wrongValue(value)
+	}
+	return value, nil
+}
+
+func (sv *SysVar) wrongValue(value string) error {
+	return mysql.NewErrf(mysql.ErrWrongValueForVar, "Variable '%s' can't be set to the value of '%s'", sv.Name, value)
+}
+
+// SysVarValue gives the value of a system variable for the session, which
+// is its global value when the session started unless the session set it.
+// The value of a variable of GLOBAL scope only is read by LoadGlobalVar.
+func (ctx *Context) SysVarValue(name string) (string, bool) {
+	name = strings.ToLower(name)
+	sv := SysVars[name]
+	if sv == nil {
+		return "", false
+	}
+	if v, ok := ctx.sessionVars[name]; ok {
+		return v, true
+	}
+	if v, ok := ctx.globalVars[name]; ok {
+		return v, true
+	}
+	return sv.Value, true
+}
+
+// SetSessionVar sets the value of a system variable for the session only
+func (ctx *Context) SetSessionVar(name string, value string) {
+	if ctx.sessionVars == nil {
+		ctx.sessionVars = make(map[string]string)
+	}
+	ctx.sessionVars[strings.ToLower(name)] = value
+}
+
+// GlobalVarsLoaded tells whether the session has read the global values
+func (ctx *Context) GlobalVarsLoaded() bool {
+	return ctx.globalVars != nil
+}
+
+// SetGlobalVars sets the global values the session starts with, which
+// were stored by SET GLOBAL
+func (ctx *Context) SetGlobalVars(vars map[string]string) {
+	ctx.globalVars = make(map[string]string, len(vars))
+	for name, value := range vars {
+		ctx.globalVars[strings.ToLower(name)] = value
+	}
+}
+
+const (
+	// the number of workers a table scan reads its rows with
+	ScanWorkers = "nesoi_scan_workers"
+	// the milliseconds a SELECT may run, 0 for no limit
+	MaxExecutionTime = "max_execution_time"
+
+	CharsetClient     = "character_set_client"
+	CharsetConnection = "character_set_connection"
+	CharsetResults    = "character_set_results"
+	CollationConn     = "collation_connection"
+)
+
+// the character sets SET NAMES takes and their collations, the first one
+// is the default
+var Charsets = map[string][]string{
+	"utf8":    {"utf8_general_ci", "utf8_bin", "utf8_unicode_ci"},
+	"utf8mb4": {"utf8mb4_general_ci", "utf8mb4_bin", "utf8mb4_unicode_ci", "utf8mb4_0900_ai_ci"},
+	"latin1":  {"latin1_swedish_ci", "latin1_bin", "latin1_general_ci", "latin1_general_cs"},
+	"ascii":   {"ascii_general_ci", "ascii_bin"},
+	"binary":  {"binary"},
+}
+
+// CollationCharset gives the character set of a collation, "" for an
+// unknown collation
+func CollationCharset(collation string) string {
+	for charset, collations := range Charsets {
+		for _, c := range collations {
+			if c == collation {
+				return charset
+			}
+		}
+	}
+	return ""
+}
+
+// the character set of SET NAMES DEFAULT
+const DefaultCharset = "utf8"
+
 var defaultVars = []*SysVar{
-	{"version_comment", "MySQL Community Server (GPL)"},
+	{Scope: ScopeGlobal, Name: "version_comment", Value: "MySQL Community Server (GPL)", ReadOnly: true},
+	{Scope: ScopeGlobal, Name: "version", Value: mysql.ServerVersion, ReadOnly: true},
+	{Scope: ScopeGlobal, Name: "lower_case_table_names", Value: "0", Type: TypeInt, ReadOnly: true},
+	{Scope: ScopeBoth, Name: "autocommit", Value: "ON", Type: TypeBool},
+	{Scope: ScopeBoth, Name: CharsetClient, Value: DefaultCharset},
+	{Scope: ScopeBoth, Name: CharsetConnection, Value: DefaultCharset},
+	{Scope: ScopeBoth, Name: CharsetResults, Value: DefaultCharset},
+	{Scope: ScopeBoth, Name: CollationConn, Value: Charsets[DefaultCharset][0]},
+	{Scope: ScopeBoth, Name: "sql_mode", Value: ""},
+	{Scope: ScopeBoth, Name: "time_zone", Value: "SYSTEM"},
+	{Scope: ScopeBoth, Name: "tx_isolation", Value: "REPEATABLE-READ", Type: TypeEnum,
+		Values: []string{"READ-UNCOMMITTED", "READ-COMMITTED", "REPEATABLE-READ", "SERIALIZABLE"}},
+	{Scope: ScopeBoth, Name: "max_allowed_packet", Value: "67108864", Type: TypeInt, Min: 1024, Max: 1073741824},
+	{Scope: ScopeBoth, Name: "wait_timeout", Value: "28800", Type: TypeInt, Min: 1, Max: 31536000},
+	{Scope: ScopeBoth, Name: "interactive_timeout", Value: "28800", Type: TypeInt, Min: 1, Max: 31536000},
+	{Scope: ScopeGlobal, Name: "max_connections", Value: "151", Type: TypeInt, Min: 1, Max: 100000},
+	{Scope: ScopeBoth, Name: ScanWorkers, Value: "1", Type: TypeInt, Min: 1, Max: 256},
+	{Scope: ScopeBoth, Name: MaxExecutionTime, Value: "0", Type: TypeInt, Min: 0, Max: 1<<32 - 1},
 }
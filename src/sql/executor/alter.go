@@ -0,0 +1,449 @@
+package executor
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+// forEachUserKey calls fn on every user key matching the pattern.
+func forEachUserKey(driver store.Driver, match string, fn func(key string) error) error {
+	var keys []string
+	var cursor uint64
+	var err error
+	for {
+		keys, cursor, err = driver.ScanUserRecords(cursor, match, OnceScanCount)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = fn(key); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// deleteUserKeys deletes every user key matching the pattern, a scan page at a time.
+func deleteUserKeys(driver store.Driver, match string) error {
+	var keys []string
+	var cursor uint64
+	var err error
+	for {
+		keys, cursor, err = driver.ScanUserRecords(cursor, match, OnceScanCount)
+		if err != nil {
+			return err
+		}
+		if err = driver.DelUserRecords(keys); err != nil {
+			return err
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// forEachSysKey calls fn on every system key matching the pattern.
+func forEachSysKey(driver store.Driver, match string, fn func(key string) error) error {
+	var keys []string
+	var cursor uint64
+	var err error
+	for {
+		keys, cursor, err = driver.ScanSysRecords(cursor, match, OnceScanCount)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = fn(key); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+/*
+ * alter table checks every spec against a copy of the table in memory,
+ * nothing is written unless they all pass. The table metadata is then
+ * saved once, and the indexes are renamed, dropped and added. Column
+ * changes only rewrite the table info, rows are keyed by column id so
+ * they are decoded against the new schema without being rewritten.
+ */
+type alterTable struct {
+	table   *parser.TableInfo
+	oldName string
+	changed bool
+	// the indexes kept, dropped and added by the statement
+	idxs  []*parser.IndexInfo
+	drops []*parser.IndexInfo
+	adds  []*parser.IndexInfo
+	// the new names of the kept indexes of a renamed table
+	renames map[string]string
+}
+
+func (ddl *DDLExec) executeAlterTable() error {
+	stmt := ddl.stmt.(*parser.AlterTable)
+
+	tblName := ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name)
+	table, err := parser.LoadTableInfo(ddl.driver, tblName)
+	if err == store.Nil {
+		return errors.New("table not exists!")
+	}
+	if err != nil {
+		return err
+	}
+	idxs, err := parser.TableIndexes(ddl.driver, tblName)
+	if err != nil {
+		return err
+	}
+
+	at := &alterTable{table: table, oldName: tblName, idxs: idxs}
+	for _, spec := range stmt.Specs {
+		switch spec.Type {
+		case parser.AlterAddColumn:
+			err = at.addColumn(spec.Column)
+		case parser.AlterDropColumn:
+			err = at.dropColumn(spec.OldName)
+		case parser.AlterModifyColumn:
+			err = ddl.alterModifyColumn(at, spec.Column.Name, spec.Column)
+		case parser.AlterChangeColumn:
+			err = ddl.alterModifyColumn(at, spec.OldName, spec.Column)
+		case parser.AlterAddIndex:
+			err = ddl.alterAddIndex(at, stmt.Table, spec)
+		case parser.AlterDropIndex:
+			err = ddl.alterDropIndex(at, spec.Index)
+		case parser.AlterRename:
+			err = ddl.alterRenameTable(at, spec.NewTable)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return at.save(ddl.driver)
+}
+
+// save writes the table and its indexes as the specs left them
+func (at *alterTable) save(driver store.Driver) error {
+	table := at.table
+	renamed := table.Name != at.oldName
+	if at.changed || renamed {
+		table.Version++
+		err := parser.SaveTableInfo(driver, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	if renamed {
+		// the new records are written before the old ones are deleted
+		for _, idx := range at.idxs {
+			old := *idx
+			idx.Name, idx.Table = at.renames[idx.Name], table.Name
+			err := parser.SaveIndexInfo(driver, idx)
+			if err != nil {
+				return err
+			}
+			err = driver.DelSysRecord(parser.TableIndexKey(old.Table, old.Fields))
+			if err != nil {
+				return err
+			}
+			if old.Name != idx.Name {
+				err = driver.DelSysRecord(parser.IndexTableKey(old.Name))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		err := driver.DelSysRecord(parser.TableKey(at.oldName))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, idx := range at.drops {
+		err := deleteIndex(driver, table, idx)
+		if err != nil {
+			return err
+		}
+	}
+	for _, idx := range at.adds {
+		idx.Table = table.Name
+		err := createIndex(driver, idx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setColumns gives the table the columns cds, in their order
+func (at *alterTable) setColumns(cds parser.ColumnTableDefs) {
+	cm := make(map[int]*parser.ColumnTableDef)
+	for i, cd := range cds {
+		cd.Pos = i + 1
+		cm[i] = cd
+	}
+	at.table.ColumnMap = cm
+	at.changed = true
+}
+
+// indexOfColumn gives an index kept or added using the column id
+func (at *alterTable) indexOfColumn(id int) *parser.IndexInfo {
+	for _, idxs := range [][]*parser.IndexInfo{at.idxs, at.adds} {
+		for _, idx := range idxs {
+			for _, f := range idx.Fields {
+				if f == id {
+					return idx
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (at *alterTable) addColumn(cd *parser.ColumnTableDef) error {
+	table := at.table
+	if table.ColumnByName(cd.Name) != nil {
+		return errors.New("column " + cd.Name + " already exists!")
+	}
+	if cd.PrimaryKey {
+		return errors.New("can't add primary key column " + cd.Name + "!")
+	}
+
+	table.MaxColumnID++
+	cd.ID = table.MaxColumnID
+	at.setColumns(append(table.ColumnDefs(), cd))
+	return nil
+}
+
+func (at *alterTable) dropColumn(name string) error {
+	table := at.table
+	old := table.ColumnByName(name)
+	if old == nil {
+		return errors.New("column " + name + " not exists!")
+	}
+	if old.PrimaryKey {
+		return errors.New("can't drop primary key column " + name + "!")
+	}
+	if len(table.ColumnMap) == 1 {
+		return errors.New("can't drop all columns of table!")
+	}
+	if idx := at.indexOfColumn(old.ID); idx != nil {
+		return errors.New("column " + name + " is used by index " + idx.Name + ", drop the index first!")
+	}
+
+	cds := parser.ColumnTableDefs{}
+	for _, cd := range table.ColumnDefs() {
+		if cd.ID != old.ID {
+			cds = append(cds, cd)
+		}
+	}
+	at.setColumns(cds)
+	return nil
+}
+
+func (ddl *DDLExec) alterModifyColumn(at *alterTable, name string, cd *parser.ColumnTableDef) error {
+	table := at.table
+	old := table.ColumnByName(name)
+	if old == nil {
+		return errors.New("column " + name + " not exists!")
+	}
+	if !strings.EqualFold(name, cd.Name) && table.ColumnByName(cd.Name) != nil {
+		return errors.New("column " + cd.Name + " already exists!")
+	}
+	if old.PrimaryKey != cd.PrimaryKey {
+		return errors.New("can't change primary key of table!")
+	}
+
+	if parser.ColumnKind(old.Type) != parser.ColumnKind(cd.Type) {
+		if old.PrimaryKey {
+			return errors.New("can't change type of primary key column " + name + "!")
+		}
+		if idx := at.indexOfColumn(old.ID); idx != nil {
+			return errors.New("can't change type of column " + name + " used by index " + idx.Name + "!")
+		}
+	}
+
+	if old.Nullable != parser.NotNull && cd.Nullable == parser.NotNull {
+		hasNull, err := ddl.columnHasNull(table, old)
+		if err != nil {
+			return err
+		}
+		if hasNull {
+			return errors.New("column " + name + " has null values!")
+		}
+	}
+
+	cd.ID = old.ID
+	cds := parser.ColumnTableDefs{}
+	for _, c := range table.ColumnDefs() {
+		if c.ID == old.ID {
+			cds = append(cds, cd)
+		} else {
+			cds = append(cds, c)
+		}
+	}
+	at.setColumns(cds)
+	return nil
+}
+
+func (ddl *DDLExec) columnHasNull(table *parser.TableInfo, cd *parser.ColumnTableDef) (bool, error) {
+	p := &plan.Scan{
+		From:      table,
+		Fields:    []*parser.TargetRes{{Type: parser.ETARGET, TargetID: 1, FieldID: cd.Pos}},
+		FieldsNum: 1,
+	}
+	rst := &ScanExec{scan: p, driver: ddl.driver, context: ddl.context}
+	for {
+		_, rc, err := rst.nextKV()
+		if err != nil {
+			return false, err
+		}
+		if rc == nil {
+			return false, nil
+		}
+		if rc.Datums[0].IsNull() {
+			return true, nil
+		}
+	}
+}
+
+func (ddl *DDLExec) alterAddIndex(at *alterTable, tname *parser.TableName, spec *parser.AlterTableSpec) error {
+	ci := &parser.CreateIndex{
+		Index:   spec.Index,
+		Table:   tname,
+		Unique:  spec.Unique,
+		Targets: spec.Targets,
+	}
+	query, err := parser.NewAnalyzer(ddl.driver, ddl.context).AnalyzeCreateIndex(ci, at.table)
+	if err != nil {
+		return err
+	}
+
+	idx := &parser.IndexInfo{Name: ddl.context.GetTableName(spec.Index.Schema, spec.Index.Name), Unique: spec.Unique}
+	for _, fd := range query.Fields {
+		idx.Fields = append(idx.Fields, at.table.ColumnMap[fd.FieldID-1].ID)
+	}
+	for _, added := range at.adds {
+		if added.Name == idx.Name {
+			return errors.New("index name already exists!")
+		}
+		if equalFields(added.Fields, idx.Fields) {
+			return errors.New("index column has already exists!")
+		}
+	}
+	at.adds = append(at.adds, idx)
+	return nil
+}
+
+func equalFields(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (ddl *DDLExec) alterDropIndex(at *alterTable, iname *parser.TableName) error {
+	idxName := ddl.context.GetTableName(iname.Schema, iname.Name)
+	for i, idx := range at.idxs {
+		if idx.Name == idxName {
+			at.idxs = append(at.idxs[:i], at.idxs[i+1:]...)
+			at.drops = append(at.drops, idx)
+			return nil
+		}
+	}
+
+	_, err := parser.LoadIndexInfo(ddl.driver, idxName)
+	if err == store.Nil {
+		return errors.New("index " + idxName + " not exists!")
+	}
+	if err != nil {
+		return err
+	}
+	return errors.New("index " + idxName + " isn't on table " + at.oldName + "!")
+}
+
+func (ddl *DDLExec) dropIndex(table *parser.TableInfo, iname *parser.TableName) error {
+	idxName := ddl.context.GetTableName(iname.Schema, iname.Name)
+	idx, err := parser.LoadIndexInfo(ddl.driver, idxName)
+	if err == store.Nil {
+		return errors.New("index " + idxName + " not exists!")
+	}
+	if err != nil {
+		return err
+	}
+	if idx.Table != table.Name {
+		return errors.New("index " + idxName + " isn't on table " + table.Name + "!")
+	}
+
+	return deleteIndex(ddl.driver, table, idx)
+}
+
+/*
+ * data of a table is keyed by its id, so renaming only rewrites the
+ * metadata. The indexes move to the database of the new name, an index
+ * being built can't be renamed under its job.
+ */
+func (ddl *DDLExec) alterRenameTable(at *alterTable, tname *parser.TableName) error {
+	newName := ddl.context.GetTableName(tname.Schema, tname.Name)
+	if newName == at.table.Name {
+		return nil
+	}
+
+	if tname.Schema != "" {
+		_, err := ddl.driver.GetSysRecord(store.SystemFlag + store.DBFlag + tname.Schema)
+		if err == store.Nil {
+			return errors.New("database not exists!")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if newName != at.oldName {
+		_, err := ddl.driver.GetSysRecord(parser.TableKey(newName))
+		if err == nil {
+			return errors.New("table alreary exists!")
+		}
+		if err != store.Nil {
+			return err
+		}
+	}
+
+	at.renames = make(map[string]string)
+	for _, idx := range at.idxs {
+		if idx.State != parser.IndexPublic {
+			return errors.New("index " + idx.Name + " is being built, can't rename table!")
+		}
+		idxName := ddl.context.GetTableName(tname.Schema, indexShortName(idx))
+		if idxName != idx.Name {
+			_, err := ddl.driver.GetSysRecord(parser.IndexTableKey(idxName))
+			if err == nil {
+				return errors.New("index name " + idxName + " already exists!")
+			}
+			if err != store.Nil {
+				return err
+			}
+		}
+		at.renames[idx.Name] = idxName
+	}
+	for _, idx := range at.adds {
+		idx.Name = ddl.context.GetTableName(tname.Schema, indexShortName(idx))
+	}
+
+	at.table.Name = newName
+	return nil
+}
@@ -0,0 +1,113 @@
+package executor
+
+import (
+	goctx "context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+// execSQL runs a statement to its end, giving its error
+func execSQL(e *Executor, sql string) error {
+	rs, err := e.Execute(goctx.Background(), sql)
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		for {
+			rc, err := r.Next()
+			if err != nil {
+				return err
+			}
+			if rc == nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func TestAlterTableAllOrNothing(t *testing.T) {
+	driver := newTestDriver()
+	e := NewExecutor(driver, context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create table t (id int primary key, a int, b string)",
+		"insert into t values (1, 10, 'x')",
+		"insert into t (id, a) values (2, 20)",
+	} {
+		queryRows(t, e, sql)
+	}
+	before, _ := parser.LoadTableInfo(driver, "Nesoi.t")
+
+	for _, sql := range []string{
+		"alter table t add column c int, drop column nope",
+		"alter table t drop column a, modify column b string not null",
+		"alter table t add column c int, add index ic (c), drop column c",
+		"alter table t add column c int, rename to nodb.u",
+	} {
+		if err := execSQL(e, sql); err == nil {
+			t.Errorf("%s: no error", sql)
+		}
+	}
+
+	after, _ := parser.LoadTableInfo(driver, "Nesoi.t")
+	if after.Version != before.Version || len(after.ColumnMap) != 3 || after.MaxColumnID != before.MaxColumnID {
+		t.Fatalf("table changed by failed statements: version %d, %d columns", after.Version, len(after.ColumnMap))
+	}
+	idxs, _ := parser.TableIndexes(driver, "Nesoi.t")
+	if len(idxs) != 0 {
+		t.Fatalf("%d indexes added by failed statements", len(idxs))
+	}
+
+	queryRows(t, e, "alter table t add column c int, drop column b")
+	got := strings.Join(queryRows(t, e, "select * from t"), "\n")
+	if got != "1 10 NULL\n2 20 NULL" {
+		t.Fatalf("rows after alter:\n%s", got)
+	}
+	after, _ = parser.LoadTableInfo(driver, "Nesoi.t")
+	if after.Version != before.Version+1 {
+		t.Fatalf("version %d, saved once from %d", after.Version, before.Version)
+	}
+}
+
+func TestAlterRenameIndexes(t *testing.T) {
+	SchemaLease = 10 * time.Millisecond
+	defer func() { SchemaLease = 10 * time.Second }()
+	driver := newTestDriver()
+	e := NewExecutor(driver, context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create database d2",
+		"create table t (id int primary key, a int)",
+		"insert into t values (1, 10), (2, 20)",
+		"create index ia on t (a)",
+	} {
+		queryRows(t, e, sql)
+	}
+
+	queryRows(t, e, "alter table t rename to d2.u")
+	if _, err := parser.LoadIndexInfo(driver, "Nesoi.ia"); err != store.Nil {
+		t.Fatalf("index left in the old database: %v", err)
+	}
+	idx, err := parser.LoadIndexInfo(driver, "d2.ia")
+	if err != nil || idx.Table != "d2.u" {
+		t.Fatalf("renamed index %+v %v", idx, err)
+	}
+	idxs, _ := parser.TableIndexes(driver, "d2.u")
+	if len(idxs) != 1 {
+		t.Fatalf("%d indexes on the renamed table", len(idxs))
+	}
+	if _, err := parser.LoadTableInfo(driver, "Nesoi.t"); err != store.Nil {
+		t.Fatalf("old table left: %v", err)
+	}
+
+	got := strings.Join(queryRows(t, e, "select id from d2.u where a = 20"), "\n")
+	if got != "2" {
+		t.Fatalf("index lookup after rename: %q", got)
+	}
+}
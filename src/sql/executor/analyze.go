@@ -0,0 +1,400 @@
+package executor
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+	"github.com/golang/glog"
+)
+
+const (
+	// values of a column sampled for its histogram
+	StatsSampleSize int = 10000
+	StatsBuckets    int = 64
+
+	/*
+	 * a table is analyzed again in the background once the rows written
+	 * since it was analyzed are AutoAnalyzeRatio of its rows, and at least
+	 * AutoAnalyzeMinRows. A table never analyzed is analyzed once that
+	 * many rows were written to it.
+	 */
+	AutoAnalyzeRatio   float64 = 0.5
+	AutoAnalyzeMinRows int64   = 1000
+)
+
+type columnCollector struct {
+	distinct map[string]bool
+	nulls    int64
+	count    int64
+	sample   []*util.Datum
+}
+
+func (c *columnCollector) add(d *util.Datum, r *rand.Rand) {
+	if d == nil || d.IsNull() {
+		c.nulls++
+		return
+	}
+	c.distinct[hashRow([]*util.Datum{d})] = true
+	c.count++
+	if len(c.sample) < StatsSampleSize {
+		c.sample = append(c.sample, d)
+	} else if i := r.Int63n(c.count); i < int64(StatsSampleSize) {
+		c.sample[i] = d
+	}
+}
+
+func datumValue(d *util.Datum) interface{} {
+	if d.GetK() == util.KindString {
+		return string(d.GetB())
+	}
+	return d.GetI()
+}
+
+/*
+ * buckets splits the sorted sample into StatsBuckets buckets of about the
+ * same number of values, a value never being split over two buckets. The
+ * counts are scaled up from the sample to all the values.
+ */
+func (c *columnCollector) buckets() []*parser.Bucket {
+	sort.Slice(c.sample, func(i, j int) bool {
+		return expression.Compare(c.sample[i], c.sample[j]) < 0
+	})
+	scale := float64(c.count) / float64(len(c.sample))
+	size := (len(c.sample) + StatsBuckets - 1) / StatsBuckets
+
+	var bs []*parser.Bucket
+	var cur *parser.Bucket
+	var count, repeats int
+	for i, d := range c.sample {
+		if cur == nil {
+			cur = &parser.Bucket{Lower: datumValue(d)}
+			count, repeats = 0, 0
+		}
+		count++
+		if i > 0 && expression.Compare(d, c.sample[i-1]) == 0 {
+			repeats++
+		} else {
+			repeats = 1
+		}
+		last := i == len(c.sample)-1
+		if last || (count >= size && expression.Compare(d, c.sample[i+1]) != 0) {
+			cur.Upper = datumValue(d)
+			cur.Count = int64(math.Round(float64(count) * scale))
+			cur.Repeats = int64(math.Round(float64(repeats) * scale))
+			bs = append(bs, cur)
+			cur = nil
+		}
+	}
+	return bs
+}
+
+// analyzeTable reads all the rows of the table to collect its statistics
+func analyzeTable(driver store.Driver, table *parser.TableInfo) (*parser.TableStats, error) {
+	modified, err := parser.TableModified(driver, table.ID)
+	if err != nil {
+		return nil, err
+	}
+	var idxs []*parser.IndexInfo
+	all, err := parser.TableIndexes(driver, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range all {
+		if idx.State == parser.IndexPublic {
+			idxs = append(idxs, idx)
+		}
+	}
+
+	ts := &parser.TableStats{TableID: table.ID, Modified: modified, Time: time.Now().Unix()}
+	cols := make([]*columnCollector, len(table.ColumnMap))
+	for i := range cols {
+		cols[i] = &columnCollector{distinct: make(map[string]bool)}
+	}
+	entries := make([]map[string]bool, len(idxs))
+	for i := range entries {
+		entries[i] = make(map[string]bool)
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	match := table.RowPrefix() + "*"
+	var keys []string
+	var cursor uint64
+	for {
+		keys, cursor, err = driver.ScanUserRecords(cursor, match, OnceScanCount)
+		if err != nil {
+			return nil, err
+		}
+		raws, exist, err := getUserRecords(driver, keys)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys {
+			if !exist[i] {
+				continue
+			}
+			dm, err := decodeRow(raws[i], table)
+			if err != nil {
+				return nil, err
+			}
+			row := make([]*util.Datum, len(table.ColumnMap))
+			for i, c := range cols {
+				row[i] = dm[i]
+				c.add(dm[i], r)
+			}
+			for i, idx := range idxs {
+				entry, err := indexKey(idx, table, row)
+				if err != nil {
+					return nil, err
+				}
+				entries[i][entry] = true
+			}
+			ts.Count++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i, c := range cols {
+		cs := &parser.ColumnStats{ID: table.ColumnMap[i].ID, NDV: int64(len(c.distinct)), Nulls: c.nulls}
+		if len(c.sample) > 0 {
+			cs.Buckets = c.buckets()
+		}
+		ts.Columns = append(ts.Columns, cs)
+	}
+	for i, idx := range idxs {
+		ts.Indexes = append(ts.Indexes, &parser.IndexStats{ID: idx.ID, NDV: int64(len(entries[i]))})
+	}
+
+	return ts, parser.SaveTableStats(driver, ts)
+}
+
+var autoAnalyzing = struct {
+	sync.Mutex
+	tables map[int64]bool
+}{tables: make(map[int64]bool)}
+
+/*
+ * the rows written to a table are counted in memory by each node, and
+ * added to the count of the storage once ModifiedFlushRows were written
+ * or every ModifiedFlushInterval, so a statement doesn't make a round trip
+ * for it. The statistics are only read when the count of the storage
+ * reaches the count the table was to be analyzed again at, when they were
+ * last read.
+ */
+var (
+	ModifiedFlushRows     int64 = 100
+	ModifiedFlushInterval       = time.Second
+)
+
+type modifiedCount struct {
+	table   *parser.TableInfo
+	driver  store.Driver
+	pending int64
+	// the count of the storage the table is analyzed again at, 0 until
+	// the statistics are read
+	threshold int64
+}
+
+var modifiedCounts = struct {
+	sync.Mutex
+	tables  map[int64]*modifiedCount
+	started bool
+}{tables: make(map[int64]*modifiedCount)}
+
+/*
+ * noteModified counts n more rows written to the table. The rows are
+ * written by then, so an error counting them is only logged.
+ */
+func noteModified(driver store.Driver, table *parser.TableInfo, n int64) {
+	if n == 0 {
+		return
+	}
+
+	modifiedCounts.Lock()
+	mc := modifiedCounts.tables[table.ID]
+	if mc == nil {
+		mc = &modifiedCount{driver: baseDriver(driver)}
+		modifiedCounts.tables[table.ID] = mc
+	}
+	mc.table = table
+	mc.pending += n
+	flush := mc.pending >= ModifiedFlushRows
+	if !modifiedCounts.started {
+		modifiedCounts.started = true
+		go flushModifiedLoop()
+	}
+	modifiedCounts.Unlock()
+
+	if !flush {
+		return
+	}
+	if err := flushModified(mc); err != nil {
+		glog.Error("Count rows written to table ", table.Name, " error: ", err.Error())
+	}
+}
+
+// forgetModified drops the rows counted in memory for a table dropped or
+// truncated, its id isn't used any more
+func forgetModified(tableID int64) {
+	modifiedCounts.Lock()
+	delete(modifiedCounts.tables, tableID)
+	modifiedCounts.Unlock()
+}
+
+func flushModifiedLoop() {
+	for {
+		time.Sleep(ModifiedFlushInterval)
+		var mcs []*modifiedCount
+		modifiedCounts.Lock()
+		for _, mc := range modifiedCounts.tables {
+			if mc.pending > 0 {
+				mcs = append(mcs, mc)
+			}
+		}
+		modifiedCounts.Unlock()
+		for _, mc := range mcs {
+			if err := flushModified(mc); err != nil {
+				glog.Error("Count rows written to table ", mc.table.Name, " error: ", err.Error())
+			}
+		}
+	}
+}
+
+/*
+ * flushModified adds the rows counted in memory to the count of the
+ * storage, and starts to analyze the table in the background when enough
+ * were written since it was analyzed. A table is analyzed by one
+ * statement at a time.
+ */
+func flushModified(mc *modifiedCount) error {
+	modifiedCounts.Lock()
+	n, threshold, table, driver := mc.pending, mc.threshold, mc.table, mc.driver
+	mc.pending = 0
+	forgotten := modifiedCounts.tables[table.ID] != mc
+	modifiedCounts.Unlock()
+	if n == 0 || forgotten {
+		return nil
+	}
+
+	modified, err := parser.AddTableModified(driver, table.ID, n)
+	if err != nil {
+		modifiedCounts.Lock()
+		mc.pending += n
+		modifiedCounts.Unlock()
+		return err
+	}
+	// the table may have been analyzed since, which only raises the count
+	if threshold > 0 && modified < threshold {
+		return nil
+	}
+
+	ts, err := parser.LoadTableStats(driver, table.ID)
+	if err != nil {
+		return err
+	}
+	threshold = AutoAnalyzeMinRows
+	if ts != nil {
+		since := int64(math.Ceil(AutoAnalyzeRatio * float64(ts.Count)))
+		if since < AutoAnalyzeMinRows {
+			since = AutoAnalyzeMinRows
+		}
+		threshold = ts.Modified + since
+	}
+	modifiedCounts.Lock()
+	mc.threshold = threshold
+	modifiedCounts.Unlock()
+	if modified < threshold {
+		return nil
+	}
+
+	autoAnalyzing.Lock()
+	defer autoAnalyzing.Unlock()
+	if autoAnalyzing.tables[table.ID] {
+		return nil
+	}
+	autoAnalyzing.tables[table.ID] = true
+	go autoAnalyze(driver, table)
+	return nil
+}
+
+func autoAnalyze(driver store.Driver, table *parser.TableInfo) {
+	defer func() {
+		autoAnalyzing.Lock()
+		delete(autoAnalyzing.tables, table.ID)
+		autoAnalyzing.Unlock()
+	}()
+
+	// the table may have been altered, dropped or truncated meanwhile
+	cur, err := parser.LoadTableInfo(driver, table.Name)
+	if err != nil || cur.ID != table.ID {
+		return
+	}
+	_, err = analyzeTable(driver, cur)
+	if err != nil {
+		glog.Error("Auto analyze table ", table.Name, " error: ", err.Error())
+	}
+}
+
+type AnalyzeTableExec struct {
+	analyze *plan.AnalyzeTable
+	driver  store.Driver
+	context *context.Context
+	pos     int
+	done    bool
+}
+
+func (a *AnalyzeTableExec) Columns() ([]*store.ColumnInfo, error) {
+	ret := []*store.ColumnInfo{}
+	for _, name := range []string{"Table", "Op", "Msg_type", "Msg_text"} {
+		ret = append(ret, &store.ColumnInfo{
+			Schema:   a.context.GetCurrentDB(),
+			Table:    "dual",
+			OrgTable: "dual",
+			Name:     name,
+			OrgName:  name,
+			Type:     mysql.TypeString,
+		})
+	}
+	return ret, nil
+}
+
+// Next analyzes one table, a table that doesn't exist gives an error row
+func (a *AnalyzeTableExec) Next() (*result.Record, error) {
+	if a.done || a.pos >= len(a.analyze.Names) {
+		a.done = true
+		return nil, nil
+	}
+	name, table := a.analyze.Names[a.pos], a.analyze.Tables[a.pos]
+	a.pos++
+
+	msgType, msgText := "status", "OK"
+	if table == nil {
+		msgType, msgText = "Error", "Table '"+name+"' doesn't exist"
+	} else if _, err := analyzeTable(a.driver, table); err != nil {
+		return nil, err
+	}
+
+	datums := []*util.Datum{
+		stringDatum(name),
+		stringDatum("analyze"),
+		stringDatum(msgType),
+		stringDatum(msgText),
+	}
+	return &result.Record{Datums: datums}, nil
+}
+
+func (a *AnalyzeTableExec) Done() bool {
+	return a.done
+}
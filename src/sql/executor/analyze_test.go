@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
+)
+
+// statsFailDriver fails to add to the counts of rows written
+type statsFailDriver struct {
+	*testDriver
+}
+
+func (d *statsFailDriver) IncrBySysRecord(key string, n int64) (int64, error) {
+	return 0, errors.New("incr error!")
+}
+
+func TestModifiedCounts(t *testing.T) {
+	ModifiedFlushRows = 1
+	defer func() { ModifiedFlushRows = 100 }()
+	d := newTestDriver()
+	e := NewExecutor(&statsFailDriver{d}, context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create table t (id int primary key, a int)",
+		"create table u (id int primary key, a int)",
+	} {
+		queryRows(t, e, sql)
+	}
+
+	// the rows are written though they aren't counted
+	for _, sql := range []string{
+		"insert into t values (1, 10), (2, 20)",
+		"update t set a = 30 where id = 2",
+		"insert into u values (1, 10)",
+	} {
+		if err := execSQL(e, sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	got := strings.Join(queryRows(t, e, "select * from t"), "|")
+	if got != "1 10|2 30" {
+		t.Fatalf("rows %q", got)
+	}
+
+	tt, _ := parser.LoadTableInfo(d, "Nesoi.t")
+	ut, _ := parser.LoadTableInfo(d, "Nesoi.u")
+	counted := func(id int64) bool {
+		modifiedCounts.Lock()
+		defer modifiedCounts.Unlock()
+		return modifiedCounts.tables[id] != nil
+	}
+	if !counted(tt.ID) || !counted(ut.ID) {
+		t.Fatal("rows written not counted in memory")
+	}
+	queryRows(t, e, "drop table t")
+	queryRows(t, e, "truncate table u")
+	if counted(tt.ID) || counted(ut.ID) {
+		t.Fatal("counts kept for a dropped or truncated table")
+	}
+}
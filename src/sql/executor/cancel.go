@@ -0,0 +1,270 @@
+package executor
+
+import (
+	goctx "context"
+	"strconv"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+/*
+ * A statement runs under the context Execute is given, which the server
+ * cancels on KILL, and a SELECT also under max_execution_time. The results
+ * of the statement read the storage through a cancelDriver, whose calls
+ * fail once the context is done, and stop waiting for a call already
+ * sent, so the statement stops as soon as it is killed. The Redis client
+ * keeps the context of WithContext without using it on the connection, a
+ * call given up on is left to complete and what it gives is dropped.
+ * INSERT and UPDATE stop while they read, but once they start writing
+ * they write with the driver under the cancelDriver, so a row is never
+ * left without its index entries.
+ */
+type cancelDriver struct {
+	store.Driver
+	ctx goctx.Context
+}
+
+func (d *cancelDriver) err() error {
+	switch d.ctx.Err() {
+	case nil:
+		return nil
+	case goctx.DeadlineExceeded:
+		return mysql.NewErr(mysql.ErrQueryTimeout)
+	}
+	return mysql.NewErr(mysql.ErrQueryInterrupted)
+}
+
+/*
+ * call runs fn, and stops waiting for it once the context is done. A call
+ * given up on still completes in the storage, what it gives is dropped.
+ */
+func (d *cancelDriver) call(fn func() error) error {
+	if err := d.err(); err != nil {
+		return err
+	}
+	done := d.ctx.Done()
+	if done == nil {
+		return fn()
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- fn()
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-done:
+		return d.err()
+	}
+}
+
+func (d *cancelDriver) GetSysRecord(key string) (string, error) {
+	var value string
+	err := d.call(func() (err error) {
+		value, err = d.Driver.GetSysRecord(key)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (d *cancelDriver) SetSysRecord(key string, value string, ttl int64) error {
+	return d.call(func() error {
+		return d.Driver.SetSysRecord(key, value, ttl)
+	})
+}
+
+func (d *cancelDriver) DelSysRecord(key string) error {
+	return d.call(func() error {
+		return d.Driver.DelSysRecord(key)
+	})
+}
+
+func (d *cancelDriver) ScanSysRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	var keys []string
+	err := d.call(func() (err error) {
+		keys, cursor, err = d.Driver.ScanSysRecords(cursor, match, count)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, cursor, nil
+}
+
+func (d *cancelDriver) IncrSysRecord(key string) (int64, error) {
+	var n int64
+	err := d.call(func() (err error) {
+		n, err = d.Driver.IncrSysRecord(key)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (d *cancelDriver) IncrBySysRecord(key string, n int64) (int64, error) {
+	var v int64
+	err := d.call(func() (err error) {
+		v, err = d.Driver.IncrBySysRecord(key, n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func (d *cancelDriver) GetUserRecord(key string) (string, error) {
+	var value string
+	err := d.call(func() (err error) {
+		value, err = d.Driver.GetUserRecord(key)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (d *cancelDriver) GetUserRecords(keys []string) ([]string, []bool, error) {
+	var values []string
+	var found []bool
+	err := d.call(func() (err error) {
+		values, found, err = d.Driver.GetUserRecords(keys)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, found, nil
+}
+
+func (d *cancelDriver) SetUserRecord(key string, value string, ttl int64) error {
+	return d.call(func() error {
+		return d.Driver.SetUserRecord(key, value, ttl)
+	})
+}
+
+func (d *cancelDriver) SetUserRecords(keys []string, values []string) error {
+	return d.call(func() error {
+		return d.Driver.SetUserRecords(keys, values)
+	})
+}
+
+func (d *cancelDriver) DelUserRecord(key string) error {
+	return d.call(func() error {
+		return d.Driver.DelUserRecord(key)
+	})
+}
+
+func (d *cancelDriver) DelUserRecords(keys []string) error {
+	return d.call(func() error {
+		return d.Driver.DelUserRecords(keys)
+	})
+}
+
+func (d *cancelDriver) ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	var keys []string
+	err := d.call(func() (err error) {
+		keys, cursor, err = d.Driver.ScanUserRecords(cursor, match, count)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, cursor, nil
+}
+
+func (d *cancelDriver) SeekUserRecords(start string, end string, count int64) ([]string, []string, error) {
+	var keys, values []string
+	err := d.call(func() (err error) {
+		keys, values, err = d.Driver.(store.OrderedDriver).SeekUserRecords(start, end, count)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+func (d *cancelDriver) DelUserRange(start string, end string) error {
+	return d.call(func() error {
+		return d.Driver.(store.OrderedDriver).DelUserRange(start, end)
+	})
+}
+
+func (d *cancelDriver) wrapped() store.Driver {
+	return d.Driver
+}
+
+/*
+ * driverWrapper is implemented by the drivers wrapping another one, as
+ * countingDriver and cancelDriver. They have the methods of OrderedDriver
+ * whether the driver they wrap has them or not.
+ */
+type driverWrapper interface {
+	wrapped() store.Driver
+}
+
+// uncancelled gives the driver a cancelDriver wraps, or driver
+func uncancelled(driver store.Driver) store.Driver {
+	if d, ok := driver.(*cancelDriver); ok {
+		return d.Driver
+	}
+	return driver
+}
+
+// baseDriver gives the driver under all the wrappers of driver
+func baseDriver(driver store.Driver) store.Driver {
+	for {
+		w, ok := driver.(driverWrapper)
+		if !ok {
+			return driver
+		}
+		driver = w.wrapped()
+	}
+}
+
+// maxExecutionTime gives the time a SELECT of the session may run, 0 for
+// no limit
+func maxExecutionTime(ctx *context.Context) time.Duration {
+	value, _ := ctx.SysVarValue(context.MaxExecutionTime)
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+/*
+ * queryExecutor gives the executor running a query of the statement. DDL
+ * runs to its end, as its long work is done by jobs, the other queries
+ * stop once ctx is done, DML only before it writes, and a SELECT once it
+ * ran max_execution_time.
+ */
+func (executor *Executor) queryExecutor(ctx goctx.Context, query parser.Statement) *Executor {
+	if query.StatementType() == parser.DDL {
+		return executor
+	}
+	if query.StatementType() == parser.Rows {
+		if _, ok := query.(*parser.SelectQuery); ok {
+			if d := maxExecutionTime(executor.context); d > 0 {
+				var cancel goctx.CancelFunc
+				ctx, cancel = goctx.WithTimeout(ctx, d)
+				executor.cancels = append(executor.cancels, cancel)
+			}
+		}
+	}
+
+	e := *executor
+	e.driver = &cancelDriver{Driver: executor.driver, ctx: ctx}
+	return &e
+}
@@ -0,0 +1,62 @@
+package executor
+
+import (
+	goctx "context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+// blockingDriver holds the scans of user records until release is closed
+type blockingDriver struct {
+	*testDriver
+	release chan struct{}
+}
+
+func (d *blockingDriver) ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	if strings.HasPrefix(match, store.UserFlag) {
+		<-d.release
+	}
+	return d.testDriver.ScanUserRecords(cursor, match, count)
+}
+
+func TestKillInFlightCall(t *testing.T) {
+	d := newTestDriver()
+	e := NewExecutor(d, context.NewContext())
+	for _, sql := range []string{
+		"create table t (id int primary key, a int)",
+		"insert into t values (1, 10), (2, 20)",
+	} {
+		queryRows(t, e, sql)
+	}
+	e.Close()
+
+	bd := &blockingDriver{testDriver: d, release: make(chan struct{})}
+	defer close(bd.release)
+	e = NewExecutor(bd, context.NewContext())
+	defer e.Close()
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	begin := time.Now()
+	rs, err := e.Execute(ctx, "select * from t")
+	for err == nil {
+		var rc interface{}
+		if rc, err = rs[0].Next(); err == nil && rc == nil {
+			break
+		}
+	}
+	if e, ok := err.(*mysql.SQLError); !ok || e.Code != mysql.ErrQueryInterrupted {
+		t.Fatalf("select killed in a call to the storage: %v", err)
+	}
+	if time.Since(begin) > time.Second {
+		t.Fatalf("select stopped %v after it was killed", time.Since(begin))
+	}
+}
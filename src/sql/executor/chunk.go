@@ -0,0 +1,357 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * scans, selections, projections and limits give their rows a chunk at a
+ * time, and evaluate targets a column at a time. The other executors read
+ * rows one by one: a chunk executor reading from one gathers its rows
+ * into chunks, and gives its own rows one by one when it is read by one.
+ */
+
+// chunkSource reads the chunks of a result, gathering its rows when it
+// doesn't give chunks
+type chunkSource struct {
+	r    result.Result
+	chk  *result.Chunk
+	done bool
+}
+
+func (s *chunkSource) next() (*result.Chunk, error) {
+	if cr, ok := s.r.(result.ChunkResult); ok {
+		return cr.NextChunk()
+	}
+	if s.done {
+		return nil, nil
+	}
+
+	if s.chk != nil {
+		s.chk.Reset()
+		s.chk.Grow()
+	}
+	for s.chk == nil || !s.chk.IsFull() {
+		r, err := s.r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			s.done = true
+			break
+		}
+		if s.chk == nil {
+			s.chk = result.NewChunk(len(r.Datums))
+		}
+		s.chk.AppendRow(r.Datums)
+	}
+	if s.chk == nil || s.chk.NumRows() == 0 {
+		return nil, nil
+	}
+	return s.chk, nil
+}
+
+// chunkRecords gives the rows of chunks one by one
+type chunkRecords struct {
+	chk  *result.Chunk
+	pos  int
+	done bool
+}
+
+func (c *chunkRecords) next(nextChunk func() (*result.Chunk, error)) (*result.Record, error) {
+	for c.chk == nil || c.pos >= c.chk.NumRows() {
+		if c.done {
+			return nil, nil
+		}
+		chk, err := nextChunk()
+		if err != nil {
+			return nil, err
+		}
+		if chk == nil {
+			c.done = true
+			return nil, nil
+		}
+		c.chk, c.pos = chk, 0
+	}
+	row := c.chk.Row(c.pos)
+	c.pos++
+	return &result.Record{Datums: row}, nil
+}
+
+// pending tells whether rows of the last chunk are left
+func (c *chunkRecords) pending() bool {
+	return c.chk != nil && c.pos < c.chk.NumRows()
+}
+
+/*
+ * fillChunk decodes the rows next gives into the chunk of a scan, until it
+ * is full or there are no more. It gives nil when no row is left.
+ */
+func fillChunk(ctx *context.Context, chk *result.Chunk, dec *rowDecoder, next func() (string, bool, error)) (*result.Chunk, error) {
+	if chk.NumRows() > 0 {
+		chk.Reset()
+		chk.Grow()
+	}
+	for !chk.IsFull() {
+		raw, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if err := dec.decode(ctx, raw, chk); err != nil {
+			return nil, err
+		}
+	}
+	if chk.NumRows() == 0 {
+		return nil, nil
+	}
+	return chk, nil
+}
+
+/*
+ * evalColumn evaluates a target on every row of chk, as evalTarget does
+ * on each of them. A column of chk is given as it is, comparisons of ints
+ * or of strings are done on the vectors. Other functions are called on
+ * the values of each row, control functions only on the rows taking
+ * each argument, and the targets that need the whole row, as subqueries
+ * do, are evaluated row by row.
+ */
+func evalColumn(e *Executor, f *parser.TargetRes, chk *result.Chunk) (*result.Column, error) {
+	n := chk.NumRows()
+	switch f.Type {
+	case parser.ETARGET:
+		if f.Depth == 0 {
+			if f.FieldID < 1 || f.FieldID > len(chk.Columns) {
+				return nil, errors.New("parse column value error!")
+			}
+			return chk.Columns[f.FieldID-1], nil
+		}
+	case parser.EVALUE:
+		d, err := valueToDatum(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		col := result.NewColumn(n)
+		for i := 0; i < n; i++ {
+			col.AppendDatum(d)
+		}
+		return col, nil
+	case parser.EFUNC:
+		fn := expression.GetFunc(f.FuncName)
+		if fn == nil {
+			return nil, errors.New("FUNCTION " + f.FuncName + " does not exist!")
+		}
+		if arms, els, ok := expression.ControlArms(f.FuncName, len(f.Args)); ok {
+			return evalArmsColumn(e, f, arms, els, chk)
+		}
+		args := make([]*result.Column, 0, len(f.Args))
+		for _, arg := range f.Args {
+			col, err := evalColumn(e, arg, chk)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, col)
+		}
+		if match := expression.CompareOp(f.FuncName); match != nil && len(args) == 2 {
+			return compareColumns(match, args[0], args[1], n), nil
+		}
+
+		col := result.NewColumn(n)
+		datums := make([]*util.Datum, len(args))
+		for i := 0; i < n; i++ {
+			for j, arg := range args {
+				datums[j] = arg.Datum(i)
+			}
+			d, err := fn.Eval(e.context, datums)
+			if err != nil {
+				return nil, err
+			}
+			col.AppendDatum(d.Convert(f.RetType))
+		}
+		return col, nil
+	}
+
+	col := result.NewColumn(n)
+	for i := 0; i < n; i++ {
+		d, err := evalTarget(e, f, chk.Row(i))
+		if err != nil {
+			return nil, err
+		}
+		col.AppendDatum(d)
+	}
+	return col, nil
+}
+
+/*
+ * evalArmsColumn evaluates a control function on every row of chk, as
+ * evalArms does on each of them. The condition of an arm is evaluated on
+ * the rows no earlier arm took, and its result on the rows it takes.
+ */
+func evalArmsColumn(e *Executor, f *parser.TargetRes, arms []expression.Arm, els int, chk *result.Chunk) (*result.Column, error) {
+	n := chk.NumRows()
+	ret := make([]*util.Datum, n)
+	// left holds the rows no arm took yet, rows[i] is the row of chk at i
+	left := chk
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = i
+	}
+	for _, arm := range arms {
+		if len(rows) == 0 {
+			break
+		}
+		cond, err := evalColumn(e, f.Args[arm.Cond], left)
+		if err != nil {
+			return nil, err
+		}
+		take := make([]bool, len(rows))
+		rest := make([]bool, len(rows))
+		var took, kept []int
+		for i, r := range rows {
+			if arm.NotNull {
+				take[i] = !cond.IsNull(i)
+			} else {
+				take[i] = isTrueAt(cond, i)
+			}
+			rest[i] = !take[i]
+			if take[i] {
+				took = append(took, r)
+			} else {
+				kept = append(kept, r)
+			}
+		}
+		if len(took) == 0 {
+			continue
+		}
+
+		if arm.Result == arm.Cond {
+			for i, r := range rows {
+				if take[i] {
+					ret[r] = cond.Datum(i)
+				}
+			}
+		} else {
+			col, err := evalColumn(e, f.Args[arm.Result], keepRows(left, take, result.NewChunk(len(chk.Columns))))
+			if err != nil {
+				return nil, err
+			}
+			for j, r := range took {
+				ret[r] = col.Datum(j)
+			}
+		}
+		left = keepRows(left, rest, result.NewChunk(len(chk.Columns)))
+		rows = kept
+	}
+	if len(rows) > 0 && els >= 0 {
+		col, err := evalColumn(e, f.Args[els], left)
+		if err != nil {
+			return nil, err
+		}
+		for j, r := range rows {
+			ret[r] = col.Datum(j)
+		}
+	}
+
+	col := result.NewColumn(n)
+	for _, d := range ret {
+		if d == nil {
+			col.AppendNull()
+			continue
+		}
+		col.AppendDatum(d.Convert(f.RetType))
+	}
+	return col, nil
+}
+
+// compareColumns compares the values of a and b row by row, as the
+// comparison functions do
+func compareColumns(match func(c int) bool, a *result.Column, b *result.Column, n int) *result.Column {
+	col := result.NewColumn(n)
+	for i := 0; i < n; i++ {
+		if a.IsNull(i) || b.IsNull(i) {
+			col.AppendNull()
+			continue
+		}
+		var c int
+		switch ka, kb := a.Kind(i), b.Kind(i); {
+		case ka == util.KindInt64 && kb == util.KindInt64:
+			switch x, y := a.Int(i), b.Int(i); {
+			case x < y:
+				c = -1
+			case x > y:
+				c = 1
+			}
+		case ka == util.KindString && kb == util.KindString:
+			c = bytes.Compare(a.Bytes(i), b.Bytes(i))
+		default:
+			c = expression.Compare(a.Datum(i), b.Datum(i))
+		}
+		if match(c) {
+			col.AppendInt(1)
+		} else {
+			col.AppendInt(0)
+		}
+	}
+	return col
+}
+
+// isTrueAt tells whether the value of row i is true, as expression.IsTrue
+func isTrueAt(col *result.Column, i int) bool {
+	switch col.Kind(i) {
+	case util.KindInt64:
+		return col.Int(i) != 0
+	case util.KindNull:
+		return false
+	}
+	return expression.IsTrue(col.Datum(i))
+}
+
+// equalAt tells whether the value of row i is d, as util.Datum.Equal
+func equalAt(col *result.Column, i int, d *util.Datum) bool {
+	if col.Kind(i) != d.GetK() {
+		return false
+	}
+	switch d.GetK() {
+	case util.KindInt64:
+		return col.Int(i) == d.GetI()
+	case util.KindFloat64:
+		return col.Float(i) == d.GetF()
+	case util.KindString:
+		return bytes.Equal(col.Bytes(i), d.GetB())
+	}
+	return true
+}
+
+/*
+ * keepRows gives the rows of chk that keep holds true, in out unless
+ * they are all kept.
+ */
+func keepRows(chk *result.Chunk, keep []bool, out *result.Chunk) *result.Chunk {
+	all := true
+	for _, k := range keep {
+		if !k {
+			all = false
+			break
+		}
+	}
+	if all {
+		return chk
+	}
+
+	out.Reset()
+	for i, k := range keep {
+		if k {
+			out.AppendRowFrom(chk, i)
+		}
+	}
+	return out
+}
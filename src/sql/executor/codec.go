@@ -0,0 +1,405 @@
+package executor
+
+import (
+	"errors"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * rows are stored as:
+ *		RowFormatV2 + Encoded ColumnID + Kind + Encoded Value + ...
+ * null columns are omitted, so columns added by ALTER TABLE read as null
+ * and dropped columns are skipped without rewriting any row.
+ *
+ * rows written before the row format was versioned start with '0' or '1'
+ * and are decoded positionally against the legacy layout of the table.
+ */
+const (
+	RowFormatV2 byte = 0x02
+)
+
+func encodeRow(table *parser.TableInfo, datums []*util.Datum) (string, error) {
+	raw := []byte{RowFormatV2}
+	for i, d := range datums {
+		if d == nil || d.IsNull() {
+			continue
+		}
+		cd, ok := table.ColumnMap[i]
+		if !ok {
+			return "", errors.New("encode row error!")
+		}
+		v, err := util.DumpValueToRaw(d)
+		if err != nil {
+			return "", err
+		}
+		raw = append(raw, util.DumpLengthEncodedInt(uint64(cd.ID))...)
+		raw = append(raw, d.GetK())
+		raw = append(raw, v...)
+	}
+
+	return util.ToString(raw), nil
+}
+
+func decodeValue(raw string, k byte) (*util.Datum, int, error) {
+	d := &util.Datum{}
+	switch k {
+	case util.KindInt64:
+		i, _, n := util.ParseLengthEncodedInt(util.ToSlice(raw))
+		d.SetK(util.KindInt64)
+		d.SetI(int64(i))
+		return d, n, nil
+	case util.KindString:
+		s, _, n, err := util.ParseLengthEncodedBytes(util.ToSlice(raw))
+		if err != nil {
+			return nil, 0, err
+		}
+		d.SetK(util.KindString)
+		d.SetB(s)
+		return d, n, nil
+	}
+
+	return nil, 0, errors.New("parse column value error!")
+}
+
+// convertDatum casts a stored value to the current type of its column,
+// values written before a MODIFY COLUMN keep their old kind.
+func convertDatum(d *util.Datum, typ parser.ColumnType) *util.Datum {
+	return d.Convert(parser.ColumnKind(typ))
+}
+
+func zeroDatum(typ parser.ColumnType) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(parser.ColumnKind(typ))
+	return d
+}
+
+func decodeLegacyRow(raw string, table *parser.TableInfo) (map[int]*util.Datum, error) {
+	pos := 0
+	dm := make(map[int]*util.Datum)
+	for _, cd := range table.Legacy {
+		if pos >= len(raw) {
+			break
+		}
+		if raw[pos] == '0' {
+			pos++
+			continue
+		}
+		pos++
+		d, n, err := decodeValue(raw[pos:], parser.ColumnKind(cd.Type))
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		dm[cd.ID] = d
+	}
+
+	return dm, nil
+}
+
+// skipValue gives the length of a value without decoding it
+func skipValue(raw string, k byte) (int, error) {
+	switch k {
+	case util.KindInt64:
+		_, _, n := util.ParseLengthEncodedInt(util.ToSlice(raw))
+		return n, nil
+	case util.KindString:
+		num, _, n := util.ParseLengthEncodedInt(util.ToSlice(raw))
+		if n+int(num) > len(raw) {
+			return 0, errors.New("parse column value error!")
+		}
+		return n + int(num), nil
+	}
+
+	return 0, errors.New("parse column value error!")
+}
+
+func decodeRow(raw string, table *parser.TableInfo) (map[int]*util.Datum, error) {
+	return decodeColumns(raw, table, nil)
+}
+
+/*
+ * decodeColumns decodes the columns of a row at the positions columns
+ * holds true, nil meaning all. The other columns are skipped and read as
+ * null.
+ */
+func decodeColumns(raw string, table *parser.TableInfo, columns []bool) (map[int]*util.Datum, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("parse column value error!")
+	}
+
+	var err error
+	var dm map[int]*util.Datum
+	if raw[0] != RowFormatV2 {
+		dm, err = decodeLegacyRow(raw, table)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var need map[int]bool
+		if columns != nil {
+			need = make(map[int]bool)
+			for i, cd := range table.ColumnMap {
+				need[cd.ID] = columns[i]
+			}
+		}
+		dm = make(map[int]*util.Datum)
+		pos := 1
+		for pos < len(raw) {
+			id, _, n := util.ParseLengthEncodedInt(util.ToSlice(raw[pos:]))
+			pos += n
+			if pos >= len(raw) {
+				return nil, errors.New("parse column value error!")
+			}
+			k := raw[pos]
+			pos++
+			if need != nil && !need[int(id)] {
+				n, err := skipValue(raw[pos:], k)
+				if err != nil {
+					return nil, err
+				}
+				pos += n
+				continue
+			}
+			d, n, err := decodeValue(raw[pos:], k)
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			dm[int(id)] = d
+		}
+	}
+
+	// map column ids to the current positions
+	row := make(map[int]*util.Datum)
+	for i, cd := range table.ColumnMap {
+		d, ok := dm[cd.ID]
+		if columns != nil && !columns[i] {
+			d = &util.Datum{}
+			d.SetK(util.KindNull)
+		} else if !ok {
+			if cd.Nullable == parser.NotNull {
+				d = zeroDatum(cd.Type)
+			} else {
+				d = &util.Datum{}
+				d.SetK(util.KindNull)
+			}
+		}
+		row[i] = convertDatum(d, cd.Type)
+	}
+
+	return row, nil
+}
+
+// a value decoded by a rowDecoder, set tells whether the row has it
+type decodedValue struct {
+	k   byte
+	i   int64
+	b   []byte
+	set bool
+}
+
+/*
+ * rowDecoder decodes rows into the columns of chunks, the fields of a scan
+ * being columns and values only. The values are written to the vectors of
+ * the columns without a datum for each, rows of the legacy layout and
+ * values of an old kind are decoded as decodeColumns does.
+ */
+type rowDecoder struct {
+	table   *parser.TableInfo
+	columns []bool
+	fields  []*parser.TargetRes
+	// positions of the column ids fields refer to
+	need   map[int]int
+	vals   []decodedValue
+	consts []*util.Datum
+	// a field is neither a column nor a value
+	slow bool
+}
+
+func newRowDecoder(table *parser.TableInfo, columns []bool, fields []*parser.TargetRes) (*rowDecoder, error) {
+	rd := &rowDecoder{
+		table:   table,
+		columns: columns,
+		fields:  fields,
+		need:    make(map[int]int),
+		vals:    make([]decodedValue, len(table.ColumnMap)),
+		consts:  make([]*util.Datum, len(fields)),
+	}
+	for i, f := range fields {
+		switch {
+		case f.Type == parser.ETARGET && f.Depth == 0 && f.FieldID >= 1 && f.FieldID <= len(table.ColumnMap):
+			pos := f.FieldID - 1
+			if columns == nil || columns[pos] {
+				rd.need[table.ColumnMap[pos].ID] = pos
+			}
+		case f.Type == parser.EVALUE:
+			d, err := valueToDatum(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			rd.consts[i] = d
+		default:
+			rd.slow = true
+		}
+	}
+	return rd, nil
+}
+
+// decode appends the fields of a row to chk
+func (rd *rowDecoder) decode(ctx *context.Context, raw string, chk *result.Chunk) error {
+	if len(raw) == 0 {
+		return errors.New("parse column value error!")
+	}
+	if rd.slow || raw[0] != RowFormatV2 {
+		dm, err := decodeColumns(raw, rd.table, rd.columns)
+		if err != nil {
+			return err
+		}
+		datums, err := evalFields(ctx, rd.fields, dm)
+		if err != nil {
+			return err
+		}
+		chk.AppendRow(datums)
+		return nil
+	}
+
+	for _, pos := range rd.need {
+		rd.vals[pos].set = false
+	}
+	b := util.ToSlice(raw)
+	pos := 1
+	for pos < len(b) {
+		id, _, n := util.ParseLengthEncodedInt(b[pos:])
+		pos += n
+		if pos >= len(b) {
+			return errors.New("parse column value error!")
+		}
+		k := b[pos]
+		pos++
+		at, ok := rd.need[int(id)]
+		if !ok {
+			n, err := skipValue(raw[pos:], k)
+			if err != nil {
+				return err
+			}
+			pos += n
+			continue
+		}
+		v := &rd.vals[at]
+		switch k {
+		case util.KindInt64:
+			i, _, n := util.ParseLengthEncodedInt(b[pos:])
+			v.i = int64(i)
+			pos += n
+		case util.KindString:
+			s, _, n, err := util.ParseLengthEncodedBytes(b[pos:])
+			if err != nil {
+				return err
+			}
+			v.b = s
+			pos += n
+		default:
+			return errors.New("parse column value error!")
+		}
+		v.k, v.set = k, true
+	}
+
+	for i, f := range rd.fields {
+		col := chk.Columns[i]
+		if d := rd.consts[i]; d != nil {
+			col.AppendDatum(d)
+			continue
+		}
+		at := f.FieldID - 1
+		cd := rd.table.ColumnMap[at]
+		v := &rd.vals[at]
+		if rd.columns != nil && !rd.columns[at] {
+			col.AppendNull()
+			continue
+		}
+		if !v.set {
+			if cd.Nullable == parser.NotNull {
+				col.AppendDatum(zeroDatum(cd.Type))
+			} else {
+				col.AppendNull()
+			}
+			continue
+		}
+		switch kind := parser.ColumnKind(cd.Type); {
+		case v.k != kind:
+			d := &util.Datum{}
+			d.SetK(v.k)
+			d.SetI(v.i)
+			d.SetB(v.b)
+			col.AppendDatum(convertDatum(d, cd.Type))
+		case kind == util.KindInt64:
+			col.AppendInt(v.i)
+		default:
+			col.AppendBytes(v.b)
+		}
+	}
+	return nil
+}
+
+/*
+ * primary keys are encoded so that the keys of rows are in the order of
+ * their primary keys:
+ *		int: 8 bytes big endian, the sign bit flipped
+ *		string: the bytes, 0x00 escaped as 0x00 0xff, ended by 0x00 0x01
+ * a key is then never the prefix of another, and the keys of a range of
+ * primary keys are a range of keys of the store.
+ */
+func encodeKey(d *util.Datum) ([]byte, error) {
+	switch d.GetK() {
+	case util.KindInt64:
+		u := uint64(d.GetI()) ^ (1 << 63)
+		raw := make([]byte, 8)
+		for i := 7; i >= 0; i-- {
+			raw[i] = byte(u)
+			u >>= 8
+		}
+		return raw, nil
+	case util.KindString:
+		var raw []byte
+		for _, c := range d.GetB() {
+			raw = append(raw, c)
+			if c == 0x00 {
+				raw = append(raw, 0xff)
+			}
+		}
+		return append(raw, 0x00, 0x01), nil
+	}
+
+	return nil, errors.New("encode primary key error!")
+}
+
+/*
+ * index entries are stored as:
+ *		Encoded numKeys + Encoded Primary key + ...
+ */
+func encodeIndexValue(keys []string) string {
+	value := util.ToString(util.DumpLengthEncodedInt(uint64(len(keys))))
+	for _, k := range keys {
+		value += util.ToString(util.DumpLengthEncodedString(util.ToSlice(k)))
+	}
+	return value
+}
+
+func decodeIndexValue(raw string) ([]string, error) {
+	num, _, pos := util.ParseLengthEncodedInt(util.ToSlice(raw))
+	keys := make([]string, 0, num)
+	var i uint64
+	for ; i < num; i++ {
+		k, _, n, err := util.ParseLengthEncodedBytes(util.ToSlice(raw[pos:]))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, string(k))
+		pos += n
+	}
+	return keys, nil
+}
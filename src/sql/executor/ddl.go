@@ -1,12 +1,12 @@
 package executor
 
 import (
-	"encoding/json"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/castermode/Nesoi/src/sql/context"
 	"github.com/castermode/Nesoi/src/sql/parser"
-	"github.com/castermode/Nesoi/src/sql/plan"
 	"github.com/castermode/Nesoi/src/sql/result"
 	"github.com/castermode/Nesoi/src/sql/store"
 	"github.com/castermode/Nesoi/src/sql/util"
@@ -36,10 +36,16 @@ func (ddl *DDLExec) Next() (*result.Record, error) {
 		err = ddl.executeCreateTable()
 	case *parser.CreateIndexQuery:
 		err = ddl.executeCreateIndex()
+	case *parser.AlterTable:
+		err = ddl.executeAlterTable()
 	case *parser.DropDatabase:
 		err = ddl.executeDropDatabase()
 	case *parser.DropTable:
 		err = ddl.executeDropTable()
+	case *parser.DropIndex:
+		err = ddl.executeDropIndex()
+	case *parser.TruncateTable:
+		err = ddl.executeTruncateTable()
 	case *parser.UseDB:
 		err = ddl.executeUseDB()
 	}
@@ -71,14 +77,19 @@ func (ddl *DDLExec) executeCreateDatabase() error {
 		return errors.New("get kv storage error!")
 	}
 
-	return ddl.driver.SetSysRecord(dbName, "", 0)
+	id, err := parser.AllocDatabaseID(ddl.driver)
+	if err != nil {
+		return err
+	}
+
+	return ddl.driver.SetSysRecord(dbName, strconv.FormatInt(id, 10), 0)
 }
 
 func (ddl *DDLExec) executeCreateTable() error {
 	stmt := ddl.stmt.(*parser.CreateTable)
 
-	tableKey := store.SystemFlag + store.TableFlag + ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name)
-	_, err := ddl.driver.GetSysRecord(tableKey)
+	tblName := ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name)
+	_, err := ddl.driver.GetSysRecord(parser.TableKey(tblName))
 	if err == nil {
 		if stmt.IfNotExists {
 			return nil
@@ -90,124 +101,253 @@ func (ddl *DDLExec) executeCreateTable() error {
 		return errors.New("get kv storage error!")
 	}
 
-	cjds := parser.ColumnTableJsonDefs{}
 	i := 1
 	for _, cd := range stmt.Defs {
 		cd.Pos = i
-		cjd := &parser.ColumnTableJsonDef{
-			Name:       cd.Name,
-			Pos:        cd.Pos,
-			Nullable:   cd.Nullable,
-			PrimaryKey: cd.PrimaryKey,
-			Unique:     cd.Unique,
-		}
-		switch cd.Type.(type) {
-		case *parser.IntType:
-			cjd.Type = parser.SqlInt
-		case *parser.StringType:
-			cjd.Type = parser.SqlString
-		}
-		cjds = append(cjds, cjd)
+		cd.ID = i
 		i++
 	}
 
-	var data []byte
-	data, err = json.Marshal(cjds)
+	table := parser.NewTableInfo(tblName, stmt.Defs)
+	table.ID, err = parser.AllocTableID(ddl.driver)
 	if err != nil {
 		return err
 	}
 
-	return ddl.driver.SetSysRecord(tableKey, util.ToString(data), 0)
+	return parser.SaveTableInfo(ddl.driver, table)
 }
 
+var errIndexRepeat = errors.New("index repeat!")
+
 func WriteIndexInfo(driver store.Driver, unique bool, key string, value string) error {
-	var newValue string
-	oldValue, err := driver.GetUserRecord(key)
-	if err == nil {
-		if unique {
-			return errors.New("index repeat!")
-		}
-		numKeys, _, num := util.ParseLengthEncodedInt(util.ToSlice(value))
-		newValue += util.ToString(util.DumpLengthEncodedInt(numKeys + 1))
-		newValue += oldValue[num:]
-		newValue += util.ToString(util.DumpLengthEncodedString(util.ToSlice(value)))
-	} else if err == store.Nil {
-		newValue += util.ToString(util.DumpLengthEncodedInt(1))
-		newValue += util.ToString(util.DumpLengthEncodedString(util.ToSlice(value)))
-	} else {
+	return WriteIndexInfos(driver, unique, []string{key}, map[string][]string{key: {value}})
+}
+
+/*
+ * WriteIndexInfos adds values[key] to the entry of every key, the entries
+ * are read and the changed ones written back in batches.
+ */
+func WriteIndexInfos(driver store.Driver, unique bool, keys []string, values map[string][]string) error {
+	oldValues, exist, err := getUserRecords(driver, keys)
+	if err != nil {
 		return err
 	}
+	var setKeys, setValues []string
+	for i, key := range keys {
+		var pks []string
+		if exist[i] {
+			pks, err = decodeIndexValue(oldValues[i])
+			if err != nil {
+				return err
+			}
+		}
 
-	return driver.SetUserRecord(key, newValue, 0)
+		changed := false
+		for _, value := range values[key] {
+			found := false
+			for _, pk := range pks {
+				// already written by a concurrent writer or an earlier backfill
+				if pk == value {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			if unique && len(pks) > 0 {
+				return errIndexRepeat
+			}
+			pks = append(pks, value)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		setKeys = append(setKeys, key)
+		setValues = append(setValues, encodeIndexValue(pks))
+		if len(setKeys) == OnceWriteCount {
+			err = driver.SetUserRecords(setKeys, setValues)
+			if err != nil {
+				return err
+			}
+			setKeys, setValues = nil, nil
+		}
+	}
+
+	if len(setKeys) == 0 {
+		return nil
+	}
+	return driver.SetUserRecords(setKeys, setValues)
 }
 
 /*
- * create index on table, we storage index info as:
- * system:
- * 		/SYSTEM/INDEX/TABLE/idxName "F + Encoded table name + Encoded Fields Num + Encoded FieldID + ... "
- *      F: unique or not
- * 		/SYSTEM/TABLE/INDEX/+ Encoded table name + Encoded Fields Num + Encoded FieldID + ... idxName
- * user:
- *		/USER/idxName/+ Encoded Field Value + ...	Encoded numKeys + Encoded Primary key + ...
+ * DeleteIndexInfos removes values[key] from the entry of every key, the
+ * entries are read in batches, the ones left empty are deleted and the
+ * others written back, both in batches.
  */
-func (ddl *DDLExec) executeCreateIndex() error {
-	stmt := ddl.stmt.(*parser.CreateIndexQuery)
-
-	plan := &plan.Scan{
-		From:      stmt.TblInfo,
-		Fields:    stmt.Fields,
-		FieldsNum: stmt.FieldsNum,
+func DeleteIndexInfos(driver store.Driver, keys []string, values map[string][]string) error {
+	oldValues, exist, err := getUserRecords(driver, keys)
+	if err != nil {
+		return err
 	}
-	rst := &ScanExec{scan: plan, driver: ddl.driver, context: ddl.context}
-	tblName := ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name)
-	idxName := ddl.context.GetTableName(stmt.Index.Schema, stmt.Index.Name)
-	for {
-		key, rc, err := rst.nextKV()
+	var setKeys, setValues, delKeys []string
+	for i, key := range keys {
+		if !exist[i] {
+			continue
+		}
+		pks, err := decodeIndexValue(oldValues[i])
 		if err != nil {
 			return err
 		}
 
-		newKey := store.UserFlag + idxName + "/"
-		if rc != nil {
-			for _, datum := range rc.Datums {
-				raw, err := util.DumpValueToRaw(datum)
+		left := pks[:0]
+		for _, pk := range pks {
+			found := false
+			for _, value := range values[key] {
+				if pk == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				left = append(left, pk)
+			}
+		}
+		if len(left) == len(pks) {
+			continue
+		}
+		if len(left) == 0 {
+			delKeys = append(delKeys, key)
+			if len(delKeys) == OnceWriteCount {
+				err = driver.DelUserRecords(delKeys)
 				if err != nil {
 					return err
 				}
-				newKey += util.ToString(raw)
+				delKeys = nil
 			}
-		} else {
-			break
+			continue
 		}
-		err = WriteIndexInfo(ddl.driver, stmt.Unique, newKey, key)
+
+		setKeys = append(setKeys, key)
+		setValues = append(setValues, encodeIndexValue(left))
+		if len(setKeys) == OnceWriteCount {
+			err = driver.SetUserRecords(setKeys, setValues)
+			if err != nil {
+				return err
+			}
+			setKeys, setValues = nil, nil
+		}
+	}
+
+	if len(delKeys) > 0 {
+		err = driver.DelUserRecords(delKeys)
 		if err != nil {
 			return err
 		}
 	}
+	if len(setKeys) == 0 {
+		return nil
+	}
+	return driver.SetUserRecords(setKeys, setValues)
+}
 
-	//system table(index->table)
-	var sysIndexTableValue string
-	sysIndexTableKey := store.SystemFlag + store.IndexFlag + store.TableFlag + idxName
-	if stmt.Unique {
-		sysIndexTableValue = "1"
-	} else {
-		sysIndexTableValue = "0"
+func indexKey(idx *parser.IndexInfo, table *parser.TableInfo, datums []*util.Datum) (string, error) {
+	key := table.IndexPrefix(idx)
+	for _, f := range idx.Fields {
+		cd := table.ColumnByID(f)
+		if cd == nil {
+			return "", errors.New("can't find index column of " + idx.Name)
+		}
+		raw, err := util.DumpValueToRaw(datums[cd.Pos-1])
+		if err != nil {
+			return "", err
+		}
+		key += util.ToString(raw)
 	}
-	sysIndexTableValue += util.ToString(util.DumpLengthEncodedString(util.ToSlice(tblName)))
-	encodedFields := util.ToString(util.DumpLengthEncodedInt(uint64(stmt.FieldsNum)))
+	return key, nil
+}
+
+/*
+ * create index on table, we storage index info as:
+ * system:
+ * 		/SYSTEM/INDEX/TABLE/idxName "F + Encoded table name + Encoded Fields Num + Encoded ColumnID + ... + Encoded State"
+ *      F: unique or not
+ * 		/SYSTEM/TABLE/INDEX/+ Encoded table name + Encoded Fields Num + Encoded ColumnID + ... idxName
+ * user:
+ *		/USER/t + tableID + _i + indexID + _ + Encoded Field Value + ...	Encoded numKeys + Encoded Primary key + ...
+ *
+ * the index is built online: it is written delete-only, and a background
+ * job makes it write-only so that every writer maintains it, then
+ * backfills the rows written before and makes the index public. Each
+ * state is held a schema lease, so a statement sees the index at most one
+ * state behind. Writers write the row before loading the index list, so
+ * any row the backfill scan misses was written by a statement that saw
+ * the index as write-only. The statement returns once the job made the
+ * index public, or with the error the job failed with.
+ */
+func (ddl *DDLExec) executeCreateIndex() error {
+	stmt := ddl.stmt.(*parser.CreateIndexQuery)
+
+	tblName := ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name)
+	idxName := ddl.context.GetTableName(stmt.Index.Schema, stmt.Index.Name)
+	idx := &parser.IndexInfo{Name: idxName, Table: tblName, Unique: stmt.Unique}
 	for _, fd := range stmt.Fields {
-		encodedFields += util.ToString(util.DumpLengthEncodedInt(uint64(fd.FieldID)))
+		idx.Fields = append(idx.Fields, stmt.TblInfo.ColumnMap[fd.FieldID-1].ID)
 	}
-	sysIndexTableValue += encodedFields
-	err := ddl.driver.SetSysRecord(sysIndexTableKey, sysIndexTableValue, 0)
+	return createIndex(ddl.driver, idx)
+}
+
+// createIndex saves idx delete-only and waits for the job building it
+func createIndex(driver store.Driver, idx *parser.IndexInfo) error {
+	var err error
+	idx.State = parser.IndexDeleteOnly
+	idx.ID, err = parser.AllocIndexID(driver)
+	if err != nil {
+		return err
+	}
+	err = parser.SaveIndexInfo(driver, idx)
+	if err != nil {
+		return err
+	}
+
+	job := &DDLJob{Type: JobAddIndex, Table: idx.Table, Index: idx.Name, StateTime: time.Now().UnixNano()}
+	err = startJob(driver, job)
 	if err != nil {
 		return err
 	}
-	//system table(table->index)
-	sysTableIndexKey := store.SystemFlag + store.TableFlag + store.IndexFlag + tblName
-	sysTableIndexKey += encodedFields
-	sysTableIndexValue := idxName
-	return ddl.driver.SetSysRecord(sysTableIndexKey, sysTableIndexValue, 0)
+	return waitJob(driver, job.ID)
+}
+
+/*
+ * drop only removes the metadata of the tables and their indexes, the
+ * rows and index entries under the data prefix of the table are
+ * reclaimed by a background job.
+ */
+func (ddl *DDLExec) dropTableMeta(tblName string) (string, error) {
+	table, err := parser.LoadTableInfo(ddl.driver, tblName)
+	if err != nil {
+		return "", err
+	}
+	idxs, err := parser.TableIndexes(ddl.driver, tblName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, idx := range idxs {
+		err = parser.DeleteIndexInfo(ddl.driver, idx)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = parser.DeleteTableStats(ddl.driver, table.ID)
+	if err != nil {
+		return "", err
+	}
+	forgetModified(table.ID)
+
+	return table.DataPrefix(), ddl.driver.DelSysRecord(parser.TableKey(tblName))
 }
 
 func (ddl *DDLExec) executeDropDatabase() error {
@@ -215,37 +355,125 @@ func (ddl *DDLExec) executeDropDatabase() error {
 
 	dbName := store.SystemFlag + store.DBFlag + stmt.DBName
 	_, err := ddl.driver.GetSysRecord(dbName)
-	if err == nil {
-		return ddl.driver.DelSysRecord(dbName)
+	if err == store.Nil {
+		if stmt.IfExists {
+			return nil
+		}
+		return errors.New("database not exists!")
 	}
-
-	if err != store.Nil {
+	if err != nil {
 		return errors.New("get kv storage error!")
 	}
 
-	if stmt.IfExists {
+	var tables []string
+	err = forEachSysKey(ddl.driver, parser.TableKey(stmt.DBName+".*"), func(key string) error {
+		tables = append(tables, key[len(parser.TableKey("")):])
 		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return errors.New("database not exists!")
+
+	var prefixes []string
+	for _, tblName := range tables {
+		prefix, err := ddl.dropTableMeta(tblName)
+		if err == store.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	err = ddl.driver.DelSysRecord(dbName)
+	if err != nil {
+		return err
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	return startJob(ddl.driver, &DDLJob{Type: JobDropDatabase, Table: stmt.DBName, Prefixes: prefixes})
 }
 
 func (ddl *DDLExec) executeDropTable() error {
 	stmt := ddl.stmt.(*parser.DropTable)
 
-	TblName := store.SystemFlag + store.TableFlag + ddl.context.GetTableName(stmt.TName.Schema, stmt.TName.Name)
-	_, err := ddl.driver.GetSysRecord(TblName)
-	if err == nil {
-		return ddl.driver.DelSysRecord(TblName)
+	tblName := ddl.context.GetTableName(stmt.TName.Schema, stmt.TName.Name)
+	prefix, err := ddl.dropTableMeta(tblName)
+	if err == store.Nil {
+		if stmt.IfExists {
+			return nil
+		}
+		return errors.New("table not exists!")
+	}
+	if err != nil {
+		return err
 	}
 
-	if err != store.Nil {
-		return errors.New("get kv storage error!")
+	return startJob(ddl.driver, &DDLJob{Type: JobDropTable, Table: tblName, Prefixes: []string{prefix}})
+}
+
+func (ddl *DDLExec) executeDropIndex() error {
+	stmt := ddl.stmt.(*parser.DropIndex)
+
+	table, err := parser.LoadTableInfo(ddl.driver, ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name))
+	if err == store.Nil {
+		return errors.New("table not exists!")
+	}
+	if err != nil {
+		return err
 	}
 
 	if stmt.IfExists {
-		return nil
+		_, err = parser.LoadIndexInfo(ddl.driver, ddl.context.GetTableName(stmt.Index.Schema, stmt.Index.Name))
+		if err == store.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return ddl.dropIndex(table, stmt.Index)
+}
+
+/*
+ * truncate moves the table to a new id, so it is empty at once and the
+ * old rows and index entries are reclaimed in the background. The
+ * indexes are kept.
+ */
+func (ddl *DDLExec) executeTruncateTable() error {
+	stmt := ddl.stmt.(*parser.TruncateTable)
+
+	tblName := ddl.context.GetTableName(stmt.Table.Schema, stmt.Table.Name)
+	table, err := parser.LoadTableInfo(ddl.driver, tblName)
+	if err == store.Nil {
+		return errors.New("table not exists!")
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix, oldID := table.DataPrefix(), table.ID
+	table.ID, err = parser.AllocTableID(ddl.driver)
+	if err != nil {
+		return err
+	}
+	table.Legacy = nil
+	table.Version++
+	err = parser.SaveTableInfo(ddl.driver, table)
+	if err != nil {
+		return err
 	}
-	return errors.New("table not exists!")
+	err = parser.DeleteTableStats(ddl.driver, oldID)
+	if err != nil {
+		return err
+	}
+	forgetModified(oldID)
+
+	return startJob(ddl.driver, &DDLJob{Type: JobTruncateTable, Table: tblName, Prefixes: []string{prefix}})
 }
 
 func (ddl *DDLExec) executeUseDB() error {
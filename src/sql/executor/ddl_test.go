@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+func TestCreateIndexWaitsForJob(t *testing.T) {
+	SchemaLease = 10 * time.Millisecond
+	defer func() { SchemaLease = 10 * time.Second }()
+	driver := newTestDriver()
+	e := NewExecutor(driver, context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create table t (id int primary key, g int)",
+		"insert into t values (1, 10), (2, 20), (3, 10)",
+		"create index ig on t (g)",
+		"create table u (id int primary key, g int)",
+		"insert into u values (1, 10), (2, 20), (3, 10)",
+	} {
+		queryRows(t, e, sql)
+	}
+	idx, err := parser.LoadIndexInfo(driver, "Nesoi.ig")
+	if err != nil || idx.State != parser.IndexPublic {
+		t.Fatalf("index after create: %+v %v", idx, err)
+	}
+
+	err = execSQL(e, "create unique index ug on u (g)")
+	if e, ok := err.(*mysql.SQLError); !ok || e.Code != mysql.ErrDupEntry || e.Message != "Duplicate entry '10' for key 'ug'" {
+		t.Fatalf("unique index over duplicates: %v", err)
+	}
+	if _, err = parser.LoadIndexInfo(driver, "Nesoi.ug"); err != store.Nil {
+		t.Fatalf("failed index left: %v", err)
+	}
+
+	err = execSQL(e, "alter table u add unique index ug (g)")
+	if e, ok := err.(*mysql.SQLError); !ok || e.Code != mysql.ErrDupEntry {
+		t.Fatalf("unique index added by alter over duplicates: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+type DistinctExec struct {
+	children []result.Result
+	// rows already returned
+	seen map[string]bool
+	done bool
+}
+
+func NewDistinctExec(d *plan.Distinct, e *Executor) *DistinctExec {
+	dExec := &DistinctExec{
+		seen: make(map[string]bool),
+	}
+
+	for _, p := range d.GetChildren() {
+		dExec.children = append(dExec.children, makePlanExec(p, e))
+	}
+
+	return dExec
+}
+
+func (d *DistinctExec) Columns() ([]*store.ColumnInfo, error) {
+	return d.children[0].Columns()
+}
+
+func (d *DistinctExec) Next() (*result.Record, error) {
+	if d.done {
+		return nil, nil
+	}
+
+	for {
+		r, err := d.children[0].Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			d.done = true
+			return nil, nil
+		}
+
+		key := hashRow(r.Datums)
+		if !d.seen[key] {
+			d.seen[key] = true
+			return r, nil
+		}
+	}
+}
+
+func (d *DistinctExec) Done() bool {
+	return d.done
+}
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	goctx "context"
 	"errors"
 
 	"github.com/castermode/Nesoi/src/sql/context"
@@ -16,6 +17,19 @@ type Executor struct {
 	analyzer *parser.Analyzer
 	driver   store.Driver
 	context  *context.Context
+
+	// rows of the enclosing queries while a correlated subquery runs,
+	// innermost last
+	outer [][]*util.Datum
+	// subqueries of the statement being executed
+	subqueries map[*parser.SelectQuery]*subquery
+	// stats of the operators while EXPLAIN ANALYZE runs a plan
+	stats map[plan.Plan]*opStats
+	// parallel scans of the statement being executed
+	scans *parallelScans
+	// release the timers of max_execution_time of the statement
+	cancels []goctx.CancelFunc
+	sm      SessionManager
 }
 
 func NewExecutor(sd store.Driver, ctx *context.Context) *Executor {
@@ -24,6 +38,7 @@ func NewExecutor(sd store.Driver, ctx *context.Context) *Executor {
 		analyzer: parser.NewAnalyzer(sd, ctx),
 		driver:   sd,
 		context:  ctx,
+		scans:    &parallelScans{},
 	}
 }
 
@@ -36,6 +51,11 @@ func valueToDatum(v interface{}) (*util.Datum, error) {
 	case string:
 		d.SetK(util.KindString)
 		d.SetB(util.ToSlice(v.(string)))
+	case float64:
+		d.SetK(util.KindFloat64)
+		d.SetF(v.(float64))
+	case nil:
+		d.SetK(util.KindNull)
 	default:
 		return nil, errors.New("unsupport value type!")
 	}
@@ -43,9 +63,23 @@ func valueToDatum(v interface{}) (*util.Datum, error) {
 	return d, nil
 }
 
-func (executor *Executor) Execute(sql string) ([]result.Result, error) {
+/*
+ * Execute runs the statements of sql under ctx, which stops them when it
+ * is done. The results keep reading under ctx until they are read, the
+ * work left of them is stopped by the next Execute or by Close.
+ */
+func (executor *Executor) Execute(ctx goctx.Context, sql string) ([]result.Result, error) {
 	var rs result.Result
 	var rss []result.Result
+	executor.Close()
+	// the session starts with the global values of the system variables
+	if !executor.context.GlobalVarsLoaded() {
+		vars, err := parser.LoadGlobalVars(executor.driver)
+		if err != nil {
+			return nil, err
+		}
+		executor.context.SetGlobalVars(vars)
+	}
 	stmts, err := executor.parser.Parse(sql)
 	if err != nil {
 		return nil, err
@@ -58,15 +92,32 @@ func (executor *Executor) Execute(sql string) ([]result.Result, error) {
 	}
 
 	var p plan.Plan
+	executor.subqueries = make(map[*parser.SelectQuery]*subquery)
 	for _, query := range querys {
+		// SHOW WARNINGS lists the warnings of the statement before it
+		if s, ok := query.(*parser.Show); !ok || s.Operator != parser.SWARNINGS {
+			executor.context.ClearWarnings()
+		}
+		e := executor.queryExecutor(ctx, query)
 		switch query.StatementType() {
+		case parser.Ack:
+			rs = nil
+			switch q := query.(type) {
+			case *parser.SetQuery:
+				err = e.executeSet(q)
+			case *parser.KillStmt:
+				err = e.executeKill(q)
+			}
+			if err != nil {
+				return nil, err
+			}
 		case parser.DDL:
-			rs, err = executor.executeQuery(query)
+			rs, err = e.executeQuery(query)
 			if err != nil {
 				return nil, err
 			}
 		case parser.RowsAffected:
-			rs, err = executor.executeWrite(query)
+			rs, err = e.executeWrite(query)
 			if err != nil {
 				return nil, err
 			}
@@ -75,7 +126,7 @@ func (executor *Executor) Execute(sql string) ([]result.Result, error) {
 			if err != nil {
 				return nil, err
 			}
-			rs, err = executor.executePlan(p)
+			rs, err = e.executePlan(p)
 			if err != nil {
 				return nil, err
 			}
@@ -90,6 +141,16 @@ func (executor *Executor) Execute(sql string) ([]result.Result, error) {
 	return rss, nil
 }
 
+// Close stops the work left of the results of the last statement, the
+// rows of a parallel scan not read, and its timers
+func (executor *Executor) Close() {
+	executor.scans.close()
+	for _, cancel := range executor.cancels {
+		cancel()
+	}
+	executor.cancels = nil
+}
+
 func (executor *Executor) executeQuery(query parser.Statement) (result.Result, error) {
 	var result result.Result
 
@@ -108,7 +169,14 @@ func (executor *Executor) executeWrite(query parser.Statement) (result.Result, e
 
 	switch query.(type) {
 	case *parser.InsertQuery:
-		result = &InsertExec{stmt: query, driver: executor.driver, context: executor.context}
+		insert := query.(*parser.InsertQuery)
+		if insert.Select != nil {
+			p, err = plan.Optimize(insert.Select)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = NewInsertExec(insert, p, executor)
 	case *parser.UpdateQuery:
 		p, err = plan.Optimize(query)
 		if err != nil {
@@ -134,31 +202,89 @@ func (executor *Executor) executeWrite(query parser.Statement) (result.Result, e
 }
 
 func makePlanExec(p plan.Plan, e *Executor) result.Result {
+	rs := buildPlanExec(p, e)
+	if e.stats == nil || rs == nil {
+		return rs
+	}
+	st, ok := e.stats[p]
+	if !ok {
+		st = &opStats{}
+		e.stats[p] = st
+	}
+	return &analyzeExec{child: rs, stats: st, driver: e.driver.(*countingDriver)}
+}
+
+func buildPlanExec(p plan.Plan, e *Executor) result.Result {
 	switch p.(type) {
 	case *plan.Show:
 		s := p.(*plan.Show)
+		if s.Operator == parser.SDDLJOBS {
+			return &ShowJobsExec{driver: e.driver, context: e.context}
+		}
+		if s.Operator == parser.SWARNINGS {
+			return &ShowWarningsExec{context: e.context}
+		}
+		if s.Operator == parser.SVARIABLES {
+			return &ShowVariablesExec{context: e.context, driver: e.driver, global: s.Global, pattern: s.Pattern}
+		}
+		if s.Operator == parser.SPROCESSLIST {
+			return &ShowProcessListExec{context: e.context, executor: e, full: s.Full}
+		}
 		return &ShowExec{operator: s.Operator, driver: e.driver, context: e.context}
 	case *plan.Simple:
 		s := p.(*plan.Simple)
-		return &SimpleExec{fields: s.Fields, context: e.context}
+		return &SimpleExec{fields: s.Fields, executor: e, context: e.context}
 	case *plan.Scan:
 		s := p.(*plan.Scan)
+		if s.From.Memory {
+			return &MemTableScanExec{scan: s, context: e.context, executor: e}
+		}
+		// a scan with a pushed down limit reads no more rows than needed
+		if workers := scanWorkers(e.context); workers > 1 && s.Limit == 0 {
+			ps := newParallelScanExec(s, workers, e)
+			e.scans.add(ps)
+			return ps
+		}
 		return &ScanExec{scan: s, driver: e.driver, context: e.context}
 	case *plan.ScanWithPK:
 		s := p.(*plan.ScanWithPK)
 		return &ScanWithPKExec{scanpk: s, driver: e.driver, context: e.context}
+	case *plan.RangeScan:
+		s := p.(*plan.RangeScan)
+		return &RangeScanExec{scan: s, driver: e.driver, context: e.context}
+	case *plan.IndexLookup:
+		s := p.(*plan.IndexLookup)
+		return &IndexLookupExec{lookup: s, driver: e.driver, context: e.context}
 	case *plan.Selection:
 		s := p.(*plan.Selection)
 		return NewSelectionExec(s, e)
+	case *plan.SemiJoin:
+		s := p.(*plan.SemiJoin)
+		return NewSemiJoinExec(s, e)
 	case *plan.Projection:
 		s := p.(*plan.Projection)
 		return NewProjectionExec(s, e)
+	case *plan.Sort:
+		s := p.(*plan.Sort)
+		return NewSortExec(s, e)
+	case *plan.SetOpr:
+		s := p.(*plan.SetOpr)
+		return NewSetOprExec(s, e)
+	case *plan.Distinct:
+		s := p.(*plan.Distinct)
+		return NewDistinctExec(s, e)
 	case *plan.Limit:
 		s := p.(*plan.Limit)
 		return NewLimitExec(s, e)
 	case *plan.Update:
 		s := p.(*plan.Update)
 		return NewUpdateExec(s, e)
+	case *plan.Explain:
+		s := p.(*plan.Explain)
+		return NewExplainExec(s, e)
+	case *plan.AnalyzeTable:
+		s := p.(*plan.AnalyzeTable)
+		return &AnalyzeTableExec{analyze: s, driver: e.driver, context: e.context}
 	}
 
 	return nil
@@ -0,0 +1,313 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * EXPLAIN ANALYZE runs the plan with each result of it wrapped in an
+ * analyzeExec, which counts the rows the result returns, the time spent
+ * in its Next and the calls made to the driver meanwhile. The time and
+ * the calls of an operator include those of the operators under it.
+ */
+type opStats struct {
+	rows  int64
+	time  time.Duration
+	calls uint64
+}
+
+// countingDriver counts the calls made to the driver it wraps
+type countingDriver struct {
+	store.Driver
+	calls uint64
+}
+
+func (d *countingDriver) count() uint64 {
+	return atomic.LoadUint64(&d.calls)
+}
+
+func (d *countingDriver) GetSysRecord(key string) (string, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.GetSysRecord(key)
+}
+
+func (d *countingDriver) SetSysRecord(key string, value string, ttl int64) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.SetSysRecord(key, value, ttl)
+}
+
+func (d *countingDriver) DelSysRecord(key string) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.DelSysRecord(key)
+}
+
+func (d *countingDriver) ScanSysRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.ScanSysRecords(cursor, match, count)
+}
+
+func (d *countingDriver) IncrSysRecord(key string) (int64, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.IncrSysRecord(key)
+}
+
+func (d *countingDriver) IncrBySysRecord(key string, n int64) (int64, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.IncrBySysRecord(key, n)
+}
+
+func (d *countingDriver) GetUserRecord(key string) (string, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.GetUserRecord(key)
+}
+
+func (d *countingDriver) GetUserRecords(keys []string) ([]string, []bool, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.GetUserRecords(keys)
+}
+
+func (d *countingDriver) SetUserRecord(key string, value string, ttl int64) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.SetUserRecord(key, value, ttl)
+}
+
+func (d *countingDriver) SetUserRecords(keys []string, values []string) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.SetUserRecords(keys, values)
+}
+
+func (d *countingDriver) DelUserRecord(key string) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.DelUserRecord(key)
+}
+
+func (d *countingDriver) DelUserRecords(keys []string) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.DelUserRecords(keys)
+}
+
+func (d *countingDriver) ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.ScanUserRecords(cursor, match, count)
+}
+
+func (d *countingDriver) SeekUserRecords(start string, end string, count int64) ([]string, []string, error) {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.(store.OrderedDriver).SeekUserRecords(start, end, count)
+}
+
+func (d *countingDriver) DelUserRange(start string, end string) error {
+	atomic.AddUint64(&d.calls, 1)
+	return d.Driver.(store.OrderedDriver).DelUserRange(start, end)
+}
+
+func (d *countingDriver) wrapped() store.Driver {
+	return d.Driver
+}
+
+type analyzeExec struct {
+	child  result.Result
+	stats  *opStats
+	driver *countingDriver
+	source chunkSource
+}
+
+func (a *analyzeExec) Columns() ([]*store.ColumnInfo, error) {
+	return a.child.Columns()
+}
+
+func (a *analyzeExec) Next() (*result.Record, error) {
+	start, calls := time.Now(), a.driver.count()
+	r, err := a.child.Next()
+	a.stats.time += time.Since(start)
+	a.stats.calls += a.driver.count() - calls
+	if r != nil {
+		a.stats.rows++
+	}
+	return r, err
+}
+
+func (a *analyzeExec) NextChunk() (*result.Chunk, error) {
+	a.source.r = a.child
+	start, calls := time.Now(), a.driver.count()
+	chk, err := a.source.next()
+	a.stats.time += time.Since(start)
+	a.stats.calls += a.driver.count() - calls
+	if chk != nil {
+		a.stats.rows += int64(chk.NumRows())
+	}
+	return chk, err
+}
+
+func (a *analyzeExec) Done() bool {
+	return a.child.Done()
+}
+
+type explainNode struct {
+	ID       int            `json:"id"`
+	Operator string         `json:"operator"`
+	Table    string         `json:"table,omitempty"`
+	Access   string         `json:"access,omitempty"`
+	Filter   string         `json:"filter,omitempty"`
+	EstRows  float64        `json:"estRows"`
+	ActRows  *int64         `json:"actRows,omitempty"`
+	Time     string         `json:"time,omitempty"`
+	Calls    *uint64        `json:"calls,omitempty"`
+	Children []*explainNode `json:"children,omitempty"`
+}
+
+type ExplainExec struct {
+	explain  *plan.Explain
+	executor *Executor
+	context  *context.Context
+	rows     [][]*util.Datum
+	pos      int
+	started  bool
+	done     bool
+}
+
+func NewExplainExec(p *plan.Explain, e *Executor) *ExplainExec {
+	return &ExplainExec{explain: p, executor: e, context: e.context}
+}
+
+func (ee *ExplainExec) Columns() ([]*store.ColumnInfo, error) {
+	names := []string{"id", "operator", "table", "access", "filter", "estRows"}
+	if ee.explain.Analyze {
+		names = append(names, "actRows", "time", "calls")
+	}
+	if ee.explain.Format == parser.ExplainJSON {
+		names = []string{"EXPLAIN"}
+	}
+
+	ret := []*store.ColumnInfo{}
+	for _, name := range names {
+		ret = append(ret, &store.ColumnInfo{
+			Schema:   ee.context.GetCurrentDB(),
+			Table:    "dual",
+			OrgTable: "dual",
+			Name:     name,
+			OrgName:  name,
+			Type:     mysql.TypeString,
+		})
+	}
+	return ret, nil
+}
+
+// analyze runs the plan to its end, returning the stats of its operators
+func (ee *ExplainExec) analyze() (map[plan.Plan]*opStats, error) {
+	e := *ee.executor
+	e.driver = &countingDriver{Driver: ee.executor.driver}
+	e.stats = make(map[plan.Plan]*opStats)
+
+	rs := makePlanExec(ee.explain.Target, &e)
+	for !rs.Done() {
+		r, err := rs.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			break
+		}
+	}
+	return e.stats, nil
+}
+
+func (ee *ExplainExec) build(p plan.Plan, stats map[plan.Plan]*opStats, id *int) *explainNode {
+	*id++
+	n := &explainNode{ID: *id, EstRows: plan.EstimateRows(p)}
+	n.Operator, n.Table, n.Access, n.Filter = plan.Describe(p)
+	if st, ok := stats[p]; ok {
+		n.ActRows, n.Time, n.Calls = &st.rows, st.time.String(), &st.calls
+	} else if stats != nil {
+		var rows int64
+		var calls uint64
+		n.ActRows, n.Time, n.Calls = &rows, time.Duration(0).String(), &calls
+	}
+	for _, child := range p.GetChildren() {
+		n.Children = append(n.Children, ee.build(child, stats, id))
+	}
+	return n
+}
+
+// addRows lists n and the nodes under it as a tree drawn by the operators
+func (ee *ExplainExec) addRows(n *explainNode, prefix string, indent string) {
+	datums := []*util.Datum{
+		stringDatum(fmt.Sprintf("%d", n.ID)),
+		stringDatum(prefix + n.Operator),
+		stringDatum(n.Table),
+		stringDatum(n.Access),
+		stringDatum(n.Filter),
+		stringDatum(fmt.Sprintf("%.2f", n.EstRows)),
+	}
+	if n.ActRows != nil {
+		datums = append(datums,
+			stringDatum(fmt.Sprintf("%d", *n.ActRows)),
+			stringDatum(n.Time),
+			stringDatum(fmt.Sprintf("%d", *n.Calls)))
+	}
+	ee.rows = append(ee.rows, datums)
+
+	for i, child := range n.Children {
+		if i == len(n.Children)-1 {
+			ee.addRows(child, indent+"└─", indent+"  ")
+		} else {
+			ee.addRows(child, indent+"├─", indent+"│ ")
+		}
+	}
+}
+
+func (ee *ExplainExec) start() error {
+	var stats map[plan.Plan]*opStats
+	if ee.explain.Analyze {
+		var err error
+		stats, err = ee.analyze()
+		if err != nil {
+			return err
+		}
+	}
+
+	id := 0
+	root := ee.build(ee.explain.Target, stats, &id)
+	if ee.explain.Format == parser.ExplainJSON {
+		b, err := json.MarshalIndent([]*explainNode{root}, "", "    ")
+		if err != nil {
+			return err
+		}
+		ee.rows = append(ee.rows, []*util.Datum{stringDatum(string(b))})
+		return nil
+	}
+	ee.addRows(root, "", "")
+	return nil
+}
+
+func (ee *ExplainExec) Next() (*result.Record, error) {
+	if !ee.started {
+		ee.started = true
+		if err := ee.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ee.done || ee.pos >= len(ee.rows) {
+		ee.done = true
+		return nil, nil
+	}
+	r := &result.Record{Datums: ee.rows[ee.pos]}
+	ee.pos++
+	return r, nil
+}
+
+func (ee *ExplainExec) Done() bool {
+	return ee.done
+}
@@ -0,0 +1,214 @@
+package executor
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// evalTarget evaluates a target on a row holding all columns of the table
+// in order, row is nil when there is no table.
+func evalTarget(e *Executor, f *parser.TargetRes, row []*util.Datum) (*util.Datum, error) {
+	switch f.Type {
+	case parser.ETARGET:
+		if f.Depth > 0 {
+			if f.Depth > len(e.outer) {
+				return nil, errors.New("parse column value error!")
+			}
+			row = e.outer[len(e.outer)-f.Depth]
+		}
+		if f.FieldID < 1 || f.FieldID > len(row) {
+			return nil, errors.New("parse column value error!")
+		}
+		return row[f.FieldID-1], nil
+	case parser.ESYSVAR:
+		value, ok := e.context.SysVarValue(f.SysVar)
+		if f.SysVarGlobal {
+			value, ok = f.Value.(string), true
+		}
+		if !ok {
+			return nil, errors.New("unsupport sysvar @@" + f.SysVar)
+		}
+		d := &util.Datum{}
+		d.SetK(util.KindString)
+		d.SetB(util.ToSlice(value))
+		return d, nil
+	case parser.EVALUE:
+		return valueToDatum(f.Value)
+	case parser.EFUNC:
+		fn := expression.GetFunc(f.FuncName)
+		if fn == nil {
+			return nil, errors.New("FUNCTION " + f.FuncName + " does not exist!")
+		}
+		if arms, els, ok := expression.ControlArms(f.FuncName, len(f.Args)); ok {
+			return evalArms(e, f, arms, els, row)
+		}
+		args := make([]*util.Datum, 0, len(f.Args))
+		for _, arg := range f.Args {
+			d, err := evalTarget(e, arg, row)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, d)
+		}
+		d, err := fn.Eval(e.context, args)
+		if err != nil {
+			return nil, err
+		}
+		return d.Convert(f.RetType), nil
+	case parser.ESUBQUERY, parser.EEXISTS, parser.EINSUBQUERY:
+		return evalSubquery(e, f, row)
+	}
+
+	return nil, errors.New("caluse error!")
+}
+
+// evalArms evaluates a control function, only the arguments of the arms
+// tested and the result taken
+func evalArms(e *Executor, f *parser.TargetRes, arms []expression.Arm, els int, row []*util.Datum) (*util.Datum, error) {
+	for _, arm := range arms {
+		d, err := evalTarget(e, f.Args[arm.Cond], row)
+		if err != nil {
+			return nil, err
+		}
+		if !arm.Holds(d) {
+			continue
+		}
+		if arm.Result != arm.Cond {
+			d, err = evalTarget(e, f.Args[arm.Result], row)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return d.Convert(f.RetType), nil
+	}
+	if els < 0 {
+		d := &util.Datum{}
+		d.SetK(util.KindNull)
+		return d.Convert(f.RetType), nil
+	}
+	d, err := evalTarget(e, f.Args[els], row)
+	if err != nil {
+		return nil, err
+	}
+	return d.Convert(f.RetType), nil
+}
+
+/*
+ * targetColumnInfo describes a target to the client, table is nil when
+ * there is no table. Name and Table are the aliases given in the query,
+ * OrgName and OrgTable the names of the column and table they refer to.
+ */
+func targetColumnInfo(ctx *context.Context, table *parser.TableInfo, alias string, f *parser.TargetRes) (*store.ColumnInfo, error) {
+	ci := &store.ColumnInfo{}
+	switch f.Type {
+	case parser.ETARGET:
+		if f.Depth > 0 {
+			ci.Name = "EXPRESSION"
+			ci.OrgName = "EXPRESSION"
+			break
+		}
+		cd := table.ColumnMap[f.FieldID-1]
+		st := strings.Split(table.Name, ".")
+		ci.Schema = st[0]
+		ci.Table = st[1]
+		if alias != "" {
+			ci.Table = alias
+		}
+		ci.OrgTable = st[1]
+		ci.Name = cd.Name
+		if f.Name != "" {
+			ci.Name = f.Name
+		}
+		ci.OrgName = cd.Name
+		switch cd.Type.(type) {
+		case *parser.IntType:
+			ci.Type = mysql.TypeLong
+			ci.ColumnLength = 4
+		case *parser.StringType:
+			ci.Type = mysql.TypeString
+		}
+		if cd.Nullable == parser.NotNull {
+			ci.Flag |= mysql.NotNullFlag
+		}
+		if cd.PrimaryKey {
+			ci.Flag |= mysql.PriKeyFlag
+		}
+		if cd.Unique {
+			ci.Flag |= mysql.UniqueKeyFlag
+		}
+		return ci, nil
+	case parser.ESYSVAR:
+		ci.Name = f.SysVar
+		ci.OrgName = f.SysVar
+	case parser.EVALUE, parser.EFUNC, parser.ESUBQUERY, parser.EEXISTS, parser.EINSUBQUERY:
+		ci.Name = "EXPRESSION"
+		ci.OrgName = "EXPRESSION"
+	default:
+		return nil, errors.New("caluse error!")
+	}
+	if f.Name != "" {
+		ci.Name = f.Name
+	}
+
+	ci.Schema = ctx.GetCurrentDB()
+	ci.Table = "dual"
+	ci.OrgTable = "dual"
+	setColumnKind(ci, f.RetType)
+	if f.RetType == util.KindInt64 && f.Type == parser.EVALUE {
+		ci.Type = mysql.TypeLong
+		ci.ColumnLength = 4
+	}
+	return ci, nil
+}
+
+// setColumnKind sets the type of a column holding values of kind k
+func setColumnKind(ci *store.ColumnInfo, k byte) {
+	ci.ColumnLength = 0
+	ci.Decimal = 0
+	switch k {
+	case util.KindInt64:
+		ci.Type = mysql.TypeLonglong
+		ci.ColumnLength = 20
+	case util.KindFloat64:
+		ci.Type = mysql.TypeDouble
+		ci.ColumnLength = 22
+		ci.Decimal = 31
+	case util.KindNull:
+		ci.Type = mysql.TypeNull
+	default:
+		ci.Type = mysql.TypeString
+	}
+}
+
+// columnInfoKind is the kind of the values of a column
+func columnInfoKind(ci *store.ColumnInfo) byte {
+	switch ci.Type {
+	case mysql.TypeLong, mysql.TypeLonglong:
+		return util.KindInt64
+	case mysql.TypeDouble:
+		return util.KindFloat64
+	case mysql.TypeNull:
+		return util.KindNull
+	}
+	return util.KindString
+}
+
+func fieldsColumnInfo(ctx *context.Context, table *parser.TableInfo, alias string, fields []*parser.TargetRes) ([]*store.ColumnInfo, error) {
+	ret := []*store.ColumnInfo{}
+	for _, f := range fields {
+		ci, err := targetColumnInfo(ctx, table, alias, f)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ci)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+)
+
+func TestControlFuncsLazy(t *testing.T) {
+	e := NewExecutor(newTestDriver(), context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create table t (id int primary key, a int)",
+		"insert into t values (1, 10), (3, 30)",
+		"insert into t (id) values (2)",
+	} {
+		queryRows(t, e, sql)
+	}
+
+	// the arguments not taken would overflow or give more than one row
+	for _, c := range []struct {
+		sql  string
+		rows string
+	}{
+		{"select if(1 > 0, 1, 9223372036854775807 + 1)", "1"},
+		{"select coalesce(1, 9223372036854775807 + 1)", "1"},
+		{"select if(id > 0, id, 9223372036854775807 + id) from t", "1 2 3"},
+		{"select case when id > 0 then id else 9223372036854775807 + id end from t", "1 2 3"},
+		{"select case id when 2 then 9223372036854775807 + id else a end from t where id <> 2", "10 30"},
+		{"select coalesce(id, 9223372036854775807 + id) from t", "1 2 3"},
+		{"select ifnull(a, id * 100) from t", "10 200 30"},
+		{"select coalesce(a, 9223372036854775807 + id, 0) from t where a > 0", "10 30"},
+		{"select if(id < 3, id, (select s.id from t s where s.id > t.id)) from t", "1 2 NULL"},
+		{"select if(id = 2, 9223372036854775807 + id, a) from t where id <> 2", "10 30"},
+	} {
+		got := strings.Join(queryRows(t, e, c.sql), " ")
+		if got != c.rows {
+			t.Errorf("%s: %q, want %q", c.sql, got, c.rows)
+		}
+	}
+
+	// the argument taken is still evaluated
+	for _, sql := range []string{
+		"select if(id > 1, 9223372036854775807 + id, id) from t",
+		"select case when id = 3 then 9223372036854775807 + id end from t",
+		"select coalesce(a, 9223372036854775807 + id) from t",
+		"select if(id = 3, (select s.id from t s where s.id < t.id), id) from t",
+	} {
+		if err := execSQL(e, sql); err == nil {
+			t.Errorf("%s: no error", sql)
+		}
+	}
+}
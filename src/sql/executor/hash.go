@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// hashRow encodes datums so that equal ones give the same key, nulls
+// being equal to each other.
+func hashRow(datums []*util.Datum) string {
+	var buf bytes.Buffer
+	for _, d := range datums {
+		switch d.GetK() {
+		case util.KindNull:
+			buf.WriteString("n")
+		case util.KindInt64:
+			buf.WriteString("i" + strconv.FormatInt(d.GetI(), 10))
+		case util.KindFloat64:
+			f := d.GetF()
+			if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+				buf.WriteString("i" + strconv.FormatInt(int64(f), 10))
+			} else {
+				buf.WriteString("f" + strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		case util.KindString:
+			buf.WriteString("s" + strconv.Itoa(len(d.GetB())) + ":")
+			buf.Write(d.GetB())
+		}
+		buf.WriteByte(';')
+	}
+	return buf.String()
+}
+
+// hashKey is the hashRow of join keys, ok is false if one of them is null
+// as it matches nothing.
+func hashKey(datums []*util.Datum) (string, bool) {
+	for _, d := range datums {
+		if d.IsNull() {
+			return "", false
+		}
+	}
+	return hashRow(datums), true
+}
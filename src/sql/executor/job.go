@@ -0,0 +1,549 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+	"github.com/golang/glog"
+)
+
+const (
+	JobAddIndex int = iota
+	JobDropTable
+	JobDropDatabase
+	JobTruncateTable
+)
+
+const (
+	JobRunning int = iota
+	JobDone
+	JobFailed
+	JobCancelled
+)
+
+const (
+	// a running job not updated for jobLease is taken over by another worker
+	jobLease = 30 * time.Second
+	// how often a statement waiting for its job loads it
+	jobPollInterval = 20 * time.Millisecond
+)
+
+/*
+ * SchemaLease is the longest a statement works with the schema it loaded,
+ * an index holds each state of its build for at least a lease so that no
+ * statement still works with the state before the one before it.
+ */
+var SchemaLease = 10 * time.Second
+
+var errJobLost = errors.New("ddl job is taken over by another node!")
+
+/*
+ * ddl jobs are stored as:
+ *		/SYSTEM/JOB/jobID	json(DDLJob)
+ * a job records its progress after every batch, so it can be resumed
+ * from its cursor by any node once its owner stops updating it.
+ *
+ * drop and truncate jobs delete the user keys under Prefixes one prefix after another,
+ * Table holds the database name of a drop database job.
+ *
+ * a node owns a job by taking the next value of
+ *		/SYSTEM/JOBOWNER/jobID
+ * from the one the job records, with INCR, so of the nodes taking over a
+ * job at once only one does. An owner stops once the value moves on.
+ */
+type DDLJob struct {
+	ID        int64
+	Type      int
+	Table     string
+	Index     string   `json:",omitempty"`
+	Prefixes  []string `json:",omitempty"`
+	PrefixPos int      `json:",omitempty"`
+	State     int
+	RowCount  int64
+	Cursor    uint64
+	Error     string `json:",omitempty"`
+	// the mysql error code of Error, if it has one
+	ErrorCode  uint16 `json:",omitempty"`
+	StartTime  int64
+	UpdateTime int64
+	Owner      int64
+	// when the index of an add index job was given its state, in nanoseconds
+	StateTime int64 `json:",omitempty"`
+}
+
+func (job *DDLJob) TypeName() string {
+	switch job.Type {
+	case JobAddIndex:
+		return "add index"
+	case JobDropTable:
+		return "drop table"
+	case JobDropDatabase:
+		return "drop database"
+	case JobTruncateTable:
+		return "truncate table"
+	}
+	return "unknown"
+}
+
+func (job *DDLJob) StateName() string {
+	switch job.State {
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	case JobCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+func jobKey(id int64) string {
+	return store.SystemFlag + store.JobFlag + strconv.FormatInt(id, 10)
+}
+
+func jobOwnerKey(id int64) string {
+	return store.SystemFlag + store.OwnerFlag + strconv.FormatInt(id, 10)
+}
+
+// claimJob makes this node the owner of the job as it was loaded, it is
+// false when another node owns the job since
+func claimJob(driver store.Driver, job *DDLJob) (bool, error) {
+	owner, err := driver.IncrSysRecord(jobOwnerKey(job.ID))
+	if err != nil {
+		return false, err
+	}
+	if owner != job.Owner+1 {
+		return false, nil
+	}
+	job.Owner = owner
+	return true, nil
+}
+
+// saveJob records the job, unless this node no longer owns it
+func saveJob(driver store.Driver, job *DDLJob) error {
+	owner, err := driver.GetSysRecord(jobOwnerKey(job.ID))
+	if err != nil && err != store.Nil {
+		return err
+	}
+	if owner != strconv.FormatInt(job.Owner, 10) {
+		return errJobLost
+	}
+	job.UpdateTime = time.Now().Unix()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return driver.SetSysRecord(jobKey(job.ID), util.ToString(data), 0)
+}
+
+func loadJobs(driver store.Driver) ([]*DDLJob, error) {
+	var keys []string
+	var cursor uint64
+	var err error
+	var jobs []*DDLJob
+	match := store.SystemFlag + store.JobFlag + "*"
+	for {
+		keys, cursor, err = driver.ScanSysRecords(cursor, match, OnceScanCount)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			value, err := driver.GetSysRecord(key)
+			if err == store.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			job := &DDLJob{}
+			if err = json.Unmarshal(util.ToSlice(value), job); err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, job)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
+
+// jobs run by this node
+var runningJobs = struct {
+	sync.Mutex
+	ids map[int64]bool
+}{ids: make(map[int64]bool)}
+
+func startJob(driver store.Driver, job *DDLJob) error {
+	job.ID = time.Now().UnixNano()
+	job.State = JobRunning
+	job.StartTime = time.Now().Unix()
+	if _, err := claimJob(driver, job); err != nil {
+		return err
+	}
+	err := saveJob(driver, job)
+	if err != nil {
+		return err
+	}
+
+	go runJob(driver, job)
+	return nil
+}
+
+// resumeJob runs a job whose owner stopped updating it, if no other node
+// took it over first
+func resumeJob(driver store.Driver, job *DDLJob) {
+	ok, err := claimJob(driver, job)
+	if err != nil {
+		glog.Error("Claim ddl job ", job.ID, " error: ", err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+	glog.Info("Resume ddl job ", job.ID)
+	runJob(driver, job)
+}
+
+func runJob(driver store.Driver, job *DDLJob) {
+	runningJobs.Lock()
+	if runningJobs.ids[job.ID] {
+		runningJobs.Unlock()
+		return
+	}
+	runningJobs.ids[job.ID] = true
+	runningJobs.Unlock()
+
+	defer func() {
+		runningJobs.Lock()
+		delete(runningJobs.ids, job.ID)
+		runningJobs.Unlock()
+	}()
+
+	var err error
+	switch job.Type {
+	case JobAddIndex:
+		err = runAddIndexJob(driver, job)
+	case JobDropTable, JobDropDatabase, JobTruncateTable:
+		err = runDropJob(driver, job)
+	default:
+		err = errors.New("unknown ddl job type!")
+	}
+
+	if err == errJobLost {
+		glog.Info("DDL job ", job.ID, " is taken over by another node")
+		return
+	}
+	if err != nil {
+		glog.Error("DDL job ", job.ID, " failed: ", err.Error())
+		job.State = JobFailed
+		job.Error = err.Error()
+		if e, ok := err.(*mysql.SQLError); ok {
+			job.Error, job.ErrorCode = e.Message, e.Code
+		}
+	}
+	if err = saveJob(driver, job); err != nil {
+		glog.Error("Save ddl job ", job.ID, " error: ", err.Error())
+	}
+}
+
+// waitJob waits until the job stops running, wherever it runs, and gives
+// the error it failed with
+func waitJob(driver store.Driver, id int64) error {
+	for {
+		value, err := driver.GetSysRecord(jobKey(id))
+		if err != nil {
+			return err
+		}
+		job := &DDLJob{}
+		if err = json.Unmarshal(util.ToSlice(value), job); err != nil {
+			return err
+		}
+		switch job.State {
+		case JobDone:
+			return nil
+		case JobFailed:
+			if job.ErrorCode != 0 {
+				return mysql.NewErrf(job.ErrorCode, "%s", job.Error)
+			}
+			return errors.New(job.Error)
+		case JobCancelled:
+			return errors.New("ddl job is cancelled!")
+		}
+		time.Sleep(jobPollInterval)
+	}
+}
+
+// StartDDLWorker resumes the running jobs whose owner has gone away.
+func StartDDLWorker(driver store.Driver) {
+	go func() {
+		for {
+			jobs, err := loadJobs(driver)
+			if err != nil {
+				glog.Error("Load ddl jobs error: ", err.Error())
+			}
+			for _, job := range jobs {
+				if job.State != JobRunning {
+					continue
+				}
+				if time.Since(time.Unix(job.UpdateTime, 0)) < jobLease {
+					continue
+				}
+				go resumeJob(driver, job)
+			}
+			time.Sleep(jobLease)
+		}
+	}()
+}
+
+// deleteIndex removes the index metadata and all index entries.
+func deleteIndex(driver store.Driver, table *parser.TableInfo, idx *parser.IndexInfo) error {
+	err := parser.DeleteIndexInfo(driver, idx)
+	if err != nil {
+		return err
+	}
+
+	return deleteUserKeys(driver, table.IndexPrefix(idx)+"*")
+}
+
+/*
+ * runAddIndexJob takes the index from delete-only to write-only, and
+ * backfills it once no statement works with it delete-only any more,
+ * each state is held a lease from job.StateTime. A row read by the
+ * backfill may be changed before its entry is written, the rows of a
+ * batch are read again once their entries are written and the entries of
+ * the rows changed are taken back: the writers keep the entries of the
+ * rows as changed, the index being write-only.
+ */
+func runAddIndexJob(driver store.Driver, job *DDLJob) error {
+	for {
+		idx, err := parser.LoadIndexInfo(driver, job.Index)
+		if err == store.Nil {
+			// dropped while being built
+			job.State = JobCancelled
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		table, err := parser.LoadTableInfo(driver, idx.Table)
+		if err == store.Nil {
+			job.State = JobCancelled
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = holdSchemaState(driver, job)
+		if err != nil {
+			return err
+		}
+		if idx.State == parser.IndexDeleteOnly {
+			idx.State = parser.IndexWriteOnly
+			err = parser.SaveIndexInfo(driver, idx)
+			if err != nil {
+				return err
+			}
+			job.StateTime = time.Now().UnixNano()
+			err = saveJob(driver, job)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		keys, cursor, err := driver.ScanUserRecords(job.Cursor, table.RowPrefix()+"*", OnceScanCount)
+		if err != nil {
+			return err
+		}
+		raws, exist, err := getUserRecords(driver, keys)
+		if err != nil {
+			return err
+		}
+		written := newIndexEntries()
+		for i, key := range keys {
+			if !exist[i] {
+				continue
+			}
+			ik, err := rowIndexKey(table, idx, raws[i])
+			if err != nil {
+				return err
+			}
+			err = WriteIndexInfo(driver, idx.Unique, ik, key)
+			if err != nil {
+				// the row may have left the key since it was read
+				changed, cerr := rowLeftIndexKey(driver, table, idx, key, ik)
+				if cerr == nil && changed {
+					continue
+				}
+				if err == errIndexRepeat {
+					if datums, derr := decodeRowDatums(raws[i], table); derr == nil {
+						err = errDupEntry(table, idx, datums)
+					}
+				}
+				if derr := deleteIndex(driver, table, idx); derr != nil {
+					glog.Error("Rollback index ", idx.Name, " error: ", derr.Error())
+				}
+				return err
+			}
+			written.add(ik, key)
+			job.RowCount++
+		}
+		err = dropChangedEntries(driver, table, idx, written)
+		if err != nil {
+			return err
+		}
+
+		job.Cursor = cursor
+		if cursor == 0 {
+			idx.State = parser.IndexPublic
+			err = parser.SaveIndexInfo(driver, idx)
+			if err != nil {
+				return err
+			}
+			job.State = JobDone
+			return nil
+		}
+
+		err = saveJob(driver, job)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// holdSchemaState waits until the state of the index is a lease old, a
+// job recording no time for it waits a lease from now
+func holdSchemaState(driver store.Driver, job *DDLJob) error {
+	if job.StateTime == 0 {
+		job.StateTime = time.Now().UnixNano()
+		if err := saveJob(driver, job); err != nil {
+			return err
+		}
+	}
+	wait := time.Until(time.Unix(0, job.StateTime).Add(SchemaLease))
+	if wait <= 0 {
+		return nil
+	}
+	time.Sleep(wait)
+	// the job is still owned and looked after
+	return saveJob(driver, job)
+}
+
+// decodeRowDatums decodes the row raw into its columns in their order
+func decodeRowDatums(raw string, table *parser.TableInfo) ([]*util.Datum, error) {
+	dm, err := decodeRow(raw, table)
+	if err != nil {
+		return nil, err
+	}
+	datums := make([]*util.Datum, len(dm))
+	for i, d := range dm {
+		datums[i] = d
+	}
+	return datums, nil
+}
+
+// rowIndexKey gives the entry of idx for the row raw
+func rowIndexKey(table *parser.TableInfo, idx *parser.IndexInfo, raw string) (string, error) {
+	datums, err := decodeRowDatums(raw, table)
+	if err != nil {
+		return "", err
+	}
+	return indexKey(idx, table, datums)
+}
+
+// rowLeftIndexKey tells whether the row at pk is gone or has another
+// entry of idx than ik
+func rowLeftIndexKey(driver store.Driver, table *parser.TableInfo, idx *parser.IndexInfo, pk string, ik string) (bool, error) {
+	raw, err := driver.GetUserRecord(pk)
+	if err == store.Nil {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cur, err := rowIndexKey(table, idx, raw)
+	if err != nil {
+		return false, err
+	}
+	return cur != ik, nil
+}
+
+// dropChangedEntries takes back the entries written by the backfill for
+// the rows changed since they were read
+func dropChangedEntries(driver store.Driver, table *parser.TableInfo, idx *parser.IndexInfo, written *indexEntries) error {
+	var pks, iks []string
+	for _, ik := range written.keys {
+		for _, pk := range written.pks[ik] {
+			pks = append(pks, pk)
+			iks = append(iks, ik)
+		}
+	}
+	raws, exist, err := getUserRecords(driver, pks)
+	if err != nil {
+		return err
+	}
+	dels := newIndexEntries()
+	for i, pk := range pks {
+		if exist[i] {
+			cur, err := rowIndexKey(table, idx, raws[i])
+			if err != nil {
+				return err
+			}
+			if cur == iks[i] {
+				continue
+			}
+		}
+		dels.add(iks[i], pk)
+	}
+	if len(dels.keys) == 0 {
+		return nil
+	}
+	return DeleteIndexInfos(driver, dels.keys, dels.pks)
+}
+
+func runDropJob(driver store.Driver, job *DDLJob) error {
+	for job.PrefixPos < len(job.Prefixes) {
+		keys, cursor, err := driver.ScanUserRecords(job.Cursor, job.Prefixes[job.PrefixPos]+"*", OnceScanCount)
+		if err != nil {
+			return err
+		}
+		err = driver.DelUserRecords(keys)
+		if err != nil {
+			return err
+		}
+		job.RowCount += int64(len(keys))
+
+		job.Cursor = cursor
+		if cursor == 0 {
+			// the order an ordered driver keeps of the rows goes too
+			if od, ok := orderedDriver(driver); ok {
+				err = od.DelUserRange(parser.RowRange(job.Prefixes[job.PrefixPos]))
+				if err != nil {
+					return err
+				}
+			}
+			job.PrefixPos++
+		}
+		err = saveJob(driver, job)
+		if err != nil {
+			return err
+		}
+	}
+
+	job.State = JobDone
+	return nil
+}
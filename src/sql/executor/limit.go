@@ -8,19 +8,24 @@ import (
 
 type LimitExec struct {
 	num      uint64
+	offset   uint64
 	cur      uint64
 	children []result.Result
 	done     bool
+	source   chunkSource
+	chk      *result.Chunk
 }
 
 func NewLimitExec(l *plan.Limit, e *Executor) *LimitExec {
 	lmtExec := &LimitExec{
-		num: l.Num,
+		num:    l.Num,
+		offset: l.Offset,
 	}
 
 	for _, p := range l.GetChildren() {
 		lmtExec.children = append(lmtExec.children, makePlanExec(p, e))
 	}
+	lmtExec.source.r = lmtExec.children[0]
 
 	return lmtExec
 }
@@ -30,20 +35,75 @@ func (l *LimitExec) Columns() ([]*store.ColumnInfo, error) {
 }
 
 func (l *LimitExec) Next() (*result.Record, error) {
-	if l.cur >= l.num {
+	if l.done || l.cur >= l.num {
 		l.done = true
 		return nil, nil
 	}
 
+	for ; l.offset > 0; l.offset-- {
+		r, err := l.children[0].Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			l.done = true
+			return nil, nil
+		}
+	}
+
 	r, err := l.children[0].Next()
 	if err != nil {
 		return nil, err
 	}
+	if r == nil {
+		l.done = true
+		return nil, nil
+	}
 
 	l.cur++
 	return r, nil
 }
 
+// NextChunk skips the offset and gives the rows up to the limit, the
+// chunks of the child that are all given are passed on as they are
+func (l *LimitExec) NextChunk() (*result.Chunk, error) {
+	for !l.done && l.cur < l.num {
+		chk, err := l.source.next()
+		if err != nil {
+			return nil, err
+		}
+		if chk == nil {
+			break
+		}
+
+		n := uint64(chk.NumRows())
+		if l.offset >= n {
+			l.offset -= n
+			continue
+		}
+		start, end := l.offset, n
+		if end-start > l.num-l.cur {
+			end = start + l.num - l.cur
+		}
+		l.offset = 0
+		l.cur += end - start
+		if start == 0 && end == n {
+			return chk, nil
+		}
+
+		if l.chk == nil {
+			l.chk = result.NewChunk(len(chk.Columns))
+		}
+		l.chk.Reset()
+		for i := start; i < end; i++ {
+			l.chk.AppendRowFrom(chk, int(i))
+		}
+		return l.chk, nil
+	}
+	l.done = true
+	return nil, nil
+}
+
 func (l *LimitExec) Done() bool {
 	return l.done
 }
@@ -0,0 +1,397 @@
+package executor
+
+import (
+	"sync"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * ParallelScanExec reads the rows of a table with workers side by side,
+ * when the session sets nesoi_scan_workers above 1. On a driver keeping
+ * its keys in order, as the Redis driver does, the primary keys are split
+ * into ranges at the bounds of the histogram of the primary key, and a
+ * producer seeks the rows of each range. On the others the one SCAN cursor
+ * of the table is walked by a single producer, only the gets and the
+ * decoding of the rows are done side by side. The producers hand batches
+ * of keys, or of rows of a range, to the workers. Each worker gets the
+ * rows of its batches, decodes and filters them into chunks of its own,
+ * and the chunks are given in the order they are filled, so the rows come
+ * in no particular order, as they do from a SCAN.
+ *
+ * A chunk given goes back to the workers on the next call. Close stops
+ * the producers and workers of a scan that is not read to its end.
+ */
+type ParallelScanExec struct {
+	scan    *plan.Scan
+	driver  store.Driver
+	context *context.Context
+	workers int
+	filter  *util.Datum
+	started bool
+	done    bool
+	out     chan *result.Chunk
+	free    chan *result.Chunk
+	last    *result.Chunk
+	stop    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	err     error
+	records chunkRecords
+}
+
+// scanBatch is a batch of keys of a part, with their rows when the
+// producer read them
+type scanBatch struct {
+	keys   []string
+	values []string
+}
+
+func newParallelScanExec(s *plan.Scan, workers int, e *Executor) *ParallelScanExec {
+	return &ParallelScanExec{
+		scan:    s,
+		driver:  e.driver,
+		context: e.context,
+		workers: workers,
+		stop:    make(chan struct{}),
+	}
+}
+
+func (s *ParallelScanExec) Columns() ([]*store.ColumnInfo, error) {
+	return fieldsColumnInfo(s.context, s.scan.From, "", s.scan.Fields)
+}
+
+func (s *ParallelScanExec) start() error {
+	if s.scan.Filter != nil {
+		filter, err := valueToDatum(s.scan.Filter.Value)
+		if err != nil {
+			return err
+		}
+		s.filter = filter
+	}
+	decs := make([]*rowDecoder, s.workers)
+	for i := range decs {
+		dec, err := newRowDecoder(s.scan.From, s.scan.Columns, s.scan.Fields)
+		if err != nil {
+			return err
+		}
+		decs[i] = dec
+	}
+	parts, err := s.parts()
+	if err != nil {
+		return err
+	}
+
+	batches := make(chan *scanBatch, s.workers)
+	s.out = make(chan *result.Chunk, s.workers)
+	s.free = make(chan *result.Chunk, s.workers+1)
+
+	var producers sync.WaitGroup
+	for _, part := range parts {
+		producers.Add(1)
+		go func(part func(chan<- *scanBatch) error) {
+			defer producers.Done()
+			if err := part(batches); err != nil {
+				s.fail(err)
+			}
+		}(part)
+	}
+	go func() {
+		producers.Wait()
+		close(batches)
+	}()
+
+	var workers sync.WaitGroup
+	for _, dec := range decs {
+		workers.Add(1)
+		go func(dec *rowDecoder) {
+			defer workers.Done()
+			if err := s.work(dec, batches); err != nil {
+				s.fail(err)
+			}
+		}(dec)
+	}
+	go func() {
+		workers.Wait()
+		close(s.out)
+	}()
+	return nil
+}
+
+// parts gives a producer for each part of the keys of the table
+func (s *ParallelScanExec) parts() ([]func(chan<- *scanBatch) error, error) {
+	var parts []func(chan<- *scanBatch) error
+	table := s.scan.From
+	match := table.RowPrefix() + "*"
+
+	if od, ok := orderedDriver(s.driver); ok {
+		bounds, err := s.splitKeys()
+		if err != nil {
+			return nil, err
+		}
+		starts := append([]string{table.RowPrefix()}, bounds...)
+		ends := append(bounds, table.RowsEnd())
+		for i := range starts {
+			start, end := starts[i], ends[i]
+			parts = append(parts, func(batches chan<- *scanBatch) error {
+				return s.seekRange(od, start, end, batches)
+			})
+		}
+		return parts, nil
+	}
+
+	parts = append(parts, func(batches chan<- *scanBatch) error {
+		return s.scanKeys(func(cursor uint64) ([]string, uint64, error) {
+			return s.driver.ScanUserRecords(cursor, match, OnceScanCount)
+		}, batches)
+	})
+	return parts, nil
+}
+
+/*
+ * splitKeys gives the keys splitting the rows of the table into a range
+ * for each worker, taken from the upper bounds of the buckets of the
+ * primary key, which hold about the same number of rows each. A table
+ * without statistics isn't split.
+ */
+func (s *ParallelScanExec) splitKeys() ([]string, error) {
+	table, stats := s.scan.From, s.scan.Stats
+	if stats == nil {
+		return nil, nil
+	}
+	var cs *parser.ColumnStats
+	for i := 0; i < len(table.ColumnMap); i++ {
+		if cd := table.ColumnMap[i]; cd.PrimaryKey {
+			cs = stats.Column(cd.ID)
+			break
+		}
+	}
+	if cs == nil || len(cs.Buckets) < 2 {
+		return nil, nil
+	}
+
+	var bounds []string
+	n := len(cs.Buckets)
+	for i := 1; i < s.workers; i++ {
+		j := i*n/s.workers - 1
+		if j < 0 {
+			continue
+		}
+		key, err := pkKey(table, cs.Buckets[j].Upper)
+		if err != nil {
+			return nil, err
+		}
+		// the range ending with a bucket includes its upper bound
+		key += "\x00"
+		if len(bounds) > 0 && key <= bounds[len(bounds)-1] {
+			continue
+		}
+		bounds = append(bounds, key)
+	}
+	return bounds, nil
+}
+
+// seekRange reads the rows of the keys from start to before end
+func (s *ParallelScanExec) seekRange(od store.OrderedDriver, start string, end string, batches chan<- *scanBatch) error {
+	for start < end {
+		keys, values, err := od.SeekUserRecords(start, end, OnceScanCount)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 && !s.send(batches, &scanBatch{keys: keys, values: values}) {
+			return nil
+		}
+		if int64(len(keys)) < OnceScanCount {
+			return nil
+		}
+		start = keys[len(keys)-1] + "\x00"
+	}
+	return nil
+}
+
+// scanKeys walks a SCAN cursor, scan reads the batch at a cursor
+func (s *ParallelScanExec) scanKeys(scan func(cursor uint64) ([]string, uint64, error), batches chan<- *scanBatch) error {
+	var cursor uint64
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		default:
+		}
+		keys, next, err := scan(cursor)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 && !s.send(batches, &scanBatch{keys: keys}) {
+			return nil
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// send hands a batch to the workers, it is false when the scan is stopped
+func (s *ParallelScanExec) send(batches chan<- *scanBatch, b *scanBatch) bool {
+	select {
+	case batches <- b:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// work decodes the rows of batches into chunks until there are no more
+func (s *ParallelScanExec) work(dec *rowDecoder, batches <-chan *scanBatch) error {
+	chk := s.chunk()
+	for b := range batches {
+		values, found := b.values, []bool(nil)
+		if values == nil {
+			var err error
+			values, found, err = getUserRecords(s.driver, b.keys)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, raw := range values {
+			if found != nil && !found[i] {
+				continue
+			}
+			if err := dec.decode(s.context, raw, chk); err != nil {
+				return err
+			}
+			if s.filter != nil {
+				n := chk.NumRows() - 1
+				if !equalAt(chk.Columns[s.scan.Filter.Pos-1], n, s.filter) {
+					chk.Truncate(n)
+					continue
+				}
+			}
+			if chk.IsFull() {
+				if !s.emit(chk) {
+					return nil
+				}
+				chk = s.chunk()
+			}
+		}
+	}
+	if chk.NumRows() > 0 {
+		s.emit(chk)
+	}
+	return nil
+}
+
+// chunk gives a chunk back from the parent, or a new one
+func (s *ParallelScanExec) chunk() *result.Chunk {
+	select {
+	case chk := <-s.free:
+		chk.Reset()
+		chk.Grow()
+		return chk
+	default:
+		return result.NewChunk(len(s.scan.Fields))
+	}
+}
+
+// emit hands a chunk to the parent, it is false when the scan is stopped
+func (s *ParallelScanExec) emit(chk *result.Chunk) bool {
+	select {
+	case s.out <- chk:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// fail keeps the first error of the producers and workers and stops them
+func (s *ParallelScanExec) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.Close()
+}
+
+func (s *ParallelScanExec) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the producers and workers of the scan
+func (s *ParallelScanExec) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *ParallelScanExec) Next() (*result.Record, error) {
+	return s.records.next(s.NextChunk)
+}
+
+func (s *ParallelScanExec) NextChunk() (*result.Chunk, error) {
+	if !s.started {
+		s.started = true
+		if err := s.start(); err != nil {
+			s.done = true
+			s.Close()
+			return nil, err
+		}
+	}
+	if s.last != nil {
+		select {
+		case s.free <- s.last:
+		default:
+		}
+		s.last = nil
+	}
+	if s.done {
+		return nil, nil
+	}
+
+	chk, ok := <-s.out
+	if err := s.error(); err != nil {
+		s.done = true
+		s.Close()
+		return nil, err
+	}
+	if !ok {
+		s.done = true
+		return nil, nil
+	}
+	s.last = chk
+	return chk, nil
+}
+
+func (s *ParallelScanExec) Done() bool {
+	return s.done && !s.records.pending()
+}
+
+/*
+ * parallelScans are the parallel scans started by the statement being
+ * executed, shared by the copies of the executor running its subqueries.
+ * A statement may leave a scan unread, as LIMIT or EXISTS do, so they are
+ * all stopped before the next statement runs.
+ */
+type parallelScans struct {
+	scans []*ParallelScanExec
+}
+
+func (ps *parallelScans) add(s *ParallelScanExec) {
+	ps.scans = append(ps.scans, s)
+}
+
+func (ps *parallelScans) close() {
+	for _, s := range ps.scans {
+		s.Close()
+	}
+	ps.scans = nil
+}
@@ -0,0 +1,253 @@
+package executor
+
+import (
+	goctx "context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// testDriver keeps the records in memory, its patterns only end with *
+type testDriver struct {
+	mu   sync.Mutex
+	data map[string]string
+	// the keys of the SCAN walked, taken when it starts
+	scan []string
+}
+
+func newTestDriver() *testDriver {
+	d := &testDriver{data: map[string]string{}}
+	d.data[store.SystemFlag+store.DBFlag+store.NesoiFlag] = ""
+	return d
+}
+
+func (d *testDriver) GetUserRecord(key string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	value, ok := d.data[key]
+	if !ok {
+		return "", store.Nil
+	}
+	return value, nil
+}
+
+func (d *testDriver) GetUserRecords(keys []string) ([]string, []bool, error) {
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		value, err := d.GetUserRecord(key)
+		values[i], found[i] = value, err == nil
+	}
+	return values, found, nil
+}
+
+func (d *testDriver) SetUserRecord(key string, value string, ttl int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.data[key] = value
+	return nil
+}
+
+func (d *testDriver) SetUserRecords(keys []string, values []string) error {
+	for i, key := range keys {
+		d.SetUserRecord(key, values[i], 0)
+	}
+	return nil
+}
+
+func (d *testDriver) DelUserRecord(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.data, key)
+	return nil
+}
+
+func (d *testDriver) DelUserRecords(keys []string) error {
+	for _, key := range keys {
+		d.DelUserRecord(key)
+	}
+	return nil
+}
+
+func (d *testDriver) ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cursor == 0 {
+		d.scan = d.scan[:0]
+		for key := range d.data {
+			d.scan = append(d.scan, key)
+		}
+		sort.Strings(d.scan)
+	}
+	prefix := strings.TrimSuffix(match, "*")
+	var keys []string
+	end := cursor + uint64(count)
+	for ; cursor < end && cursor < uint64(len(d.scan)); cursor++ {
+		if strings.HasPrefix(d.scan[cursor], prefix) {
+			keys = append(keys, d.scan[cursor])
+		}
+	}
+	if cursor == uint64(len(d.scan)) {
+		cursor = 0
+	}
+	return keys, cursor, nil
+}
+
+func (d *testDriver) GetSysRecord(key string) (string, error) {
+	return d.GetUserRecord(key)
+}
+
+func (d *testDriver) SetSysRecord(key string, value string, ttl int64) error {
+	return d.SetUserRecord(key, value, ttl)
+}
+
+func (d *testDriver) DelSysRecord(key string) error {
+	return d.DelUserRecord(key)
+}
+
+func (d *testDriver) ScanSysRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	return d.ScanUserRecords(cursor, match, count)
+}
+
+func (d *testDriver) IncrSysRecord(key string) (int64, error) {
+	return d.IncrBySysRecord(key, 1)
+}
+
+func (d *testDriver) IncrBySysRecord(key string, n int64) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, _ := strconv.ParseInt(d.data[key], 10, 64)
+	v += n
+	d.data[key] = strconv.FormatInt(v, 10)
+	return v, nil
+}
+
+// orderedTestDriver is a testDriver keeping its keys in order
+type orderedTestDriver struct {
+	*testDriver
+	// the ends of the ranges sought
+	ends map[string]bool
+}
+
+func (d *orderedTestDriver) SeekUserRecords(start string, end string, count int64) ([]string, []string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ends[end] = true
+	var keys []string
+	for key := range d.data {
+		if key >= start && key < end {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if int64(len(keys)) > count {
+		keys = keys[:count]
+	}
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = d.data[key]
+	}
+	return keys, values, nil
+}
+
+func (d *orderedTestDriver) DelUserRange(start string, end string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.data {
+		if key >= start && key < end {
+			delete(d.data, key)
+		}
+	}
+	return nil
+}
+
+// queryRows gives the rows of a query a line each, sorted
+func queryRows(t *testing.T, e *Executor, sql string) []string {
+	rs, err := e.Execute(goctx.Background(), sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	var rows []string
+	for _, r := range rs {
+		for {
+			rc, err := r.Next()
+			if err != nil {
+				t.Fatalf("%s: %v", sql, err)
+			}
+			if rc == nil {
+				break
+			}
+			var fields []string
+			for _, d := range rc.Datums {
+				if d == nil || d.IsNull() {
+					fields = append(fields, "NULL")
+					continue
+				}
+				text, _ := util.DumpValueToText(d)
+				fields = append(fields, string(text))
+			}
+			rows = append(rows, strings.Join(fields, " "))
+		}
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+func TestParallelScanRows(t *testing.T) {
+	queries := []string{
+		"select * from t",
+		"select id, name from t where g = 3",
+		"select id + 1 from t where g = 2 and id > 100",
+		"select distinct g from t",
+	}
+
+	for _, ordered := range []bool{false, true} {
+		mem := newTestDriver()
+		var driver store.Driver = mem
+		od := &orderedTestDriver{testDriver: mem, ends: map[string]bool{}}
+		if ordered {
+			driver = od
+		}
+		ctx := context.NewContext()
+		e := NewExecutor(driver, ctx)
+
+		var values []string
+		for i := 0; i < 1000; i++ {
+			values = append(values, fmt.Sprintf("(%d, 'n%d', %d)", i, i, i%7))
+		}
+		for _, sql := range []string{
+			"create table t (id int primary key, name string, g int)",
+			"insert into t values " + strings.Join(values, ", "),
+			"analyze table t",
+		} {
+			queryRows(t, e, sql)
+		}
+
+		serial := make([][]string, len(queries))
+		for i, sql := range queries {
+			serial[i] = queryRows(t, e, sql)
+		}
+		if len(serial[0]) != 1000 {
+			t.Fatalf("%d rows with 1 worker", len(serial[0]))
+		}
+		queryRows(t, e, "set nesoi_scan_workers = 4")
+		for i, sql := range queries {
+			rows := queryRows(t, e, sql)
+			if strings.Join(rows, "\n") != strings.Join(serial[i], "\n") {
+				t.Errorf("ordered %v, %s: %d rows with 4 workers, %d with 1", ordered, sql, len(rows), len(serial[i]))
+			}
+		}
+		// the primary keys are split into a range for each worker
+		if ordered && len(od.ends) != 4 {
+			t.Errorf("%d ranges sought", len(od.ends))
+		}
+		e.Close()
+	}
+}
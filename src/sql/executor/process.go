@@ -0,0 +1,208 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// SessionManager gives the connections of the server to KILL and to
+// SHOW PROCESSLIST
+type SessionManager interface {
+	// Kill kills the connection connID, or only the statement it runs
+	// when query is set. It is false when there is no such connection.
+	Kill(connID uint32, query bool) bool
+	// ShowProcessList gives the connections in the order of their ids
+	ShowProcessList() []*ProcessInfo
+}
+
+// ProcessInfo is what a connection is doing
+type ProcessInfo struct {
+	ID      uint32
+	User    string
+	Host    string
+	DB      string
+	Command string
+	// when the connection started the command, or went idle
+	Since time.Time
+	State string
+	// the statement being run
+	Info string
+}
+
+// the length SHOW PROCESSLIST cuts the statements to, unless FULL
+const processInfoLen = 100
+
+func (executor *Executor) SetSessionManager(sm SessionManager) {
+	executor.sm = sm
+}
+
+func (executor *Executor) executeKill(stmt *parser.KillStmt) error {
+	if executor.sm == nil || stmt.ConnectionID > uint64(^uint32(0)) ||
+		!executor.sm.Kill(uint32(stmt.ConnectionID), stmt.Query) {
+		return mysql.NewErrf(mysql.ErrNoSuchThread, "Unknown thread id: %d", stmt.ConnectionID)
+	}
+	return nil
+}
+
+// processList gives the connections of the server, none without one
+func (executor *Executor) processList() []*ProcessInfo {
+	if executor.sm == nil {
+		return nil
+	}
+	return executor.sm.ShowProcessList()
+}
+
+// processRow gives the columns of the processlist for a connection, the
+// statement cut to max characters when max > 0
+func processRow(p *ProcessInfo, now time.Time, max int) []*util.Datum {
+	nullOr := func(s string) *util.Datum {
+		if s == "" {
+			return &util.Datum{}
+		}
+		return stringDatum(s)
+	}
+	info := p.Info
+	if max > 0 && len([]rune(info)) > max {
+		info = string([]rune(info)[:max])
+	}
+	return []*util.Datum{
+		intDatum(int64(p.ID)),
+		stringDatum(p.User),
+		stringDatum(p.Host),
+		nullOr(p.DB),
+		stringDatum(p.Command),
+		intDatum(int64(now.Sub(p.Since) / time.Second)),
+		stringDatum(p.State),
+		nullOr(info),
+	}
+}
+
+type ShowProcessListExec struct {
+	context   *context.Context
+	executor  *Executor
+	full      bool
+	processes []*ProcessInfo
+	now       time.Time
+	started   bool
+	pos       int
+	done      bool
+}
+
+func (s *ShowProcessListExec) Columns() ([]*store.ColumnInfo, error) {
+	ret := []*store.ColumnInfo{}
+	names := []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"}
+	for _, name := range names {
+		ci := &store.ColumnInfo{
+			Schema:   s.context.GetCurrentDB(),
+			Table:    "dual",
+			OrgTable: "dual",
+			Name:     name,
+			OrgName:  name,
+			Type:     mysql.TypeString,
+		}
+		if name == "Id" || name == "Time" {
+			ci.Type = mysql.TypeLonglong
+		}
+		ret = append(ret, ci)
+	}
+
+	return ret, nil
+}
+
+func (s *ShowProcessListExec) Next() (*result.Record, error) {
+	if !s.started {
+		s.started = true
+		s.processes = s.executor.processList()
+		s.now = time.Now()
+	}
+	if s.done || s.pos >= len(s.processes) {
+		s.done = true
+		return nil, nil
+	}
+	p := s.processes[s.pos]
+	s.pos++
+
+	max := processInfoLen
+	if s.full {
+		max = 0
+	}
+	return &result.Record{Datums: processRow(p, s.now, max)}, nil
+}
+
+func (s *ShowProcessListExec) Done() bool {
+	return s.done
+}
+
+/*
+ * MemTableScanExec scans a table of information_schema, its rows are made
+ * from the connections of the server when it is first read. The table has
+ * neither primary key nor indexes, so it is only ever scanned.
+ */
+type MemTableScanExec struct {
+	scan     *plan.Scan
+	context  *context.Context
+	executor *Executor
+	rows     [][]*util.Datum
+	started  bool
+	pos      int
+	count    uint64
+	done     bool
+}
+
+func (s *MemTableScanExec) Columns() ([]*store.ColumnInfo, error) {
+	return fieldsColumnInfo(s.context, s.scan.From, "", s.scan.Fields)
+}
+
+func (s *MemTableScanExec) start() {
+	now := time.Now()
+	for _, p := range s.executor.processList() {
+		s.rows = append(s.rows, processRow(p, now, 0))
+	}
+}
+
+func (s *MemTableScanExec) Next() (*result.Record, error) {
+	if !s.started {
+		s.started = true
+		s.start()
+	}
+	for !s.done && s.pos < len(s.rows) {
+		if s.scan.Limit > 0 && s.count >= s.scan.Limit {
+			break
+		}
+		row := s.rows[s.pos]
+		s.pos++
+
+		dm := make(map[int]*util.Datum, len(row))
+		for i, d := range row {
+			dm[i] = d
+		}
+		datums, err := evalFields(s.context, s.scan.Fields, dm)
+		if err != nil {
+			return nil, err
+		}
+		if s.scan.Filter != nil {
+			ok, err := matchQual(s.scan.Filter, datums)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		s.count++
+		return &result.Record{Datums: datums}, nil
+	}
+	s.done = true
+	return nil, nil
+}
+
+func (s *MemTableScanExec) Done() bool {
+	return s.done
+}
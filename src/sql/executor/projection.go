@@ -1,70 +1,107 @@
 package executor
 
 import (
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
 	"github.com/castermode/Nesoi/src/sql/plan"
 	"github.com/castermode/Nesoi/src/sql/result"
 	"github.com/castermode/Nesoi/src/sql/store"
-	"github.com/castermode/Nesoi/src/sql/util"
 )
 
 type ProjectionExec struct {
-	fieldsNum int
-	children  []result.Result
-	done      bool
+	from     *parser.TableInfo
+	alias    string
+	fields   []*parser.TargetRes
+	executor *Executor
+	context  *context.Context
+	children []result.Result
+	done     bool
+	source   chunkSource
+	chk      *result.Chunk
+	records  chunkRecords
 }
 
 func NewProjectionExec(p *plan.Projection, e *Executor) *ProjectionExec {
 	pExec := &ProjectionExec{
-		fieldsNum: p.FieldsNum,
+		from:     p.From,
+		alias:    p.Alias,
+		fields:   p.Fields,
+		executor: e,
+		context:  e.context,
 	}
 
 	for _, n := range p.GetChildren() {
 		pExec.children = append(pExec.children, makePlanExec(n, e))
 	}
+	pExec.source.r = pExec.children[0]
 
 	return pExec
 }
 
 func (p *ProjectionExec) Columns() ([]*store.ColumnInfo, error) {
-	clms, err := p.children[0].Columns()
+	if p.from != nil {
+		return fieldsColumnInfo(p.context, p.from, p.alias, p.fields)
+	}
+
+	// columns of a derived table are described by its subquery
+	cis, err := p.children[0].Columns()
 	if err != nil {
 		return nil, err
 	}
-
 	ret := []*store.ColumnInfo{}
-	var i int
-	for i < p.fieldsNum {
-		ret = append(ret, clms[i])
-		i++
+	for _, f := range p.fields {
+		if f.Type != parser.ETARGET || f.Depth > 0 {
+			ci, err := targetColumnInfo(p.context, nil, "", f)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, ci)
+			continue
+		}
+		ci := *cis[f.FieldID-1]
+		ci.Table = p.alias
+		ci.OrgTable = p.alias
+		ci.OrgName = ci.Name
+		if f.Name != "" {
+			ci.Name = f.Name
+		}
+		ret = append(ret, &ci)
 	}
-
 	return ret, nil
 }
 
 func (p *ProjectionExec) Next() (*result.Record, error) {
+	return p.records.next(p.NextChunk)
+}
+
+// NextChunk evaluates the fields on a chunk of rows, a field that is a
+// column of the rows gives that column as it is
+func (p *ProjectionExec) NextChunk() (*result.Chunk, error) {
 	if p.done {
 		return nil, nil
 	}
 
-	record, err := p.children[0].Next()
+	chk, err := p.source.next()
 	if err != nil {
 		return nil, err
 	}
-	if record == nil {
+	if chk == nil {
 		p.done = true
 		return nil, nil
 	}
 
-	datums := []*util.Datum{}
-	var i int
-	for i < p.fieldsNum {
-		datums = append(datums, record.Datums[i])
-		i++
+	if p.chk == nil {
+		p.chk = &result.Chunk{Columns: make([]*result.Column, len(p.fields))}
 	}
-
-	return &result.Record{Datums: datums}, nil
+	for i, f := range p.fields {
+		p.chk.Columns[i], err = evalColumn(p.executor, f, chk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p.chk, nil
 }
 
 func (p *ProjectionExec) Done() bool {
-	return p.done
+	return p.done && !p.records.pending()
 }
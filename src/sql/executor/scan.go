@@ -1,11 +1,7 @@
 package executor
 
 import (
-	"errors"
-	"strings"
-
 	"github.com/castermode/Nesoi/src/sql/context"
-	"github.com/castermode/Nesoi/src/sql/mysql"
 	"github.com/castermode/Nesoi/src/sql/parser"
 	"github.com/castermode/Nesoi/src/sql/plan"
 	"github.com/castermode/Nesoi/src/sql/result"
@@ -17,352 +13,577 @@ const (
 	OnceScanCount int64 = 100
 )
 
+// FetchBatchSize is the number of rows read in one round trip, the server
+// sets it from its configuration
+var FetchBatchSize = 100
+
+/*
+ * getUserRecords reads the records at keys, FetchBatchSize of them in one
+ * round trip. found[i] tells whether there is one at keys[i].
+ */
+func getUserRecords(driver store.Driver, keys []string) ([]string, []bool, error) {
+	size := FetchBatchSize
+	if size < 1 {
+		size = 1
+	}
+	if len(keys) <= size {
+		return driver.GetUserRecords(keys)
+	}
+
+	values := make([]string, 0, len(keys))
+	found := make([]bool, 0, len(keys))
+	for i := 0; i < len(keys); i += size {
+		end := i + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		vs, fs, err := driver.GetUserRecords(keys[i:end])
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, vs...)
+		found = append(found, fs...)
+	}
+	return values, found, nil
+}
+
+/*
+ * rowFetcher reads the rows of a list of keys, a batch of them in one
+ * round trip when the rows are needed. Keys without a row are skipped.
+ */
+type rowFetcher struct {
+	driver store.Driver
+	keys   []string
+	pos    int
+	// the keys last fetched and their rows
+	batch  []string
+	values []string
+	found  []bool
+	vpos   int
+}
+
+func (f *rowFetcher) reset(driver store.Driver, keys []string) {
+	f.driver, f.keys, f.pos = driver, keys, 0
+	f.batch, f.values, f.found, f.vpos = nil, nil, nil, 0
+}
+
+/*
+ * next gives the key and the row of the next key with a row, ok is false
+ * when there are no more keys. A batch holds at most max keys when max
+ * isn't 0, so that no more rows than needed are read.
+ */
+func (f *rowFetcher) next(max int) (key string, raw string, ok bool, err error) {
+	for {
+		if f.vpos >= len(f.batch) {
+			if f.pos >= len(f.keys) {
+				return "", "", false, nil
+			}
+			n := FetchBatchSize
+			if max > 0 && max < n {
+				n = max
+			}
+			if n < 1 {
+				n = 1
+			}
+			end := f.pos + n
+			if end > len(f.keys) {
+				end = len(f.keys)
+			}
+			f.values, f.found, err = f.driver.GetUserRecords(f.keys[f.pos:end])
+			if err != nil {
+				return "", "", false, err
+			}
+			f.batch, f.vpos, f.pos = f.keys[f.pos:end], 0, end
+		}
+		i := f.vpos
+		f.vpos++
+		if f.found[i] {
+			return f.batch[i], f.values[i], true, nil
+		}
+	}
+}
+
 type ScanExec struct {
 	scan    *plan.Scan
 	driver  store.Driver
 	context *context.Context
-	keys    []string
-	pos     int
+	rows    rowFetcher
 	cursor  uint64
+	started bool
 	done    bool
+	// rows returned so far, checked against the pushed down limit
+	count   uint64
+	dec     *rowDecoder
+	chk     *result.Chunk
+	records chunkRecords
 }
 
 func (s *ScanExec) Columns() ([]*store.ColumnInfo, error) {
-	ret := []*store.ColumnInfo{}
-	for _, f := range s.scan.Fields {
-		ci := &store.ColumnInfo{}
-		switch f.Type {
-		case parser.ETARGET:
-			st := strings.Split(s.scan.From.Name, ".")
-			ci.Schema = st[0]
-			ci.Table = st[1]
-			ci.OrgTable = st[1]
-			ci.Name = s.scan.From.ColumnMap[f.FieldID-1].Name
-			ci.OrgName = s.scan.From.ColumnMap[f.FieldID-1].Name
-			switch s.scan.From.ColumnMap[f.FieldID-1].Type.(type) {
-			case *parser.IntType:
-				ci.Type = mysql.TypeLong
-				ci.ColumnLength = 4
-			case *parser.StringType:
-				ci.Type = mysql.TypeString
-			}
-			if s.scan.From.ColumnMap[f.FieldID-1].Nullable == parser.NotNull {
-				ci.Flag |= mysql.NotNullFlag
-			}
-			if s.scan.From.ColumnMap[f.FieldID-1].PrimaryKey {
-				ci.Flag |= mysql.PriKeyFlag
+	return fieldsColumnInfo(s.context, s.scan.From, "", s.scan.Fields)
+}
+
+// evalFields evaluates the fields of a scan on a decoded row, they are
+// columns and values only.
+func evalFields(ctx *context.Context, fields []*parser.TargetRes, dm map[int]*util.Datum) ([]*util.Datum, error) {
+	e := &Executor{context: ctx}
+	row := make([]*util.Datum, len(dm))
+	for i, d := range dm {
+		row[i] = d
+	}
+
+	datums := make([]*util.Datum, 0, len(fields))
+	for _, f := range fields {
+		d, err := evalTarget(e, f, row)
+		if err != nil {
+			return nil, err
+		}
+		datums = append(datums, d)
+	}
+	return datums, nil
+}
+
+func (s *ScanExec) Next() (*result.Record, error) {
+	return s.records.next(s.NextChunk)
+}
+
+// nextRow gives the key and the row of the next key of the table
+func (s *ScanExec) nextRow() (string, string, bool, error) {
+	for !s.done {
+		var max int
+		if s.scan.Limit != 0 {
+			if s.count >= s.scan.Limit {
+				s.done = true
+				break
 			}
-			if s.scan.From.ColumnMap[f.FieldID-1].Unique {
-				ci.Flag |= mysql.UniqueKeyFlag
+			max = int(s.scan.Limit - s.count)
+		}
+
+		key, raw, ok, err := s.rows.next(max)
+		if err != nil {
+			return "", "", false, err
+		}
+		if ok {
+			return key, raw, true, nil
+		}
+		if s.started && s.cursor == 0 {
+			s.done = true
+			break
+		}
+		s.started = true
+		// a batch may match nothing before the cursor is back to 0
+		match := s.scan.From.RowPrefix() + "*"
+		keys, cursor, err := s.driver.ScanUserRecords(s.cursor, match, OnceScanCount)
+		if err != nil {
+			return "", "", false, err
+		}
+		s.cursor = cursor
+		s.rows.reset(s.driver, keys)
+	}
+	return "", "", false, nil
+}
+
+func (s *ScanExec) nextKV() (string, *result.Record, error) {
+	for {
+		key, raw, ok, err := s.nextRow()
+		if err != nil || !ok {
+			return "", nil, err
+		}
+
+		// Parse one row
+		dm, err := decodeColumns(raw, s.scan.From, s.scan.Columns)
+		if err != nil {
+			return "", nil, err
+		}
+
+		datums, err := evalFields(s.context, s.scan.Fields, dm)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if s.scan.Filter != nil {
+			ok, err := matchQual(s.scan.Filter, datums)
+			if err != nil {
+				return "", nil, err
 			}
-			ret = append(ret, ci)
-		case parser.ESYSVAR:
-			ci.Schema = s.context.GetCurrentDB()
-			ci.Table = "dual"
-			ci.OrgTable = "dual"
-			ci.Name = f.SysVar
-			ci.OrgName = f.SysVar
-			ci.Type = uint8(mysql.TypeString)
-			ret = append(ret, ci)
-		case parser.EVALUE:
-			ci.Schema = s.context.GetCurrentDB()
-			ci.Table = "dual"
-			ci.OrgTable = "dual"
-			ci.Name = "EXPRESSION"
-			ci.OrgName = "EXPRESSION"
-			switch f.Value.(type) {
-			case int64:
-				ci.Type = uint8(mysql.TypeLong)
-				ci.ColumnLength = 4
-			case string:
-				ci.Type = mysql.TypeString
+			if !ok {
+				continue
 			}
-			ret = append(ret, ci)
-		default:
-			return nil, errors.New("caluse error!")
 		}
-	}
 
-	return ret, nil
+		s.count++
+		return key, &result.Record{Datums: datums}, nil
+	}
 }
 
-func (s *ScanExec) nextKey() ([]byte, bool, error) {
-	if s.done {
-		return nil, false, nil
+func (s *ScanExec) NextChunk() (*result.Chunk, error) {
+	if s.chk == nil {
+		dec, err := newRowDecoder(s.scan.From, s.scan.Columns, s.scan.Fields)
+		if err != nil {
+			return nil, err
+		}
+		s.dec, s.chk = dec, result.NewChunk(len(s.scan.Fields))
 	}
 
-	if s.keys != nil && s.pos < len(s.keys) {
-		if s.pos == len(s.keys)-1 && s.cursor == 0 {
-			s.done = true
-		}
-		key := s.keys[s.pos]
-		s.pos++
-		return util.ToSlice(key), true, nil
-	} else {
+	var filter *util.Datum
+	if s.scan.Filter != nil {
 		var err error
-		match := store.UserFlag + s.scan.From.Name + "/*"
-		s.keys, s.cursor, err = s.driver.ScanUserRecords(s.cursor, match, OnceScanCount)
+		filter, err = valueToDatum(s.scan.Filter.Value)
 		if err != nil {
-			return nil, true, err
+			return nil, err
 		}
-		s.pos = 0
-		if s.keys != nil {
-			if s.cursor == 0 && (s.pos == len(s.keys)-1 || len(s.keys) == 0) {
-				s.done = true
-			}
-			if len(s.keys) > 0 {
-				key := s.keys[0]
-				s.pos++
-				return util.ToSlice(key), true, nil
-			} else {
-				return nil, true, nil
+	}
+
+	if s.chk.NumRows() > 0 {
+		s.chk.Reset()
+		s.chk.Grow()
+	}
+	for !s.chk.IsFull() {
+		_, raw, ok, err := s.nextRow()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if err := s.dec.decode(s.context, raw, s.chk); err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			n := s.chk.NumRows() - 1
+			if !equalAt(s.chk.Columns[s.scan.Filter.Pos-1], n, filter) {
+				s.chk.Truncate(n)
+				continue
 			}
 		}
+		s.count++
+	}
+	if s.chk.NumRows() == 0 {
+		return nil, nil
+	}
+	return s.chk, nil
+}
 
-		s.done = true
-		return nil, false, nil
+func (s *ScanExec) Done() bool {
+	return s.done && !s.records.pending()
+}
+
+type ScanWithPKExec struct {
+	scanpk  *plan.ScanWithPK
+	driver  store.Driver
+	context *context.Context
+	rows    rowFetcher
+	started bool
+	done    bool
+	dec     *rowDecoder
+	chk     *result.Chunk
+	records chunkRecords
+}
+
+func (s *ScanWithPKExec) Columns() ([]*store.ColumnInfo, error) {
+	return fieldsColumnInfo(s.context, s.scanpk.From, "", s.scanpk.Fields)
+}
+
+// pkKey gives the key of the row whose primary key is v
+func pkKey(table *parser.TableInfo, v interface{}) (string, error) {
+	d, err := valueToDatum(v)
+	if err != nil {
+		return "", err
 	}
+	for i := 0; i < len(table.ColumnMap); i++ {
+		if cd := table.ColumnMap[i]; cd.PrimaryKey {
+			d = convertDatum(d, cd.Type)
+			break
+		}
+	}
+	raw, err := encodeKey(d)
+	if err != nil {
+		return "", err
+	}
+	return table.RowPrefix() + util.ToString(raw), nil
 }
 
-func parseColumnValue(raw string, cm map[int]*parser.ColumnTableDef) (map[int]*util.Datum, error) {
-	l := len(cm)
-	pos := 0
+func (s *ScanWithPKExec) Next() (*result.Record, error) {
+	return s.records.next(s.NextChunk)
+}
 
-	dm := make(map[int]*util.Datum)
-	for i := 0; i < l; i++ {
-		d := &util.Datum{}
-		if raw[pos] == '0' {
-			pos++
-			d.SetK(util.KindNull)
-		} else {
-			pos++
-			switch cm[i].Type.(type) {
-			case *parser.IntType:
-				i, _, n := util.ParseLengthEncodedInt(util.ToSlice(raw[pos:]))
-				d.SetK(util.KindInt64)
-				d.SetI(int64(i))
-				pos += n
-			case *parser.StringType:
-				s, _, n, err := util.ParseLengthEncodedBytes(util.ToSlice(raw[pos:]))
-				if err != nil {
-					return nil, err
-				}
-				d.SetK(util.KindString)
-				d.SetB(s)
-				pos += n
+// nextRow gets the row of the next primary key, skipping those not found
+func (s *ScanWithPKExec) nextRow() (string, bool, error) {
+	if !s.started {
+		s.started = true
+		keys := make([]string, 0, len(s.scanpk.Values))
+		for _, v := range s.scanpk.Values {
+			pk, err := pkKey(s.scanpk.From, v)
+			if err != nil {
+				return "", false, err
 			}
+			keys = append(keys, pk)
 		}
-		dm[i] = d
+		s.rows.reset(s.driver, keys)
+	}
+	if s.done {
+		return "", false, nil
 	}
+	_, raw, ok, err := s.rows.next(0)
+	if err == nil && !ok {
+		s.done = true
+	}
+	return raw, ok, err
+}
 
-	if len(dm) != len(cm) {
-		return nil, errors.New("parse column value error!")
+func (s *ScanWithPKExec) NextChunk() (*result.Chunk, error) {
+	if s.chk == nil {
+		dec, err := newRowDecoder(s.scanpk.From, s.scanpk.Columns, s.scanpk.Fields)
+		if err != nil {
+			return nil, err
+		}
+		s.dec, s.chk = dec, result.NewChunk(len(s.scanpk.Fields))
 	}
+	return fillChunk(s.context, s.chk, s.dec, s.nextRow)
+}
 
-	return dm, nil
+func (s *ScanWithPKExec) Done() bool {
+	return s.done && !s.records.pending()
 }
 
-func (s *ScanExec) Next() (*result.Record, error) {
-	_, v, err := s.nextKV()
-	return v, err
+type IndexLookupExec struct {
+	lookup  *plan.IndexLookup
+	driver  store.Driver
+	context *context.Context
+	rows    rowFetcher
+	started bool
+	done    bool
+	dec     *rowDecoder
+	chk     *result.Chunk
+	records chunkRecords
 }
 
-func (s *ScanExec) nextKV() (string, *result.Record, error) {
-	var key []byte
-	var exist bool
-	var err error
+func (s *IndexLookupExec) Columns() ([]*store.ColumnInfo, error) {
+	return fieldsColumnInfo(s.context, s.lookup.From, "", s.lookup.Fields)
+}
 
-	for {
-		key, exist, err = s.nextKey()
+// entry reads the primary keys of the rows the index entry holds
+func (s *IndexLookupExec) entry() error {
+	l := s.lookup
+	key := l.From.IndexPrefix(l.Index)
+	for _, v := range l.Values {
+		d, err := valueToDatum(v)
 		if err != nil {
-			return "", nil, err
-		}
-		if !exist {
-			return "", nil, nil
+			return err
 		}
-
-		if key != nil {
-			break
+		raw, err := util.DumpValueToRaw(d)
+		if err != nil {
+			return err
 		}
+		key += util.ToString(raw)
 	}
 
-	// Get and parse one row
-	var raw string
-	var dm map[int]*util.Datum
-	raw, err = s.driver.GetUserRecord(util.ToString(key))
+	value, err := s.driver.GetUserRecord(key)
+	if err == store.Nil {
+		return nil
+	}
 	if err != nil {
-		return "", nil, err
+		return err
 	}
-	dm, err = parseColumnValue(raw, s.scan.From.ColumnMap)
+	pks, err := decodeIndexValue(value)
 	if err != nil {
-		return "", nil, err
+		return err
 	}
+	s.rows.reset(s.driver, pks)
+	return nil
+}
 
-	var datums []*util.Datum = make([]*util.Datum, 0)
-	var d *util.Datum
-	for _, f := range s.scan.Fields {
-		switch f.Type {
-		case parser.ETARGET:
-			var ok bool
-			d, ok = dm[f.FieldID-1]
-			if !ok {
-				return "", nil, errors.New("parse column value error!")
-			}
-		case parser.ESYSVAR:
-			d = &util.Datum{}
-			sv := context.GetSysVar(f.SysVar)
-			if sv == nil {
-				return "", nil, errors.New("unsupport sysvar @@" + f.SysVar)
-			}
-			d.SetK(util.KindString)
-			d.SetB(util.ToSlice(sv.Name))
-		case parser.EVALUE:
-			var err error
-			d, err = valueToDatum(f.Value)
-			if err != nil {
-				return "", nil, err
-			}
+func (s *IndexLookupExec) Next() (*result.Record, error) {
+	return s.records.next(s.NextChunk)
+}
+
+func (s *IndexLookupExec) nextRow() (string, bool, error) {
+	if !s.started {
+		s.started = true
+		if err := s.entry(); err != nil {
+			return "", false, err
 		}
-		datums = append(datums, d)
 	}
+	if s.done {
+		return "", false, nil
+	}
+	_, raw, ok, err := s.rows.next(0)
+	if err == nil && !ok {
+		s.done = true
+	}
+	return raw, ok, err
+}
+
+func (s *IndexLookupExec) NextChunk() (*result.Chunk, error) {
+	if s.chk == nil {
+		dec, err := newRowDecoder(s.lookup.From, s.lookup.Columns, s.lookup.Fields)
+		if err != nil {
+			return nil, err
+		}
+		s.dec, s.chk = dec, result.NewChunk(len(s.lookup.Fields))
+	}
+	return fillChunk(s.context, s.chk, s.dec, s.nextRow)
+}
 
-	return util.ToString(key), &result.Record{Datums: datums}, nil
+func (s *IndexLookupExec) Done() bool {
+	return s.done && !s.records.pending()
 }
 
-func (s *ScanExec) Done() bool {
-	return s.done
+// orderedDriver gives the driver as an OrderedDriver when it is one
+func orderedDriver(driver store.Driver) (store.OrderedDriver, bool) {
+	if _, ok := baseDriver(driver).(store.OrderedDriver); !ok {
+		return nil, false
+	}
+	od, ok := driver.(store.OrderedDriver)
+	return od, ok
 }
 
-type ScanWithPKExec struct {
-	scanpk  *plan.ScanWithPK
+/*
+ * RangeScanExec reads the rows of a range of primary keys, which are the
+ * keys from start to before end. A driver keeping its keys in order is
+ * asked for the range a batch at a time. Other drivers are scanned for
+ * the keys of the table, and only the rows of the keys in the range are
+ * got.
+ */
+type RangeScanExec struct {
+	scan    *plan.RangeScan
 	driver  store.Driver
 	context *context.Context
+	start   string
+	end     string
+	// the rows of an ordered driver, other drivers fill rows
+	keys    []string
+	values  []string
+	pos     int
+	rows    rowFetcher
+	cursor  uint64
+	started bool
+	last    bool
 	done    bool
+	dec     *rowDecoder
+	chk     *result.Chunk
+	records chunkRecords
 }
 
-func (s *ScanWithPKExec) Columns() ([]*store.ColumnInfo, error) {
-	ret := []*store.ColumnInfo{}
-	for _, f := range s.scanpk.Fields {
-		ci := &store.ColumnInfo{}
-		switch f.Type {
-		case parser.ETARGET:
-			st := strings.Split(s.scanpk.From.Name, ".")
-			ci.Schema = st[0]
-			ci.Table = st[1]
-			ci.OrgTable = st[1]
-			ci.Name = s.scanpk.From.ColumnMap[f.FieldID-1].Name
-			ci.OrgName = s.scanpk.From.ColumnMap[f.FieldID-1].Name
-			switch s.scanpk.From.ColumnMap[f.FieldID-1].Type.(type) {
-			case *parser.IntType:
-				ci.Type = mysql.TypeLong
-				ci.ColumnLength = 4
-			case *parser.StringType:
-				ci.Type = mysql.TypeString
-			}
-			if s.scanpk.From.ColumnMap[f.FieldID-1].Nullable == parser.NotNull {
-				ci.Flag |= mysql.NotNullFlag
-			}
-			if s.scanpk.From.ColumnMap[f.FieldID-1].PrimaryKey {
-				ci.Flag |= mysql.PriKeyFlag
-			}
-			if s.scanpk.From.ColumnMap[f.FieldID-1].Unique {
-				ci.Flag |= mysql.UniqueKeyFlag
-			}
-			ret = append(ret, ci)
-		case parser.ESYSVAR:
-			ci.Schema = s.context.GetCurrentDB()
-			ci.Table = "dual"
-			ci.OrgTable = "dual"
-			ci.Name = f.SysVar
-			ci.OrgName = f.SysVar
-			ci.Type = uint8(mysql.TypeString)
-			ret = append(ret, ci)
-		case parser.EVALUE:
-			ci.Schema = s.context.GetCurrentDB()
-			ci.Table = "dual"
-			ci.OrgTable = "dual"
-			ci.Name = "EXPRESSION"
-			ci.OrgName = "EXPRESSION"
-			switch f.Value.(type) {
-			case int64:
-				ci.Type = uint8(mysql.TypeLong)
-				ci.ColumnLength = 4
-			case string:
-				ci.Type = mysql.TypeString
-			}
-			ret = append(ret, ci)
-		default:
-			return nil, errors.New("caluse error!")
+func (s *RangeScanExec) Columns() ([]*store.ColumnInfo, error) {
+	return fieldsColumnInfo(s.context, s.scan.From, "", s.scan.Fields)
+}
+
+func (s *RangeScanExec) bounds() error {
+	table := s.scan.From
+	s.start, s.end = table.RowPrefix(), table.RowsEnd()
+	if low := s.scan.Low; low != nil {
+		key, err := pkKey(table, low.Value)
+		if err != nil {
+			return err
+		}
+		// no key is between a key and the key followed by 0x00
+		s.start = key
+		if !low.Inclusive {
+			s.start += "\x00"
 		}
 	}
-
-	return ret, nil
+	if high := s.scan.High; high != nil {
+		key, err := pkKey(table, high.Value)
+		if err != nil {
+			return err
+		}
+		s.end = key
+		if high.Inclusive {
+			s.end += "\x00"
+		}
+	}
+	if s.start >= s.end {
+		s.last = true
+	}
+	return nil
 }
 
-func (s *ScanWithPKExec) Next() (*result.Record, error) {
-	if s.done {
-		return nil, nil
+// fetch reads the next batch of keys in the range
+func (s *RangeScanExec) fetch() error {
+	var err error
+	s.pos = 0
+	if od, ok := orderedDriver(s.driver); ok {
+		s.keys, s.values, err = od.SeekUserRecords(s.start, s.end, OnceScanCount)
+		if err != nil {
+			return err
+		}
+		if int64(len(s.keys)) < OnceScanCount {
+			s.last = true
+		} else {
+			s.start = s.keys[len(s.keys)-1] + "\x00"
+		}
+		return nil
 	}
 
-	var pk string
-	switch s.scanpk.PK.(type) {
-	case *parser.ComparisonQual:
-		r := s.scanpk.PK.(*parser.ComparisonQual).Right
-		switch r.Value.(type) {
-		case int64:
-			v := r.Value.(int64)
-			pk = util.ToString(util.DumpLengthEncodedInt(uint64(v)))
-		case string:
-			v := r.Value.(string)
-			pk = util.ToString(util.DumpLengthEncodedString(util.ToSlice(v)))
+	var keys, inRange []string
+	match := s.scan.From.RowPrefix() + "*"
+	keys, s.cursor, err = s.driver.ScanUserRecords(s.cursor, match, OnceScanCount)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key >= s.start && key < s.end {
+			inRange = append(inRange, key)
 		}
-		pk = store.UserFlag + s.scanpk.From.Name + "/" + pk
-	default:
-		return nil, errors.New("unsupport where clause now!")
 	}
+	s.rows.reset(s.driver, inRange)
+	s.last = s.cursor == 0
+	return nil
+}
 
-	// Get and parse one row
-	var dm map[int]*util.Datum
-	raw, err := s.driver.GetUserRecord(pk)
-	if err != nil {
-		return nil, err
+// row gives the next row of the last batch fetched, ok is false when
+// there are no more
+func (s *RangeScanExec) row() (raw string, ok bool, err error) {
+	if s.pos < len(s.keys) {
+		s.pos++
+		return s.values[s.pos-1], true, nil
 	}
-	dm, err = parseColumnValue(raw, s.scanpk.From.ColumnMap)
-	if err != nil {
-		return nil, err
+	_, raw, ok, err = s.rows.next(0)
+	return raw, ok, err
+}
+
+func (s *RangeScanExec) Next() (*result.Record, error) {
+	return s.records.next(s.NextChunk)
+}
+
+func (s *RangeScanExec) nextRow() (string, bool, error) {
+	if !s.started {
+		s.started = true
+		if err := s.bounds(); err != nil {
+			return "", false, err
+		}
 	}
 
-	var datums []*util.Datum = make([]*util.Datum, 0)
-	for _, f := range s.scanpk.Fields {
-		var d *util.Datum
-		switch f.Type {
-		case parser.ETARGET:
-			var ok bool
-			d, ok = dm[f.FieldID-1]
-			if !ok {
-				return nil, errors.New("parse column value error")
-			}
-		case parser.ESYSVAR:
-			d = &util.Datum{}
-			sv := context.GetSysVar(f.SysVar)
-			if sv == nil {
-				return nil, errors.New("unsupport sysvar @@" + f.SysVar)
-			}
-			d.SetK(util.KindString)
-			d.SetB(util.ToSlice(sv.Name))
-		case parser.EVALUE:
-			var err error
-			d, err = valueToDatum(f.Value)
-			if err != nil {
-				return nil, err
-			}
+	for !s.done {
+		raw, ok, err := s.row()
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return raw, true, nil
+		}
+		if s.last {
+			s.done = true
+			break
+		}
+		if err := s.fetch(); err != nil {
+			return "", false, err
 		}
-		datums = append(datums, d)
 	}
-	s.done = true
-	return &result.Record{Datums: datums}, nil
+	return "", false, nil
 }
 
-func (s *ScanWithPKExec) Done() bool {
-	return s.done
+func (s *RangeScanExec) NextChunk() (*result.Chunk, error) {
+	if s.chk == nil {
+		dec, err := newRowDecoder(s.scan.From, s.scan.Columns, s.scan.Fields)
+		if err != nil {
+			return nil, err
+		}
+		s.dec, s.chk = dec, result.NewChunk(len(s.scan.Fields))
+	}
+	return fillChunk(s.context, s.chk, s.dec, s.nextRow)
+}
+
+func (s *RangeScanExec) Done() bool {
+	return s.done && !s.records.pending()
 }
@@ -1,25 +1,36 @@
 package executor
 
 import (
+	"github.com/castermode/Nesoi/src/sql/parser"
 	"github.com/castermode/Nesoi/src/sql/plan"
 	"github.com/castermode/Nesoi/src/sql/result"
 	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
 )
 
 type SelectionExec struct {
 	filter   *plan.Qual
+	conds    []*parser.TargetRes
+	executor *Executor
 	children []result.Result
 	done     bool
+	source   chunkSource
+	// the rows kept, a condition reads from one and writes to the other
+	bufs    [2]*result.Chunk
+	records chunkRecords
 }
 
 func NewSelectionExec(s *plan.Selection, e *Executor) *SelectionExec {
 	selExec := &SelectionExec{
-		filter: s.Filter,
+		filter:   s.Filter,
+		conds:    s.Conds,
+		executor: e,
 	}
 
 	for _, p := range s.GetChildren() {
 		selExec.children = append(selExec.children, makePlanExec(p, e))
 	}
+	selExec.source.r = selExec.children[0]
 
 	return selExec
 }
@@ -29,32 +40,85 @@ func (s *SelectionExec) Columns() ([]*store.ColumnInfo, error) {
 }
 
 func (s *SelectionExec) Next() (*result.Record, error) {
-	if s.done {
-		return nil, nil
+	return s.records.next(s.NextChunk)
+}
+
+func (s *SelectionExec) NextChunk() (*result.Chunk, error) {
+	for !s.done {
+		chk, err := s.source.next()
+		if err != nil {
+			return nil, err
+		}
+		if chk == nil {
+			s.done = true
+			break
+		}
+
+		chk, err = s.match(chk)
+		if err != nil {
+			return nil, err
+		}
+		if chk.NumRows() > 0 {
+			return chk, nil
+		}
 	}
+	return nil, nil
+}
 
-	v, err := valueToDatum(s.filter.Value)
+// matchQual tells whether a row of all the table columns passes the filter
+func matchQual(q *plan.Qual, row []*util.Datum) (bool, error) {
+	v, err := valueToDatum(q.Value)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	return v.Equal(row[q.Pos-1]), nil
+}
+
+// buffer gives the buffer chk isn't
+func (s *SelectionExec) buffer(chk *result.Chunk) *result.Chunk {
+	i := 0
+	if chk == s.bufs[0] {
+		i = 1
+	}
+	if s.bufs[i] == nil {
+		s.bufs[i] = result.NewChunk(len(chk.Columns))
+	}
+	return s.bufs[i]
+}
 
-	for {
-		r, err := s.children[0].Next()
+// match gives the rows of chk that pass the filter and all the conditions,
+// a condition is only evaluated on the rows the ones before it passed
+func (s *SelectionExec) match(chk *result.Chunk) (*result.Chunk, error) {
+	keep := make([]bool, chk.NumRows())
+	if s.filter != nil {
+		v, err := valueToDatum(s.filter.Value)
 		if err != nil {
 			return nil, err
 		}
-
-		if r == nil {
-			s.done = true
-			return nil, nil
+		col := chk.Columns[s.filter.Pos-1]
+		for i := range keep {
+			keep[i] = equalAt(col, i, v)
 		}
+		return keepRows(chk, keep, s.buffer(chk)), nil
+	}
 
-		if v.Equal(r.Datums[s.filter.Pos-1]) {
-			return r, nil
+	for _, cond := range s.conds {
+		if chk.NumRows() == 0 {
+			break
+		}
+		col, err := evalColumn(s.executor, cond, chk)
+		if err != nil {
+			return nil, err
+		}
+		keep = keep[:chk.NumRows()]
+		for i := range keep {
+			keep[i] = isTrueAt(col, i)
 		}
+		chk = keepRows(chk, keep, s.buffer(chk))
 	}
+	return chk, nil
 }
 
 func (s *SelectionExec) Done() bool {
-	return s.done
+	return s.done && !s.records.pending()
 }
@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"strconv"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// executeSet sets the system variables of a SET statement, all of them are
+// checked before any is set. A global value is stored for the sessions
+// started after it, on every node, and for every session at once when the
+// variable is of GLOBAL scope only.
+func (executor *Executor) executeSet(query *parser.SetQuery) error {
+	values := make([]string, 0, len(query.Variables))
+	for _, v := range query.Variables {
+		d, err := evalTarget(executor, v.Value, nil)
+		if err != nil {
+			return err
+		}
+		text, err := util.DumpValueToText(d)
+		if err != nil {
+			return mysql.NewErrf(mysql.ErrWrongValueForVar, "Variable '%s' can't be set to the value of 'NULL'", v.Name)
+		}
+		value, err := context.GetSysVar(v.Name).Validate(string(text))
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+
+	for i, v := range query.Variables {
+		if !v.IsGlobal {
+			executor.context.SetSessionVar(v.Name, values[i])
+			continue
+		}
+		if err := parser.StoreGlobalVar(executor.driver, v.Name, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanWorkers gives the number of workers a table scan of the session
+// reads its rows with
+func scanWorkers(ctx *context.Context) int {
+	value, _ := ctx.SysVarValue(context.ScanWorkers)
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
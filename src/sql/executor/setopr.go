@@ -0,0 +1,141 @@
+package executor
+
+import (
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+type SetOprExec struct {
+	setopr   *plan.SetOpr
+	children []result.Result
+	// child UNION is reading
+	pos int
+	// rows already returned, for the operations without ALL
+	seen map[string]bool
+	// counts of the rows of the second child, read on the first Next of
+	// INTERSECT and EXCEPT
+	right map[string]int
+	done  bool
+}
+
+func NewSetOprExec(s *plan.SetOpr, e *Executor) *SetOprExec {
+	sExec := &SetOprExec{
+		setopr: s,
+		seen:   make(map[string]bool),
+	}
+
+	for _, p := range s.GetChildren() {
+		sExec.children = append(sExec.children, makePlanExec(p, e))
+	}
+
+	return sExec
+}
+
+// Columns are described by the left side, in the kinds of the result
+func (s *SetOprExec) Columns() ([]*store.ColumnInfo, error) {
+	cis, err := s.children[0].Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*store.ColumnInfo, 0, len(cis))
+	for i, ci := range cis {
+		c := *ci
+		if k := s.setopr.Fields[i].RetType; columnInfoKind(&c) != k {
+			setColumnKind(&c, k)
+		}
+		ret = append(ret, &c)
+	}
+	return ret, nil
+}
+
+// next reads a row of a child converted to the kinds of the result
+func (s *SetOprExec) next(child int) (*result.Record, error) {
+	r, err := s.children[child].Next()
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	c := &result.Record{}
+	for i, d := range r.Datums {
+		c.Datums = append(c.Datums, d.Convert(s.setopr.Fields[i].RetType))
+	}
+	return c, nil
+}
+
+func (s *SetOprExec) Next() (*result.Record, error) {
+	if s.done {
+		return nil, nil
+	}
+
+	if s.setopr.Op == parser.SetUnion {
+		for s.pos < len(s.children) {
+			r, err := s.next(s.pos)
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				s.pos++
+				continue
+			}
+			if !s.setopr.All {
+				key := hashRow(r.Datums)
+				if s.seen[key] {
+					continue
+				}
+				s.seen[key] = true
+			}
+			return r, nil
+		}
+		s.done = true
+		return nil, nil
+	}
+
+	if s.right == nil {
+		s.right = make(map[string]int)
+		for {
+			r, err := s.next(1)
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				break
+			}
+			s.right[hashRow(r.Datums)]++
+		}
+	}
+
+	for {
+		r, err := s.next(0)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			s.done = true
+			return nil, nil
+		}
+
+		key := hashRow(r.Datums)
+		if !s.setopr.All {
+			if s.seen[key] {
+				continue
+			}
+			s.seen[key] = true
+		}
+
+		// with ALL a row of the right side cancels one row of the left
+		matched := s.right[key] > 0
+		if matched && s.setopr.All {
+			s.right[key]--
+		}
+		if matched == (s.setopr.Op == parser.SetIntersect) {
+			return r, nil
+		}
+	}
+}
+
+func (s *SetOprExec) Done() bool {
+	return s.done
+}
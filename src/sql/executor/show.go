@@ -2,6 +2,9 @@ package executor
 
 import (
 	"errors"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/castermode/Nesoi/src/sql/context"
 	"github.com/castermode/Nesoi/src/sql/mysql"
@@ -117,3 +120,269 @@ func (s *ShowExec) Next() (*result.Record, error) {
 func (s *ShowExec) Done() bool {
 	return s.done
 }
+
+type ShowJobsExec struct {
+	context *context.Context
+	driver  store.Driver
+	jobs    []*DDLJob
+	pos     int
+	loaded  bool
+	done    bool
+}
+
+func (s *ShowJobsExec) Columns() ([]*store.ColumnInfo, error) {
+	ret := []*store.ColumnInfo{}
+	names := []string{"JOB_ID", "JOB_TYPE", "TABLE_NAME", "INDEX_NAME", "SCHEMA_STATE", "STATE", "ROW_COUNT", "START_TIME", "ERROR"}
+	for _, name := range names {
+		ci := &store.ColumnInfo{
+			Schema:   s.context.GetCurrentDB(),
+			Table:    "dual",
+			OrgTable: "dual",
+			Name:     name,
+			OrgName:  name,
+			Type:     mysql.TypeString,
+		}
+		if name == "JOB_ID" || name == "ROW_COUNT" {
+			ci.Type = mysql.TypeLonglong
+		}
+		ret = append(ret, ci)
+	}
+
+	return ret, nil
+}
+
+func stringDatum(s string) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(util.KindString)
+	d.SetB(util.ToSlice(s))
+	return d
+}
+
+func intDatum(i int64) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(util.KindInt64)
+	d.SetI(i)
+	return d
+}
+
+func (s *ShowJobsExec) Next() (*result.Record, error) {
+	if s.done {
+		return nil, nil
+	}
+
+	if !s.loaded {
+		var err error
+		s.jobs, err = loadJobs(s.driver)
+		if err != nil {
+			return nil, err
+		}
+		s.loaded = true
+	}
+
+	if s.pos >= len(s.jobs) {
+		s.done = true
+		return nil, nil
+	}
+	job := s.jobs[s.pos]
+	s.pos++
+
+	schemaState := "none"
+	if job.State == JobDone {
+		schemaState = parser.IndexStateName(parser.IndexPublic)
+	} else if job.State == JobRunning && job.Index != "" {
+		idx, err := parser.LoadIndexInfo(s.driver, job.Index)
+		if err == nil {
+			schemaState = parser.IndexStateName(idx.State)
+		} else if err != store.Nil {
+			return nil, err
+		}
+	}
+
+	datums := []*util.Datum{
+		intDatum(job.ID),
+		stringDatum(job.TypeName()),
+		stringDatum(job.Table),
+		stringDatum(job.Index),
+		stringDatum(schemaState),
+		stringDatum(job.StateName()),
+		intDatum(job.RowCount),
+		stringDatum(time.Unix(job.StartTime, 0).Format("2006-01-02 15:04:05")),
+		stringDatum(job.Error),
+	}
+
+	return &result.Record{Datums: datums}, nil
+}
+
+func (s *ShowJobsExec) Done() bool {
+	return s.done
+}
+
+type ShowWarningsExec struct {
+	context *context.Context
+	pos     int
+	done    bool
+}
+
+func (s *ShowWarningsExec) Columns() ([]*store.ColumnInfo, error) {
+	ret := []*store.ColumnInfo{}
+	names := []string{"Level", "Code", "Message"}
+	for _, name := range names {
+		ci := &store.ColumnInfo{
+			Schema:   s.context.GetCurrentDB(),
+			Table:    "dual",
+			OrgTable: "dual",
+			Name:     name,
+			OrgName:  name,
+			Type:     mysql.TypeString,
+		}
+		if name == "Code" {
+			ci.Type = mysql.TypeLonglong
+		}
+		ret = append(ret, ci)
+	}
+
+	return ret, nil
+}
+
+func (s *ShowWarningsExec) Next() (*result.Record, error) {
+	warnings := s.context.Warnings()
+	if s.done || s.pos >= len(warnings) {
+		s.done = true
+		return nil, nil
+	}
+	w := warnings[s.pos]
+	s.pos++
+
+	datums := []*util.Datum{
+		stringDatum(w.Level),
+		intDatum(int64(w.Code)),
+		stringDatum(w.Message),
+	}
+	return &result.Record{Datums: datums}, nil
+}
+
+func (s *ShowWarningsExec) Done() bool {
+	return s.done
+}
+
+/*
+ * ShowVariablesExec lists the system variables by name. The session values
+ * are the ones the session reads, the GLOBAL ones are read from the storage
+ * when the statement starts, and leave out the variables of SESSION scope.
+ */
+type ShowVariablesExec struct {
+	context *context.Context
+	driver  store.Driver
+	global  bool
+	pattern string
+	names   []string
+	values  []string
+	started bool
+	pos     int
+	done    bool
+}
+
+func (s *ShowVariablesExec) Columns() ([]*store.ColumnInfo, error) {
+	ret := []*store.ColumnInfo{}
+	for _, name := range []string{"Variable_name", "Value"} {
+		ret = append(ret, &store.ColumnInfo{
+			Schema:   s.context.GetCurrentDB(),
+			Table:    "dual",
+			OrgTable: "dual",
+			Name:     name,
+			OrgName:  name,
+			Type:     mysql.TypeString,
+		})
+	}
+
+	return ret, nil
+}
+
+// the variables of GLOBAL scope only show their global values, read now
+// like those of SHOW GLOBAL VARIABLES
+func (s *ShowVariablesExec) start() error {
+	globals, err := parser.LoadGlobalVars(s.driver)
+	if err != nil {
+		return err
+	}
+
+	for name, sv := range context.SysVars {
+		if s.pattern != "" && !likeMatch(s.pattern, name) {
+			continue
+		}
+		if s.global && sv.Scope&context.ScopeGlobal == 0 {
+			continue
+		}
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	for _, name := range s.names {
+		value, _ := s.context.SysVarValue(name)
+		if s.global || context.SysVars[name].Scope == context.ScopeGlobal {
+			value = context.SysVars[name].Value
+			if v, ok := globals[name]; ok {
+				value = v
+			}
+		}
+		s.values = append(s.values, value)
+	}
+	return nil
+}
+
+func (s *ShowVariablesExec) Next() (*result.Record, error) {
+	if !s.started {
+		s.started = true
+		if err := s.start(); err != nil {
+			s.done = true
+			return nil, err
+		}
+	}
+	if s.done || s.pos >= len(s.names) {
+		s.done = true
+		return nil, nil
+	}
+	i := s.pos
+	s.pos++
+
+	datums := []*util.Datum{stringDatum(s.names[i]), stringDatum(s.values[i])}
+	return &result.Record{Datums: datums}, nil
+}
+
+func (s *ShowVariablesExec) Done() bool {
+	return s.done
+}
+
+// likeMatch tells whether s matches the LIKE pattern, % matching any
+// characters and _ one, \ escaping them, without regard to case
+func likeMatch(pattern string, s string) bool {
+	p, t := []rune(strings.ToLower(pattern)), []rune(strings.ToLower(s))
+	for len(p) > 0 {
+		switch {
+		case p[0] == '%':
+			for len(p) > 0 && p[0] == '%' {
+				p = p[1:]
+			}
+			if len(p) == 0 {
+				return true
+			}
+			for i := 0; i <= len(t); i++ {
+				if likeMatch(string(p), string(t[i:])) {
+					return true
+				}
+			}
+			return false
+		case len(t) == 0:
+			return false
+		case p[0] == '_':
+		case p[0] == '\\' && len(p) > 1:
+			p = p[1:]
+			if p[0] != t[0] {
+				return false
+			}
+		case p[0] != t[0]:
+			return false
+		}
+		p, t = p[1:], t[1:]
+	}
+	return len(t) == 0
+}
@@ -0,0 +1,132 @@
+package executor
+
+import (
+	"sort"
+
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+type SortExec struct {
+	byItems  []*parser.SortItem
+	executor *Executor
+	children []result.Result
+	// rows of the child in order, read on the first Next
+	rows []*result.Record
+	pos  int
+	done bool
+}
+
+func NewSortExec(s *plan.Sort, e *Executor) *SortExec {
+	sExec := &SortExec{
+		byItems:  s.ByItems,
+		executor: e,
+	}
+
+	for _, p := range s.GetChildren() {
+		sExec.children = append(sExec.children, makePlanExec(p, e))
+	}
+
+	return sExec
+}
+
+func (s *SortExec) Columns() ([]*store.ColumnInfo, error) {
+	return s.children[0].Columns()
+}
+
+// compareKeys orders nulls first, as MySQL does
+func compareKeys(a *util.Datum, b *util.Datum) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	}
+	return expression.Compare(a, b)
+}
+
+func (s *SortExec) fetch() error {
+	var keys [][]*util.Datum
+	for {
+		r, err := s.children[0].Next()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+
+		key := make([]*util.Datum, 0, len(s.byItems))
+		for _, item := range s.byItems {
+			d, err := evalTarget(s.executor, item.Key, r.Datums)
+			if err != nil {
+				return err
+			}
+			key = append(key, d)
+		}
+		s.rows = append(s.rows, r)
+		keys = append(keys, key)
+	}
+
+	sort.Stable(&sortRows{rows: s.rows, keys: keys, byItems: s.byItems})
+	return nil
+}
+
+func (s *SortExec) Next() (*result.Record, error) {
+	if s.done {
+		return nil, nil
+	}
+
+	if s.rows == nil {
+		if err := s.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.pos >= len(s.rows) {
+		s.done = true
+		return nil, nil
+	}
+	r := s.rows[s.pos]
+	s.pos++
+	return r, nil
+}
+
+func (s *SortExec) Done() bool {
+	return s.done
+}
+
+type sortRows struct {
+	rows    []*result.Record
+	keys    [][]*util.Datum
+	byItems []*parser.SortItem
+}
+
+func (s *sortRows) Len() int {
+	return len(s.rows)
+}
+
+func (s *sortRows) Less(i, j int) bool {
+	for k, item := range s.byItems {
+		c := compareKeys(s.keys[i][k], s.keys[j][k])
+		if c == 0 {
+			continue
+		}
+		if item.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+func (s *sortRows) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
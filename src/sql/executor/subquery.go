@@ -0,0 +1,179 @@
+package executor
+
+import (
+	"errors"
+
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/plan"
+	"github.com/castermode/Nesoi/src/sql/result"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+type subquery struct {
+	plan plan.Plan
+	// rows of an uncorrelated subquery, which runs only once
+	rows []*result.Record
+	done bool
+}
+
+/*
+ * subqueryRows runs a subquery for a row of the query it appears in and
+ * returns at most max of its rows, 0 means all. A correlated subquery runs
+ * again for every row with the row pushed on the outer rows, so its
+ * columns of the enclosing queries are taken from there.
+ */
+func (e *Executor) subqueryRows(q *parser.SelectQuery, row []*util.Datum, max int) ([]*result.Record, error) {
+	if e.subqueries == nil {
+		e.subqueries = make(map[*parser.SelectQuery]*subquery)
+	}
+	sq, ok := e.subqueries[q]
+	if !ok {
+		p, err := plan.Optimize(q)
+		if err != nil {
+			return nil, err
+		}
+		sq = &subquery{plan: p}
+		e.subqueries[q] = sq
+	}
+	if sq.done {
+		return sq.rows, nil
+	}
+
+	sub := *e
+	sub.outer = append(e.outer[:len(e.outer):len(e.outer)], row)
+	rs := makePlanExec(sq.plan, &sub)
+	var rows []*result.Record
+	for max == 0 || len(rows) < max {
+		r, err := rs.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			break
+		}
+		rows = append(rows, r)
+	}
+
+	if !q.Correlated {
+		sq.rows = rows
+		sq.done = true
+	}
+	return rows, nil
+}
+
+func evalSubquery(e *Executor, f *parser.TargetRes, row []*util.Datum) (*util.Datum, error) {
+	switch f.Type {
+	case parser.ESUBQUERY:
+		rows, err := e.subqueryRows(f.Sub, row, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 1 {
+			return nil, errors.New("Subquery returns more than 1 row")
+		}
+		if len(rows) == 0 {
+			return valueToDatum(nil)
+		}
+		return rows[0].Datums[0], nil
+	case parser.EEXISTS:
+		rows, err := e.subqueryRows(f.Sub, row, 1)
+		if err != nil {
+			return nil, err
+		}
+		return valueToDatum(int64(len(rows)))
+	case parser.EINSUBQUERY:
+		v, err := evalTarget(e, f.Args[0], row)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := e.subqueryRows(f.Sub, row, 0)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]*util.Datum, 0, len(rows))
+		for _, r := range rows {
+			values = append(values, r.Datums[0])
+		}
+		return expression.In(v, values), nil
+	}
+
+	return nil, errors.New("caluse error!")
+}
+
+type SemiJoinExec struct {
+	join     *plan.SemiJoin
+	executor *Executor
+	children []result.Result
+	// keys of the rows of the second child, read on the first Next
+	keys map[string]bool
+	done bool
+}
+
+func NewSemiJoinExec(j *plan.SemiJoin, e *Executor) *SemiJoinExec {
+	jExec := &SemiJoinExec{
+		join:     j,
+		executor: e,
+	}
+
+	for _, p := range j.GetChildren() {
+		jExec.children = append(jExec.children, makePlanExec(p, e))
+	}
+
+	return jExec
+}
+
+func (j *SemiJoinExec) Columns() ([]*store.ColumnInfo, error) {
+	return j.children[0].Columns()
+}
+
+func (j *SemiJoinExec) Next() (*result.Record, error) {
+	if j.done {
+		return nil, nil
+	}
+
+	if j.keys == nil {
+		j.keys = make(map[string]bool)
+		for {
+			r, err := j.children[1].Next()
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				break
+			}
+			if key, ok := hashKey(r.Datums); ok {
+				j.keys[key] = true
+			}
+		}
+	}
+
+	for {
+		r, err := j.children[0].Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			j.done = true
+			return nil, nil
+		}
+
+		datums := make([]*util.Datum, 0, len(j.join.OuterKeys))
+		for _, k := range j.join.OuterKeys {
+			d, err := evalTarget(j.executor, k, r.Datums)
+			if err != nil {
+				return nil, err
+			}
+			datums = append(datums, d)
+		}
+		key, ok := hashKey(datums)
+		if (ok && j.keys[key]) != j.join.Anti {
+			return r, nil
+		}
+	}
+}
+
+func (j *SemiJoinExec) Done() bool {
+	return j.done
+}
@@ -0,0 +1,184 @@
+package executor
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+	"github.com/golang/glog"
+)
+
+/*
+ * the key layout of the store is recorded as:
+ *		/SYSTEM/VERSION		StoreVersion
+ * stores without it were written before tables had ids:
+ *		/USER/tblName/ + Encoded Primary key
+ *		/USER/idxName/ + Encoded Field Value + ...
+ * UpgradeStore assigns the ids and moves the data to the current layout
+ * before the server accepts clients. The id given to a table is kept
+ * under /SYSTEM/UPGRADE/tblName until the table is done, so an
+ * interrupted upgrade resumes with the same id. Every row is moved to
+ * its ordered key with its index entries written first, the old index
+ * entries are dropped once no old row is left, so that is resumed too.
+ */
+const StoreVersion = 1
+
+func UpgradeStore(driver store.Driver) error {
+	vkey := store.SystemFlag + store.VersionFlag
+	value, err := driver.GetSysRecord(vkey)
+	if err == nil {
+		version, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if version > StoreVersion {
+			return errors.New("store version " + value + " is newer than the server!")
+		}
+		return nil
+	} else if err != store.Nil {
+		return err
+	}
+
+	glog.Info("Upgrade store to version ", StoreVersion)
+	err = upgradeDatabases(driver)
+	if err != nil {
+		return err
+	}
+
+	var tables []string
+	err = forEachSysKey(driver, parser.TableKey("*"), func(key string) error {
+		name := key[len(parser.TableKey("")):]
+		// index lookup keys share the table prefix
+		if !strings.HasPrefix(name, store.IndexFlag) {
+			tables = append(tables, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, tblName := range tables {
+		err = upgradeTable(driver, tblName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return driver.SetSysRecord(vkey, strconv.Itoa(StoreVersion), 0)
+}
+
+func upgradeDatabases(driver store.Driver) error {
+	return forEachSysKey(driver, store.SystemFlag+store.DBFlag+"*", func(key string) error {
+		value, err := driver.GetSysRecord(key)
+		if err != nil || value != "" {
+			return err
+		}
+		id, err := parser.AllocDatabaseID(driver)
+		if err != nil {
+			return err
+		}
+		return driver.SetSysRecord(key, strconv.FormatInt(id, 10), 0)
+	})
+}
+
+func upgradeTable(driver store.Driver, tblName string) error {
+	table, err := parser.LoadTableInfo(driver, tblName)
+	if err != nil {
+		return err
+	}
+	ukey := store.SystemFlag + store.UpgradeFlag + tblName
+	// saved with its id by an interrupted upgrade
+	if table.ID != 0 {
+		return driver.DelSysRecord(ukey)
+	}
+	idxs, err := parser.TableIndexes(driver, tblName)
+	if err != nil {
+		return err
+	}
+
+	value, err := driver.GetSysRecord(ukey)
+	if err == store.Nil {
+		table.ID, err = parser.AllocTableID(driver)
+		if err != nil {
+			return err
+		}
+		err = driver.SetSysRecord(ukey, strconv.FormatInt(table.ID, 10), 0)
+	} else if err == nil {
+		table.ID, err = strconv.ParseInt(value, 10, 64)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range idxs {
+		if idx.ID != 0 {
+			continue
+		}
+		idx.ID, err = parser.AllocIndexID(driver)
+		if err != nil {
+			return err
+		}
+		err = parser.SaveIndexInfo(driver, idx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the old index entries hold the old keys of the rows, they are
+	// written again from the rows
+	err = forEachUserKey(driver, store.UserFlag+tblName+"/*", func(key string) error {
+		raw, err := driver.GetUserRecord(key)
+		if err == store.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dm, err := decodeRow(raw, table)
+		if err != nil {
+			return err
+		}
+		datums := make([]*util.Datum, len(dm))
+		for i, d := range dm {
+			datums[i] = d
+		}
+		pk, err := rowKey(table, datums)
+		if err != nil {
+			return err
+		}
+		for _, idx := range idxs {
+			ik, err := indexKey(idx, table, datums)
+			if err != nil {
+				return err
+			}
+			err = WriteIndexInfo(driver, idx.Unique, ik, pk)
+			if err != nil {
+				return err
+			}
+		}
+		err = driver.SetUserRecord(pk, raw, 0)
+		if err != nil {
+			return err
+		}
+		return driver.DelUserRecord(key)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range idxs {
+		err = deleteUserKeys(driver, store.UserFlag+idx.Name+"/*")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = parser.SaveTableInfo(driver, table)
+	if err != nil {
+		return err
+	}
+	return driver.DelSysRecord(ukey)
+}
@@ -0,0 +1,147 @@
+package executor
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func lenencInt(v uint64) string {
+	return util.ToString(util.DumpLengthEncodedInt(v))
+}
+
+func lenencString(s string) string {
+	return util.ToString(util.DumpLengthEncodedString([]byte(s)))
+}
+
+/*
+ * seedBaseline writes the table Nesoi.t (id int primary key, g int,
+ * s string) with the index ig on g and n rows, the way the server wrote
+ * them before tables had ids.
+ */
+func seedBaseline(d *testDriver, n int) {
+	d.data[store.SystemFlag+store.TableFlag+"Nesoi.t"] = `[{"Name":"id","Pos":1,"Type":0,"PrimaryKey":true},` +
+		`{"Name":"g","Pos":2,"Type":0},{"Name":"s","Pos":3,"Type":1}]`
+	fields := lenencInt(1) + lenencInt(2)
+	d.data[store.SystemFlag+store.IndexFlag+store.TableFlag+"Nesoi.ig"] = "0" + lenencString("Nesoi.t") + fields
+	d.data[store.SystemFlag+store.TableFlag+store.IndexFlag+"Nesoi.t"+fields] = "Nesoi.ig"
+	byG := map[uint64][]string{}
+	for i := uint64(1); i <= uint64(n); i++ {
+		key := store.UserFlag + "Nesoi.t/" + lenencInt(i)
+		d.data[key] = "1" + lenencInt(i) + "1" + lenencInt(i%3) + "1" + lenencString("s"+strconv.FormatUint(i, 10))
+		byG[i%3] = append(byG[i%3], key)
+	}
+	for g, keys := range byG {
+		d.data[store.UserFlag+"Nesoi.ig/"+lenencInt(g)] = encodeIndexValue(keys)
+	}
+}
+
+// checkUpgraded checks no old key is left and the rows are read by key and by index
+func checkUpgraded(t *testing.T, d *testDriver, n int) {
+	for key := range d.data {
+		if strings.HasPrefix(key, store.UserFlag+"Nesoi.") || strings.HasPrefix(key, store.SystemFlag+store.UpgradeFlag) {
+			t.Fatalf("key %q left by the upgrade", key)
+		}
+	}
+	if v := d.data[store.SystemFlag+store.VersionFlag]; v != strconv.Itoa(StoreVersion) {
+		t.Fatalf("store version %q", v)
+	}
+
+	e := NewExecutor(d, context.NewContext())
+	defer e.Close()
+	if got := queryRows(t, e, "select id from t"); len(got) != n {
+		t.Fatalf("%d rows after the upgrade", len(got))
+	}
+	got := strings.Join(queryRows(t, e, "select * from t where id = 7"), "\n")
+	if got != "7 1 s7" {
+		t.Fatalf("row by key: %q", got)
+	}
+	got = strings.Join(queryRows(t, e, "explain select id from t where g = 2 and id < 12"), "\n")
+	if !strings.Contains(got, "ig") {
+		t.Fatalf("index not used:\n%s", got)
+	}
+	got = strings.Join(queryRows(t, e, "select id from t where g = 2 and id < 12"), " ")
+	if got != "11 2 5 8" {
+		t.Fatalf("rows by index: %q", got)
+	}
+}
+
+func TestUpgradeStore(t *testing.T) {
+	d := newTestDriver()
+	seedBaseline(d, 100)
+	if err := UpgradeStore(d); err != nil {
+		t.Fatal(err)
+	}
+	checkUpgraded(t, d, 100)
+
+	// an upgraded store is left as it is
+	before := len(d.data)
+	if err := UpgradeStore(d); err != nil || len(d.data) != before {
+		t.Fatalf("second upgrade: %v, %d keys from %d", err, len(d.data), before)
+	}
+}
+
+// failingDriver fails the user writes after left of them
+type failingDriver struct {
+	*testDriver
+	left int
+}
+
+var errInterrupted = errors.New("interrupted!")
+
+func (d *failingDriver) SetUserRecord(key string, value string, ttl int64) error {
+	if d.left == 0 {
+		return errInterrupted
+	}
+	d.left--
+	return d.testDriver.SetUserRecord(key, value, ttl)
+}
+
+func TestUpgradeStoreResume(t *testing.T) {
+	d := newTestDriver()
+	seedBaseline(d, 100)
+	if err := UpgradeStore(&failingDriver{testDriver: d, left: 50}); err != errInterrupted {
+		t.Fatalf("interrupted upgrade: %v", err)
+	}
+	id := d.data[store.SystemFlag+store.UpgradeFlag+"Nesoi.t"]
+	if id == "" {
+		t.Fatal("table id not kept by the interrupted upgrade")
+	}
+
+	if err := UpgradeStore(d); err != nil {
+		t.Fatal(err)
+	}
+	checkUpgraded(t, d, 100)
+	table, _ := parser.LoadTableInfo(d, "Nesoi.t")
+	if strconv.FormatInt(table.ID, 10) != id {
+		t.Fatalf("table id %d, %s given by the interrupted upgrade", table.ID, id)
+	}
+}
+
+func TestUpgradeStoreAlter(t *testing.T) {
+	d := newTestDriver()
+	seedBaseline(d, 10)
+	if err := UpgradeStore(d); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExecutor(d, context.NewContext())
+	defer e.Close()
+
+	// the moved rows keep their positional format
+	queryRows(t, e, "alter table t drop column s, add column c int")
+	queryRows(t, e, "insert into t values (11, 2, 5)")
+	got := strings.Join(queryRows(t, e, "select * from t where id < 3 or id > 9"), "\n")
+	if got != "1 1 NULL\n10 1 NULL\n11 2 5\n2 2 NULL" {
+		t.Fatalf("rows after alter:\n%s", got)
+	}
+	got = strings.Join(queryRows(t, e, "select id from t where g = 2"), " ")
+	if got != "11 2 5 8" {
+		t.Fatalf("rows by index after alter: %q", got)
+	}
+}
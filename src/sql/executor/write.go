@@ -2,8 +2,10 @@ package executor
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
 	"github.com/castermode/Nesoi/src/sql/parser"
 	"github.com/castermode/Nesoi/src/sql/plan"
 	"github.com/castermode/Nesoi/src/sql/result"
@@ -11,109 +13,761 @@ import (
 	"github.com/castermode/Nesoi/src/sql/util"
 )
 
+const (
+	OnceWriteCount int = 100
+)
+
+// a row as stored before the statement and as the statement leaves it,
+// either is nil when there is no row
+type pendingRow struct {
+	old     []*util.Datum
+	cur     []*util.Datum
+	changed bool
+}
+
+/*
+ * rowWriter keeps the rows a statement writes by their primary keys, so
+ * that a row sees what the rows before it did, and writes them when the
+ * statement is worked out. The rows are written in batches, and the index
+ * entries of all the rows after them, in batches too. The index list is
+ * loaded once, when the statement first needs it.
+ *
+ * the keys of the unique indexes are checked before anything is written,
+ * against the rows of the statement and the entries stored, so a
+ * statement that fails on a duplicate entry leaves no row behind.
+ */
+type rowWriter struct {
+	table  *parser.TableInfo
+	driver store.Driver
+	// the driver flush writes with, which the statement being killed
+	// doesn't stop between a row and its index entries
+	writer store.Driver
+	rows   map[string]*pendingRow
+	// primary keys in the order the rows are met
+	keys []string
+
+	// the indexes of the table and the unique ones writers maintain,
+	// loaded when first needed
+	idxs    []*parser.IndexInfo
+	uniques []*parser.IndexInfo
+	loaded  bool
+	// the primary keys of the stored entries of unique keys read so far
+	entries map[string][]string
+	// the primary keys of the rows of the statement given a unique key,
+	// a row may have left it since
+	byKey map[string][]string
+}
+
+func newRowWriter(table *parser.TableInfo, driver store.Driver) *rowWriter {
+	return &rowWriter{
+		table:   table,
+		driver:  driver,
+		writer:  uncancelled(driver),
+		rows:    make(map[string]*pendingRow),
+		entries: make(map[string][]string),
+		byKey:   make(map[string][]string),
+	}
+}
+
+// seed records a row read by the statement, so it isn't read again
+func (w *rowWriter) seed(pk string, datums []*util.Datum) {
+	if _, ok := w.rows[pk]; ok {
+		return
+	}
+	w.rows[pk] = &pendingRow{old: datums, cur: datums}
+	w.keys = append(w.keys, pk)
+}
+
+// load reads the rows at pks not met yet, in batches
+func (w *rowWriter) load(pks []string) error {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, pk := range pks {
+		if _, ok := w.rows[pk]; !ok && !seen[pk] {
+			seen[pk] = true
+			keys = append(keys, pk)
+		}
+	}
+	values, found, err := getUserRecords(w.driver, keys)
+	if err != nil {
+		return err
+	}
+	for i, pk := range keys {
+		if err := w.add(pk, values[i], found[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add records the row read at pk, if found
+func (w *rowWriter) add(pk string, raw string, found bool) error {
+	r := &pendingRow{}
+	if found {
+		dm, err := decodeRow(raw, w.table)
+		if err != nil {
+			return err
+		}
+		r.old = make([]*util.Datum, len(w.table.ColumnMap))
+		for i := range r.old {
+			r.old[i] = dm[i]
+		}
+		r.cur = r.old
+	}
+	w.rows[pk] = r
+	w.keys = append(w.keys, pk)
+	return nil
+}
+
+func (w *rowWriter) row(pk string) (*pendingRow, error) {
+	if r, ok := w.rows[pk]; ok {
+		return r, nil
+	}
+
+	raw, err := w.driver.GetUserRecord(pk)
+	if err != nil && err != store.Nil {
+		return nil, err
+	}
+	if err := w.add(pk, raw, err == nil); err != nil {
+		return nil, err
+	}
+	return w.rows[pk], nil
+}
+
+// set makes datums the row r at pk
+func (w *rowWriter) set(pk string, r *pendingRow, datums []*util.Datum) error {
+	idxs, err := w.uniqueIndexes()
+	if err != nil {
+		return err
+	}
+	for _, idx := range idxs {
+		key, err := indexKey(idx, w.table, datums)
+		if err != nil {
+			return err
+		}
+		w.byKey[key] = append(w.byKey[key], pk)
+	}
+	r.cur, r.changed = datums, true
+	return nil
+}
+
+// indexes gives the indexes of the table, read with driver the first time
+func (w *rowWriter) indexes(driver store.Driver) ([]*parser.IndexInfo, error) {
+	if w.loaded {
+		return w.idxs, nil
+	}
+	idxs, err := parser.TableIndexes(driver, w.table.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range idxs {
+		if idx.Unique && idx.State != parser.IndexDeleteOnly {
+			w.uniques = append(w.uniques, idx)
+		}
+	}
+	w.idxs, w.loaded = idxs, true
+	return w.idxs, nil
+}
+
+func (w *rowWriter) uniqueIndexes() ([]*parser.IndexInfo, error) {
+	if _, err := w.indexes(w.driver); err != nil {
+		return nil, err
+	}
+	return w.uniques, nil
+}
+
+// loadEntries reads the stored entries of the unique keys not read yet
+func (w *rowWriter) loadEntries(keys []string) error {
+	var miss []string
+	for _, key := range keys {
+		if _, ok := w.entries[key]; !ok {
+			w.entries[key] = nil
+			miss = append(miss, key)
+		}
+	}
+	values, found, err := getUserRecords(w.driver, miss)
+	if err != nil {
+		return err
+	}
+	for i, key := range miss {
+		if !found[i] {
+			continue
+		}
+		pks, err := decodeIndexValue(values[i])
+		if err != nil {
+			return err
+		}
+		w.entries[key] = pks
+	}
+	return nil
+}
+
+/*
+ * prepare reads, in batches, the stored entries of the unique keys of
+ * rows and the rows they point to, which conflicts would otherwise read
+ * one by one.
+ */
+func (w *rowWriter) prepare(rows [][]*util.Datum) error {
+	idxs, err := w.uniqueIndexes()
+	if err != nil || len(idxs) == 0 {
+		return err
+	}
+	var keys []string
+	for _, datums := range rows {
+		for _, idx := range idxs {
+			key, err := indexKey(idx, w.table, datums)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+	if err := w.loadEntries(keys); err != nil {
+		return err
+	}
+	var pks []string
+	for _, key := range keys {
+		pks = append(pks, w.entries[key]...)
+	}
+	return w.load(pks)
+}
+
+/*
+ * conflicts gives the primary keys of the rows other than those at self
+ * which have a unique key of datums, as the statement leaves them, and
+ * the first index they conflict on.
+ */
+func (w *rowWriter) conflicts(datums []*util.Datum, self ...string) ([]string, *parser.IndexInfo, error) {
+	idxs, err := w.uniqueIndexes()
+	if err != nil {
+		return nil, nil, err
+	}
+	var pks []string
+	var first *parser.IndexInfo
+	seen := make(map[string]bool)
+	for _, s := range self {
+		seen[s] = true
+	}
+	for _, idx := range idxs {
+		key, err := indexKey(idx, w.table, datums)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := w.loadEntries([]string{key}); err != nil {
+			return nil, nil, err
+		}
+		candidates := append(append([]string(nil), w.entries[key]...), w.byKey[key]...)
+		for _, pk := range candidates {
+			if seen[pk] {
+				continue
+			}
+			r, err := w.row(pk)
+			if err != nil {
+				return nil, nil, err
+			}
+			if r.cur == nil {
+				continue
+			}
+			k, err := indexKey(idx, w.table, r.cur)
+			if err != nil {
+				return nil, nil, err
+			}
+			if k != key {
+				continue
+			}
+			seen[pk] = true
+			pks = append(pks, pk)
+			if first == nil {
+				first = idx
+			}
+		}
+	}
+	return pks, first, nil
+}
+
+// errDupEntry is the error of datums taking the key of idx another row has
+func errDupEntry(table *parser.TableInfo, idx *parser.IndexInfo, datums []*util.Datum) error {
+	return mysql.NewErrf(mysql.ErrDupEntry, "Duplicate entry '%s' for key '%s'", indexEntry(idx, table, datums), indexShortName(idx))
+}
+
+// checkUnique checks that no row the statement writes takes a unique key
+// another row has
+func (w *rowWriter) checkUnique() error {
+	for _, pk := range w.keys {
+		r := w.rows[pk]
+		if !r.changed || r.cur == nil {
+			continue
+		}
+		pks, idx, err := w.conflicts(r.cur, pk)
+		if err != nil {
+			return err
+		}
+		if len(pks) != 0 {
+			return errDupEntry(w.table, idx, r.cur)
+		}
+	}
+	return nil
+}
+
+/*
+ * update changes the row r at pk to datums, which is moved to its new
+ * primary key when that changes. Neither the new primary key nor a new
+ * unique key may be another row's. It tells whether the row changed.
+ */
+func (w *rowWriter) update(pk string, r *pendingRow, datums []*util.Datum) (bool, error) {
+	if hashRow(datums) == hashRow(r.cur) {
+		return false, nil
+	}
+
+	newPK, err := rowKey(w.table, datums)
+	if err != nil {
+		return false, err
+	}
+	if newPK != pk {
+		nr, err := w.row(newPK)
+		if err != nil {
+			return false, err
+		}
+		if nr.cur != nil {
+			return false, errors.New("primary key can't repeat!")
+		}
+	}
+	// the unique keys are checked before the row is changed, as MySQL
+	// checks them row by row
+	others, idx, err := w.conflicts(datums, pk, newPK)
+	if err != nil {
+		return false, err
+	}
+	if len(others) != 0 {
+		return false, errDupEntry(w.table, idx, datums)
+	}
+	if newPK != pk {
+		r.cur, r.changed = nil, true
+		r, pk = w.rows[newPK], newPK
+	}
+	return true, w.set(pk, r, datums)
+}
+
+func (w *rowWriter) flush() error {
+	if err := w.checkUnique(); err != nil {
+		return err
+	}
+	// a statement killed while it read writes nothing
+	if d, ok := w.driver.(*cancelDriver); ok {
+		if err := d.err(); err != nil {
+			return err
+		}
+	}
+
+	var setKeys, setValues []string
+	var modified int64
+	for _, pk := range w.keys {
+		r := w.rows[pk]
+		if !r.changed {
+			continue
+		}
+		modified++
+		if r.cur == nil {
+			if r.old != nil {
+				err := w.writer.DelUserRecord(pk)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		value, err := encodeRow(w.table, r.cur)
+		if err != nil {
+			return err
+		}
+		setKeys = append(setKeys, pk)
+		setValues = append(setValues, value)
+	}
+	for i := 0; i < len(setKeys); i += OnceWriteCount {
+		end := i + OnceWriteCount
+		if end > len(setKeys) {
+			end = len(setKeys)
+		}
+		err := w.writer.SetUserRecords(setKeys[i:end], setValues[i:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	idxs, err := w.indexes(w.writer)
+	if err != nil {
+		return err
+	}
+	for _, idx := range idxs {
+		dels := newIndexEntries()
+		adds := newIndexEntries()
+		for _, pk := range w.keys {
+			r := w.rows[pk]
+			if !r.changed {
+				continue
+			}
+			err = diffIndexEntries(idx, w.table, pk, r.old, r.cur, dels, adds)
+			if err != nil {
+				return err
+			}
+		}
+		// old entries go first, a row may take the entry another row left
+		err = DeleteIndexInfos(w.writer, dels.keys, dels.pks)
+		if err != nil {
+			return err
+		}
+		err = WriteIndexInfos(w.writer, idx.Unique, adds.keys, adds.pks)
+		if err != nil {
+			return err
+		}
+	}
+
+	noteModified(w.writer, w.table, modified)
+	return nil
+}
+
+// indexEntries collects the primary keys to add to or remove from index
+// entries, keys are the entries in the order they are met
+type indexEntries struct {
+	keys []string
+	pks  map[string][]string
+}
+
+func newIndexEntries() *indexEntries {
+	return &indexEntries{pks: make(map[string][]string)}
+}
+
+func (ie *indexEntries) add(key string, pk string) {
+	if _, ok := ie.pks[key]; !ok {
+		ie.keys = append(ie.keys, key)
+	}
+	ie.pks[key] = append(ie.pks[key], pk)
+}
+
+/*
+ * diffIndexEntries works out the entries of idx to change when the row at
+ * pk goes from old to cur, either of them nil when there is no row. An
+ * index in delete-only state only has its old entries removed.
+ */
+func diffIndexEntries(idx *parser.IndexInfo, table *parser.TableInfo, pk string, old []*util.Datum, cur []*util.Datum, dels *indexEntries, adds *indexEntries) error {
+	var oldKey, newKey string
+	var err error
+	if old != nil {
+		oldKey, err = indexKey(idx, table, old)
+		if err != nil {
+			return err
+		}
+	}
+	if cur != nil && idx.State != parser.IndexDeleteOnly {
+		newKey, err = indexKey(idx, table, cur)
+		if err != nil {
+			return err
+		}
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if oldKey != "" {
+		dels.add(oldKey, pk)
+	}
+	if newKey != "" {
+		adds.add(newKey, pk)
+	}
+	return nil
+}
+
+// checkRow checks a row worked out at run time as the analyzer checks values
+func checkRow(table *parser.TableInfo, datums []*util.Datum) error {
+	for i, d := range datums {
+		cd := table.ColumnMap[i]
+		if d.IsNull() {
+			if cd.PrimaryKey {
+				return errors.New(cd.Name + " is primary key, cann't be null")
+			}
+			if cd.Nullable == parser.NotNull {
+				return errors.New(cd.Name + " is NotNull!")
+			}
+			continue
+		}
+		switch cd.Type.(type) {
+		case *parser.IntType:
+			if d.GetK() != util.KindInt64 {
+				return errors.New("the value of " + cd.Name + " isn't int type!")
+			}
+		case *parser.StringType:
+			if d.GetK() != util.KindString {
+				return errors.New("the value of " + cd.Name + " isn't string type!")
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * assign applies assignments to a copy of row in order, each sees the
+ * columns set before it. The new row is checked as values are.
+ */
+func assign(e *Executor, table *parser.TableInfo, assignments []*parser.Assignment, row []*util.Datum) ([]*util.Datum, error) {
+	row = append([]*util.Datum(nil), row...)
+	for _, a := range assignments {
+		d, err := evalTarget(e, a.Value, row)
+		if err != nil {
+			return nil, err
+		}
+		// float results are rounded into int columns
+		if d.GetK() == util.KindFloat64 {
+			d = convertDatum(d, table.ColumnMap[a.Pos].Type)
+		}
+		row[a.Pos] = d
+	}
+	if err := checkRow(table, row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func rowKey(table *parser.TableInfo, datums []*util.Datum) (string, error) {
+	key := table.RowPrefix()
+	for i := range datums {
+		if !table.ColumnMap[i].PrimaryKey {
+			continue
+		}
+		raw, err := encodeKey(datums[i])
+		if err != nil {
+			return "", err
+		}
+		key += util.ToString(raw)
+	}
+	return key, nil
+}
+
+// indexEntry is the text of the key of idx datums have
+func indexEntry(idx *parser.IndexInfo, table *parser.TableInfo, datums []*util.Datum) string {
+	var entry string
+	for _, f := range idx.Fields {
+		cd := table.ColumnByID(f)
+		if cd == nil {
+			continue
+		}
+		text, _ := util.DumpValueToText(datums[cd.Pos-1])
+		if entry != "" {
+			entry += "-"
+		}
+		entry += util.ToString(text)
+	}
+	return entry
+}
+
+// indexShortName is the name of idx without its database
+func indexShortName(idx *parser.IndexInfo) string {
+	return idx.Name[strings.LastIndex(idx.Name, ".")+1:]
+}
+
+func pkEntry(table *parser.TableInfo, datums []*util.Datum) string {
+	var entry string
+	for i := range datums {
+		if !table.ColumnMap[i].PrimaryKey {
+			continue
+		}
+		text, _ := util.DumpValueToText(datums[i])
+		if entry != "" {
+			entry += "-"
+		}
+		entry += util.ToString(text)
+	}
+	return entry
+}
+
 type InsertExec struct {
-	stmt    parser.Statement
-	driver  store.Driver
-	context *context.Context
-	done    bool
+	stmt     *parser.InsertQuery
+	executor *Executor
+	children []result.Result
+	driver   store.Driver
+	context  *context.Context
+	done     bool
+}
+
+func NewInsertExec(stmt *parser.InsertQuery, p plan.Plan, e *Executor) *InsertExec {
+	iExec := &InsertExec{
+		stmt:     stmt,
+		executor: e,
+		driver:   e.driver,
+		context:  e.context,
+	}
+	if p != nil {
+		iExec.children = append(iExec.children, makePlanExec(p, e))
+	}
+
+	return iExec
 }
 
 func (insert *InsertExec) Columns() ([]*store.ColumnInfo, error) {
 	return nil, nil
 }
 
-func parseIndexFields(raw string) []uint64 {
-	num, _, len := util.ParseLengthEncodedInt(util.ToSlice(raw))
-	idxFields := make([]uint64, num)
-	var i uint64
-	for ; i < num; i++ {
-		idxField, _, l := util.ParseLengthEncodedInt(util.ToSlice(raw[len:]))
-		idxFields[i] = idxField
-		len += l
+/*
+ * rows returns the rows to insert. The rows of a select are all read
+ * before anything is written, so a select from the table itself doesn't
+ * see the rows it inserts.
+ */
+func (insert *InsertExec) rows() ([][]*util.Datum, error) {
+	stmt := insert.stmt
+	var rows [][]*util.Datum
+	for _, values := range stmt.Rows {
+		datums := make([]*util.Datum, stmt.NumColumns)
+		for i := 0; i < stmt.NumColumns; i++ {
+			d, err := valueToDatum(values[i])
+			if err != nil {
+				return nil, err
+			}
+			datums[i] = d
+		}
+		rows = append(rows, datums)
+	}
+	if len(insert.children) == 0 {
+		return rows, nil
+	}
+
+	for {
+		rc, err := insert.children[0].Next()
+		if err != nil {
+			return nil, err
+		}
+		if rc == nil {
+			break
+		}
+		datums := make([]*util.Datum, stmt.NumColumns)
+		for i := range datums {
+			datums[i], _ = valueToDatum(nil)
+		}
+		for i, pos := range stmt.Columns {
+			datums[pos] = rc.Datums[i]
+		}
+		if err := checkRow(stmt.Table, datums); err != nil {
+			return nil, err
+		}
+		rows = append(rows, datums)
 	}
-	return idxFields
+	return rows, nil
 }
 
+/*
+ * Next inserts all the rows of the statement. A row whose primary key or
+ * a unique key exists, or was inserted by the statement before, replaces
+ * every row in its way, is skipped with a warning or updates the row at
+ * its primary key, else the first row with its unique key, as the
+ * statement says.
+ * For ON DUPLICATE KEY UPDATE, VALUES(col) is taken from the row that was
+ * to be inserted, which is the row one level out.
+ */
 func (insert *InsertExec) Next() (*result.Record, error) {
 	if insert.done {
 		return nil, nil
 	}
-
-	var value string
-	stmt := insert.stmt.(*parser.InsertQuery)
-	for i := 0; i < stmt.NumColumns; i++ {
-		if stmt.Values[i] != nil {
-			value += "1"
-			switch stmt.Values[i].(type) {
-			case int64:
-				v := stmt.Values[i].(int64)
-				value += util.ToString(util.DumpLengthEncodedInt(uint64(v)))
-			case string:
-				v := stmt.Values[i].(string)
-				value += util.ToString(util.DumpLengthEncodedString(util.ToSlice(v)))
-			}
-		} else {
-			value += "0"
-		}
-	}
-
-	affectedRows := insert.context.AffectedRows()
-	insert.context.SetAffectedRows(affectedRows + 1)
 	insert.done = true
 
-	err := insert.driver.SetUserRecord(stmt.PK, value, 0)
+	stmt := insert.stmt
+	rows, err := insert.rows()
 	if err != nil {
 		return nil, err
 	}
 
-	//insert index
-	var keys []string
-	var cursor uint64
-	match := store.SystemFlag + store.TableFlag + store.IndexFlag + stmt.TableName + "*"
-	for {
-		keys, cursor, err = insert.driver.ScanSysRecords(cursor, match, OnceScanCount)
+	pks := make([]string, len(rows))
+	for i, datums := range rows {
+		pks[i], err = rowKey(stmt.Table, datums)
 		if err != nil {
 			return nil, err
 		}
-		for _, key := range keys {
-			var unique bool
-			idxName, err := insert.driver.GetSysRecord(key)
-			if err != nil {
+	}
+	w := newRowWriter(stmt.Table, insert.driver)
+	if err = w.load(pks); err != nil {
+		return nil, err
+	}
+	if err = w.prepare(rows); err != nil {
+		return nil, err
+	}
+
+	var affected uint64
+	for i, datums := range rows {
+		pk := pks[i]
+		r, err := w.row(pk)
+		if err != nil {
+			return nil, err
+		}
+		others, idx, err := w.conflicts(datums, pk)
+		if err != nil {
+			return nil, err
+		}
+		if r.cur == nil && len(others) == 0 {
+			if err := w.set(pk, r, datums); err != nil {
 				return nil, err
 			}
-			idxFields := parseIndexFields(key[len(match)-1:])
-			idxKey := store.UserFlag + idxName + "/"
-			for _, idxField := range idxFields {
-				switch stmt.Values[int(idxField-1)].(type) {
-				case int64:
-					v := stmt.Values[int(idxField-1)].(int64)
-					idxKey += util.ToString(util.DumpLengthEncodedInt(uint64(v)))
-				case string:
-					v := stmt.Values[int(idxField-1)].(string)
-					idxKey += util.ToString(util.DumpLengthEncodedString(util.ToSlice(v)))
+			affected++
+			continue
+		}
+
+		switch {
+		case stmt.Replace:
+			// every row in the way is deleted, a row at the same primary
+			// key is replaced
+			for _, other := range others {
+				or, err := w.row(other)
+				if err != nil {
+					return nil, err
 				}
+				or.cur, or.changed = nil, true
+				affected++
 			}
-			idxTblKey := store.SystemFlag + store.IndexFlag + store.TableFlag + idxName
-			idxTblValue, err := insert.driver.GetSysRecord(idxTblKey)
-			if err == nil {
-				if idxTblValue[0:1] == "1" {
-					unique = true
-				} else {
-					unique = false
-				}
+			if r.cur != nil {
+				affected++
+			}
+			if err := w.set(pk, r, datums); err != nil {
+				return nil, err
+			}
+			affected++
+		case stmt.Ignore:
+			if r.cur != nil {
+				insert.context.AppendWarning(mysql.ErrDupEntry, "Duplicate entry '"+pkEntry(stmt.Table, datums)+"' for key 'PRIMARY'")
 			} else {
-				return nil, errors.New("can't get index table system key!")
+				insert.context.AppendWarning(mysql.ErrDupEntry, "Duplicate entry '"+indexEntry(idx, stmt.Table, datums)+"' for key '"+indexShortName(idx)+"'")
 			}
-			err = WriteIndexInfo(insert.driver, unique, idxKey, stmt.PK)
+		case stmt.OnDuplicate != nil:
+			// the row at the primary key goes first, then the first row
+			// with a unique key of the row
+			target := pk
+			if r.cur == nil {
+				target = others[0]
+				if r, err = w.row(target); err != nil {
+					return nil, err
+				}
+			}
+			e := *insert.executor
+			e.outer = append(e.outer[:len(e.outer):len(e.outer)], datums)
+			row, err := assign(&e, stmt.Table, stmt.OnDuplicate, r.cur)
 			if err != nil {
 				return nil, err
 			}
-		}
-		if cursor == 0 {
-			break
+			changed, err := w.update(target, r, row)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				affected += 2
+			}
+		case r.cur != nil:
+			return nil, errors.New("primary key can't repeat!")
+		default:
+			return nil, errDupEntry(stmt.Table, idx, datums)
 		}
 	}
 
+	err = w.flush()
+	if err != nil {
+		return nil, err
+	}
+	affectedRows := insert.context.AffectedRows()
+	insert.context.SetAffectedRows(affectedRows + affected)
+
 	return nil, nil
 }
 
@@ -123,6 +777,7 @@ func (insert *InsertExec) Done() bool {
 
 type UpdateExec struct {
 	update   *plan.Update
+	executor *Executor
 	children []result.Result
 	driver   store.Driver
 	context  *context.Context
@@ -131,9 +786,10 @@ type UpdateExec struct {
 
 func NewUpdateExec(p *plan.Update, e *Executor) *UpdateExec {
 	pExec := &UpdateExec{
-		update:  p,
-		driver:  e.driver,
-		context: e.context,
+		update:   p,
+		executor: e,
+		driver:   e.driver,
+		context:  e.context,
 	}
 
 	for _, n := range p.GetChildren() {
@@ -147,126 +803,87 @@ func (ue *UpdateExec) Columns() ([]*store.ColumnInfo, error) {
 	return nil, nil
 }
 
+/*
+ * Next updates all the rows of the statement. The rows are all read
+ * before any is updated, so a row moved to a new primary key isn't met
+ * again, and are updated in the order read. A row may only take a
+ * primary key or a unique key no row has at that point, and nothing is
+ * written when one doesn't. Only the rows that change are written and
+ * counted.
+ */
 func (ue *UpdateExec) Next() (*result.Record, error) {
 	if ue.done {
 		return nil, nil
 	}
+	ue.done = true
 
-	rc, err := ue.children[0].Next()
-	if err != nil {
-		return nil, err
-	}
-	if rc == nil {
-		ue.done = true
-		return nil, nil
+	table := ue.update.Table
+	var rows [][]*util.Datum
+	var pks []string
+	w := newRowWriter(table, ue.driver)
+	for {
+		rc, err := ue.children[0].Next()
+		if err != nil {
+			return nil, err
+		}
+		if rc == nil {
+			break
+		}
+		pk, err := rowKey(table, rc.Datums)
+		if err != nil {
+			return nil, err
+		}
+		w.seed(pk, rc.Datums)
+		rows = append(rows, rc.Datums)
+		pks = append(pks, pk)
 	}
 
-	var newRaw string
-	key := store.UserFlag + ue.update.Table.Name + "/"
-	for i := 0; i < ue.update.FieldsNum; i++ {
-		var raw []byte
-		pk := ue.update.Table.ColumnMap[i].PrimaryKey
-		c, ok := ue.update.Values[i]
-		if !ok {
-			raw, err = util.DumpValueToRaw(rc.Datums[i])
-			if err != nil {
-				return nil, err
-			}
-			if raw != nil {
-				newRaw += "1"
-				newRaw += util.ToString(raw)
-			} else {
-				newRaw += "0"
-			}
-		} else {
-			newRaw += "1"
-
-			switch ue.update.Table.ColumnMap[i].Type.(type) {
-			case *parser.IntType:
-				v := c.(int64)
-				raw = util.DumpLengthEncodedInt(uint64(v))
-				newRaw += util.ToString(raw)
-			case *parser.StringType:
-				v := c.(string)
-				raw = util.DumpLengthEncodedString(util.ToSlice(v))
-				newRaw += util.ToString(raw)
-			}
+	// the rows taking new primary keys are read before any is updated
+	news := make([][]*util.Datum, len(rows))
+	var moved []string
+	for i, datums := range rows {
+		row, err := assign(ue.executor, table, ue.update.Assignments, datums)
+		if err != nil {
+			return nil, err
 		}
-
-		if pk {
-			key += util.ToString(raw)
+		news[i] = row
+		newPK, err := rowKey(table, row)
+		if err != nil {
+			return nil, err
+		}
+		if newPK != pks[i] {
+			moved = append(moved, newPK)
 		}
 	}
-	affectedRows := ue.context.AffectedRows()
-	ue.context.SetAffectedRows(affectedRows + 1)
-
-	err = ue.driver.SetUserRecord(key, newRaw, 0)
-	if err != nil {
+	if err := w.load(moved); err != nil {
+		return nil, err
+	}
+	if err := w.prepare(news); err != nil {
 		return nil, err
 	}
 
-	//update index
-	var ks []string
-	var cursor uint64
-	match := store.SystemFlag + store.TableFlag + store.IndexFlag + ue.update.Table.Name + "*"
-	for {
-		var shouldReset bool
-		ks, cursor, err = ue.driver.ScanSysRecords(cursor, match, OnceScanCount)
+	var affected uint64
+	for i, row := range news {
+		r, err := w.row(pks[i])
 		if err != nil {
 			return nil, err
 		}
-		for _, k := range ks {
-			var unique bool
-			idxName, err := ue.driver.GetSysRecord(k)
-			if err != nil {
-				return nil, err
-			}
-			idxFields := parseIndexFields(k[len(match)-1:])
-			idxKey := store.UserFlag + idxName + "/"
-			for _, idxField := range idxFields {
-				c, ok := ue.update.Values[int(idxField-1)]
-				if ok {
-					shouldReset = true
-					switch ue.update.Table.ColumnMap[int(idxField-1)].Type.(type) {
-					case *parser.IntType:
-						v := c.(int64)
-						idxKey += util.ToString(util.DumpLengthEncodedInt(uint64(v)))
-					case *parser.StringType:
-						v := c.(string)
-						idxKey += util.ToString(util.DumpLengthEncodedString(util.ToSlice(v)))
-					}
-				} else {
-					raw, err := util.DumpValueToRaw(rc.Datums[int(idxField-1)])
-					if err != nil {
-						return nil, err
-					}
-					idxKey += util.ToString(raw)
-				}
-			}
-
-			if shouldReset {
-				idxTblKey := store.SystemFlag + store.IndexFlag + store.TableFlag + idxName
-				idxTblValue, err := ue.driver.GetSysRecord(idxTblKey)
-				if err == nil {
-					if idxTblValue[0:1] == "1" {
-						unique = true
-					} else {
-						unique = false
-					}
-				} else {
-					return nil, errors.New("can't get index table system key!")
-				}
-				err = WriteIndexInfo(ue.driver, unique, idxKey, key)
-				if err != nil {
-					return nil, err
-				}
-			}
+		changed, err := w.update(pks[i], r, row)
+		if err != nil {
+			return nil, err
 		}
-		if cursor == 0 {
-			break
+		if changed {
+			affected++
 		}
 	}
 
+	err := w.flush()
+	if err != nil {
+		return nil, err
+	}
+	affectedRows := ue.context.AffectedRows()
+	ue.context.SetAffectedRows(affectedRows + affected)
+
 	return nil, nil
 }
 
@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/parser"
+)
+
+/*
+ * checkIndex checks every entry of the index idxName points to rows that
+ * are stored and hold its key, and every row has one, so that no entry is
+ * left behind by a row that moved or went away.
+ */
+func checkIndex(t *testing.T, d *testDriver, tblName string, idxName string) {
+	table, err := parser.LoadTableInfo(d, tblName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := parser.LoadIndexInfo(d, idxName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var rows, pointers int
+	for key, value := range d.data {
+		if strings.HasPrefix(key, table.RowPrefix()) {
+			rows++
+			continue
+		}
+		if !strings.HasPrefix(key, table.IndexPrefix(idx)) {
+			continue
+		}
+		pks, err := decodeIndexValue(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pk := range pks {
+			pointers++
+			raw, ok := d.data[pk]
+			if !ok {
+				t.Errorf("%s: entry %q points to no row", idxName, key)
+				continue
+			}
+			datums, err := decodeRowDatums(raw, table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ik, _ := indexKey(idx, table, datums); ik != key {
+				t.Errorf("%s: entry %q points to a row keyed %q", idxName, key, ik)
+			}
+		}
+	}
+	if pointers != rows {
+		t.Errorf("%s: %d entries for %d rows", idxName, pointers, rows)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	SchemaLease = 10 * time.Millisecond
+	defer func() { SchemaLease = 10 * time.Second }()
+	d := newTestDriver()
+	e := NewExecutor(d, context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create table t (id int primary key, u int, v int)",
+		"create unique index iu on t (u)",
+		"create index iv on t (v)",
+		"insert into t values (1, 10, 0), (2, 20, 0)",
+	} {
+		queryRows(t, e, sql)
+	}
+
+	for _, c := range []struct {
+		sql  string
+		rows string
+	}{
+		// a duplicate key fails the statement, and writes none of its rows
+		{"insert into t values (3, 30, 0), (4, 10, 0)", "1 10 0|2 20 0"},
+		{"insert ignore into t values (3, 10, 0), (4, 40, 0), (5, 40, 5)", "1 10 0|2 20 0|4 40 0"},
+		// the rows holding either key are replaced
+		{"replace into t values (5, 10, 5)", "2 20 0|4 40 0|5 10 5"},
+		{"replace into t values (2, 40, 2)", "2 40 2|5 10 5"},
+		{"insert into t values (5, 99, 7) on duplicate key update v = v + values(v)", "2 40 2|5 10 12"},
+		{"insert into t values (6, 40, 1) on duplicate key update v = values(v) * 100", "2 40 100|5 10 12"},
+		// the row updated moves to its new primary key
+		{"insert into t values (7, 10, 0) on duplicate key update id = 8", "2 40 100|8 10 12"},
+		{"insert into t values (2, 0, 0) on duplicate key update u = 10", "2 40 100|8 10 12"},
+		{"insert into t values (8, 0, 0) on duplicate key update id = 2", "2 40 100|8 10 12"},
+	} {
+		execSQL(e, c.sql)
+		got := strings.Join(queryRows(t, e, "select * from t"), "|")
+		if got != c.rows {
+			t.Errorf("%s: rows %q, want %q", c.sql, got, c.rows)
+		}
+		checkIndex(t, d, "Nesoi.t", "Nesoi.iu")
+		checkIndex(t, d, "Nesoi.t", "Nesoi.iv")
+	}
+
+	for _, c := range []struct {
+		sql string
+		err string
+	}{
+		{"insert into t values (3, 30, 0), (4, 10, 0)", "Duplicate entry '10' for key 'iu'"},
+		{"insert into t values (2, 0, 0) on duplicate key update u = 10", "Duplicate entry '10' for key 'iu'"},
+		{"insert into t values (8, 0, 0) on duplicate key update id = 2", "primary key can't repeat!"},
+	} {
+		if err := execSQL(e, c.sql); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: %v, want %s", c.sql, err, c.err)
+		}
+	}
+	queryRows(t, e, "insert ignore into t values (9, 10, 0), (10, 40, 0)")
+	warnings := strings.Join(queryRows(t, e, "show warnings"), "|")
+	if strings.Count(warnings, "Duplicate entry") != 2 {
+		t.Errorf("warnings %q", warnings)
+	}
+
+	got := strings.Join(queryRows(t, e, "select id from t where u = 10"), "|")
+	if got != "8" {
+		t.Errorf("rows by the unique index: %q", got)
+	}
+	got = strings.Join(queryRows(t, e, "select id from t where v = 100"), "|")
+	if got != "2" {
+		t.Errorf("rows by the index: %q", got)
+	}
+}
+
+func TestUpdateIndexes(t *testing.T) {
+	SchemaLease = 10 * time.Millisecond
+	defer func() { SchemaLease = 10 * time.Second }()
+	d := newTestDriver()
+	e := NewExecutor(d, context.NewContext())
+	defer e.Close()
+	for _, sql := range []string{
+		"create table t (id int primary key, u int, v int)",
+		"create unique index iu on t (u)",
+		"create index iv on t (v)",
+		"insert into t values (1, 10, 1), (2, 20, 2), (3, 30, 3)",
+	} {
+		queryRows(t, e, sql)
+	}
+
+	for _, c := range []struct {
+		sql  string
+		rows string
+	}{
+		// a row takes the unique key another row leaves
+		{"update t set u = u + 10 order by u desc", "1 20 1|2 30 2|3 40 3"},
+		{"update t set v = v * 10 where id > 1", "1 20 1|2 30 20|3 40 30"},
+		{"update t set u = 40 where id = 1", "1 20 1|2 30 20|3 40 30"},
+		{"update t set v = 0 order by id desc limit 2", "1 20 1|2 30 0|3 40 0"},
+		// the row moves to its new primary key
+		{"update t set id = id + 10, u = u + 1 where id = 1", "11 21 1|2 30 0|3 40 0"},
+		{"update t set id = 2 where id = 3", "11 21 1|2 30 0|3 40 0"},
+		{"update t set id = id + 1 order by id desc", "12 21 1|3 30 0|4 40 0"},
+	} {
+		execSQL(e, c.sql)
+		got := strings.Join(queryRows(t, e, "select * from t"), "|")
+		if got != c.rows {
+			t.Errorf("%s: rows %q, want %q", c.sql, got, c.rows)
+		}
+		checkIndex(t, d, "Nesoi.t", "Nesoi.iu")
+		checkIndex(t, d, "Nesoi.t", "Nesoi.iv")
+	}
+
+	for _, c := range []struct {
+		sql string
+		err string
+	}{
+		// in the order of the primary key a row takes the key of the next one
+		{"update t set u = u + 10", "Duplicate entry '40' for key 'iu'"},
+		{"update t set u = 40 where id = 12", "Duplicate entry '40' for key 'iu'"},
+		{"update t set id = 3 where id = 4", "primary key can't repeat!"},
+	} {
+		if err := execSQL(e, c.sql); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: %v, want %s", c.sql, err, c.err)
+		}
+	}
+
+	got := strings.Join(queryRows(t, e, "select id from t where u = 21"), "|")
+	if got != "12" {
+		t.Errorf("rows by the unique index: %q", got)
+	}
+	got = strings.Join(queryRows(t, e, "select id from t where v = 0"), "|")
+	if got != "3|4" {
+		t.Errorf("rows by the index: %q", got)
+	}
+}
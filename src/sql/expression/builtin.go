@@ -0,0 +1,117 @@
+package expression
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * every operator and function of a scalar expression is a Func, looked up
+ * by its lower case name. The analyzer checks the number of arguments and
+ * infers the result kind from the kinds of the arguments, the executor
+ * evaluates the arguments of a row and calls Eval on them.
+ */
+type Func struct {
+	MinArgs int
+	// -1 means any number of arguments
+	MaxArgs int
+	RetType func(args []byte) byte
+	Eval    func(ctx *context.Context, args []*util.Datum) (*util.Datum, error)
+}
+
+var funcs = make(map[string]*Func)
+
+func register(names []string, f *Func) {
+	for _, name := range names {
+		funcs[name] = f
+	}
+}
+
+func GetFunc(name string) *Func {
+	return funcs[strings.ToLower(name)]
+}
+
+func (f *Func) CheckArgs(name string, n int) error {
+	if n < f.MinArgs || (f.MaxArgs >= 0 && n > f.MaxArgs) {
+		return errors.New("Incorrect parameter count in the call to native function '" + name + "'")
+	}
+	return nil
+}
+
+// MergeKinds returns the kind that values of the given kinds are converted to
+// when they are mixed in one result, null kinds are ignored.
+func MergeKinds(kinds ...byte) byte {
+	ret := util.KindNull
+	for _, k := range kinds {
+		switch {
+		case k == util.KindNull || k == ret:
+		case ret == util.KindNull:
+			ret = k
+		case k == util.KindString || ret == util.KindString:
+			ret = util.KindString
+		default:
+			ret = util.KindFloat64
+		}
+	}
+	return ret
+}
+
+func retKind(k byte) func(args []byte) byte {
+	return func(args []byte) byte {
+		return k
+	}
+}
+
+func retMerge(args []byte) byte {
+	return MergeKinds(args...)
+}
+
+func intDatum(i int64) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(util.KindInt64)
+	d.SetI(i)
+	return d
+}
+
+func floatDatum(f float64) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(util.KindFloat64)
+	d.SetF(f)
+	return d
+}
+
+func stringDatum(b []byte) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(util.KindString)
+	d.SetB(b)
+	return d
+}
+
+func nullDatum() *util.Datum {
+	d := &util.Datum{}
+	d.SetK(util.KindNull)
+	return d
+}
+
+func hasNull(args []*util.Datum) bool {
+	for _, arg := range args {
+		if arg.IsNull() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrue reports whether the datum is true in a condition, null is not.
+func IsTrue(d *util.Datum) bool {
+	switch d.GetK() {
+	case util.KindInt64:
+		return d.GetI() != 0
+	case util.KindNull:
+		return false
+	}
+	return d.ToFloat64() != 0
+}
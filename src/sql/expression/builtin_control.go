@@ -0,0 +1,179 @@
+package expression
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func init() {
+	register([]string{"if"}, &Func{3, 3, retIf, evalIf})
+	register([]string{"ifnull"}, &Func{2, 2, retMerge, evalCoalesce})
+	register([]string{"coalesce"}, &Func{1, -1, retMerge, evalCoalesce})
+	register([]string{"nullif"}, &Func{2, 2, retNullIf, evalNullIf})
+	register([]string{"case"}, &Func{2, -1, retCase, evalCase})
+
+	register([]string{"cast_as_signed"}, &Func{1, 1, retKind(util.KindInt64), evalCast(util.KindInt64)})
+	register([]string{"cast_as_unsigned"}, &Func{1, 1, retKind(util.KindInt64), evalCastUnsigned})
+	register([]string{"cast_as_double", "cast_as_decimal"}, &Func{1, 1, retKind(util.KindFloat64), evalCast(util.KindFloat64)})
+	register([]string{"cast_as_char", "cast_as_binary"}, &Func{1, 2, retKind(util.KindString), evalCastChar})
+}
+
+/*
+ * if, ifnull, coalesce and case don't evaluate all their arguments: the
+ * executor tests the conditions of their arms in order, and evaluates the
+ * result of the first arm that holds, or the else argument when none does.
+ * Their Eval functions give the same results on arguments all evaluated,
+ * when their calls are folded.
+ */
+type Arm struct {
+	// the argument tested, for not being null when NotNull is set, else
+	// for being true
+	Cond    int
+	NotNull bool
+	// the argument given when the test holds
+	Result int
+}
+
+// Holds tells whether the arm is taken when its condition is d
+func (a Arm) Holds(d *util.Datum) bool {
+	if a.NotNull {
+		return !d.IsNull()
+	}
+	return IsTrue(d)
+}
+
+/*
+ * ControlArms gives the arms of the control function name called with n
+ * arguments, and the argument given when none holds, -1 meaning null. ok
+ * is false for the other functions, which get all their arguments.
+ */
+func ControlArms(name string, n int) (arms []Arm, els int, ok bool) {
+	switch strings.ToLower(name) {
+	case "if":
+		return []Arm{{Cond: 0, Result: 1}}, 2, true
+	case "ifnull", "coalesce":
+		for i := 0; i < n; i++ {
+			arms = append(arms, Arm{Cond: i, NotNull: true, Result: i})
+		}
+		return arms, -1, true
+	case "case":
+		i := 0
+		for ; i+1 < n; i += 2 {
+			arms = append(arms, Arm{Cond: i, Result: i + 1})
+		}
+		if i < n {
+			return arms, i, true
+		}
+		return arms, -1, true
+	}
+	return nil, -1, false
+}
+
+func retIf(args []byte) byte {
+	return MergeKinds(args[1], args[2])
+}
+
+func evalIf(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if IsTrue(args[0]) {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
+func evalCoalesce(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	for _, arg := range args {
+		if !arg.IsNull() {
+			return arg, nil
+		}
+	}
+	return nullDatum(), nil
+}
+
+func retNullIf(args []byte) byte {
+	return args[0]
+}
+
+func evalNullIf(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if !hasNull(args) && Compare(args[0], args[1]) == 0 {
+		return nullDatum(), nil
+	}
+	return args[0], nil
+}
+
+/*
+ * case takes its arguments as:
+ *		cond1, result1, cond2, result2, ... [, else]
+ * CASE value WHEN ... is compiled into conditions comparing the value.
+ */
+func retCase(args []byte) byte {
+	var results []byte
+	for i := 1; i < len(args); i += 2 {
+		results = append(results, args[i])
+	}
+	if len(args)%2 == 1 {
+		results = append(results, args[len(args)-1])
+	}
+	return MergeKinds(results...)
+}
+
+func evalCase(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	i := 0
+	for ; i+1 < len(args); i += 2 {
+		if IsTrue(args[i]) {
+			return args[i+1], nil
+		}
+	}
+	if i < len(args) {
+		return args[i], nil
+	}
+	return nullDatum(), nil
+}
+
+func evalCast(k byte) func(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return func(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+		return args[0].Convert(k), nil
+	}
+}
+
+var errUnsignedRange = errors.New("BIGINT UNSIGNED value is out of range!")
+
+/*
+ * there is no unsigned kind, an unsigned value is kept in an int64, so a
+ * value that doesn't fit in it, like a negative one which would wrap around
+ * to 2^64 minus its absolute value, is out of range.
+ */
+func evalCastUnsigned(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	a := args[0]
+	switch a.GetK() {
+	case util.KindNull:
+		return a, nil
+	case util.KindInt64:
+		if a.GetI() < 0 {
+			return nil, errUnsignedRange
+		}
+		return a, nil
+	}
+	if f := math.RoundToEven(a.ToFloat64()); f < 0 || f >= math.MaxInt64 {
+		return nil, errUnsignedRange
+	}
+	return a.Convert(util.KindInt64), nil
+}
+
+// the optional second argument is the length of CHAR(n)
+func evalCastChar(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	d := args[0].Convert(util.KindString)
+	if len(args) < 2 || d.IsNull() {
+		return d, nil
+	}
+
+	n := int(args[1].ToInt64())
+	rs := []rune(string(d.GetB()))
+	if n < len(rs) {
+		return stringDatum([]byte(string(rs[:n]))), nil
+	}
+	return d, nil
+}
@@ -0,0 +1,88 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func init() {
+	register([]string{"database", "schema"}, &Func{0, 0, retKind(util.KindString), evalDatabase})
+	register([]string{"version"}, &Func{0, 0, retKind(util.KindString), evalVersion})
+	register([]string{"connection_id"}, &Func{0, 0, retKind(util.KindInt64), evalConnectionID})
+	register([]string{"user", "current_user", "session_user", "system_user"}, &Func{0, 0, retKind(util.KindString), evalUser})
+	register([]string{"format"}, &Func{2, 3, retKind(util.KindString), evalFormat})
+}
+
+// no current database gives null
+func evalDatabase(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	db := ctx.GetCurrentDB()
+	if db == "" {
+		return nullDatum(), nil
+	}
+	return stringDatum([]byte(db)), nil
+}
+
+func evalVersion(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return stringDatum([]byte(mysql.ServerVersion)), nil
+}
+
+func evalConnectionID(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return intDatum(int64(ctx.ConnectionID())), nil
+}
+
+func evalUser(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return stringDatum([]byte(ctx.User())), nil
+}
+
+/*
+ * format rounds x to d decimals and groups its digits as the locale does:
+ *		FORMAT(x, d [, locale])
+ * locale defaults to en_US, unsupported locales are formatted as en_US like
+ * MySQL does.
+ */
+func evalFormat(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return nullDatum(), nil
+	}
+
+	d := args[1].ToInt64()
+	if d < 0 {
+		d = 0
+	}
+	if d > 30 {
+		d = 30
+	}
+
+	var number string
+	if args[0].GetK() == util.KindInt64 {
+		number = strconv.FormatInt(args[0].GetI(), 10)
+	} else {
+		// rounds half away from zero like ROUND, and a result of zero has no sign
+		p := math.Pow10(int(d))
+		f := math.Round(args[0].ToFloat64()*p) / p
+		if f == 0 {
+			f = 0
+		}
+		number = strconv.FormatFloat(f, 'f', int(d), 64)
+	}
+
+	locale := "en_US"
+	if len(args) == 3 && !args[2].IsNull() {
+		locale = string(args[2].ToBytes())
+	}
+	precision := strconv.FormatInt(d, 10)
+	s, err := mysql.GetLocaleFormatFunction(locale)(number, precision)
+	if err != nil {
+		ctx.AppendWarning(mysql.ErrUnknownLocale, fmt.Sprintf("Unknown locale: '%s'", locale))
+		s, err = mysql.GetLocaleFormatFunction("en_US")(number, precision)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stringDatum([]byte(s)), nil
+}
@@ -0,0 +1,87 @@
+package expression
+
+import (
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func init() {
+	register([]string{"and"}, &Func{2, 2, retKind(util.KindInt64), evalAnd})
+	register([]string{"or"}, &Func{2, 2, retKind(util.KindInt64), evalOr})
+	register([]string{"xor"}, &Func{2, 2, retKind(util.KindInt64), evalXor})
+	register([]string{"not"}, &Func{1, 1, retKind(util.KindInt64), evalNot})
+	register([]string{"in"}, &Func{2, -1, retKind(util.KindInt64), evalIn})
+}
+
+func boolDatum(b bool) *util.Datum {
+	if b {
+		return intDatum(1)
+	}
+	return intDatum(0)
+}
+
+// false wins over null
+func evalAnd(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	for _, arg := range args {
+		if !arg.IsNull() && !IsTrue(arg) {
+			return intDatum(0), nil
+		}
+	}
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return intDatum(1), nil
+}
+
+// true wins over null
+func evalOr(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	for _, arg := range args {
+		if IsTrue(arg) {
+			return intDatum(1), nil
+		}
+	}
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return intDatum(0), nil
+}
+
+func evalXor(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return boolDatum(IsTrue(args[0]) != IsTrue(args[1])), nil
+}
+
+func evalNot(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return boolDatum(!IsTrue(args[0])), nil
+}
+
+// In tells whether v is one of values, it is null when v is null or no
+// value matches and some of them are null.
+func In(v *util.Datum, values []*util.Datum) *util.Datum {
+	if v.IsNull() {
+		return nullDatum()
+	}
+	null := false
+	for _, value := range values {
+		if value.IsNull() {
+			null = true
+			continue
+		}
+		if Compare(v, value) == 0 {
+			return intDatum(1)
+		}
+	}
+	if null {
+		return nullDatum()
+	}
+	return intDatum(0)
+}
+
+func evalIn(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return In(args[0], args[1:]), nil
+}
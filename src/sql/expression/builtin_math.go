@@ -0,0 +1,115 @@
+package expression
+
+import (
+	"math"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func init() {
+	register([]string{"abs"}, &Func{1, 1, retArith, evalAbs})
+	register([]string{"round"}, &Func{1, 2, retRound, evalRound})
+	register([]string{"floor"}, &Func{1, 1, retRound, evalFloor})
+	register([]string{"ceil", "ceiling"}, &Func{1, 1, retRound, evalCeil})
+}
+
+// rounding numbers to integers gives integers, rounding strings or
+// rounding to decimals gives floats
+func retRound(args []byte) byte {
+	if args[0] == util.KindString || (len(args) == 2 && args[0] != util.KindInt64) {
+		return util.KindFloat64
+	}
+	return util.KindInt64
+}
+
+func evalAbs(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	a := args[0]
+	switch a.GetK() {
+	case util.KindNull:
+		return nullDatum(), nil
+	case util.KindInt64:
+		if a.GetI() == math.MinInt64 {
+			return nil, errOutOfRange
+		}
+		if a.GetI() < 0 {
+			return intDatum(-a.GetI()), nil
+		}
+		return a, nil
+	}
+	return floatDatum(math.Abs(a.ToFloat64())), nil
+}
+
+func floatToInt(f float64) (*util.Datum, error) {
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return nil, errOutOfRange
+	}
+	return intDatum(int64(f)), nil
+}
+
+// round rounds half away from zero to d decimals, d may be negative
+func evalRound(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	var d int64
+	if len(args) == 2 {
+		d = args[1].ToInt64()
+	}
+	if d > 30 {
+		d = 30
+	}
+
+	x := args[0]
+	if x.GetK() == util.KindInt64 {
+		if d >= 0 {
+			return x, nil
+		}
+		if d < -18 {
+			return intDatum(0), nil
+		}
+		p := int64(math.Pow10(int(-d)))
+		i := x.GetI()
+		r := i / p * p
+		if rem := i % p; rem*2 >= p {
+			r += p
+		} else if rem*2 <= -p {
+			r -= p
+		}
+		return intDatum(r), nil
+	}
+
+	p := math.Pow10(int(d))
+	f := math.Round(x.ToFloat64()*p) / p
+	if len(args) == 2 || x.GetK() == util.KindString {
+		return floatDatum(f), nil
+	}
+	return floatToInt(f)
+}
+
+func evalFloor(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	x := args[0]
+	switch x.GetK() {
+	case util.KindNull:
+		return nullDatum(), nil
+	case util.KindInt64:
+		return x, nil
+	case util.KindString:
+		return floatDatum(math.Floor(x.ToFloat64())), nil
+	}
+	return floatToInt(math.Floor(x.ToFloat64()))
+}
+
+func evalCeil(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	x := args[0]
+	switch x.GetK() {
+	case util.KindNull:
+		return nullDatum(), nil
+	case util.KindInt64:
+		return x, nil
+	case util.KindString:
+		return floatDatum(math.Ceil(x.ToFloat64())), nil
+	}
+	return floatToInt(math.Ceil(x.ToFloat64()))
+}
@@ -0,0 +1,215 @@
+package expression
+
+import (
+	"bytes"
+	"errors"
+	"math"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func init() {
+	register([]string{"+"}, &Func{2, 2, retArith, evalPlus})
+	register([]string{"-"}, &Func{2, 2, retArith, evalMinus})
+	register([]string{"*"}, &Func{2, 2, retArith, evalMul})
+	register([]string{"/"}, &Func{2, 2, retKind(util.KindFloat64), evalDiv})
+	register([]string{"div"}, &Func{2, 2, retKind(util.KindInt64), evalIntDiv})
+	register([]string{"mod"}, &Func{2, 2, retArith, evalMod})
+	register([]string{"unaryminus"}, &Func{1, 1, retArith, evalUnaryMinus})
+
+	for name, match := range compareOps {
+		register([]string{name}, &Func{2, 2, retKind(util.KindInt64), compareFunc(match)})
+	}
+}
+
+// the comparisons, each tells whether the result of Compare matches it
+var compareOps = map[string]func(c int) bool{
+	"=":  func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+// CompareOp gives the match of a comparison, nil if name isn't one
+func CompareOp(name string) func(c int) bool {
+	return compareOps[name]
+}
+
+var errOutOfRange = errors.New("BIGINT value is out of range!")
+
+// integer arithmetic stays integer, anything else is done in floating point
+func retArith(args []byte) byte {
+	for _, k := range args {
+		if k != util.KindInt64 && k != util.KindNull {
+			return util.KindFloat64
+		}
+	}
+	return util.KindInt64
+}
+
+func isIntArgs(args []*util.Datum) bool {
+	for _, arg := range args {
+		if arg.GetK() != util.KindInt64 {
+			return false
+		}
+	}
+	return true
+}
+
+func evalPlus(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	if isIntArgs(args) {
+		a, b := args[0].GetI(), args[1].GetI()
+		r := a + b
+		if (a > 0 && b > 0 && r < 0) || (a < 0 && b < 0 && r >= 0) {
+			return nil, errOutOfRange
+		}
+		return intDatum(r), nil
+	}
+	return floatDatum(args[0].ToFloat64() + args[1].ToFloat64()), nil
+}
+
+func evalMinus(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	if isIntArgs(args) {
+		a, b := args[0].GetI(), args[1].GetI()
+		r := a - b
+		if (a >= 0 && b < 0 && r < 0) || (a < 0 && b > 0 && r >= 0) {
+			return nil, errOutOfRange
+		}
+		return intDatum(r), nil
+	}
+	return floatDatum(args[0].ToFloat64() - args[1].ToFloat64()), nil
+}
+
+func evalMul(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	if isIntArgs(args) {
+		a, b := args[0].GetI(), args[1].GetI()
+		r := a * b
+		if a != 0 && (r/a != b || (a == -1 && b == math.MinInt64)) {
+			return nil, errOutOfRange
+		}
+		return intDatum(r), nil
+	}
+	return floatDatum(args[0].ToFloat64() * args[1].ToFloat64()), nil
+}
+
+// division by zero gives null
+func evalDiv(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	b := args[1].ToFloat64()
+	if b == 0 {
+		return nullDatum(), nil
+	}
+	return floatDatum(args[0].ToFloat64() / b), nil
+}
+
+func evalIntDiv(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	if isIntArgs(args) {
+		a, b := args[0].GetI(), args[1].GetI()
+		if b == 0 {
+			return nullDatum(), nil
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, errOutOfRange
+		}
+		return intDatum(a / b), nil
+	}
+	b := args[1].ToFloat64()
+	if b == 0 {
+		return nullDatum(), nil
+	}
+	r := math.Trunc(args[0].ToFloat64() / b)
+	if r >= math.MaxInt64 || r < math.MinInt64 {
+		return nil, errOutOfRange
+	}
+	return intDatum(int64(r)), nil
+}
+
+func evalMod(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	if isIntArgs(args) {
+		a, b := args[0].GetI(), args[1].GetI()
+		if b == 0 {
+			return nullDatum(), nil
+		}
+		if b == -1 {
+			return intDatum(0), nil
+		}
+		return intDatum(a % b), nil
+	}
+	b := args[1].ToFloat64()
+	if b == 0 {
+		return nullDatum(), nil
+	}
+	return floatDatum(math.Mod(args[0].ToFloat64(), b)), nil
+}
+
+func evalUnaryMinus(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	a := args[0]
+	switch a.GetK() {
+	case util.KindNull:
+		return nullDatum(), nil
+	case util.KindInt64:
+		if a.GetI() == math.MinInt64 {
+			return nil, errOutOfRange
+		}
+		return intDatum(-a.GetI()), nil
+	}
+	return floatDatum(-a.ToFloat64()), nil
+}
+
+// Compare compares two non null datums, strings are compared as strings
+// and any other mix as numbers.
+func Compare(a *util.Datum, b *util.Datum) int {
+	switch {
+	case a.GetK() == util.KindInt64 && b.GetK() == util.KindInt64:
+		switch {
+		case a.GetI() < b.GetI():
+			return -1
+		case a.GetI() > b.GetI():
+			return 1
+		}
+		return 0
+	case a.GetK() == util.KindString && b.GetK() == util.KindString:
+		return bytes.Compare(a.GetB(), b.GetB())
+	}
+
+	fa, fb := a.ToFloat64(), b.ToFloat64()
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+func compareFunc(match func(c int) bool) func(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return func(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+		if hasNull(args) {
+			return nullDatum(), nil
+		}
+		if match(Compare(args[0], args[1])) {
+			return intDatum(1), nil
+		}
+		return intDatum(0), nil
+	}
+}
@@ -0,0 +1,42 @@
+package expression
+
+import (
+	"math"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func TestIntDiv(t *testing.T) {
+	cases := []struct {
+		a, b *util.Datum
+		want *util.Datum
+		err  error
+	}{
+		{intDatum(7), intDatum(2), intDatum(3), nil},
+		{intDatum(-7), intDatum(2), intDatum(-3), nil},
+		{intDatum(7), intDatum(0), nullDatum(), nil},
+		{intDatum(math.MinInt64), intDatum(-1), nil, errOutOfRange},
+		{floatDatum(7.5), floatDatum(2), intDatum(3), nil},
+		{floatDatum(-9223372036854775808), intDatum(-1), nil, errOutOfRange},
+		{floatDatum(-9223372036854775808), intDatum(1), intDatum(math.MinInt64), nil},
+		{floatDatum(1e30), floatDatum(-1), nil, errOutOfRange},
+		{nullDatum(), intDatum(1), nullDatum(), nil},
+	}
+
+	ctx := context.NewContext()
+	for i, c := range cases {
+		got, err := evalIntDiv(ctx, []*util.Datum{c.a, c.b})
+		if err != c.err {
+			t.Errorf("case %d: error %v, want %v", i, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.GetK() != c.want.GetK() || (!got.IsNull() && got.GetI() != c.want.GetI()) {
+			t.Errorf("case %d: got %v, want %v", i, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package expression
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+const (
+	TrimBoth int64 = iota
+	TrimLeading
+	TrimTrailing
+)
+
+func init() {
+	register([]string{"concat"}, &Func{1, -1, retKind(util.KindString), evalConcat})
+	register([]string{"length", "octet_length"}, &Func{1, 1, retKind(util.KindInt64), evalLength})
+	register([]string{"char_length", "character_length"}, &Func{1, 1, retKind(util.KindInt64), evalCharLength})
+	register([]string{"upper", "ucase"}, &Func{1, 1, retKind(util.KindString), evalUpper})
+	register([]string{"lower", "lcase"}, &Func{1, 1, retKind(util.KindString), evalLower})
+	register([]string{"substring", "substr", "mid"}, &Func{2, 3, retKind(util.KindString), evalSubstring})
+	register([]string{"trim"}, &Func{1, 3, retKind(util.KindString), evalTrim})
+	register([]string{"ltrim"}, &Func{1, 1, retKind(util.KindString), evalLTrim})
+	register([]string{"rtrim"}, &Func{1, 1, retKind(util.KindString), evalRTrim})
+	register([]string{"replace"}, &Func{3, 3, retKind(util.KindString), evalReplace})
+	register([]string{"locate"}, &Func{2, 3, retKind(util.KindInt64), evalLocate})
+}
+
+func evalConcat(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	var b []byte
+	for _, arg := range args {
+		b = append(b, arg.ToBytes()...)
+	}
+	return stringDatum(b), nil
+}
+
+func evalLength(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return intDatum(int64(len(args[0].ToBytes()))), nil
+}
+
+func evalCharLength(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return intDatum(int64(utf8.RuneCount(args[0].ToBytes()))), nil
+}
+
+func evalUpper(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return stringDatum(bytes.ToUpper(args[0].ToBytes())), nil
+}
+
+func evalLower(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return stringDatum(bytes.ToLower(args[0].ToBytes())), nil
+}
+
+// positions count characters from 1, negative positions count from the end
+func evalSubstring(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	rs := []rune(string(args[0].ToBytes()))
+	pos := args[1].ToInt64()
+	var start int64
+	switch {
+	case pos > 0:
+		start = pos - 1
+	case pos < 0:
+		start = int64(len(rs)) + pos
+	default:
+		return stringDatum([]byte{}), nil
+	}
+	if start < 0 || start >= int64(len(rs)) {
+		return stringDatum([]byte{}), nil
+	}
+
+	end := int64(len(rs))
+	if len(args) == 3 {
+		n := args[2].ToInt64()
+		if n <= 0 {
+			return stringDatum([]byte{}), nil
+		}
+		if start+n < end {
+			end = start + n
+		}
+	}
+	return stringDatum([]byte(string(rs[start:end]))), nil
+}
+
+// trim takes the string, the string to remove and the direction
+func evalTrim(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	s := string(args[0].ToBytes())
+	rem := " "
+	if len(args) > 1 {
+		rem = string(args[1].ToBytes())
+	}
+	dir := TrimBoth
+	if len(args) > 2 {
+		dir = args[2].ToInt64()
+	}
+
+	if rem != "" {
+		if dir != TrimTrailing {
+			for strings.HasPrefix(s, rem) {
+				s = s[len(rem):]
+			}
+		}
+		if dir != TrimLeading {
+			for strings.HasSuffix(s, rem) {
+				s = s[:len(s)-len(rem)]
+			}
+		}
+	}
+	return stringDatum([]byte(s)), nil
+}
+
+func evalLTrim(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return stringDatum(bytes.TrimLeft(args[0].ToBytes(), " ")), nil
+}
+
+func evalRTrim(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+	return stringDatum(bytes.TrimRight(args[0].ToBytes(), " ")), nil
+}
+
+func evalReplace(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	s, from := args[0].ToBytes(), args[1].ToBytes()
+	if len(from) == 0 {
+		return stringDatum(s), nil
+	}
+	return stringDatum(bytes.Replace(s, from, args[2].ToBytes(), -1)), nil
+}
+
+// locate gives the character position of the first match from pos, 0 if none
+func evalLocate(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	sub := []rune(string(args[0].ToBytes()))
+	rs := []rune(string(args[1].ToBytes()))
+	pos := int64(1)
+	if len(args) == 3 {
+		pos = args[2].ToInt64()
+	}
+	if pos < 1 || pos > int64(len(rs))+1 {
+		return intDatum(0), nil
+	}
+
+	i := strings.Index(string(rs[pos-1:]), string(sub))
+	if i < 0 {
+		return intDatum(0), nil
+	}
+	return intDatum(pos + int64(utf8.RuneCountInString(string(rs[pos-1:])[:i]))), nil
+}
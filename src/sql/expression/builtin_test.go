@@ -0,0 +1,101 @@
+package expression
+
+import (
+	"math"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/mysql"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		args []*util.Datum
+		want string
+	}{
+		{[]*util.Datum{floatDatum(-0.5), intDatum(0)}, "-1"},
+		{[]*util.Datum{floatDatum(-0.4), intDatum(0)}, "0"},
+		{[]*util.Datum{floatDatum(2.5), intDatum(0)}, "3"},
+		{[]*util.Datum{floatDatum(1234.5678), intDatum(2)}, "1,234.57"},
+		{[]*util.Datum{intDatum(-1234567), intDatum(0)}, "-1,234,567"},
+	}
+
+	for i, c := range cases {
+		got, err := evalFormat(context.NewContext(), c.args)
+		if err != nil || string(got.GetB()) != c.want {
+			t.Errorf("case %d: got %v %v, want %s", i, got, err, c.want)
+		}
+	}
+}
+
+func TestFormatUnknownLocale(t *testing.T) {
+	ctx := context.NewContext()
+	got, err := evalFormat(ctx, []*util.Datum{floatDatum(1234.5), intDatum(1), stringDatum([]byte("xx_XX"))})
+	if err != nil || string(got.GetB()) != "1,234.5" {
+		t.Fatalf("got %v %v", got, err)
+	}
+	if ws := ctx.Warnings(); len(ws) != 1 || ws[0].Code != mysql.ErrUnknownLocale {
+		t.Fatalf("warnings %v", ws)
+	}
+}
+
+func TestCastUnsigned(t *testing.T) {
+	cases := []struct {
+		arg  *util.Datum
+		want int64
+		err  error
+	}{
+		{intDatum(7), 7, nil},
+		{floatDatum(7.5), 8, nil},
+		{stringDatum([]byte("12abc")), 12, nil},
+		{intDatum(-1), 0, errUnsignedRange},
+		{floatDatum(-3), 0, errUnsignedRange},
+		{stringDatum([]byte("18446744073709551615")), 0, errUnsignedRange},
+	}
+
+	for i, c := range cases {
+		got, err := evalCastUnsigned(context.NewContext(), []*util.Datum{c.arg})
+		if err != c.err || (err == nil && got.GetI() != c.want) {
+			t.Errorf("case %d: got %v %v, want %d %v", i, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestAbs(t *testing.T) {
+	if _, err := evalAbs(context.NewContext(), []*util.Datum{intDatum(math.MinInt64)}); err != errOutOfRange {
+		t.Fatalf("ABS(-9223372036854775808): %v", err)
+	}
+	got, err := evalAbs(context.NewContext(), []*util.Datum{intDatum(math.MinInt64 + 1)})
+	if err != nil || got.GetI() != math.MaxInt64 {
+		t.Fatalf("got %v %v", got, err)
+	}
+}
+
+func TestDateFormatWeeks(t *testing.T) {
+	cases := []struct {
+		date string
+		want string
+	}{
+		// a monday
+		{"2024-01-01", "00 01 2023-53 2024-01"},
+		// a sunday
+		{"2023-01-01", "01 00 2023-01 2022-52"},
+		{"2023-12-31", "53 52 2023-53 2023-52"},
+		// a friday
+		{"2021-01-01", "00 00 2020-52 2020-53"},
+		{"2021-01-04", "01 01 2021-01 2021-01"},
+	}
+
+	for _, c := range cases {
+		got, err := evalDateFormat(context.NewContext(), []*util.Datum{stringDatum([]byte(c.date)), stringDatum([]byte("%U %u %X-%V %x-%v"))})
+		if err != nil || string(got.GetB()) != c.want {
+			t.Errorf("%s: got %s %v, want %s", c.date, got.GetB(), err, c.want)
+		}
+	}
+
+	got, _ := evalDateFormat(context.NewContext(), []*util.Datum{stringDatum([]byte("2024-03-22")), stringDatum([]byte("%D %D"))})
+	if string(got.GetB()) != "22nd 22nd" {
+		t.Errorf("got %s", got.GetB())
+	}
+}
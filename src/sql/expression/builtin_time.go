@@ -0,0 +1,253 @@
+package expression
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	datetimeLayout = "2006-01-02 15:04:05"
+)
+
+func init() {
+	register([]string{"now", "current_timestamp", "localtime", "localtimestamp", "sysdate"}, &Func{0, 0, retKind(util.KindString), evalNow})
+	register([]string{"curdate", "current_date"}, &Func{0, 0, retKind(util.KindString), evalCurDate})
+	register([]string{"date_format"}, &Func{2, 2, retKind(util.KindString), evalDateFormat})
+	register([]string{"date_add", "adddate"}, &Func{3, 3, retKind(util.KindString), evalDateAdd(1)})
+	register([]string{"date_sub", "subdate"}, &Func{3, 3, retKind(util.KindString), evalDateAdd(-1)})
+}
+
+func evalNow(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return stringDatum([]byte(time.Now().Format(datetimeLayout))), nil
+}
+
+func evalCurDate(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return stringDatum([]byte(time.Now().Format(dateLayout))), nil
+}
+
+// parseTime parses a date or datetime string, hasTime reports whether
+// the string had a time part.
+func parseTime(s string) (t time.Time, hasTime bool, ok bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05.999999", datetimeLayout, "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true, true
+		}
+	}
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, false, true
+	}
+	return time.Time{}, false, false
+}
+
+// formatTime formats t with the specifiers of MySQL DATE_FORMAT.
+func formatTime(t time.Time, format string) string {
+	var b []byte
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b = append(b, format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			b = append(b, t.Format("2006")...)
+		case 'y':
+			b = append(b, t.Format("06")...)
+		case 'm':
+			b = append(b, t.Format("01")...)
+		case 'c':
+			b = strconv.AppendInt(b, int64(t.Month()), 10)
+		case 'M':
+			b = append(b, t.Month().String()...)
+		case 'b':
+			b = append(b, t.Format("Jan")...)
+		case 'd':
+			b = append(b, t.Format("02")...)
+		case 'e':
+			b = strconv.AppendInt(b, int64(t.Day()), 10)
+		case 'j':
+			b = append(b, t.Format("002")...)
+		case 'W':
+			b = append(b, t.Weekday().String()...)
+		case 'a':
+			b = append(b, t.Format("Mon")...)
+		case 'w':
+			b = strconv.AppendInt(b, int64(t.Weekday()), 10)
+		case 'D':
+			b = strconv.AppendInt(b, int64(t.Day()), 10)
+			b = append(b, daySuffix(t.Day())...)
+		case 'U':
+			b = appendTwoDigits(b, sundayWeek(t))
+		case 'u':
+			b = appendTwoDigits(b, mondayWeek(t))
+		case 'V':
+			_, week := sundayYearWeek(t)
+			b = appendTwoDigits(b, week)
+		case 'X':
+			year, _ := sundayYearWeek(t)
+			b = strconv.AppendInt(b, int64(year), 10)
+		case 'v':
+			_, week := t.ISOWeek()
+			b = appendTwoDigits(b, week)
+		case 'x':
+			year, _ := t.ISOWeek()
+			b = strconv.AppendInt(b, int64(year), 10)
+		case 'H':
+			b = append(b, t.Format("15")...)
+		case 'k':
+			b = strconv.AppendInt(b, int64(t.Hour()), 10)
+		case 'h', 'I':
+			b = append(b, t.Format("03")...)
+		case 'l':
+			b = append(b, t.Format("3")...)
+		case 'i':
+			b = append(b, t.Format("04")...)
+		case 's', 'S':
+			b = append(b, t.Format("05")...)
+		case 'f':
+			b = append(b, t.Format(".000000")[1:]...)
+		case 'p':
+			b = append(b, t.Format("PM")...)
+		case 'T':
+			b = append(b, t.Format("15:04:05")...)
+		case 'r':
+			b = append(b, t.Format("03:04:05 PM")...)
+		default:
+			// %% and unknown specifiers give the character itself
+			b = append(b, format[i])
+		}
+	}
+	return string(b)
+}
+
+func appendTwoDigits(b []byte, n int) []byte {
+	if n < 10 {
+		b = append(b, '0')
+	}
+	return strconv.AppendInt(b, int64(n), 10)
+}
+
+func daySuffix(day int) string {
+	if day/10 != 1 {
+		switch day % 10 {
+		case 1:
+			return "st"
+		case 2:
+			return "nd"
+		case 3:
+			return "rd"
+		}
+	}
+	return "th"
+}
+
+// sundayWeek is the week of %U, weeks start on sunday and the days before
+// the first sunday of the year are in week 0
+func sundayWeek(t time.Time) int {
+	return (t.YearDay() + 6 - int(t.Weekday())) / 7
+}
+
+// mondayWeek is the week of %u, weeks start on monday and week 1 is the
+// first one with more than 3 days in the year
+func mondayWeek(t time.Time) int {
+	jan1 := (int(t.AddDate(0, 0, 1-t.YearDay()).Weekday()) + 6) % 7
+	week := (t.YearDay() - 1 + jan1) / 7
+	if jan1 <= 3 {
+		week++
+	}
+	return week
+}
+
+// sundayYearWeek is the year and week of %X and %V, like %U but the days
+// before the first sunday are in the last week of the year before
+func sundayYearWeek(t time.Time) (int, int) {
+	if week := sundayWeek(t); week > 0 {
+		return t.Year(), week
+	}
+	dec31 := t.AddDate(0, 0, -t.YearDay())
+	return dec31.Year(), sundayWeek(dec31)
+}
+
+// invalid dates give null
+func evalDateFormat(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	if hasNull(args) {
+		return nullDatum(), nil
+	}
+
+	t, _, ok := parseTime(string(args[0].ToBytes()))
+	if !ok {
+		return nullDatum(), nil
+	}
+	return stringDatum([]byte(formatTime(t, string(args[1].ToBytes())))), nil
+}
+
+// adding months keeps the day in the month, 2019-01-31 + 1 month is 2019-02-28
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	if d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+/*
+ * date_add takes the date, the interval and its unit:
+ *		DATE_ADD(date, INTERVAL n unit)
+ * dates without a time part stay dates unless the unit is smaller than a day.
+ */
+func evalDateAdd(sign int64) func(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+	return func(ctx *context.Context, args []*util.Datum) (*util.Datum, error) {
+		if hasNull(args) {
+			return nullDatum(), nil
+		}
+
+		t, hasTime, ok := parseTime(string(args[0].ToBytes()))
+		if !ok {
+			return nullDatum(), nil
+		}
+		n := sign * args[1].ToInt64()
+		switch strings.ToUpper(string(args[2].ToBytes())) {
+		case "MICROSECOND":
+			t = t.Add(time.Duration(n) * time.Microsecond)
+			hasTime = true
+		case "SECOND":
+			t = t.Add(time.Duration(n) * time.Second)
+			hasTime = true
+		case "MINUTE":
+			t = t.Add(time.Duration(n) * time.Minute)
+			hasTime = true
+		case "HOUR":
+			t = t.Add(time.Duration(n) * time.Hour)
+			hasTime = true
+		case "DAY":
+			t = t.AddDate(0, 0, int(n))
+		case "WEEK":
+			t = t.AddDate(0, 0, int(n)*7)
+		case "MONTH":
+			t = addMonths(t, int(n))
+		case "QUARTER":
+			t = addMonths(t, int(n)*3)
+		case "YEAR":
+			t = addMonths(t, int(n)*12)
+		default:
+			return nil, errors.New("unsupport interval unit " + string(args[2].ToBytes()) + "!")
+		}
+
+		if !hasTime {
+			return stringDatum([]byte(t.Format(dateLayout))), nil
+		}
+		if t.Nanosecond() != 0 {
+			return stringDatum([]byte(t.Format("2006-01-02 15:04:05.000000"))), nil
+		}
+		return stringDatum([]byte(t.Format(datetimeLayout))), nil
+	}
+}
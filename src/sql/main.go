@@ -28,6 +28,10 @@ var (
 	dsport = flag.String("dsport", "6379", "distkv server sys port")
 	duhost = flag.String("duhost", "0.0.0.0", "distkv server user host")
 	duport = flag.String("duport", "6379", "distkv server user port")
+
+	//executor flag
+	fetchBatch  = flag.Int("fetch_batch_size", 100, "rows read from the storage in one round trip")
+	maxExecTime = flag.Int("max_execution_time", 0, "milliseconds a SELECT may run, 0 for no limit")
 )
 
 func init() {
@@ -38,11 +42,13 @@ func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	cfg := &server.Config{
-		Addr:         fmt.Sprintf("%s:%s", *shost, *sport),
-		RedisAddr:    fmt.Sprintf("%s:%s", *rhost, *rport),
-		StorageType:  *stype,
-		DistSysAddr:  fmt.Sprintf("%s:%s", *dshost, *dsport),
-		DistUserAddr: fmt.Sprintf("%s:%s", *duhost, *duport),
+		Addr:             fmt.Sprintf("%s:%s", *shost, *sport),
+		RedisAddr:        fmt.Sprintf("%s:%s", *rhost, *rport),
+		StorageType:      *stype,
+		DistSysAddr:      fmt.Sprintf("%s:%s", *dshost, *dsport),
+		DistUserAddr:     fmt.Sprintf("%s:%s", *duhost, *duport),
+		FetchBatchSize:   *fetchBatch,
+		MaxExecutionTime: *maxExecTime,
 	}
 
 	svr, err := server.NewServer(cfg)
@@ -63,6 +69,8 @@ func main() {
 		return
 	}
 
+	svr.StartDDLWorker()
+
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc,
 		syscall.SIGHUP,
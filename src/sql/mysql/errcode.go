@@ -882,4 +882,6 @@ const (
 	ErrMustChangePasswordLogin                                      = 1862
 	ErrRowInWrongPartition                                          = 1863
 	ErrErrorLast                                                    = 1863
+
+	ErrQueryTimeout = 3024
 )
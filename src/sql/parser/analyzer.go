@@ -1,11 +1,13 @@
 package parser
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/mysql"
 	"github.com/castermode/Nesoi/src/sql/store"
 	"github.com/castermode/Nesoi/src/sql/util"
 )
@@ -37,7 +39,7 @@ func (a *Analyzer) Analyze(stmts []Statement) ([]Statement, error) {
 			} else {
 				query = stmt
 			}
-		case Rows, RowsAffected:
+		case Rows, RowsAffected, Ack:
 			query, err = a.transformStmt(stmt)
 			if err != nil {
 				return nil, err
@@ -51,37 +53,13 @@ func (a *Analyzer) Analyze(stmts []Statement) ([]Statement, error) {
 	return querys, nil
 }
 
-func (a *Analyzer) getColumnDefs(tname string) (ColumnTableDefs, error) {
-	tableKey := store.SystemFlag + store.TableFlag + tname
-	tableValue, err := a.driver.GetSysRecord(tableKey)
+func (a *Analyzer) getTableInfo(tname string) (*TableInfo, ColumnTableDefs, error) {
+	table, err := LoadTableInfo(a.driver, tname)
 	if err != nil {
-		return nil, err
-	}
-
-	cjds := ColumnTableJsonDefs{}
-	cds := ColumnTableDefs{}
-	err = json.Unmarshal(util.ToSlice(tableValue), &cjds)
-	if err != nil {
-		return nil, err
-	}
-	for _, cjd := range cjds {
-		cd := &ColumnTableDef{
-			Name:       cjd.Name,
-			Pos:        cjd.Pos,
-			Nullable:   cjd.Nullable,
-			PrimaryKey: cjd.PrimaryKey,
-			Unique:     cjd.Unique,
-		}
-		switch cjd.Type {
-		case SqlInt:
-			cd.Type = &IntType{Name: "INT"}
-		case SqlString:
-			cd.Type = &StringType{Name: "STRING"}
-		}
-		cds = append(cds, cd)
+		return nil, nil, err
 	}
 
-	return cds, nil
+	return table, table.ColumnDefs(), nil
 }
 
 func (a *Analyzer) transformStmt(stmt Statement) (Statement, error) {
@@ -98,12 +76,136 @@ func (a *Analyzer) transformStmt(stmt Statement) (Statement, error) {
 		return &Show{Operator: SDATABASES}, nil
 	case *ShowTables:
 		return &Show{Operator: STABLES}, nil
+	case *ShowWarnings:
+		return &Show{Operator: SWARNINGS}, nil
+	case *ShowVariables:
+		sv := stmt.(*ShowVariables)
+		return &Show{Operator: SVARIABLES, Global: sv.Global, Pattern: sv.Pattern}, nil
+	case *ShowProcessList:
+		return &Show{Operator: SPROCESSLIST, Full: stmt.(*ShowProcessList).Full}, nil
+	case *AdminShowDDLJobs:
+		return &Show{Operator: SDDLJOBS}, nil
+	case *Explain:
+		return a.transformExplain(stmt)
+	case *AnalyzeTable:
+		return a.transformAnalyzeTable(stmt)
+	case *SetStmt:
+		return a.transformSet(stmt)
+	case *KillStmt:
+		return stmt, nil
 	}
 
 	return nil, errors.New("unsupport statement: " + stmt.String())
 }
 
-func (a *Analyzer) transformTarget(expr Expr, cds ColumnTableDefs) ([]*TargetRes, bool, error) {
+type scopeColumn struct {
+	name string
+	pos  int
+	kind byte
+}
+
+/*
+ * tableScope is the table whose columns a statement refers to, columns
+ * may be qualified with the alias of the table, or with its name and
+ * optionally its database when it has no alias. A derived table has only
+ * an alias, a query without FROM has no columns at all.
+ *
+ * Every subquery gets its own scope whose outer is the scope of the query
+ * it appears in. A name not found in a scope is looked up in the enclosing
+ * ones, and all scopes in between are marked as correlated.
+ */
+type tableScope struct {
+	table *TableInfo
+	alias string
+	cols  []*scopeColumn
+	outer *tableScope
+	// a column of an enclosing scope is referred to
+	correlated bool
+	// the scope of ON DUPLICATE KEY UPDATE, where VALUES(col) is allowed
+	insert bool
+}
+
+func newTableScope(table *TableInfo, alias string, cds ColumnTableDefs, outer *tableScope) *tableScope {
+	scope := &tableScope{table: table, alias: alias, outer: outer}
+	for _, cd := range cds {
+		scope.cols = append(scope.cols, &scopeColumn{name: cd.Name, pos: cd.Pos, kind: ColumnKind(cd.Type)})
+	}
+	return scope
+}
+
+// columns of a nil scope are empty
+func (scope *tableScope) columns() []*scopeColumn {
+	if scope == nil {
+		return nil
+	}
+	return scope.cols
+}
+
+func (scope *tableScope) columnName(pos int) string {
+	for _, col := range scope.columns() {
+		if col.pos == pos {
+			return col.name
+		}
+	}
+	return ""
+}
+
+// resolveColumn looks a column up in scope first and then outwards, Depth
+// of the target is the number of scopes it went out.
+func (scope *tableScope) resolveColumn(v *VariableExpr) (*TargetRes, error) {
+	depth := 0
+	for s := scope; s != nil; s = s.outer {
+		if s.checkQualifier(v) == nil {
+			for _, col := range s.cols {
+				if strings.EqualFold(v.Name, col.name) {
+					for c := scope; c != s; c = c.outer {
+						c.correlated = true
+					}
+					return &TargetRes{Type: ETARGET, FieldID: col.pos, RetType: col.kind, Depth: depth}, nil
+				}
+			}
+		}
+		depth++
+	}
+
+	return nil, errors.New("Invalid target name " + qualifiedName(v))
+}
+
+func qualifiedName(v *VariableExpr) string {
+	name := v.Name
+	if v.Type == EALLTARGET {
+		name = "*"
+	}
+	if v.Table != "" {
+		name = v.Table + "." + name
+	}
+	if v.Schema != "" {
+		name = v.Schema + "." + name
+	}
+	return name
+}
+
+func (scope *tableScope) checkQualifier(v *VariableExpr) error {
+	if v.Table == "" {
+		return nil
+	}
+	if scope != nil {
+		if scope.alias != "" {
+			if v.Schema == "" && v.Table == scope.alias {
+				return nil
+			}
+		} else if scope.table != nil {
+			st := strings.SplitN(scope.table.Name, ".", 2)
+			if (v.Schema == "" || v.Schema == st[0]) && v.Table == st[1] {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("Invalid target name " + qualifiedName(v))
+}
+
+func (a *Analyzer) transformTarget(expr Expr, scope *tableScope) ([]*TargetRes, bool, error) {
 	if expr == nil {
 		return nil, false, errors.New("invalid target value")
 	}
@@ -114,31 +216,29 @@ func (a *Analyzer) transformTarget(expr Expr, cds ColumnTableDefs) ([]*TargetRes
 		var all bool
 		vtarget := expr.(*VariableExpr)
 		if vtarget.Type == EALLTARGET {
+			if err := scope.checkQualifier(vtarget); err != nil {
+				return nil, false, err
+			}
 			all = true
-			for _, cd := range cds {
+			for _, col := range scope.columns() {
 				tgr := &TargetRes{Type: ETARGET}
-				tgr.TargetID = cd.Pos
-				tgr.FieldID = cd.Pos
+				tgr.TargetID = col.pos
+				tgr.FieldID = col.pos
+				tgr.RetType = col.kind
 				tgrs = append(tgrs, tgr)
 			}
 		} else if vtarget.Type == ETARGET {
-			var find bool = false
-			tgr := &TargetRes{Type: ETARGET}
-			for _, cd := range cds {
-				if strings.EqualFold(vtarget.Name, cd.Name) {
-					tgr.FieldID = cd.Pos
-					find = true
-					break
-				}
-			}
-			if !find {
-				return nil, false, errors.New("Invalid target name " + vtarget.Name)
+			tgr, err := scope.resolveColumn(vtarget)
+			if err != nil {
+				return nil, false, err
 			}
 			tgrs = append(tgrs, tgr)
 		} else {
 			//sysVar
-			tgr := &TargetRes{Type: ESYSVAR}
-			tgr.SysVar = vtarget.Name[2:]
+			tgr, err := a.transformSysVar(vtarget.Name)
+			if err != nil {
+				return nil, false, err
+			}
 			tgrs = append(tgrs, tgr)
 		}
 		return tgrs, all, nil
@@ -146,11 +246,181 @@ func (a *Analyzer) transformTarget(expr Expr, cds ColumnTableDefs) ([]*TargetRes
 		tgr := &TargetRes{Type: EVALUE}
 		vtarget := expr.(*ValueExpr)
 		tgr.Value = vtarget.Item
+		switch v := vtarget.Item.(type) {
+		case int64:
+			tgr.RetType = util.KindInt64
+		case uint64:
+			tgr.Value = float64(v)
+			tgr.RetType = util.KindFloat64
+		case float64:
+			tgr.RetType = util.KindFloat64
+		case string:
+			tgr.RetType = util.KindString
+		case nil:
+			tgr.RetType = util.KindNull
+		default:
+			return nil, false, errors.New("unsupport value type!")
+		}
 		tgrs = append(tgrs, tgr)
 		return tgrs, false, nil
 	}
 
-	return nil, false, errors.New("unsupport target type: " + expr.String())
+	tgr, err := a.transformExpr(expr, scope)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(tgrs, tgr), false, nil
+}
+
+var (
+	comparisonFuncs = []string{EQ: "=", NE: "!=", LT: "<", LE: "<=", GT: ">", GE: ">="}
+	logicFuncs      = []string{LogicAnd: "and", LogicOr: "or", LogicXor: "xor"}
+	arithFuncs      = []string{PLUS: "+", MINUS: "-", MULT: "*", DIVIDE: "/", INTDIV: "div", MODULO: "mod", UMINUS: "unaryminus"}
+	castFuncs       = []string{
+		CastSigned:   "cast_as_signed",
+		CastUnsigned: "cast_as_unsigned",
+		CastChar:     "cast_as_char",
+		CastBinary:   "cast_as_binary",
+		CastDouble:   "cast_as_double",
+		CastDecimal:  "cast_as_decimal",
+	}
+)
+
+// transformExpr transforms an expression giving a single value, operators
+// become calls of the builtin functions registered in package expression.
+func (a *Analyzer) transformExpr(expr Expr, scope *tableScope) (*TargetRes, error) {
+	switch e := expr.(type) {
+	case *VariableExpr, *ValueExpr:
+		tgrs, all, err := a.transformTarget(expr, scope)
+		if err != nil {
+			return nil, err
+		}
+		if all {
+			return nil, errors.New("invalid use of *")
+		}
+		return tgrs[0], nil
+	case *ComparisonExpr:
+		return a.transformFunc(comparisonFuncs[e.Operator], scope, e.Left, e.Right)
+	case *BinaryExpr:
+		return a.transformFunc(arithFuncs[e.Operator], scope, e.Left, e.Right)
+	case *LogicalExpr:
+		return a.transformFunc(logicFuncs[e.Operator], scope, e.Left, e.Right)
+	case *NotExpr:
+		return a.transformFunc("not", scope, e.Expr)
+	case *InExpr:
+		var tgr *TargetRes
+		var err error
+		if e.Sub != nil {
+			tgr = &TargetRes{Type: EINSUBQUERY, RetType: util.KindInt64}
+			var lhs *TargetRes
+			lhs, err = a.transformExpr(e.Expr, scope)
+			if err != nil {
+				return nil, err
+			}
+			tgr.Args = []*TargetRes{lhs}
+			tgr.Sub, err = a.transformSubquery(e.Sub, scope)
+		} else {
+			tgr, err = a.transformFunc("in", scope, append(Exprs{e.Expr}, e.List...)...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e.Not {
+			tgr = &TargetRes{Type: EFUNC, FuncName: "not", Args: []*TargetRes{tgr}, RetType: util.KindInt64}
+		}
+		return tgr, nil
+	case *ExistsExpr:
+		sub, _, err := a.transformSelect(e.Sub.Select, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &TargetRes{Type: EEXISTS, Sub: sub, RetType: util.KindInt64}, nil
+	case *SubqueryExpr:
+		sub, err := a.transformSubquery(e, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &TargetRes{Type: ESUBQUERY, Sub: sub, RetType: sub.Fields[0].RetType}, nil
+	case *UnaryExpr:
+		return a.transformFunc(arithFuncs[e.Operator], scope, e.Expr)
+	case *FuncCallExpr:
+		args := e.Args
+		if n := len(args); n > 0 {
+			if interval, ok := args[n-1].(*IntervalExpr); ok {
+				args = append(args[:n-1:n-1], interval.Value, &ValueExpr{Item: interval.Unit})
+			}
+		}
+		return a.transformFunc(e.Name, scope, args...)
+	case *CaseExpr:
+		var args Exprs
+		for _, w := range e.Whens {
+			cond := w.Cond
+			if e.Value != nil {
+				cond = &ComparisonExpr{Operator: EQ, Left: e.Value, Right: w.Cond}
+			}
+			args = append(args, cond, w.Result)
+		}
+		if e.Else != nil {
+			args = append(args, e.Else)
+		}
+		return a.transformFunc("case", scope, args...)
+	case *ValuesExpr:
+		if scope == nil || !scope.insert {
+			return nil, errors.New("VALUES() is only allowed in ON DUPLICATE KEY UPDATE")
+		}
+		// the row to insert is evaluated as the row one level out
+		tgr, err := scope.resolveColumn(&VariableExpr{Type: ETARGET, Name: e.Name})
+		if err != nil {
+			return nil, err
+		}
+		tgr.Depth = 1
+		return tgr, nil
+	case *CastExpr:
+		args := Exprs{e.Expr}
+		if e.Len >= 0 {
+			args = append(args, &ValueExpr{Item: e.Len})
+		}
+		return a.transformFunc(castFuncs[e.Type], scope, args...)
+	}
+
+	return nil, errors.New("unsupport target type: " + expr.String())
+}
+
+func (a *Analyzer) transformFunc(name string, scope *tableScope, args ...Expr) (*TargetRes, error) {
+	fn := expression.GetFunc(name)
+	if fn == nil {
+		return nil, errors.New("FUNCTION " + name + " does not exist!")
+	}
+	err := fn.CheckArgs(name, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	tgr := &TargetRes{Type: EFUNC, FuncName: strings.ToLower(name)}
+	var kinds []byte
+	for _, arg := range args {
+		atgr, err := a.transformExpr(arg, scope)
+		if err != nil {
+			return nil, err
+		}
+		tgr.Args = append(tgr.Args, atgr)
+		kinds = append(kinds, atgr.RetType)
+	}
+	tgr.RetType = fn.RetType(kinds)
+
+	return tgr, nil
+}
+
+// transformSubquery transforms a subquery giving a single column
+func (a *Analyzer) transformSubquery(e *SubqueryExpr, scope *tableScope) (*SelectQuery, error) {
+	sub, _, err := a.transformSelect(e.Select, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(sub.Fields) != 1 {
+		return nil, errors.New("Operand should contain 1 column(s)")
+	}
+	return sub, nil
 }
 
 func (a *Analyzer) transformCreateIndex(stmt Statement) (Statement, error) {
@@ -158,23 +428,24 @@ func (a *Analyzer) transformCreateIndex(stmt Statement) (Statement, error) {
 
 	// transform table
 	tblName := a.context.GetTableName(cistmt.Table.Schema, cistmt.Table.Name)
-	idxName := a.context.GetTableName(cistmt.Index.Schema, cistmt.Table.Name)
-	cds, err := a.getColumnDefs(tblName)
+	table, _, err := a.getTableInfo(tblName)
 	if err != nil {
 		return nil, err
 	}
-	var cm map[int]*ColumnTableDef
-	cm = make(map[int]*ColumnTableDef)
-	for _, cd := range cds {
-		cm[cd.Pos-1] = cd
-	}
-	table := &TableInfo{Name: tblName, ColumnMap: cm}
+	return a.AnalyzeCreateIndex(cistmt, table)
+}
+
+// AnalyzeCreateIndex analyzes the index against table, which ALTER TABLE
+// gives as it is before the statement is saved
+func (a *Analyzer) AnalyzeCreateIndex(cistmt *CreateIndex, table *TableInfo) (*CreateIndexQuery, error) {
+	idxName := a.context.GetTableName(cistmt.Index.Schema, cistmt.Index.Name)
+	scope := newTableScope(table, "", table.ColumnDefs(), nil)
 
 	//transform target
 	i := 1
 	var tgrs []*TargetRes
 	for _, target := range cistmt.Targets {
-		tgrs1, all, err := a.transformTarget(target.Item, cds)
+		tgrs1, all, err := a.transformTarget(target.Item, scope)
 		if err != nil {
 			return nil, err
 		}
@@ -185,6 +456,9 @@ func (a *Analyzer) transformCreateIndex(stmt Statement) (Statement, error) {
 			break
 		} else {
 			tgr := tgrs1[0]
+			if tgr.Type != ETARGET {
+				return nil, errors.New("index target must be a column!")
+			}
 			tgr.TargetID = i
 			tgrs = append(tgrs, tgr)
 		}
@@ -192,8 +466,7 @@ func (a *Analyzer) transformCreateIndex(stmt Statement) (Statement, error) {
 	}
 
 	//transform index
-	sysIndexTableKey := store.SystemFlag + store.IndexFlag + store.TableFlag + idxName
-	_, err = a.driver.GetSysRecord(sysIndexTableKey)
+	_, err := a.driver.GetSysRecord(IndexTableKey(idxName))
 	if err == nil {
 		return nil, errors.New("index name already exists!")
 	}
@@ -201,13 +474,11 @@ func (a *Analyzer) transformCreateIndex(stmt Statement) (Statement, error) {
 		return nil, err
 	}
 	fieldsNum := len(tgrs)
-	sysTableIndexKey := store.SystemFlag + store.TableFlag + store.IndexFlag
-	sysTableIndexKey += util.ToString(util.DumpLengthEncodedString(util.ToSlice(tblName)))
-	sysTableIndexKey += util.ToString(util.DumpLengthEncodedInt(uint64(fieldsNum)))
+	var fields []int
 	for _, tgr := range tgrs {
-		sysTableIndexKey += util.ToString(util.DumpLengthEncodedInt(uint64(tgr.FieldID)))
+		fields = append(fields, table.ColumnMap[tgr.FieldID-1].ID)
 	}
-	_, err = a.driver.GetSysRecord(sysTableIndexKey)
+	_, err = a.driver.GetSysRecord(TableIndexKey(table.Name, fields))
 	if err == nil {
 		return nil, errors.New("index column has already exists!")
 	}
@@ -226,114 +497,277 @@ func (a *Analyzer) transformCreateIndex(stmt Statement) (Statement, error) {
 }
 
 func (a *Analyzer) transformSelectStmt(stmt Statement) (Statement, error) {
-	sstmt := stmt.(*SelectStmt)
+	query, _, err := a.transformSelect(stmt.(*SelectStmt), nil)
+	if err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// isColumnQual tells whether a where clause is column = value
+func isColumnQual(cond *TargetRes) bool {
+	if cond.Type != EFUNC || cond.FuncName != comparisonFuncs[EQ] {
+		return false
+	}
+	l, r := cond.Args[0], cond.Args[1]
+	return l.Type == ETARGET && l.Depth == 0 && r.Type == EVALUE && r.Value != nil
+}
+
+/*
+ * transformSelect transforms a select whose enclosing query has the scope
+ * outer, nil at the top. It also returns the names of the result columns,
+ * which are the columns of the select used as a derived table.
+ */
+func (a *Analyzer) transformSelect(sstmt *SelectStmt, outer *tableScope) (*SelectQuery, []string, error) {
+	if sstmt.SetOpr != nil {
+		return a.transformSetOpr(sstmt, outer)
+	}
 
 	var from *TableInfo
-	var cds ColumnTableDefs
-	var tblName string
-	var err error
+	var fromQuery *SelectQuery
+	var alias string
+	var stats *TableStats
+	var indexes []*IndexInfo
+	scope := &tableScope{outer: outer}
 	// transform from clause
-	if sstmt.From != nil {
-		tblName = a.context.GetTableName(sstmt.From.Schema, sstmt.From.Name)
-		cds, err = a.getColumnDefs(tblName)
+	if sstmt.From != nil && sstmt.From.Select != nil {
+		// derived tables can't refer to the enclosing queries
+		sub, names, err := a.transformSelect(sstmt.From.Select, nil)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		var cm map[int]*ColumnTableDef
-		cm = make(map[int]*ColumnTableDef)
-		for _, cd := range cds {
-			cm[cd.Pos-1] = cd
+		fromQuery = sub
+		alias = sstmt.From.AsName
+		scope.alias = alias
+		for i, f := range sub.Fields {
+			for _, col := range scope.cols {
+				if strings.EqualFold(col.name, names[i]) {
+					return nil, nil, errors.New("Duplicate column name '" + names[i] + "'")
+				}
+			}
+			scope.cols = append(scope.cols, &scopeColumn{name: names[i], pos: i + 1, kind: f.RetType})
 		}
+	} else if sstmt.From != nil {
+		tblName := a.context.GetTableName(sstmt.From.Schema, sstmt.From.Name)
+		if table := MemoryTableInfo(tblName); table != nil {
+			// a memory table has no statistics nor indexes
+			from = table
+			alias = sstmt.From.AsName
+			scope = newTableScope(table, alias, table.ColumnDefs(), outer)
+		} else {
+			table, cds, err := a.getTableInfo(tblName)
+			if err != nil {
+				return nil, nil, err
+			}
+			from = table
+			alias = sstmt.From.AsName
+			scope = newTableScope(table, alias, cds, outer)
 
-		from = &TableInfo{Name: tblName, ColumnMap: cm}
+			stats, err = LoadTableStats(a.driver, table.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			idxs, err := TableIndexes(a.driver, tblName)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, idx := range idxs {
+				if idx.State == IndexPublic {
+					indexes = append(indexes, idx)
+				}
+			}
+		}
 	}
 
 	// transform target clause
-	var num int
 	var tgrs []*TargetRes
+	var names []string
 	i := 1
 	for _, target := range sstmt.Target {
-		tgrs1, all, err := a.transformTarget(target.Item, cds)
+		tgrs1, all, err := a.transformTarget(target.Item, scope)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if all {
-			tgrs = tgrs1
-			i = len(tgrs) + 1
-			break
-		} else {
-			tgr := tgrs1[0]
-			tgr.TargetID = i
-			tgrs = append(tgrs, tgr)
+			for _, tgr := range tgrs1 {
+				tgr.TargetID = i
+				tgrs = append(tgrs, tgr)
+				names = append(names, scope.columnName(tgr.FieldID))
+				i++
+			}
+			continue
 		}
+
+		tgr := tgrs1[0]
+		tgr.TargetID = i
+		tgr.Name = target.AsName
+		tgrs = append(tgrs, tgr)
+		name := tgr.Name
+		if name == "" && tgr.Type == ETARGET && tgr.Depth == 0 {
+			name = scope.columnName(tgr.FieldID)
+		} else if name == "" {
+			name = fmt.Sprintf("Name_exp_%d", i)
+		}
+		names = append(names, name)
 		i++
 	}
-	num = len(tgrs)
 
-	// transform where clause
+	// transform where clause, column = value is kept apart so that the
+	// optimizer may use it to look the row up by primary key
 	var qual *ComparisonQual
+	var where *TargetRes
 	if sstmt.Where != nil {
-		qual = &ComparisonQual{}
-		switch sstmt.Where.Cond.(type) {
-		case *ComparisonExpr:
-			cond := sstmt.Where.Cond.(*ComparisonExpr)
-			qual.Operator = cond.Operator
-			tgrs1, _, err := a.transformTarget(cond.Left, cds)
-			if err != nil {
-				return nil, err
-			}
-			qual.Left = tgrs1[0]
-			qual.Left.TargetID = i
-			tgrs = append(tgrs, qual.Left)
+		cond, err := a.transformExpr(sstmt.Where.Cond, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		if from != nil && isColumnQual(cond) {
+			qual = &ComparisonQual{Operator: EQ, Left: cond.Args[0], Right: cond.Args[1]}
+		} else {
+			where = cond
+		}
+	}
 
-			i++
-			var tgrs2 []*TargetRes
-			tgrs2, _, err = a.transformTarget(cond.Right, cds)
-			if err != nil {
-				return nil, err
+	// transform order by clause
+	var orderBy []*SortItem
+	for _, item := range sstmt.OrderBy {
+		key, err := a.transformOrderBy(item.Expr, tgrs, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		orderBy = append(orderBy, &SortItem{Key: key, Desc: item.Desc})
+	}
+
+	return &SelectQuery{
+		From:       from,
+		Stats:      stats,
+		Indexes:    indexes,
+		FromQuery:  fromQuery,
+		Alias:      alias,
+		Distinct:   sstmt.Distinct,
+		Fields:     tgrs,
+		Qual:       qual,
+		Where:      where,
+		OrderBy:    orderBy,
+		Limit:      sstmt.Limit,
+		Correlated: scope.correlated,
+	}, names, nil
+}
+
+func unknownOrderColumn(expr Expr) error {
+	name := expr.String()
+	switch e := expr.(type) {
+	case *VariableExpr:
+		name = qualifiedName(e)
+	case *ValueExpr:
+		name = fmt.Sprintf("%v", e.Item)
+	}
+	return errors.New("Unknown column '" + name + "' in 'order clause'")
+}
+
+// transformOrderBy transforms an order by item of a select, a position or
+// an alias refers to the target itself.
+func (a *Analyzer) transformOrderBy(expr Expr, tgrs []*TargetRes, scope *tableScope) (*TargetRes, error) {
+	switch e := expr.(type) {
+	case *ValueExpr:
+		if pos, ok := e.Item.(int64); ok {
+			if pos < 1 || pos > int64(len(tgrs)) {
+				return nil, unknownOrderColumn(expr)
+			}
+			return tgrs[pos-1], nil
+		}
+	case *VariableExpr:
+		if e.Type == ETARGET && e.Table == "" {
+			for _, tgr := range tgrs {
+				if tgr.Name != "" && strings.EqualFold(tgr.Name, e.Name) {
+					return tgr, nil
+				}
 			}
-			qual.Right = tgrs2[0]
-			qual.Right.TargetID = i
-			tgrs = append(tgrs, qual.Right)
-		default:
-			return nil, errors.New("unsupport qual target: " + sstmt.Where.Cond.String())
 		}
 	}
 
-	// transform limit clause
-	var limitNum uint64
-	if sstmt.Limit != nil {
-		limitNum = sstmt.Limit.Num
+	return a.transformExpr(expr, scope)
+}
+
+/*
+ * transformSetOpr transforms a set operation, both sides must have the
+ * same number of columns and are converted to the kinds merged from them.
+ * The names of the columns are those of the left side, order by refers
+ * to them by name or position only.
+ */
+func (a *Analyzer) transformSetOpr(sstmt *SelectStmt, outer *tableScope) (*SelectQuery, []string, error) {
+	left, names, err := a.transformSelect(sstmt.SetOpr.Left, outer)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, _, err := a.transformSelect(sstmt.SetOpr.Right, outer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(left.Fields) != len(right.Fields) {
+		return nil, nil, errors.New("The used SELECT statements have a different number of columns")
+	}
+
+	var fields []*TargetRes
+	for i, f := range left.Fields {
+		fields = append(fields, &TargetRes{
+			Type:     ETARGET,
+			TargetID: i + 1,
+			FieldID:  i + 1,
+			RetType:  expression.MergeKinds(f.RetType, right.Fields[i].RetType),
+		})
+	}
+
+	var orderBy []*SortItem
+	for _, item := range sstmt.OrderBy {
+		pos := 0
+		switch e := item.Expr.(type) {
+		case *ValueExpr:
+			if n, ok := e.Item.(int64); ok && n >= 1 && n <= int64(len(fields)) {
+				pos = int(n)
+			}
+		case *VariableExpr:
+			for i, name := range names {
+				if e.Type == ETARGET && e.Table == "" && strings.EqualFold(name, e.Name) {
+					pos = i + 1
+					break
+				}
+			}
+		}
+		if pos == 0 {
+			return nil, nil, unknownOrderColumn(item.Expr)
+		}
+		orderBy = append(orderBy, &SortItem{Key: fields[pos-1], Desc: item.Desc})
 	}
 
 	return &SelectQuery{
-		From:      from,
-		Fields:    tgrs,
-		FieldsNum: num,
-		Qual:      qual,
-		Limit:     limitNum,
-	}, nil
+		Fields:     fields,
+		OrderBy:    orderBy,
+		Limit:      sstmt.Limit,
+		Correlated: left.Correlated || right.Correlated,
+		SetOpr: &SetOprQuery{
+			Op:    sstmt.SetOpr.Op,
+			All:   sstmt.SetOpr.All,
+			Left:  left,
+			Right: right,
+		},
+	}, names, nil
 }
 
 func (a *Analyzer) transformInsertStmt(stmt Statement) (Statement, error) {
 	istmt := stmt.(*InsertStmt)
 
 	tblName := a.context.GetTableName(istmt.TName.Schema, istmt.TName.Name)
-	cds, err := a.getColumnDefs(tblName)
+	table, cds, err := a.getTableInfo(tblName)
 	if err != nil {
 		return nil, err
 	}
-	pks := []int{}
-	vm := make(map[int]interface{})
 	cm := make(map[string]*ColumnTableDef)
 	cm1 := make(map[int]*ColumnTableDef)
 	for _, cd := range cds {
 		cm[cd.Name] = cd
 		cm1[cd.Pos-1] = cd
-		if cd.PrimaryKey {
-			pks = append(pks, cd.Pos-1)
-		}
 	}
 
 	var e string
@@ -346,169 +780,306 @@ func (a *Analyzer) transformInsertStmt(stmt Statement) (Statement, error) {
 		}
 	}
 
-	i := 0
+	listed := make(map[int]bool)
 	for _, c := range istmt.ColumnList {
 		if _, ok := cm[c]; !ok {
 			e = c + " not exists!"
 			return nil, errors.New(e)
 		}
+		listed[cm[c].Pos-1] = true
+	}
 
-		// we only support valueexpr now
-		ve, ok := istmt.Values[i].(*ValueExpr)
-		if !ok {
-			return nil, errors.New("we only support value-expr now!")
+	//check null
+	for _, cd := range cds {
+		if listed[cd.Pos-1] {
+			continue
 		}
+		if cd.PrimaryKey {
+			e = cd.Name + " is primary key, cann't be null"
+			return nil, errors.New(e)
+		}
+		if cd.Nullable == NotNull {
+			e = cd.Name + " is NotNull!"
+			return nil, errors.New(e)
+		}
+	}
 
-		switch cm[c].Type.(type) {
-		case *IntType:
-			if _, ok := ve.Item.(int64); !ok {
-				e = "the value of " + cm[c].Name + " isn't int type!"
-				return nil, errors.New(e)
+	iq := &InsertQuery{NumColumns: len(cds), TableName: tblName, Table: table, Replace: istmt.Replace, Ignore: istmt.Ignore}
+	if istmt.OnDuplicate != nil {
+		scope := newTableScope(table, "", cds, nil)
+		scope.insert = true
+		for _, cs := range istmt.OnDuplicate {
+			cd, ok := cm[cs.ColumnName]
+			if !ok {
+				return nil, errors.New(cs.ColumnName + " not exists!")
 			}
-		case *StringType:
-			if _, ok := ve.Item.(string); !ok {
-				e = "the value of " + cm[c].Name + " isn't string type!"
-				return nil, errors.New(e)
+			v, err := a.transformExpr(cs.Value, scope)
+			if err != nil {
+				return nil, err
 			}
+			iq.OnDuplicate = append(iq.OnDuplicate, &Assignment{Pos: cd.Pos - 1, Value: v})
 		}
+	}
 
-		vm[cm[c].Pos-1] = ve.Item
-		i++
+	if istmt.Select != nil {
+		// the rows are checked as they are read
+		q, _, err := a.transformSelect(istmt.Select, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(q.Fields) != len(istmt.ColumnList) {
+			return nil, errors.New("Column count doesn't match value count at row 1")
+		}
+		for _, c := range istmt.ColumnList {
+			iq.Columns = append(iq.Columns, cm[c].Pos-1)
+		}
+		iq.Select = q
+		return iq, nil
 	}
 
-	//check null
-	if len(vm) < len(cds) {
-		for _, cd := range cds {
-			if _, ok := vm[cd.Pos-1]; !ok {
-				if cd.PrimaryKey {
-					e = cd.Name + " is primary key, cann't be null"
+	for n, values := range istmt.Values {
+		if len(values) != len(istmt.ColumnList) {
+			return nil, fmt.Errorf("Column count doesn't match value count at row %d", n+1)
+		}
+
+		vm := make(map[int]interface{})
+		for i, c := range istmt.ColumnList {
+			// we only support valueexpr now
+			ve, ok := values[i].(*ValueExpr)
+			if !ok {
+				return nil, errors.New("we only support value-expr now!")
+			}
+
+			switch cm[c].Type.(type) {
+			case *IntType:
+				if _, ok := ve.Item.(int64); !ok {
+					e = "the value of " + cm[c].Name + " isn't int type!"
 					return nil, errors.New(e)
 				}
-
-				if cd.Nullable == NotNull {
-					e = cd.Name + " is NotNull!"
+			case *StringType:
+				if _, ok := ve.Item.(string); !ok {
+					e = "the value of " + cm[c].Name + " isn't string type!"
 					return nil, errors.New(e)
 				}
+			}
 
+			vm[cm[c].Pos-1] = ve.Item
+		}
+		for _, cd := range cds {
+			if _, ok := vm[cd.Pos-1]; !ok {
 				vm[cd.Pos-1] = nil
 			}
 		}
+		iq.Rows = append(iq.Rows, vm)
 	}
 
-	//check primary key
-	pkv := store.UserFlag + tblName + "/"
-	for _, pk := range pks {
-		switch vm[pk].(type) {
-		case int64:
-			v := vm[pk].(int64)
-			pkv += util.ToString(util.DumpLengthEncodedInt(uint64(v)))
-		case string:
-			v := vm[pk].(string)
-			pkv += util.ToString(util.DumpLengthEncodedString(util.ToSlice(v)))
+	return iq, nil
+}
+
+func (a *Analyzer) transformExplain(stmt Statement) (Statement, error) {
+	estmt := stmt.(*Explain)
+
+	eq := &ExplainQuery{Analyze: estmt.Analyze}
+	switch {
+	case estmt.Format == "" || strings.EqualFold(estmt.Format, "TRADITIONAL"):
+		eq.Format = ExplainRow
+	case strings.EqualFold(estmt.Format, "JSON"):
+		eq.Format = ExplainJSON
+	default:
+		return nil, errors.New("Unknown EXPLAIN format name: '" + estmt.Format + "'")
+	}
+
+	query, err := a.transformStmt(estmt.Stmt)
+	if err != nil {
+		return nil, err
+	}
+	eq.Query = query
+	return eq, nil
+}
+
+func (a *Analyzer) transformAnalyzeTable(stmt Statement) (Statement, error) {
+	astmt := stmt.(*AnalyzeTable)
+
+	aq := &AnalyzeTableQuery{}
+	for _, t := range astmt.Tables {
+		tblName := a.context.GetTableName(t.Schema, t.Name)
+		table, err := LoadTableInfo(a.driver, tblName)
+		if err == store.Nil {
+			table, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
 		}
+		aq.Names = append(aq.Names, tblName)
+		aq.Tables = append(aq.Tables, table)
 	}
-	_, err = a.driver.GetUserRecord(pkv)
-	if err == nil {
-		return nil, errors.New("primary key can't repeat!")
+	return aq, nil
+}
+
+// transformSet checks the variables a SET statement sets, a value that is
+// a bare name, as ON, is the name itself. SET NAMES sets the character
+// sets of the connection.
+func (a *Analyzer) transformSet(stmt Statement) (Statement, error) {
+	sstmt := stmt.(*SetStmt)
+
+	sq := &SetQuery{}
+	for _, v := range sstmt.Variables {
+		if v.Name == SetNames {
+			vars, err := setNamesVariables(v)
+			if err != nil {
+				return nil, err
+			}
+			sq.Variables = append(sq.Variables, vars...)
+			continue
+		}
+
+		name := strings.ToLower(v.Name)
+		sv := context.GetSysVar(name)
+		if sv == nil {
+			return nil, mysql.NewErrf(mysql.ErrUnknownSystemVariable, "Unknown system variable '%s'", v.Name)
+		}
+		if sv.ReadOnly {
+			return nil, mysql.NewErrf(mysql.ErrIncorrectGlobalLocalVar, "Variable '%s' is a read only variable", name)
+		}
+		if v.IsGlobal && sv.Scope&context.ScopeGlobal == 0 {
+			return nil, mysql.NewErrf(mysql.ErrLocalVariable, "Variable '%s' is a SESSION variable and can't be used with SET GLOBAL", name)
+		}
+		if !v.IsGlobal && sv.Scope&context.ScopeSession == 0 {
+			return nil, mysql.NewErrf(mysql.ErrGlobalVariable, "Variable '%s' is a GLOBAL variable and should be set with SET GLOBAL", name)
+		}
+
+		var value *TargetRes
+		if ve, ok := v.Value.(*VariableExpr); ok && ve.Type == ETARGET && ve.Table == "" {
+			value = &TargetRes{Type: EVALUE, Value: ve.Name, RetType: util.KindString}
+		} else {
+			var err error
+			value, err = a.transformExpr(v.Value, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sq.Variables = append(sq.Variables, &SetVariable{Name: name, IsGlobal: v.IsGlobal, Value: value})
 	}
+	return sq, nil
+}
 
-	if err != store.Nil {
-		return nil, err
+// setNamesVariables gives the variables SET NAMES sets for the session
+func setNamesVariables(v *VariableAssignment) ([]*SetVariable, error) {
+	charset := strings.ToLower(v.Value.(*ValueExpr).Item.(string))
+	if charset == "" {
+		charset = context.DefaultCharset
+	}
+	collations, ok := context.Charsets[charset]
+	if !ok {
+		return nil, mysql.NewErrf(mysql.ErrUnknownCharacterSet, "Unknown character set: '%s'", charset)
+	}
+	collation := collations[0]
+	if v.Collate != "" {
+		collation = strings.ToLower(v.Collate)
+		switch context.CollationCharset(collation) {
+		case charset:
+		case "":
+			return nil, mysql.NewErrf(mysql.ErrUnknownCollation, "Unknown collation: '%s'", collation)
+		default:
+			return nil, mysql.NewErrf(mysql.ErrCollationCharsetMismatch, "COLLATION '%s' is not valid for CHARACTER SET '%s'", collation, charset)
+		}
 	}
 
-	return &InsertQuery{NumColumns: len(cds), TableName: tblName, PK: pkv, Values: vm}, nil
+	value := func(s string) *TargetRes {
+		return &TargetRes{Type: EVALUE, Value: s, RetType: util.KindString}
+	}
+	return []*SetVariable{
+		{Name: context.CharsetClient, Value: value(charset)},
+		{Name: context.CharsetConnection, Value: value(charset)},
+		{Name: context.CharsetResults, Value: value(charset)},
+		{Name: context.CollationConn, Value: value(collation)},
+	}, nil
+}
+
+/*
+ * transformSysVar transforms @@[scope.]name. The global value of
+ * @@global.name, and of a variable of GLOBAL scope only, is read now, so
+ * the statement sees the value stored by SET GLOBAL on any node when it
+ * started.
+ */
+func (a *Analyzer) transformSysVar(lit string) (*TargetRes, error) {
+	name, global := SysVarName(lit)
+	name = strings.ToLower(name)
+	sv := context.GetSysVar(name)
+	if sv == nil {
+		return nil, mysql.NewErrf(mysql.ErrUnknownSystemVariable, "Unknown system variable '%s'", name)
+	}
+	tgr := &TargetRes{Type: ESYSVAR, RetType: util.KindString, SysVar: name}
+	if strings.HasPrefix(strings.ToLower(lit), "@@session.") && sv.Scope&context.ScopeSession == 0 {
+		return nil, mysql.NewErrf(mysql.ErrIncorrectGlobalLocalVar, "Variable '%s' is a GLOBAL variable", name)
+	}
+	if !global && sv.Scope != context.ScopeGlobal {
+		return tgr, nil
+	}
+	if sv.Scope&context.ScopeGlobal == 0 {
+		return nil, mysql.NewErrf(mysql.ErrIncorrectGlobalLocalVar, "Variable '%s' is a SESSION variable", name)
+	}
+
+	value, ok, err := LoadGlobalVar(a.driver, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		value = sv.Value
+	}
+	tgr.SysVarGlobal = true
+	tgr.Value = value
+	return tgr, nil
 }
 
 func (a *Analyzer) transformUpdateStmt(stmt Statement) (Statement, error) {
 	ustmt := stmt.(*UpdateStmt)
 
 	tblName := a.context.GetTableName(ustmt.TName.Schema, ustmt.TName.Name)
-	cds, err := a.getColumnDefs(tblName)
+	table, cds, err := a.getTableInfo(tblName)
 	if err != nil {
 		return nil, err
 	}
-	cm := make(map[int]*ColumnTableDef)
 	cm1 := make(map[string]*ColumnTableDef)
 	for _, cd := range cds {
-		cm[cd.Pos-1] = cd
 		cm1[cd.Name] = cd
 	}
+	scope := newTableScope(table, "", cds, nil)
 
-	table := &TableInfo{Name: tblName, ColumnMap: cm}
-
-	//Get all targetvar
-	var tgrs []*TargetRes
-	allTarget := &VariableExpr{Type: EALLTARGET}
-	tgrs, _, err = a.transformTarget(allTarget, cds)
+	// the rows to update are selected as SELECT * would
+	if ustmt.Limit != nil && ustmt.Limit.Offset != 0 {
+		return nil, errors.New("UPDATE can't take a LIMIT offset!")
+	}
+	sstmt := &SelectStmt{
+		From:    ustmt.TName,
+		Target:  TargetClause{&TargetElem{Item: &VariableExpr{Type: EALLTARGET}}},
+		Where:   ustmt.Where,
+		OrderBy: ustmt.OrderBy,
+		Limit:   ustmt.Limit,
+	}
+	sq, _, err := a.transformSelect(sstmt, nil)
 	if err != nil {
 		return nil, err
 	}
-	num := len(tgrs)
 
 	//check columnset
-	vm := make(map[int]interface{})
+	var assignments []*Assignment
 	for _, cs := range ustmt.ColumnSetList {
-		var e string
-		var cd *ColumnTableDef
-		var ok bool
-		cd, ok = cm1[cs.ColumnName]
+		cd, ok := cm1[cs.ColumnName]
 		if !ok {
-			e = cs.ColumnName + " not exists!"
-			return nil, errors.New(e)
-		}
-
-		v := cs.Value.(*ValueExpr).Item
-		switch cd.Type.(type) {
-		case *IntType:
-			if _, ok := v.(int64); !ok {
-				e = "the value of " + cd.Name + " isn't int type!"
-				return nil, errors.New(e)
-			}
-		case *StringType:
-			if _, ok := v.(string); !ok {
-				e = "the value of " + cd.Name + " isn't string type!"
-				return nil, errors.New(e)
-			}
+			return nil, errors.New(cs.ColumnName + " not exists!")
 		}
-		vm[cd.Pos-1] = v
-	}
 
-	// transform where clause
-	var qual *ComparisonQual
-	if ustmt.Where != nil {
-		i := num + 1
-		qual = &ComparisonQual{}
-		switch ustmt.Where.Cond.(type) {
-		case *ComparisonExpr:
-			cond := ustmt.Where.Cond.(*ComparisonExpr)
-			qual.Operator = cond.Operator
-			tgrs1, _, err := a.transformTarget(cond.Left, cds)
-			if err != nil {
-				return nil, err
-			}
-			qual.Left = tgrs1[0]
-			qual.Left.TargetID = i
-			tgrs = append(tgrs, qual.Left)
-
-			i++
-			var tgrs2 []*TargetRes
-			tgrs2, _, err = a.transformTarget(cond.Right, cds)
-			if err != nil {
-				return nil, err
-			}
-			qual.Right = tgrs2[0]
-			qual.Right.TargetID = i
-			tgrs = append(tgrs, qual.Right)
-		default:
-			return nil, errors.New("unsupport qual target: " + ustmt.Where.Cond.String())
+		v, err := a.transformExpr(cs.Value, scope)
+		if err != nil {
+			return nil, err
 		}
+		assignments = append(assignments, &Assignment{Pos: cd.Pos - 1, Value: v})
 	}
 
 	return &UpdateQuery{
-		Table:     table,
-		Fields:    tgrs,
-		FieldsNum: num,
-		Values:    vm,
-		Qual:      qual,
+		Table:       table,
+		Select:      sq,
+		Assignments: assignments,
 	}, nil
 }
@@ -0,0 +1,397 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * table metadata is stored as:
+ * 		/SYSTEM/TABLE/tblName	json(TableJsonDef)
+ *
+ * databases, tables and indexes get an id from /SYSTEM/ID/DATABASE,
+ * /SYSTEM/ID/TABLE and /SYSTEM/ID/INDEX when they are created, user data
+ * is keyed by the ids rather than the names:
+ *		/USER/t + tableID + _r + Ordered Primary key
+ *		/USER/t + tableID + _i + indexID + _ + Encoded Field Value + ...
+ * so a dropped table is gone as soon as its metadata is, and a table
+ * created with the same name never sees the old rows. The layout is
+ * recorded as /SYSTEM/VERSION, stores written before it are upgraded
+ * when the server starts.
+ *
+ * tables created before schema changes were supported stored a bare
+ * json(ColumnTableJsonDefs) here, their rows are encoded positionally.
+ * When such a table is loaded, column ids are taken from the column
+ * positions and the original layout is kept as Legacy so these rows
+ * can still be decoded after the columns are altered.
+ */
+type TableJsonDef struct {
+	ID          int64 `json:",omitempty"`
+	Version     int
+	MaxColumnID int
+	Columns     ColumnTableJsonDefs
+	Legacy      ColumnTableJsonDefs `json:",omitempty"`
+}
+
+func TableKey(tblName string) string {
+	return store.SystemFlag + store.TableFlag + tblName
+}
+
+func AllocDatabaseID(driver store.Driver) (int64, error) {
+	return driver.IncrSysRecord(store.SystemFlag + store.IDFlag + "DATABASE")
+}
+
+func AllocTableID(driver store.Driver) (int64, error) {
+	return driver.IncrSysRecord(store.SystemFlag + store.IDFlag + "TABLE")
+}
+
+func AllocIndexID(driver store.Driver) (int64, error) {
+	return driver.IncrSysRecord(store.SystemFlag + store.IDFlag + "INDEX")
+}
+
+// DataPrefix returns the prefix of all user keys owned by the table.
+func (t *TableInfo) DataPrefix() string {
+	return store.UserFlag + "t" + strconv.FormatInt(t.ID, 10) + "_"
+}
+
+// RowPrefix returns the prefix of the rows, in the order of their keys
+func (t *TableInfo) RowPrefix() string {
+	start, _ := RowRange(t.DataPrefix())
+	return start
+}
+
+// RowsEnd returns the first key after all the rows of the table
+func (t *TableInfo) RowsEnd() string {
+	_, end := RowRange(t.DataPrefix())
+	return end
+}
+
+// RowRange returns the prefix of the rows under the data prefix of a
+// table, and the first key after them
+func RowRange(dataPrefix string) (string, string) {
+	return dataPrefix + "r", dataPrefix + "s"
+}
+
+func (t *TableInfo) IndexPrefix(idx *IndexInfo) string {
+	return t.DataPrefix() + "i" + strconv.FormatInt(idx.ID, 10) + "_"
+}
+
+func columnTypeFromJson(t int) ColumnType {
+	switch t {
+	case SqlInt:
+		return &IntType{Name: "INT"}
+	case SqlString:
+		return &StringType{Name: "STRING"}
+	}
+	return nil
+}
+
+func columnTypeToJson(t ColumnType) int {
+	switch t.(type) {
+	case *StringType:
+		return SqlString
+	}
+	return SqlInt
+}
+
+func columnDefsFromJson(cjds ColumnTableJsonDefs) ColumnTableDefs {
+	cds := ColumnTableDefs{}
+	for _, cjd := range cjds {
+		cd := &ColumnTableDef{
+			ID:         cjd.ID,
+			Name:       cjd.Name,
+			Pos:        cjd.Pos,
+			Type:       columnTypeFromJson(cjd.Type),
+			Nullable:   cjd.Nullable,
+			PrimaryKey: cjd.PrimaryKey,
+			Unique:     cjd.Unique,
+		}
+		if cd.ID == 0 {
+			cd.ID = cd.Pos
+		}
+		cds = append(cds, cd)
+	}
+	return cds
+}
+
+func columnDefsToJson(cds ColumnTableDefs) ColumnTableJsonDefs {
+	cjds := ColumnTableJsonDefs{}
+	for _, cd := range cds {
+		cjds = append(cjds, &ColumnTableJsonDef{
+			ID:         cd.ID,
+			Name:       cd.Name,
+			Pos:        cd.Pos,
+			Type:       columnTypeToJson(cd.Type),
+			Nullable:   cd.Nullable,
+			PrimaryKey: cd.PrimaryKey,
+			Unique:     cd.Unique,
+		})
+	}
+	return cjds
+}
+
+func NewTableInfo(tblName string, cds ColumnTableDefs) *TableInfo {
+	cm := make(map[int]*ColumnTableDef)
+	maxID := 0
+	for _, cd := range cds {
+		cm[cd.Pos-1] = cd
+		if cd.ID > maxID {
+			maxID = cd.ID
+		}
+	}
+	return &TableInfo{Name: tblName, ColumnMap: cm, MaxColumnID: maxID}
+}
+
+func LoadTableInfo(driver store.Driver, tblName string) (*TableInfo, error) {
+	value, err := driver.GetSysRecord(TableKey(tblName))
+	if err != nil {
+		return nil, err
+	}
+
+	var table *TableInfo
+	if strings.HasPrefix(value, "[") {
+		cjds := ColumnTableJsonDefs{}
+		err = json.Unmarshal(util.ToSlice(value), &cjds)
+		if err != nil {
+			return nil, err
+		}
+		table = NewTableInfo(tblName, columnDefsFromJson(cjds))
+		table.Legacy = columnDefsFromJson(cjds)
+	} else {
+		tjd := &TableJsonDef{}
+		err = json.Unmarshal(util.ToSlice(value), tjd)
+		if err != nil {
+			return nil, err
+		}
+		table = NewTableInfo(tblName, columnDefsFromJson(tjd.Columns))
+		table.ID = tjd.ID
+		table.Version = tjd.Version
+		if tjd.MaxColumnID > table.MaxColumnID {
+			table.MaxColumnID = tjd.MaxColumnID
+		}
+		if tjd.Legacy != nil {
+			table.Legacy = columnDefsFromJson(tjd.Legacy)
+		}
+	}
+
+	return table, nil
+}
+
+func SaveTableInfo(driver store.Driver, table *TableInfo) error {
+	tjd := &TableJsonDef{
+		ID:          table.ID,
+		Version:     table.Version,
+		MaxColumnID: table.MaxColumnID,
+		Columns:     columnDefsToJson(table.ColumnDefs()),
+	}
+	if table.Legacy != nil {
+		tjd.Legacy = columnDefsToJson(table.Legacy)
+	}
+
+	data, err := json.Marshal(tjd)
+	if err != nil {
+		return err
+	}
+
+	return driver.SetSysRecord(TableKey(table.Name), util.ToString(data), 0)
+}
+
+// ColumnDefs returns the columns of the table ordered by position.
+func (t *TableInfo) ColumnDefs() ColumnTableDefs {
+	cds := ColumnTableDefs{}
+	for _, cd := range t.ColumnMap {
+		cds = append(cds, cd)
+	}
+	sort.Slice(cds, func(i, j int) bool { return cds[i].Pos < cds[j].Pos })
+	return cds
+}
+
+func (t *TableInfo) ColumnByID(id int) *ColumnTableDef {
+	for _, cd := range t.ColumnMap {
+		if cd.ID == id {
+			return cd
+		}
+	}
+	return nil
+}
+
+func (t *TableInfo) ColumnByName(name string) *ColumnTableDef {
+	for _, cd := range t.ColumnMap {
+		if strings.EqualFold(cd.Name, name) {
+			return cd
+		}
+	}
+	return nil
+}
+
+/*
+ * index metadata is stored as:
+ * 		/SYSTEM/INDEX/TABLE/idxName "F + Encoded table name + Encoded Fields Num + Encoded ColumnID + ... + Encoded State + Encoded indexID"
+ *      F: unique or not
+ * 		/SYSTEM/TABLE/INDEX/tblName + Encoded Fields Num + Encoded ColumnID + ... idxName
+ *
+ * index created before schema changes were supported stored column
+ * positions here, which are the same as the column ids of such tables.
+ * They also have no schema state and are public.
+ */
+type IndexInfo struct {
+	ID     int64
+	Name   string
+	Table  string
+	Unique bool
+	Fields []int
+	State  int
+}
+
+/*
+ * schema states of an index being built online:
+ * delete-only: writers only remove entries of the index
+ * write-only:  writers maintain the index, the backfill fills in old rows
+ * public:      the index is complete and can be read
+ */
+const (
+	IndexPublic int = iota
+	IndexDeleteOnly
+	IndexWriteOnly
+)
+
+func IndexStateName(state int) string {
+	switch state {
+	case IndexDeleteOnly:
+		return "delete only"
+	case IndexWriteOnly:
+		return "write only"
+	}
+	return "public"
+}
+
+func IndexTableKey(idxName string) string {
+	return store.SystemFlag + store.IndexFlag + store.TableFlag + idxName
+}
+
+func encodeIndexFields(fields []int) string {
+	encoded := util.ToString(util.DumpLengthEncodedInt(uint64(len(fields))))
+	for _, f := range fields {
+		encoded += util.ToString(util.DumpLengthEncodedInt(uint64(f)))
+	}
+	return encoded
+}
+
+func decodeIndexFields(raw string) ([]int, int) {
+	num, _, pos := util.ParseLengthEncodedInt(util.ToSlice(raw))
+	fields := make([]int, 0, num)
+	var i uint64
+	for ; i < num; i++ {
+		f, _, l := util.ParseLengthEncodedInt(util.ToSlice(raw[pos:]))
+		fields = append(fields, int(f))
+		pos += l
+	}
+	return fields, pos
+}
+
+func TableIndexKey(tblName string, fields []int) string {
+	return store.SystemFlag + store.TableFlag + store.IndexFlag + tblName + encodeIndexFields(fields)
+}
+
+func LoadIndexInfo(driver store.Driver, idxName string) (*IndexInfo, error) {
+	value, err := driver.GetSysRecord(IndexTableKey(idxName))
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < 2 {
+		return nil, errors.New("invalid index info of " + idxName)
+	}
+
+	tbl, _, n, err := util.ParseLengthEncodedBytes(util.ToSlice(value[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &IndexInfo{
+		Name:   idxName,
+		Table:  string(tbl),
+		Unique: value[0:1] == "1",
+		State:  IndexPublic,
+	}
+	var l int
+	idx.Fields, l = decodeIndexFields(value[1+n:])
+	if rest := value[1+n+l:]; len(rest) > 0 {
+		state, _, sl := util.ParseLengthEncodedInt(util.ToSlice(rest))
+		idx.State = int(state)
+		if rest = rest[sl:]; len(rest) > 0 {
+			id, _, _ := util.ParseLengthEncodedInt(util.ToSlice(rest))
+			idx.ID = int64(id)
+		}
+	}
+
+	return idx, nil
+}
+
+func SaveIndexInfo(driver store.Driver, idx *IndexInfo) error {
+	var value string
+	if idx.Unique {
+		value = "1"
+	} else {
+		value = "0"
+	}
+	value += util.ToString(util.DumpLengthEncodedString(util.ToSlice(idx.Table)))
+	value += encodeIndexFields(idx.Fields)
+	value += util.ToString(util.DumpLengthEncodedInt(uint64(idx.State)))
+	value += util.ToString(util.DumpLengthEncodedInt(uint64(idx.ID)))
+	err := driver.SetSysRecord(IndexTableKey(idx.Name), value, 0)
+	if err != nil {
+		return err
+	}
+
+	return driver.SetSysRecord(TableIndexKey(idx.Table, idx.Fields), idx.Name, 0)
+}
+
+func DeleteIndexInfo(driver store.Driver, idx *IndexInfo) error {
+	err := driver.DelSysRecord(TableIndexKey(idx.Table, idx.Fields))
+	if err != nil {
+		return err
+	}
+
+	return driver.DelSysRecord(IndexTableKey(idx.Name))
+}
+
+// TableIndexes returns all indexes built on the table.
+func TableIndexes(driver store.Driver, tblName string) ([]*IndexInfo, error) {
+	var keys []string
+	var cursor uint64
+	var err error
+	var idxs []*IndexInfo
+	match := store.SystemFlag + store.TableFlag + store.IndexFlag + tblName + "*"
+	for {
+		keys, cursor, err = driver.ScanSysRecords(cursor, match, 100)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			idxName, err := driver.GetSysRecord(key)
+			if err != nil {
+				return nil, err
+			}
+			idx, err := LoadIndexInfo(driver, idxName)
+			if err != nil {
+				return nil, err
+			}
+			// the match pattern also hits tables sharing the name prefix
+			if idx.Table != tblName {
+				continue
+			}
+			idxs = append(idxs, idx)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return idxs, nil
+}
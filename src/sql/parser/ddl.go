@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 // CreateDatabase represents a CREATE DATABASE statement.
@@ -24,10 +25,18 @@ func (node *CreateDatabase) String() string {
 type TableName struct {
 	Schema string
 	Name   string
+	// alias given in the FROM clause
+	AsName string
+	// derived table, Name is empty then
+	Select *SelectStmt
 }
 
 func (node *TableName) String() string {
 	var buf bytes.Buffer
+	if node.Select != nil {
+		fmt.Fprintf(&buf, "(%s) %s", node.Select, node.AsName)
+		return buf.String()
+	}
 	if node.Schema != "" {
 		fmt.Fprintf(&buf, "%s.", node.Schema)
 	}
@@ -46,6 +55,7 @@ const (
 )
 
 type ColumnTableJsonDef struct {
+	ID         int `json:",omitempty"`
 	Name       string
 	Pos        int
 	Type       int
@@ -57,6 +67,7 @@ type ColumnTableJsonDef struct {
 // ColumnTableDef represents a column definition within a CREATE TABLE
 // statement.
 type ColumnTableDef struct {
+	ID         int
 	Name       string
 	Pos        int
 	Type       ColumnType
@@ -186,6 +197,49 @@ func (node *DropTable) String() string {
 	return buf.String()
 }
 
+type DropIndex struct {
+	IfExists bool
+	Index    *TableName
+	Table    *TableName
+}
+
+func (node *DropIndex) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("DROP INDEX")
+	if node.IfExists {
+		fmt.Fprintf(&buf, " IF EXISTS")
+	}
+	fmt.Fprintf(&buf, " %s ON %s", node.Index, node.Table)
+	return buf.String()
+}
+
+type TruncateTable struct {
+	Table *TableName
+}
+
+func (node *TruncateTable) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("TRUNCATE TABLE")
+	fmt.Fprintf(&buf, " %s", node.Table)
+	return buf.String()
+}
+
+type AnalyzeTable struct {
+	Tables []*TableName
+}
+
+func (node *AnalyzeTable) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("ANALYZE TABLE")
+	for i, t := range node.Tables {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, " %s", t)
+	}
+	return buf.String()
+}
+
 type UseDB struct {
 	DBName string
 }
@@ -197,6 +251,73 @@ func (node *UseDB) String() string {
 	return buf.String()
 }
 
+// VariableAssignment is one of the assignments of a SET statement
+// the name of the assignment of SET NAMES, whose value is the character
+// set, "" for the default one
+const SetNames = "SET NAMES"
+
+type VariableAssignment struct {
+	Name     string
+	Value    Expr
+	IsGlobal bool
+	// collation of SET NAMES
+	Collate string
+}
+
+type SetStmt struct {
+	Variables []*VariableAssignment
+}
+
+func (node *SetStmt) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("SET")
+	for i, v := range node.Variables {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if v.Name == SetNames {
+			fmt.Fprintf(&buf, " NAMES %v", v.Value.(*ValueExpr).Item)
+			if v.Collate != "" {
+				fmt.Fprintf(&buf, " COLLATE %s", v.Collate)
+			}
+			continue
+		}
+		if v.IsGlobal {
+			buf.WriteString(" GLOBAL")
+		}
+		fmt.Fprintf(&buf, " %s = %s", v.Name, v.Value)
+	}
+	return buf.String()
+}
+
+// KillStmt kills a connection, or only the statement it runs when Query
+// is set
+type KillStmt struct {
+	ConnectionID uint64
+	Query        bool
+}
+
+func (node *KillStmt) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("KILL")
+	if node.Query {
+		buf.WriteString(" QUERY")
+	}
+	fmt.Fprintf(&buf, " %d", node.ConnectionID)
+	return buf.String()
+}
+
+// SysVarName gives the name of the system variable @@[scope.]name, global
+// tells whether the scope is GLOBAL
+func SysVarName(lit string) (name string, global bool) {
+	name = strings.TrimPrefix(lit, "@@")
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		global = strings.EqualFold(name[:i], "global")
+		name = name[i+1:]
+	}
+	return name, global
+}
+
 type ColumnOption interface {
 	columnOption()
 }
@@ -224,3 +345,71 @@ type UniqueConstraint struct {
 
 func (UniqueConstraint) columnOption() {
 }
+
+const (
+	AlterAddColumn int = iota
+	AlterDropColumn
+	AlterModifyColumn
+	AlterChangeColumn
+	AlterAddIndex
+	AlterDropIndex
+	AlterRename
+)
+
+type AlterTableSpec struct {
+	Type int
+
+	// column
+	Column  *ColumnTableDef
+	OldName string
+
+	// index
+	Index   *TableName
+	Unique  bool
+	Targets TargetClause
+
+	// rename
+	NewTable *TableName
+}
+
+func (node *AlterTableSpec) String() string {
+	var buf bytes.Buffer
+	switch node.Type {
+	case AlterAddColumn:
+		fmt.Fprintf(&buf, "ADD COLUMN %s", node.Column)
+	case AlterDropColumn:
+		fmt.Fprintf(&buf, "DROP COLUMN %s", node.OldName)
+	case AlterModifyColumn:
+		fmt.Fprintf(&buf, "MODIFY COLUMN %s", node.Column)
+	case AlterChangeColumn:
+		fmt.Fprintf(&buf, "CHANGE COLUMN %s %s", node.OldName, node.Column)
+	case AlterAddIndex:
+		buf.WriteString("ADD")
+		if node.Unique {
+			buf.WriteString(" UNIQUE")
+		}
+		fmt.Fprintf(&buf, " INDEX %s (%s)", node.Index, node.Targets)
+	case AlterDropIndex:
+		fmt.Fprintf(&buf, "DROP INDEX %s", node.Index)
+	case AlterRename:
+		fmt.Fprintf(&buf, "RENAME TO %s", node.NewTable)
+	}
+	return buf.String()
+}
+
+// AlterTable represents an ALTER TABLE statement.
+type AlterTable struct {
+	Table *TableName
+	Specs []*AlterTableSpec
+}
+
+func (node *AlterTable) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "ALTER TABLE %s", node.Table)
+	var prefix = " "
+	for _, spec := range node.Specs {
+		fmt.Fprintf(&buf, "%s%s", prefix, spec)
+		prefix = ", "
+	}
+	return buf.String()
+}
@@ -6,7 +6,8 @@ import (
 )
 
 type TargetElem struct {
-	Item Expr
+	Item   Expr
+	AsName string
 }
 
 func (node *TargetElem) String() string {
@@ -15,6 +16,9 @@ func (node *TargetElem) String() string {
 	if node.Item != nil {
 		fmt.Fprintf(&buf, "%s", node.Item)
 	}
+	if node.AsName != "" {
+		fmt.Fprintf(&buf, " AS %s", node.AsName)
+	}
 
 	return buf.String()
 }
@@ -44,23 +48,69 @@ func (node *WhereClause) String() string {
 }
 
 type LimitClause struct {
-	Num uint64
+	Num    uint64
+	Offset uint64
 }
 
 func (node *LimitClause) String() string {
+	if node.Offset != 0 {
+		return fmt.Sprintf("%v OFFSET %v", node.Num, node.Offset)
+	}
 	return fmt.Sprintf("%v", node.Num)
 }
 
+type ByItem struct {
+	Expr Expr
+	Desc bool
+}
+
+func (node *ByItem) String() string {
+	if node.Desc {
+		return fmt.Sprintf("%s DESC", node.Expr)
+	}
+	return fmt.Sprintf("%s", node.Expr)
+}
+
+const (
+	SetUnion int = iota
+	SetIntersect
+	SetExcept
+)
+
+var setOprNames = []string{SetUnion: "UNION", SetIntersect: "INTERSECT", SetExcept: "EXCEPT"}
+
+type SetOpr struct {
+	Op          int
+	All         bool
+	Left, Right *SelectStmt
+}
+
+// SelectStmt is a set operation of two selects when SetOpr is set, OrderBy
+// and Limit then apply to its result and the other clauses are empty.
 type SelectStmt struct {
-	From   *TableName
-	Target TargetClause
-	Where  *WhereClause
-	Limit  *LimitClause
+	Distinct bool
+	From     *TableName
+	Target   TargetClause
+	Where    *WhereClause
+	OrderBy  []*ByItem
+	Limit    *LimitClause
+	SetOpr   *SetOpr
 }
 
 func (node *SelectStmt) String() string {
 	var buf bytes.Buffer
-	buf.WriteString("SELECT ")
+	if node.SetOpr != nil {
+		fmt.Fprintf(&buf, "(%s) %s ", node.SetOpr.Left, setOprNames[node.SetOpr.Op])
+		if node.SetOpr.All {
+			buf.WriteString("ALL ")
+		}
+		fmt.Fprintf(&buf, "(%s) ", node.SetOpr.Right)
+	} else {
+		buf.WriteString("SELECT ")
+		if node.Distinct {
+			buf.WriteString("DISTINCT ")
+		}
+	}
 
 	if node.Target != nil {
 		fmt.Fprintf(&buf, "%s ", node.Target)
@@ -74,6 +124,13 @@ func (node *SelectStmt) String() string {
 		fmt.Fprintf(&buf, "WHERE %s ", node.Where)
 	}
 
+	if node.OrderBy != nil {
+		buf.WriteString("ORDER BY ")
+		for _, item := range node.OrderBy {
+			fmt.Fprintf(&buf, "%s, ", item)
+		}
+	}
+
 	if node.Limit != nil {
 		fmt.Fprintf(&buf, "LIMIT %s ", node.Limit)
 	}
@@ -82,14 +139,24 @@ func (node *SelectStmt) String() string {
 }
 
 type InsertStmt struct {
-	TName      *TableName
-	ColumnList []string
-	Values     Exprs
+	TName       *TableName
+	ColumnList  []string
+	Values      []Exprs
+	Select      *SelectStmt
+	Ignore      bool
+	Replace     bool
+	OnDuplicate []*ColumnSet
 }
 
 func (node *InsertStmt) String() string {
 	var buf bytes.Buffer
-	buf.WriteString("INSERT INTO")
+	if node.Replace {
+		buf.WriteString("REPLACE INTO")
+	} else if node.Ignore {
+		buf.WriteString("INSERT IGNORE INTO")
+	} else {
+		buf.WriteString("INSERT INTO")
+	}
 
 	if node.TName != nil {
 		fmt.Fprintf(&buf, " %s", node.TName)
@@ -99,12 +166,27 @@ func (node *InsertStmt) String() string {
 	for _, c := range node.ColumnList {
 		fmt.Fprintf(&buf, "%s, ", c)
 	}
-	buf.WriteString(") VALUES (")
+	buf.WriteString(")")
+
+	if node.Select != nil {
+		fmt.Fprintf(&buf, " %s", node.Select)
+	} else {
+		buf.WriteString(" VALUES ")
+		for _, row := range node.Values {
+			buf.WriteString("(")
+			for _, v := range row {
+				fmt.Fprintf(&buf, "%s, ", v)
+			}
+			buf.WriteString(")")
+		}
+	}
 
-	for _, v := range node.Values {
-		fmt.Fprintf(&buf, "%s, ", v)
+	if node.OnDuplicate != nil {
+		buf.WriteString(" ON DUPLICATE KEY UPDATE ")
+		for _, cs := range node.OnDuplicate {
+			fmt.Fprintf(&buf, "%s=%s, ", cs.ColumnName, cs.Value)
+		}
 	}
-	buf.WriteString(")")
 
 	return buf.String()
 }
@@ -118,6 +200,8 @@ type UpdateStmt struct {
 	TName         *TableName
 	ColumnSetList []*ColumnSet
 	Where         *WhereClause
+	OrderBy       []*ByItem
+	Limit         *LimitClause
 }
 
 func (node *UpdateStmt) String() string {
@@ -135,8 +219,38 @@ func (node *UpdateStmt) String() string {
 	}
 
 	if node.Where != nil {
-		fmt.Fprintf(&buf, "WHERE %s", node.Where)
+		fmt.Fprintf(&buf, "WHERE %s ", node.Where)
 	}
 
+	if node.OrderBy != nil {
+		buf.WriteString("ORDER BY ")
+		for _, item := range node.OrderBy {
+			fmt.Fprintf(&buf, "%s, ", item)
+		}
+	}
+
+	if node.Limit != nil {
+		fmt.Fprintf(&buf, "LIMIT %s ", node.Limit)
+	}
+
+	return buf.String()
+}
+
+// EXPLAIN of a statement, Format is the name given with FORMAT =
+type Explain struct {
+	Stmt    Statement
+	Format  string
+	Analyze bool
+}
+
+func (node *Explain) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("EXPLAIN ")
+	if node.Analyze {
+		buf.WriteString("ANALYZE ")
+	} else if node.Format != "" {
+		fmt.Fprintf(&buf, "FORMAT = %s ", node.Format)
+	}
+	fmt.Fprintf(&buf, "%s", node.Stmt)
 	return buf.String()
 }
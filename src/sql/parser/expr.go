@@ -12,6 +12,27 @@ type Exprs []Expr
 
 const (
 	EQ int = iota
+	NE
+	LT
+	LE
+	GT
+	GE
+)
+
+const (
+	PLUS int = iota
+	MINUS
+	MULT
+	DIVIDE
+	INTDIV
+	MODULO
+	UMINUS
+)
+
+const (
+	LogicAnd int = iota
+	LogicOr
+	LogicXor
 )
 
 const (
@@ -20,6 +41,13 @@ const (
 	EALLTARGET
 	ETARGET
 	EVALUE
+	EFUNC
+	// value of the single column of the single row of a subquery
+	ESUBQUERY
+	// EXISTS of a subquery
+	EEXISTS
+	// first argument IN the rows of a subquery
+	EINSUBQUERY
 )
 
 type ComparisonExpr struct {
@@ -31,9 +59,12 @@ func (node *ComparisonExpr) String() string {
 	return "Comparison"
 }
 
+// Schema and Table qualify column names
 type VariableExpr struct {
-	Type int
-	Name string
+	Type   int
+	Schema string
+	Table  string
+	Name   string
 }
 
 func (node *VariableExpr) String() string {
@@ -47,3 +78,131 @@ type ValueExpr struct {
 func (node *ValueExpr) String() string {
 	return "Value"
 }
+
+type BinaryExpr struct {
+	Operator    int
+	Left, Right Expr
+}
+
+func (node *BinaryExpr) String() string {
+	return "Binary"
+}
+
+type UnaryExpr struct {
+	Operator int
+	Expr     Expr
+}
+
+func (node *UnaryExpr) String() string {
+	return "Unary"
+}
+
+type FuncCallExpr struct {
+	Name string
+	Args Exprs
+}
+
+func (node *FuncCallExpr) String() string {
+	return "FuncCall"
+}
+
+type WhenClause struct {
+	Cond   Expr
+	Result Expr
+}
+
+// CASE Value WHEN ... compares Value with the conditions of the whens
+type CaseExpr struct {
+	Value Expr
+	Whens []*WhenClause
+	Else  Expr
+}
+
+func (node *CaseExpr) String() string {
+	return "Case"
+}
+
+const (
+	CastSigned int = iota
+	CastUnsigned
+	CastChar
+	CastBinary
+	CastDouble
+	CastDecimal
+)
+
+// Len is the length of CHAR(n), -1 if not given
+type CastExpr struct {
+	Expr Expr
+	Type int
+	Len  int64
+}
+
+func (node *CastExpr) String() string {
+	return "Cast"
+}
+
+// INTERVAL Value Unit, only allowed as the last argument of date arithmetic
+type IntervalExpr struct {
+	Value Expr
+	Unit  string
+}
+
+func (node *IntervalExpr) String() string {
+	return "Interval"
+}
+
+type LogicalExpr struct {
+	Operator    int
+	Left, Right Expr
+}
+
+func (node *LogicalExpr) String() string {
+	return "Logical"
+}
+
+type NotExpr struct {
+	Expr Expr
+}
+
+func (node *NotExpr) String() string {
+	return "Not"
+}
+
+type SubqueryExpr struct {
+	Select *SelectStmt
+}
+
+func (node *SubqueryExpr) String() string {
+	return "Subquery"
+}
+
+type ExistsExpr struct {
+	Sub *SubqueryExpr
+}
+
+func (node *ExistsExpr) String() string {
+	return "Exists"
+}
+
+// Expr IN a list of values or a subquery, one of List and Sub is set
+type InExpr struct {
+	Expr Expr
+	List Exprs
+	Sub  *SubqueryExpr
+	Not  bool
+}
+
+func (node *InExpr) String() string {
+	return "In"
+}
+
+// VALUES(col) in ON DUPLICATE KEY UPDATE, the value col would have been
+// inserted with
+type ValuesExpr struct {
+	Name string
+}
+
+func (node *ValuesExpr) String() string {
+	return "Values"
+}
@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"strings"
+)
+
+/*
+ * The tables of information_schema are kept in memory by the server, and
+ * not in the storage. Their TableInfo is made up here, with Memory set, and
+ * a scan of one is given its rows by the executor.
+ */
+const ProcessListTable = "information_schema.processlist"
+
+// MemoryTableInfo gives the table info of the memory table tblName, nil
+// when it is not one
+func MemoryTableInfo(tblName string) *TableInfo {
+	if !strings.EqualFold(tblName, ProcessListTable) {
+		return nil
+	}
+
+	names := []string{"ID", "USER", "HOST", "DB", "COMMAND", "TIME", "STATE", "INFO"}
+	cds := ColumnTableDefs{}
+	for i, name := range names {
+		var typ ColumnType = &StringType{Name: "STRING"}
+		if name == "ID" || name == "TIME" {
+			typ = &IntType{Name: "INT"}
+		}
+		cds = append(cds, &ColumnTableDef{ID: i + 1, Name: name, Pos: i + 1, Type: typ, Nullable: Null})
+	}
+	table := NewTableInfo(ProcessListTable, cds)
+	table.Memory = true
+	return table
+}
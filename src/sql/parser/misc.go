@@ -242,6 +242,11 @@ var tokenMap = map[string]int{
 	"TIMESTAMPDIFF":      TIMESTAMPDIFF,
 	"NONE":               NONE,
 	"SUPER":              SUPER,
+	"ADMIN":              ADMIN,
+	"DDL":                DDLSYM,
+	"JOBS":               JOBS,
+	"DUPLICATE":          DUPLICATE,
+	"QUERY":              QUERY,
 	"ADD":                ADD,
 	"ALL":                ALL,
 	"ALTER":              ALTER,
@@ -258,6 +263,7 @@ var tokenMap = map[string]int{
 	"CASCADE":            CASCADE,
 	"CASE":               CASE,
 	"CHANGE":             CHANGE,
+	"CHAR":               CHAR,
 	"CHARACTER":          CHARACTER,
 	"CHECK":              CHECK,
 	"COLLATE":            COLLATE,
@@ -289,6 +295,7 @@ var tokenMap = map[string]int{
 	"ELSE":               ELSE,
 	"ENCLOSED":           ENCLOSED,
 	"ESCAPED":            ESCAPED,
+	"EXCEPT":             EXCEPT,
 	"EXISTS":             EXISTS,
 	"EXPLAIN":            EXPLAIN,
 	"FALSE":              FALSE,
@@ -314,6 +321,7 @@ var tokenMap = map[string]int{
 	"INT":                INT,
 	"INTO":               INTO,
 	"INTEGER":            INTEGER,
+	"INTERSECT":          INTERSECT,
 	"INTERVAL":           INTERVAL,
 	"IS":                 IS,
 	"JOIN":               JOIN,
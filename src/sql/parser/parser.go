@@ -58,7 +58,7 @@ func toInt(l yyLexer, lval *yySymType, str string) int {
 	}
 
 	switch {
-	case n < math.MaxInt64:
+	case n <= math.MaxInt64:
 		lval.item = int64(n)
 	default:
 		lval.item = uint64(n)
@@ -66,9 +66,15 @@ func toInt(l yyLexer, lval *yySymType, str string) int {
 	return intLit
 }
 
+// decimals are evaluated as floats
 func toDecimal(l yyLexer, lval *yySymType, str string) int {
-	//@TODO
-	lval.item = nil
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		l.Errorf("decimal literal: %v", err)
+		return int(unicode.ReplacementChar)
+	}
+
+	lval.item = n
 	return decLit
 }
 
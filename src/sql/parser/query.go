@@ -3,15 +3,29 @@ package parser
 type TargetRes struct {
 	Type     int
 	TargetID int
+	// alias given with AS
+	Name string
 
-	// column id
+	// column id, of the row of the query Depth levels out
 	FieldID int
+	Depth   int
 
-	// sysvar
-	SysVar string
+	// sysvar, the value of @@global.SysVar is kept in Value
+	SysVar       string
+	SysVarGlobal bool
 
 	// value
 	Value interface{}
+
+	// function or operator, evaluated on its arguments
+	FuncName string
+	Args     []*TargetRes
+
+	// subquery
+	Sub *SelectQuery
+
+	// util.Kind* of the result
+	RetType byte
 }
 
 type ComparisonQual struct {
@@ -20,16 +34,53 @@ type ComparisonQual struct {
 }
 
 type TableInfo struct {
+	ID        int64
 	Name      string
 	ColumnMap map[int]*ColumnTableDef
+
+	// schema version, bumped by every ALTER TABLE
+	Version     int
+	MaxColumnID int
+	// layout of rows written before the table was first altered
+	Legacy ColumnTableDefs
+	// table of information_schema, kept in memory by the server
+	Memory bool
 }
 
 type SelectQuery struct {
-	From      *TableInfo
+	From *TableInfo
+	// statistics and public indexes of From, for the optimizer
+	Stats   *TableStats
+	Indexes []*IndexInfo
+	// derived table, From is nil then
+	FromQuery *SelectQuery
+	Alias     string
+	Distinct  bool
 	Fields    []*TargetRes
-	FieldsNum int
-	Qual      *ComparisonQual
-	Limit     uint64
+	// where clause when it is column = value
+	Qual *ComparisonQual
+	// any other where clause
+	Where   *TargetRes
+	OrderBy []*SortItem
+	Limit   *LimitClause
+	// refers to columns of an enclosing query
+	Correlated bool
+
+	// set operation of two queries, Fields are then the columns of its
+	// result, of the kinds both sides are converted to
+	SetOpr *SetOprQuery
+}
+
+// Key is evaluated on the rows the query is sorted on
+type SortItem struct {
+	Key  *TargetRes
+	Desc bool
+}
+
+type SetOprQuery struct {
+	Op          int
+	All         bool
+	Left, Right *SelectQuery
 }
 
 func (node *SelectQuery) String() string {
@@ -57,10 +108,18 @@ func IsPKFilter(qual *ComparisonQual, cm map[int]*ColumnTableDef) bool {
 const (
 	SDATABASES int = iota
 	STABLES
+	SDDLJOBS
+	SWARNINGS
+	SPROCESSLIST
+	SVARIABLES
 )
 
 type Show struct {
 	Operator int
+	Full     bool
+	// the GLOBAL values of SHOW VARIABLES, and the names they match
+	Global  bool
+	Pattern string
 }
 
 func (node *Show) String() string {
@@ -70,26 +129,81 @@ func (node *Show) String() string {
 type InsertQuery struct {
 	NumColumns int
 	TableName  string
-	PK         string
-	Values     map[int]interface{}
+	Table      *TableInfo
+	Rows       []map[int]interface{}
+
+	// INSERT ... SELECT, field i of Select goes to column Columns[i]
+	Select  *SelectQuery
+	Columns []int
+
+	// what to do with a row whose primary key exists: fail, replace the
+	// row, skip it, or update the row by OnDuplicate
+	Replace     bool
+	Ignore      bool
+	OnDuplicate []*Assignment
+}
+
+// Assignment sets the column at Pos, counted from 0, to Value
+type Assignment struct {
+	Pos   int
+	Value *TargetRes
 }
 
 func (node *InsertQuery) String() string {
 	return "INSERT QUERY"
 }
 
+// the rows of Select, all the columns of Table, are updated by Assignments
 type UpdateQuery struct {
-	Table     *TableInfo
-	Fields    []*TargetRes
-	FieldsNum int
-	Values    map[int]interface{}
-	Qual      *ComparisonQual
+	Table       *TableInfo
+	Select      *SelectQuery
+	Assignments []*Assignment
 }
 
 func (node *UpdateQuery) String() string {
 	return "UPDATE QUERY"
 }
 
+const (
+	ExplainRow int = iota
+	ExplainJSON
+)
+
+type ExplainQuery struct {
+	Query   Statement
+	Format  int
+	Analyze bool
+}
+
+func (node *ExplainQuery) String() string {
+	return "EXPLAIN QUERY"
+}
+
+// Tables[i] is nil when the table named Names[i] doesn't exist
+type AnalyzeTableQuery struct {
+	Names  []string
+	Tables []*TableInfo
+}
+
+func (node *AnalyzeTableQuery) String() string {
+	return "ANALYZE TABLE QUERY"
+}
+
+// SetVariable gives Value to the system variable Name
+type SetVariable struct {
+	Name     string
+	IsGlobal bool
+	Value    *TargetRes
+}
+
+type SetQuery struct {
+	Variables []*SetVariable
+}
+
+func (node *SetQuery) String() string {
+	return "SET QUERY"
+}
+
 type CreateIndexQuery struct {
 	Index     *TableName
 	Table     *TableName
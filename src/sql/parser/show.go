@@ -13,3 +13,46 @@ type ShowTables struct {
 func (node *ShowTables) String() string {
 	return "SHOW TABLES"
 }
+
+type ShowWarnings struct {
+}
+
+func (node *ShowWarnings) String() string {
+	return "SHOW WARNINGS"
+}
+
+// ShowVariables lists the system variables whose names match Pattern, of
+// the session or the GLOBAL ones
+type ShowVariables struct {
+	Global  bool
+	Pattern string
+}
+
+func (node *ShowVariables) String() string {
+	s := "SHOW VARIABLES"
+	if node.Global {
+		s = "SHOW GLOBAL VARIABLES"
+	}
+	if node.Pattern != "" {
+		s += " LIKE '" + node.Pattern + "'"
+	}
+	return s
+}
+
+type ShowProcessList struct {
+	Full bool
+}
+
+func (node *ShowProcessList) String() string {
+	if node.Full {
+		return "SHOW FULL PROCESSLIST"
+	}
+	return "SHOW PROCESSLIST"
+}
+
+type AdminShowDDLJobs struct {
+}
+
+func (node *AdminShowDDLJobs) String() string {
+	return "ADMIN SHOW DDL JOBS"
+}
@@ -1,5 +1,12 @@
 %{
 package parser
+
+import (
+	"math"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/expression"
+)
 %}
 
 %union {
@@ -9,6 +16,7 @@ package parser
 	stmt		Statement
 	stmts		[]Statement
 	tname   	*TableName
+	tnames		[]*TableName
 	tbldef  	*ColumnTableDef
 	tbldefs 	ColumnTableDefs
 	colType 	ColumnType
@@ -18,10 +26,19 @@ package parser
 	csl 		[]*ColumnSet
 	expr		Expr
 	exprs		Exprs
+	exprsl		[]Exprs
 	tgelem		*TargetElem
 	tglist		TargetClause
 	where		*WhereClause
 	limit 		*LimitClause
+	byitem		*ByItem
+	byitems		[]*ByItem
+	alspec		*AlterTableSpec
+	alspecs		[]*AlterTableSpec
+	when		*WhenClause
+	whens		[]*WhenClause
+	varAssign	*VariableAssignment
+	varAssigns	[]*VariableAssignment
 }
 
 %type <stmts>	StmtList
@@ -29,36 +46,59 @@ package parser
 %type <stmt>	CreateDatabaseStmt
 %type <stmt>	CreateTableStmt
 %type <stmt>	CreateIndexStmt
+%type <stmt>	AlterTableStmt
 %type <stmt>	DropDatabaseStmt
 %type <stmt>	DropTableStmt
-%type <stmt>	SelectStmt
+%type <stmt>	DropIndexStmt
+%type <stmt>	TruncateTableStmt
+%type <stmt>	SelectStmt SimpleSelect SelectBody SelectFirstTerm SelectTerm SelectOperand
 %type <stmt>	InsertStmt
 %type <stmt>	UpdateStmt
 %type <stmt>	ShowStmt
 %type <stmt>	UseDBStmt
+%type <stmt>	AdminStmt
+%type <stmt>	ExplainStmt ExplainableStmt
+%type <stmt>	AnalyzeTableStmt
+%type <stmt>	SetStmt
+%type <stmt>	KillStmt
 
 %type <stmt>	InsertValues
 
 %type <expr>	Lit
 %type <expr>	Expression
-%type <exprs>	ExpressionList
+%type <exprs>	ExpressionList ExpressionListOpt
+%type <exprsl>	ValuesList
+%type <expr>	FunctionCall CaseValueOpt ElseOpt SubSelect
+%type <when>	WhenClause
+%type <whens>	WhenClauseList
+%type <varAssign>	VariableAssignment
+%type <varAssigns>	VariableAssignmentList
+%type <item>	CastType TrimDirection GlobalScope
+%type <str>		FunctionNameConflict
 %type <tgelem>	TargetElem
 %type <tglist>	TargetClause
 %type <tname>	FromClause
 %type <where>	WhereClause
 %type <limit>	LimitClause
+%type <byitem>	ByItem
+%type <byitems>	OrderByOpt ByList
+%type <item>	SetOprAllOpt OrderOpt DistinctOpt
 
 %type <tname>		TableName
+%type <tnames>		TableNameList
 %type <tbldef>		TableElem
 %type <tbldefs>		TableElemList
 %type <colType>		TypeName NumericType StringType
 %type <colOption>	ColumnOptionItem
 %type <colOptions>	ColumnOption
 %type <cs>			ColumnSetOpt
-%type <csl>			ColumnSetListOpt
+%type <csl>			ColumnSetListOpt OnDuplicateOpt
 %type <strs>	ColumnListOpt
-%type <str>		Name IntoOpt ValueSym
+%type <str>		Name IntoOpt ValueSym ExplainSym CharsetName ShowLikeOpt
 %type <str>		UnReservedKeyword ReservedKeyword
+%type <alspec>		AlterTableSpec
+%type <alspecs>		AlterTableSpecList
+%type <item>		ColumnKeywordOpt IndexOrKey UniqueOpt IgnoreOpt RenameToOpt TableKeywordOpt
 
 %token <item> intLit floatLit decLit hexLit bitLit
 %token <str> at identifier invalid sysVar userVar 
@@ -76,18 +116,18 @@ package parser
 %token <str> MIN_ROWS NATIONAL ROW ROW_FORMAT QUARTER GRANTS TRIGGERS DELAY_KEY_WRITE ISOLATION
 %token <str> REPEATABLE COMMITTED UNCOMMITTED ONLY SERIALIZABLE LEVEL VARIABLES SQL_CACHE INDEXES PROCESSLIST
 %token <str> SQL_NO_CACHE DISABLE ENABLE REVERSE SPACE PRIVILEGES NO BINLOG FUNCTION VIEW MODIFY EVENTS PARTITIONS
-%token <str> TIMESTAMPDIFF NONE SUPER
+%token <str> TIMESTAMPDIFF NONE SUPER ADMIN DDLSYM JOBS DUPLICATE QUERY
 
 %token <str> ADD ALL ALTER ANALYZE AND AS ASC BETWEEN BIGINT
-%token <str> BINARY BLOB BOTH BY CASCADE CASE CHANGE CHARACTER CHECK COLLATE
+%token <str> BINARY BLOB BOTH BY CASCADE CASE CHANGE CHAR CHARACTER CHECK COLLATE
 %token <str> COLUMN CONSTRAINT CONVERT CREATE CROSS CURRENT_DATE CURRENT_TIME
 %token <str> CURRENT_TIMESTAMP CURRENT_USER DATABASE DATABASES DAY_HOUR DAY_MICROSECOND
 %token <str> DAY_MINUTE DAY_SECOND DECIMAL DEFAULT DELETE DESC DESCRIBE
 %token <str> DISTINCT DIV DOUBLE DROP DUAL ELSE ENCLOSED ESCAPED
-%token <str> EXISTS EXPLAIN FALSE FLOAT FOR FORCE FOREIGN FROM
+%token <str> EXCEPT EXISTS EXPLAIN FALSE FLOAT FOR FORCE FOREIGN FROM
 %token <str> FULLTEXT GRANT GROUP HAVING HOUR_MICROSECOND HOUR_MINUTE
 %token <str> HOUR_SECOND IF IGNORE IN INDEX INFILE INNER INSERT INT INTO INTEGER
-%token <str> INTERVAL IS JOIN KEY KEYS KILL LEADING LEFT LIKE LIMIT LINES LOAD
+%token <str> INTERSECT INTERVAL IS JOIN KEY KEYS KILL LEADING LEFT LIKE LIMIT LINES LOAD
 %token <str> LOCALTIME LOCALTIMESTAMP LOCK LONGBLOB LONGTEXT MAXVALUE MEDIUMBLOB MEDIUMINT MEDIUMTEXT
 %token <str> MINUTE_MICROSECOND MINUTE_SECOND MOD NOT NO_WRITE_TO_BINLOG NULL NUMERIC
 %token <str> ON OPTION OR ORDER OUTER PARTITION PRECISION PRIMARY PROCEDURE RANGE READ
@@ -98,7 +138,14 @@ package parser
 %token <str> UPDATE USE USING UTC_DATE UTC_TIMESTAMP VALUES VARBINARY VARCHAR
 %token <str> WHEN WHERE WRITE XOR YEAR_MONTH ZEROFILL
 
-%left eq
+%left OR oror
+%left XOR
+%left AND andand
+%right NOT
+%left eq neq neqSynonym '<' le '>' ge IN
+%left '+' '-'
+%left '*' '/' '%' DIV MOD
+%precedence neg
 
 %%
 
@@ -122,28 +169,146 @@ Stmt:
 	CreateDatabaseStmt
 |	CreateTableStmt
 |	CreateIndexStmt
+|	AlterTableStmt
 |	SelectStmt
 |	InsertStmt
 |	UpdateStmt
 |	DropDatabaseStmt
 |	DropTableStmt
+|	DropIndexStmt
+|	TruncateTableStmt
 |	ShowStmt
 |	UseDBStmt
+|	AdminStmt
+|	ExplainStmt
+|	AnalyzeTableStmt
+|	SetStmt
+|	KillStmt
 | 	/* EMPTY */
 	{
 		$$ = nil
 	}
 	
 SelectStmt:
-	SELECT TargetClause FromClause WhereClause LimitClause
+	SelectBody OrderByOpt LimitClause
+	{
+		s := $1.(*SelectStmt)
+		s.OrderBy = $2
+		s.Limit = $3
+		$$ = s
+	}
+
+SimpleSelect:
+	SELECT DistinctOpt TargetClause FromClause WhereClause
 	{
 		$$ = &SelectStmt{
-			Target: $2,
-			From: $3,
-			Where: $4,
-			Limit: $5,
+			Distinct: $2.(bool),
+			Target: $3,
+			From: $4,
+			Where: $5,
 		}
 	}
+
+DistinctOpt:
+	{
+		$$ = false
+	}
+|	ALL
+	{
+		$$ = false
+	}
+|	DISTINCT
+	{
+		$$ = true
+	}
+
+/*
+ * INTERSECT binds tighter than UNION and EXCEPT. Only operands after the
+ * first may be parenthesized, a select starting with '(' can't be told
+ * from a parenthesized expression in a subquery.
+ */
+SelectBody:
+	SelectFirstTerm
+|	SelectBody UNION SetOprAllOpt SelectTerm
+	{
+		$$ = &SelectStmt{SetOpr: &SetOpr{Op: SetUnion, All: $3.(bool), Left: $1.(*SelectStmt), Right: $4.(*SelectStmt)}}
+	}
+|	SelectBody EXCEPT SetOprAllOpt SelectTerm
+	{
+		$$ = &SelectStmt{SetOpr: &SetOpr{Op: SetExcept, All: $3.(bool), Left: $1.(*SelectStmt), Right: $4.(*SelectStmt)}}
+	}
+
+SelectFirstTerm:
+	SimpleSelect
+|	SelectFirstTerm INTERSECT SetOprAllOpt SelectOperand
+	{
+		$$ = &SelectStmt{SetOpr: &SetOpr{Op: SetIntersect, All: $3.(bool), Left: $1.(*SelectStmt), Right: $4.(*SelectStmt)}}
+	}
+
+SelectTerm:
+	SelectOperand
+|	SelectTerm INTERSECT SetOprAllOpt SelectOperand
+	{
+		$$ = &SelectStmt{SetOpr: &SetOpr{Op: SetIntersect, All: $3.(bool), Left: $1.(*SelectStmt), Right: $4.(*SelectStmt)}}
+	}
+
+SelectOperand:
+	SimpleSelect
+|	'(' SelectStmt ')'
+	{
+		$$ = $2
+	}
+
+SetOprAllOpt:
+	{
+		$$ = false
+	}
+|	ALL
+	{
+		$$ = true
+	}
+|	DISTINCT
+	{
+		$$ = false
+	}
+
+OrderByOpt:
+	{
+		$$ = nil
+	}
+|	ORDER BY ByList
+	{
+		$$ = $3
+	}
+
+ByList:
+	ByItem
+	{
+		$$ = []*ByItem{$1}
+	}
+|	ByList ',' ByItem
+	{
+		$$ = append($1, $3)
+	}
+
+ByItem:
+	Expression OrderOpt
+	{
+		$$ = &ByItem{Expr: $1, Desc: $2.(bool)}
+	}
+
+OrderOpt:
+	{
+		$$ = false
+	}
+|	ASC
+	{
+		$$ = false
+	}
+|	DESC
+	{
+		$$ = true
+	}
 	
 TargetClause:
 	TargetElem
@@ -164,10 +329,30 @@ TargetElem:
 	{
 		$$ = &TargetElem{Item: $1}
 	}
+|	Expression AsOpt Name
+	{
+		$$ = &TargetElem{Item: $1, AsName: $3}
+	}
+|	Expression AsOpt stringLit
+	{
+		$$ = &TargetElem{Item: $1, AsName: $3}
+	}
 |	'*'
 	{
 		$$ = &TargetElem{Item: &VariableExpr{Type: EALLTARGET}}
 	}
+|	Name '.' '*'
+	{
+		$$ = &TargetElem{Item: &VariableExpr{Type: EALLTARGET, Table: $1}}
+	}
+|	Name '.' Name '.' '*'
+	{
+		$$ = &TargetElem{Item: &VariableExpr{Type: EALLTARGET, Schema: $1, Table: $3}}
+	}
+
+AsOpt:
+	{}
+|	AS
 	
 
 FromClause:
@@ -175,6 +360,15 @@ FromClause:
 	{
 		$$ = $2
 	}
+|	FROM TableName AsOpt Name
+	{
+		$2.AsName = $4
+		$$ = $2
+	}
+|	FROM '(' SelectStmt ')' AsOpt Name
+	{
+		$$ = &TableName{Select: $3.(*SelectStmt), AsName: $6}
+	}
 |	/* Empty */
 	{
 		$$ = nil
@@ -195,6 +389,14 @@ LimitClause:
 	{
 		$$ = &LimitClause{Num: getUint64FromItem($2)}
 	}
+|	LIMIT intLit ',' intLit
+	{
+		$$ = &LimitClause{Num: getUint64FromItem($4), Offset: getUint64FromItem($2)}
+	}
+|	LIMIT intLit OFFSET intLit
+	{
+		$$ = &LimitClause{Num: getUint64FromItem($2), Offset: getUint64FromItem($4)}
+	}
 |	/* Empty */
 	{
 		$$ = nil
@@ -215,6 +417,14 @@ Expression:
 	{
 		$$ = &VariableExpr{Type: ETARGET, Name: $1}
 	}
+|	Name '.' Name
+	{
+		$$ = &VariableExpr{Type: ETARGET, Table: $1, Name: $3}
+	}
+|	Name '.' Name '.' Name
+	{
+		$$ = &VariableExpr{Type: ETARGET, Schema: $1, Table: $3, Name: $5}
+	}
 |	sysVar
 	{
 		$$ = &VariableExpr{Type: ESYSVAR, Name: $1}
@@ -223,18 +433,322 @@ Expression:
 	{
 		$$ = &ValueExpr{Item: $1}
 	}
+|	floatLit
+	{
+		$$ = &ValueExpr{Item: $1}
+	}
+|	decLit
+	{
+		$$ = &ValueExpr{Item: $1}
+	}
 |	stringLit
 	{
 		$$ = &ValueExpr{Item: $1}
 	}
+|	NULL
+	{
+		$$ = &ValueExpr{Item: nil}
+	}
+|	FunctionCall
+|	'(' Expression ')'
+	{
+		$$ = $2
+	}
 |	Expression eq Expression
 	{
 		$$ = &ComparisonExpr{Operator: EQ, Left: $1, Right: $3}
 	}
-|	/*Empty*/
+|	Expression neq Expression
+	{
+		$$ = &ComparisonExpr{Operator: NE, Left: $1, Right: $3}
+	}
+|	Expression neqSynonym Expression
+	{
+		$$ = &ComparisonExpr{Operator: NE, Left: $1, Right: $3}
+	}
+|	Expression '<' Expression
+	{
+		$$ = &ComparisonExpr{Operator: LT, Left: $1, Right: $3}
+	}
+|	Expression le Expression
+	{
+		$$ = &ComparisonExpr{Operator: LE, Left: $1, Right: $3}
+	}
+|	Expression '>' Expression
+	{
+		$$ = &ComparisonExpr{Operator: GT, Left: $1, Right: $3}
+	}
+|	Expression ge Expression
+	{
+		$$ = &ComparisonExpr{Operator: GE, Left: $1, Right: $3}
+	}
+|	Expression '+' Expression
+	{
+		$$ = &BinaryExpr{Operator: PLUS, Left: $1, Right: $3}
+	}
+|	Expression '-' Expression
+	{
+		$$ = &BinaryExpr{Operator: MINUS, Left: $1, Right: $3}
+	}
+|	Expression '*' Expression
+	{
+		$$ = &BinaryExpr{Operator: MULT, Left: $1, Right: $3}
+	}
+|	Expression '/' Expression
+	{
+		$$ = &BinaryExpr{Operator: DIVIDE, Left: $1, Right: $3}
+	}
+|	Expression DIV Expression
+	{
+		$$ = &BinaryExpr{Operator: INTDIV, Left: $1, Right: $3}
+	}
+|	Expression MOD Expression
+	{
+		$$ = &BinaryExpr{Operator: MODULO, Left: $1, Right: $3}
+	}
+|	Expression '%' Expression
+	{
+		$$ = &BinaryExpr{Operator: MODULO, Left: $1, Right: $3}
+	}
+|	'-' Expression %prec neg
+	{
+		// -9223372036854775808 is the smallest BIGINT, not a negated float
+		if v, ok := $2.(*ValueExpr); ok && v.Item == uint64(-math.MinInt64) {
+			$$ = &ValueExpr{Item: int64(math.MinInt64)}
+		} else {
+			$$ = &UnaryExpr{Operator: UMINUS, Expr: $2}
+		}
+	}
+|	'+' Expression %prec neg
+	{
+		$$ = $2
+	}
+|	INTERVAL Expression Name
+	{
+		$$ = &IntervalExpr{Value: $2, Unit: $3}
+	}
+|	Expression AND Expression
+	{
+		$$ = &LogicalExpr{Operator: LogicAnd, Left: $1, Right: $3}
+	}
+|	Expression andand Expression
+	{
+		$$ = &LogicalExpr{Operator: LogicAnd, Left: $1, Right: $3}
+	}
+|	Expression OR Expression
+	{
+		$$ = &LogicalExpr{Operator: LogicOr, Left: $1, Right: $3}
+	}
+|	Expression oror Expression
+	{
+		$$ = &LogicalExpr{Operator: LogicOr, Left: $1, Right: $3}
+	}
+|	Expression XOR Expression
+	{
+		$$ = &LogicalExpr{Operator: LogicXor, Left: $1, Right: $3}
+	}
+|	NOT Expression
+	{
+		$$ = &NotExpr{Expr: $2}
+	}
+|	'!' Expression %prec neg
+	{
+		$$ = &NotExpr{Expr: $2}
+	}
+|	SubSelect
+|	EXISTS SubSelect
+	{
+		$$ = &ExistsExpr{Sub: $2.(*SubqueryExpr)}
+	}
+|	Expression IN SubSelect
+	{
+		$$ = &InExpr{Expr: $1, Sub: $3.(*SubqueryExpr)}
+	}
+|	Expression NOT IN SubSelect
+	{
+		$$ = &InExpr{Expr: $1, Sub: $4.(*SubqueryExpr), Not: true}
+	}
+|	Expression IN '(' ExpressionList ')'
+	{
+		$$ = &InExpr{Expr: $1, List: $4}
+	}
+|	Expression NOT IN '(' ExpressionList ')'
+	{
+		$$ = &InExpr{Expr: $1, List: $5, Not: true}
+	}
+
+SubSelect:
+	'(' SelectStmt ')'
+	{
+		$$ = &SubqueryExpr{Select: $2.(*SelectStmt)}
+	}
+
+ExpressionListOpt:
+	{
+		$$ = nil
+	}
+|	ExpressionList
+
+FunctionCall:
+	Name '(' ExpressionListOpt ')'
+	{
+		$$ = &FuncCallExpr{Name: $1, Args: $3}
+	}
+|	Name '(' Expression AS CastType ')'
+	{
+		if !strings.EqualFold($1, "CAST") {
+			yylex.Errorf("syntax error near AS in function %s", $1)
+			return 1
+		}
+		c := $5.(*CastExpr)
+		c.Expr = $3
+		$$ = c
+	}
+|	FunctionNameConflict '(' ExpressionListOpt ')'
+	{
+		$$ = &FuncCallExpr{Name: $1, Args: $3}
+	}
+|	CURRENT_USER
+	{
+		$$ = &FuncCallExpr{Name: $1}
+	}
+|	CURRENT_DATE
+	{
+		$$ = &FuncCallExpr{Name: $1}
+	}
+|	CURRENT_TIMESTAMP
+	{
+		$$ = &FuncCallExpr{Name: $1}
+	}
+|	Name '(' Expression FROM Expression ')'
+	{
+		if !strings.EqualFold($1, "TRIM") {
+			yylex.Errorf("syntax error near FROM in function %s", $1)
+			return 1
+		}
+		$$ = &FuncCallExpr{Name: $1, Args: Exprs{$5, $3}}
+	}
+|	Name '(' TrimDirection FROM Expression ')'
+	{
+		if !strings.EqualFold($1, "TRIM") {
+			yylex.Errorf("syntax error near FROM in function %s", $1)
+			return 1
+		}
+		$$ = &FuncCallExpr{Name: $1, Args: Exprs{$5, &ValueExpr{Item: " "}, &ValueExpr{Item: $3}}}
+	}
+|	Name '(' TrimDirection Expression FROM Expression ')'
+	{
+		if !strings.EqualFold($1, "TRIM") {
+			yylex.Errorf("syntax error near FROM in function %s", $1)
+			return 1
+		}
+		$$ = &FuncCallExpr{Name: $1, Args: Exprs{$6, $4, &ValueExpr{Item: $3}}}
+	}
+|	CONVERT '(' Expression ',' CastType ')'
+	{
+		c := $5.(*CastExpr)
+		c.Expr = $3
+		$$ = c
+	}
+|	CONVERT '(' Expression USING Name ')'
+	{
+		$$ = &CastExpr{Expr: $3, Type: CastChar, Len: -1}
+	}
+|	CASE CaseValueOpt WhenClauseList ElseOpt END
+	{
+		$$ = &CaseExpr{Value: $2, Whens: $3, Else: $4}
+	}
+|	VALUES '(' Name ')'
+	{
+		$$ = &ValuesExpr{Name: $3}
+	}
+
+/* reserved keywords which are also function names */
+FunctionNameConflict:
+	IF | DATABASE | SCHEMA | REPLACE | MOD | CURRENT_USER | CURRENT_DATE | CURRENT_TIMESTAMP
+
+TrimDirection:
+	BOTH
+	{
+		$$ = expression.TrimBoth
+	}
+|	LEADING
+	{
+		$$ = expression.TrimLeading
+	}
+|	TRAILING
+	{
+		$$ = expression.TrimTrailing
+	}
+
+CaseValueOpt:
+	{
+		$$ = nil
+	}
+|	Expression
+
+WhenClauseList:
+	WhenClause
+	{
+		$$ = []*WhenClause{$1}
+	}
+|	WhenClauseList WhenClause
+	{
+		$$ = append($1, $2)
+	}
+
+WhenClause:
+	WHEN Expression THEN Expression
+	{
+		$$ = &WhenClause{Cond: $2, Result: $4}
+	}
+
+ElseOpt:
 	{
 		$$ = nil
 	}
+|	ELSE Expression
+	{
+		$$ = $2
+	}
+
+CastType:
+	CHAR
+	{
+		$$ = &CastExpr{Type: CastChar, Len: -1}
+	}
+|	CHAR '(' intLit ')'
+	{
+		$$ = &CastExpr{Type: CastChar, Len: int64(getUint64FromItem($3))}
+	}
+|	BINARY
+	{
+		$$ = &CastExpr{Type: CastBinary, Len: -1}
+	}
+|	SIGNED
+	{
+		$$ = &CastExpr{Type: CastSigned, Len: -1}
+	}
+|	SIGNED INTEGER
+	{
+		$$ = &CastExpr{Type: CastSigned, Len: -1}
+	}
+|	UNSIGNED
+	{
+		$$ = &CastExpr{Type: CastUnsigned, Len: -1}
+	}
+|	UNSIGNED INTEGER
+	{
+		$$ = &CastExpr{Type: CastUnsigned, Len: -1}
+	}
+|	DOUBLE
+	{
+		$$ = &CastExpr{Type: CastDouble, Len: -1}
+	}
+|	DECIMAL
+	{
+		$$ = &CastExpr{Type: CastDecimal, Len: -1}
+	}
 
 Lit:
 	intLit
@@ -247,21 +761,66 @@ Lit:
 	}
 	
 InsertStmt:
-	INSERT IntoOpt TableName InsertValues
+	INSERT IgnoreOpt IntoOpt TableName InsertValues OnDuplicateOpt
+	{
+		n := $5.(*InsertStmt)
+		n.TName = $4
+		n.Ignore = $2.(bool)
+		n.OnDuplicate = $6
+		$$ = n
+	}
+|	REPLACE IntoOpt TableName InsertValues
 	{
 		n := $4.(*InsertStmt)
 		n.TName = $3
+		n.Replace = true
 		$$ = n
 	}
 
+IgnoreOpt:
+	{
+		$$ = false
+	}
+|	IGNORE
+	{
+		$$ = true
+	}
+
+OnDuplicateOpt:
+	{
+		$$ = nil
+	}
+|	ON DUPLICATE KEY UPDATE ColumnSetListOpt
+	{
+		$$ = $5
+	}
+
 InsertValues:
-	'(' ColumnListOpt ')' ValueSym '(' ExpressionList ')'
+	'(' ColumnListOpt ')' ValueSym ValuesList
+	{
+		$$ = &InsertStmt{ColumnList: $2, Values: $5}
+	}
+|	ValueSym ValuesList
+	{
+		$$ = &InsertStmt{Values: $2}
+	}
+|	'(' ColumnListOpt ')' SelectStmt
+	{
+		$$ = &InsertStmt{ColumnList: $2, Select: $4.(*SelectStmt)}
+	}
+|	SelectStmt
+	{
+		$$ = &InsertStmt{Select: $1.(*SelectStmt)}
+	}
+
+ValuesList:
+	'(' ExpressionList ')'
 	{
-		$$ = &InsertStmt{ColumnList: $2, Values: $6}
+		$$ = []Exprs{$2}
 	}
-|	ValueSym '(' ExpressionList ')'
+|	ValuesList ',' '(' ExpressionList ')'
 	{
-		$$ = &InsertStmt{Values: $3}
+		$$ = append($1, $4)
 	}
 
 ColumnListOpt:
@@ -283,7 +842,7 @@ ValueSym:
 |	VALUES
 
 ColumnSetOpt:
-	Name eq Lit
+	Name eq Expression
 	{
 		$$ = &ColumnSet{ColumnName: $1, Value: $3}
 	}
@@ -299,9 +858,9 @@ ColumnSetListOpt:
 	}
 
 UpdateStmt:
-	UPDATE TableName SET ColumnSetListOpt WhereClause
+	UPDATE TableName SET ColumnSetListOpt WhereClause OrderByOpt LimitClause
 	{
-		$$ = &UpdateStmt{TName: $2, ColumnSetList: $4, Where: $5}
+		$$ = &UpdateStmt{TName: $2, ColumnSetList: $4, Where: $5, OrderBy: $6, Limit: $7}
 	}
 
 CreateDatabaseStmt:
@@ -334,6 +893,89 @@ CreateIndexStmt:
 		$$ = &CreateIndex{Index: $4, Table: $6, Unique: true, Targets: $8}
 	}
 
+AlterTableStmt:
+	ALTER TABLE TableName AlterTableSpecList
+	{
+		$$ = &AlterTable{Table: $3, Specs: $4}
+	}
+
+AlterTableSpecList:
+	AlterTableSpec
+	{
+		$$ = []*AlterTableSpec{$1}
+	}
+|	AlterTableSpecList ',' AlterTableSpec
+	{
+		$$ = append($1, $3)
+	}
+
+AlterTableSpec:
+	ADD ColumnKeywordOpt TableElem
+	{
+		$$ = &AlterTableSpec{Type: AlterAddColumn, Column: $3}
+	}
+|	DROP ColumnKeywordOpt Name
+	{
+		$$ = &AlterTableSpec{Type: AlterDropColumn, OldName: $3}
+	}
+|	MODIFY ColumnKeywordOpt TableElem
+	{
+		$$ = &AlterTableSpec{Type: AlterModifyColumn, Column: $3}
+	}
+|	CHANGE ColumnKeywordOpt Name TableElem
+	{
+		$$ = &AlterTableSpec{Type: AlterChangeColumn, OldName: $3, Column: $4}
+	}
+|	ADD UniqueOpt IndexOrKey TableName '(' TargetClause ')'
+	{
+		$$ = &AlterTableSpec{Type: AlterAddIndex, Unique: $2.(bool), Index: $4, Targets: $6}
+	}
+|	DROP IndexOrKey TableName
+	{
+		$$ = &AlterTableSpec{Type: AlterDropIndex, Index: $3}
+	}
+|	RENAME RenameToOpt TableName
+	{
+		$$ = &AlterTableSpec{Type: AlterRename, NewTable: $3}
+	}
+
+ColumnKeywordOpt:
+	{}
+|	COLUMN
+	{
+		$$ = true
+	}
+
+IndexOrKey:
+	INDEX
+	{
+		$$ = true
+	}
+|	KEY
+	{
+		$$ = true
+	}
+
+UniqueOpt:
+	{
+		$$ = false
+	}
+|	UNIQUE
+	{
+		$$ = true
+	}
+
+RenameToOpt:
+	{}
+|	TO
+	{
+		$$ = true
+	}
+|	AS
+	{
+		$$ = true
+	}
+
 TableName:
 	Name
 	{
@@ -408,6 +1050,29 @@ DropTableStmt:
 		$$ = &DropTable{TName: $5, IfExists: true}
 	}
 
+DropIndexStmt:
+	DROP INDEX TableName ON TableName
+	{
+		$$ = &DropIndex{Index: $3, Table: $5, IfExists: false}
+	}
+|	DROP INDEX IF EXISTS TableName ON TableName
+	{
+		$$ = &DropIndex{Index: $5, Table: $7, IfExists: true}
+	}
+
+TruncateTableStmt:
+	TRUNCATE TableKeywordOpt TableName
+	{
+		$$ = &TruncateTable{Table: $3}
+	}
+
+TableKeywordOpt:
+	{}
+|	TABLE
+	{
+		$$ = true
+	}
+
 ShowStmt:
 	SHOW DATABASES
 	{
@@ -417,6 +1082,89 @@ ShowStmt:
 	{
 		$$ = &ShowTables{}
 	}
+|	SHOW WARNINGS
+	{
+		$$ = &ShowWarnings{}
+	}
+|	SHOW GlobalScope VARIABLES ShowLikeOpt
+	{
+		$$ = &ShowVariables{Global: $2.(bool), Pattern: $4}
+	}
+|	SHOW PROCESSLIST
+	{
+		$$ = &ShowProcessList{}
+	}
+|	SHOW FULL PROCESSLIST
+	{
+		$$ = &ShowProcessList{Full: true}
+	}
+
+GlobalScope:
+	{
+		$$ = false
+	}
+|	GLOBAL
+	{
+		$$ = true
+	}
+|	SESSION
+	{
+		$$ = false
+	}
+
+ShowLikeOpt:
+	{
+		$$ = ""
+	}
+|	LIKE stringLit
+	{
+		$$ = $2
+	}
+
+AdminStmt:
+	ADMIN SHOW DDLSYM JOBS
+	{
+		$$ = &AdminShowDDLJobs{}
+	}
+
+ExplainStmt:
+	ExplainSym ExplainableStmt
+	{
+		$$ = &Explain{Stmt: $2}
+	}
+|	ExplainSym FORMAT eq Name ExplainableStmt
+	{
+		$$ = &Explain{Stmt: $5, Format: $4}
+	}
+|	ExplainSym ANALYZE ExplainableStmt
+	{
+		$$ = &Explain{Stmt: $3, Analyze: true}
+	}
+
+AnalyzeTableStmt:
+	ANALYZE TABLE TableNameList
+	{
+		$$ = &AnalyzeTable{Tables: $3}
+	}
+
+TableNameList:
+	TableName
+	{
+		$$ = []*TableName{$1}
+	}
+|	TableNameList ',' TableName
+	{
+		$$ = append($1, $3)
+	}
+
+ExplainSym:
+	EXPLAIN
+|	DESCRIBE
+|	DESC
+
+ExplainableStmt:
+	SelectStmt
+|	UpdateStmt
 
 UseDBStmt:
 	USE Name
@@ -424,6 +1172,81 @@ UseDBStmt:
 		$$ = &UseDB{DBName: $2}
 	}
 
+SetStmt:
+	SET VariableAssignmentList
+	{
+		$$ = &SetStmt{Variables: $2}
+	}
+
+VariableAssignmentList:
+	VariableAssignment
+	{
+		$$ = []*VariableAssignment{$1}
+	}
+|	VariableAssignmentList ',' VariableAssignment
+	{
+		$$ = append($1, $3)
+	}
+
+VariableAssignment:
+	Name eq Expression
+	{
+		$$ = &VariableAssignment{Name: $1, Value: $3}
+	}
+|	GLOBAL Name eq Expression
+	{
+		$$ = &VariableAssignment{Name: $2, Value: $4, IsGlobal: true}
+	}
+|	SESSION Name eq Expression
+	{
+		$$ = &VariableAssignment{Name: $2, Value: $4}
+	}
+|	LOCAL Name eq Expression
+	{
+		$$ = &VariableAssignment{Name: $2, Value: $4}
+	}
+|	sysVar eq Expression
+	{
+		name, global := SysVarName($1)
+		$$ = &VariableAssignment{Name: name, Value: $3, IsGlobal: global}
+	}
+|	NAMES CharsetName
+	{
+		$$ = &VariableAssignment{Name: SetNames, Value: &ValueExpr{Item: $2}}
+	}
+|	NAMES CharsetName COLLATE CharsetName
+	{
+		$$ = &VariableAssignment{Name: SetNames, Value: &ValueExpr{Item: $2}, Collate: $4}
+	}
+|	NAMES DEFAULT
+	{
+		$$ = &VariableAssignment{Name: SetNames, Value: &ValueExpr{Item: ""}}
+	}
+
+CharsetName:
+	Name
+	{
+		$$ = $1
+	}
+|	stringLit
+	{
+		$$ = $1
+	}
+
+KillStmt:
+	KILL intLit
+	{
+		$$ = &KillStmt{ConnectionID: getUint64FromItem($2)}
+	}
+|	KILL CONNECTION intLit
+	{
+		$$ = &KillStmt{ConnectionID: getUint64FromItem($3)}
+	}
+|	KILL QUERY intLit
+	{
+		$$ = &KillStmt{ConnectionID: getUint64FromItem($3), Query: true}
+	}
+
 /******************************************Type Begin**********************************************/
 
 TypeName:
@@ -473,19 +1296,19 @@ ACTION | ASCII | AUTO_INCREMENT | AFTER | AT | AVG | BEGIN | BIT | BOOL | BOOLEA
 | MIN_ROWS | NATIONAL | ROW | ROW_FORMAT | QUARTER | GRANTS | TRIGGERS | DELAY_KEY_WRITE | ISOLATION
 | REPEATABLE | COMMITTED | UNCOMMITTED | ONLY | SERIALIZABLE | LEVEL | VARIABLES | SQL_CACHE | INDEXES | PROCESSLIST
 | SQL_NO_CACHE | DISABLE  | ENABLE | REVERSE | SPACE | PRIVILEGES | NO | BINLOG | FUNCTION | VIEW | MODIFY | EVENTS | PARTITIONS
-| TIMESTAMPDIFF | NONE | SUPER
+| TIMESTAMPDIFF | NONE | SUPER | ADMIN | DDLSYM | JOBS | DUPLICATE | QUERY
 
 ReservedKeyword:
 ADD | ALL | ALTER | ANALYZE | AND | AS | ASC | BETWEEN | BIGINT
-| BINARY | BLOB | BOTH | BY | CASCADE | CASE | CHANGE | CHARACTER | CHECK | COLLATE
+| BINARY | BLOB | BOTH | BY | CASCADE | CASE | CHANGE | CHAR | CHARACTER | CHECK | COLLATE
 | COLUMN | CONSTRAINT | CONVERT | CREATE | CROSS | CURRENT_DATE | CURRENT_TIME
 | CURRENT_TIMESTAMP | CURRENT_USER | DATABASE | DATABASES | DAY_HOUR | DAY_MICROSECOND
 | DAY_MINUTE | DAY_SECOND | DECIMAL | DEFAULT | DELETE | DESC | DESCRIBE
 | DISTINCT | DIV | DOUBLE | DROP | DUAL | ELSE | ENCLOSED | ESCAPED
-| EXISTS | EXPLAIN | FALSE | FLOAT | FOR | FORCE | FOREIGN | FROM
+| EXCEPT | EXISTS | EXPLAIN | FALSE | FLOAT | FOR | FORCE | FOREIGN | FROM
 | FULLTEXT | GRANT | GROUP | HAVING | HOUR_MICROSECOND | HOUR_MINUTE
 | HOUR_SECOND | IF | IGNORE | IN | INDEX | INFILE | INNER | INSERT | INT | INTO | INTEGER
-| INTERVAL | IS | JOIN | KEY | KEYS | KILL | LEADING | LEFT | LIKE | LIMIT | LINES | LOAD
+| INTERSECT | INTERVAL | IS | JOIN | KEY | KEYS | KILL | LEADING | LEFT | LIKE | LIMIT | LINES | LOAD
 | LOCALTIME | LOCALTIMESTAMP | LOCK | LONGBLOB | LONGTEXT | MAXVALUE | MEDIUMBLOB | MEDIUMINT | MEDIUMTEXT
 | MINUTE_MICROSECOND | MINUTE_SECOND | MOD | NOT | NO_WRITE_TO_BINLOG | NULL | NUMERIC
 | ON | OPTION | OR | ORDER | OUTER | PARTITION | PRECISION | PRIMARY | PROCEDURE | RANGE | READ
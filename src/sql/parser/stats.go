@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/castermode/Nesoi/src/sql/store"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * statistics of a table are collected by ANALYZE TABLE and stored as:
+ *		/SYSTEM/STATS/tableID	json(TableStats)
+ * and the rows written to the table are counted in:
+ *		/SYSTEM/STATS/MODIFY/tableID
+ * Modified is that count when the statistics were collected, they are
+ * collected again once enough rows were written since.
+ *
+ * the statistics of a column are kept by the column id, and a column
+ * added after the table was analyzed has none. Values of the histogram
+ * are int64 or string, but int64 ones come back as float64 when loaded.
+ */
+type TableStats struct {
+	TableID  int64
+	Count    int64
+	Modified int64
+	Time     int64
+	Columns  []*ColumnStats
+	Indexes  []*IndexStats
+}
+
+type ColumnStats struct {
+	ID    int
+	NDV   int64
+	Nulls int64
+	// buckets of about the same number of rows, in ascending order
+	Buckets []*Bucket
+}
+
+// Bucket holds Count rows from Lower to Upper, Repeats of them equal Upper
+type Bucket struct {
+	Lower   interface{}
+	Upper   interface{}
+	Count   int64
+	Repeats int64
+}
+
+// NDV of an index is the number of distinct entries it has
+type IndexStats struct {
+	ID  int64
+	NDV int64
+}
+
+func (ts *TableStats) Column(id int) *ColumnStats {
+	for _, cs := range ts.Columns {
+		if cs.ID == id {
+			return cs
+		}
+	}
+	return nil
+}
+
+func (ts *TableStats) Index(id int64) *IndexStats {
+	for _, is := range ts.Indexes {
+		if is.ID == id {
+			return is
+		}
+	}
+	return nil
+}
+
+func TableStatsKey(tableID int64) string {
+	return store.SystemFlag + store.StatsFlag + strconv.FormatInt(tableID, 10)
+}
+
+func TableModifyKey(tableID int64) string {
+	return store.SystemFlag + store.StatsFlag + "MODIFY/" + strconv.FormatInt(tableID, 10)
+}
+
+// LoadTableStats returns nil when the table was never analyzed
+func LoadTableStats(driver store.Driver, tableID int64) (*TableStats, error) {
+	value, err := driver.GetSysRecord(TableStatsKey(tableID))
+	if err == store.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &TableStats{}
+	err = json.Unmarshal(util.ToSlice(value), ts)
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func SaveTableStats(driver store.Driver, ts *TableStats) error {
+	data, err := json.Marshal(ts)
+	if err != nil {
+		return err
+	}
+	return driver.SetSysRecord(TableStatsKey(ts.TableID), util.ToString(data), 0)
+}
+
+func DeleteTableStats(driver store.Driver, tableID int64) error {
+	err := driver.DelSysRecord(TableModifyKey(tableID))
+	if err != nil {
+		return err
+	}
+	return driver.DelSysRecord(TableStatsKey(tableID))
+}
+
+// AddTableModified counts n more rows written to the table
+func AddTableModified(driver store.Driver, tableID int64, n int64) (int64, error) {
+	return driver.IncrBySysRecord(TableModifyKey(tableID), n)
+}
+
+func TableModified(driver store.Driver, tableID int64) (int64, error) {
+	value, err := driver.GetSysRecord(TableModifyKey(tableID))
+	if err == store.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -36,6 +36,10 @@ func (*CreateIndex) StatementType() int {
 	return DDL
 }
 
+func (*AlterTable) StatementType() int {
+	return DDL
+}
+
 func (*DropDatabase) StatementType() int {
 	return DDL
 }
@@ -44,10 +48,30 @@ func (*DropTable) StatementType() int {
 	return DDL
 }
 
+func (*DropIndex) StatementType() int {
+	return DDL
+}
+
+func (*TruncateTable) StatementType() int {
+	return DDL
+}
+
+func (*AnalyzeTable) StatementType() int {
+	return Rows
+}
+
 func (*UseDB) StatementType() int {
 	return DDL
 }
 
+func (*SetStmt) StatementType() int {
+	return Ack
+}
+
+func (*KillStmt) StatementType() int {
+	return Ack
+}
+
 func (*ShowDatabases) StatementType() int {
 	return Rows
 }
@@ -56,10 +80,30 @@ func (*ShowTables) StatementType() int {
 	return Rows
 }
 
+func (*ShowWarnings) StatementType() int {
+	return Rows
+}
+
+func (*ShowVariables) StatementType() int {
+	return Rows
+}
+
+func (*ShowProcessList) StatementType() int {
+	return Rows
+}
+
+func (*AdminShowDDLJobs) StatementType() int {
+	return Rows
+}
+
 func (*SelectStmt) StatementType() int {
 	return Rows
 }
 
+func (*Explain) StatementType() int {
+	return Rows
+}
+
 func (*InsertStmt) StatementType() int {
 	return RowsAffected
 }
@@ -76,6 +120,14 @@ func (*SelectQuery) StatementType() int {
 	return Rows
 }
 
+func (*ExplainQuery) StatementType() int {
+	return Rows
+}
+
+func (*AnalyzeTableQuery) StatementType() int {
+	return Rows
+}
+
 func (*InsertQuery) StatementType() int {
 	return RowsAffected
 }
@@ -84,6 +136,10 @@ func (*UpdateQuery) StatementType() int {
 	return RowsAffected
 }
 
+func (*SetQuery) StatementType() int {
+	return Ack
+}
+
 func (*CreateIndexQuery) StatementType() int {
 	return DDL
 }
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/store"
+)
+
+// SysVarKey is the system record of the global value of a system variable
+func SysVarKey(name string) string {
+	return store.SystemFlag + store.SysVarFlag + strings.ToLower(name)
+}
+
+// LoadGlobalVars returns the global values SET GLOBAL stored
+func LoadGlobalVars(driver store.Driver) (map[string]string, error) {
+	var keys []string
+	var cursor uint64
+	var err error
+	vars := make(map[string]string)
+	prefix := store.SystemFlag + store.SysVarFlag
+	for {
+		keys, cursor, err = driver.ScanSysRecords(cursor, prefix+"*", 100)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			value, err := driver.GetSysRecord(key)
+			if err == store.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			vars[key[len(prefix):]] = value
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return vars, nil
+}
+
+// LoadGlobalVar returns the global value of a system variable, ok is false
+// when SET GLOBAL never stored one
+func LoadGlobalVar(driver store.Driver, name string) (value string, ok bool, err error) {
+	value, err = driver.GetSysRecord(SysVarKey(name))
+	if err == store.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func StoreGlobalVar(driver store.Driver, name string, value string) error {
+	return driver.SetSysRecord(SysVarKey(name), value, 0)
+}
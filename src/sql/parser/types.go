@@ -3,6 +3,8 @@ package parser
 import (
 	"bytes"
 	"fmt"
+
+	"github.com/castermode/Nesoi/src/sql/util"
 )
 
 type ColumnType interface {
@@ -43,3 +45,12 @@ func (node *StringType) String() string {
 
 func (*StringType) columnType() {
 }
+
+// ColumnKind gives the datum kind of values of the column type.
+func ColumnKind(typ ColumnType) byte {
+	switch typ.(type) {
+	case *StringType:
+		return util.KindString
+	}
+	return util.KindInt64
+}
@@ -0,0 +1,619 @@
+package plan
+
+import (
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * the cost of reading the rows of a table is the number of calls made to
+ * the driver: a full scan gets every row and scans their keys scanBatch
+ * at a time, a point get gets one row, and an index lookup gets the
+ * entry of the index and then each row it holds.
+ *
+ * the rows are estimated from the statistics of the table. A table never
+ * analyzed is taken to have PseudoRowCount rows, of which an equality on
+ * a column keeps eqSelectivity and any other condition condSelectivity.
+ *
+ * only access paths are chosen by cost. The grammar has no joins of
+ * tables, the only joins are the semi joins of IN and EXISTS subqueries,
+ * which are hash joins reading their second child once whatever their
+ * order, so they are left in the order of the where clause.
+ */
+const (
+	PseudoRowCount  float64 = 10000
+	eqSelectivity   float64 = 0.001
+	condSelectivity float64 = 0.8
+	scanBatch       float64 = 100
+)
+
+// compareValue compares values of a column, numbers go before strings
+func compareValue(a interface{}, b interface{}) int {
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	switch {
+	case aNum && bNum:
+		if af < bf {
+			return -1
+		} else if af > bf {
+			return 1
+		}
+		return 0
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	as, _ := a.(string)
+	bs, _ := b.(string)
+	return strings.Compare(as, bs)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// tableRows gives the number of rows of a table
+func tableRows(stats *parser.TableStats) float64 {
+	if stats == nil {
+		return PseudoRowCount
+	}
+	return float64(stats.Count)
+}
+
+func columnStats(table *parser.TableInfo, stats *parser.TableStats, pos int) *parser.ColumnStats {
+	if stats == nil || table == nil || pos < 1 || pos > len(table.ColumnMap) {
+		return nil
+	}
+	return stats.Column(table.ColumnMap[pos-1].ID)
+}
+
+// eqRows gives the number of rows whose column equals v
+func eqRows(stats *parser.TableStats, cs *parser.ColumnStats, v interface{}) float64 {
+	if v == nil || cs.NDV == 0 || len(cs.Buckets) == 0 {
+		return 0
+	}
+	if compareValue(v, cs.Buckets[0].Lower) < 0 || compareValue(v, cs.Buckets[len(cs.Buckets)-1].Upper) > 0 {
+		return 0
+	}
+	for _, b := range cs.Buckets {
+		if compareValue(v, b.Upper) == 0 {
+			return float64(b.Repeats)
+		}
+	}
+	return float64(stats.Count-cs.Nulls) / float64(cs.NDV)
+}
+
+// lessRows gives the number of rows whose column is less than v, or
+// equals it too with inclusive
+func lessRows(cs *parser.ColumnStats, v interface{}, inclusive bool) float64 {
+	var rows float64
+	for _, b := range cs.Buckets {
+		c := compareValue(v, b.Upper)
+		if c > 0 {
+			rows += float64(b.Count)
+			continue
+		}
+		if c == 0 {
+			rows += float64(b.Count - b.Repeats)
+			if inclusive {
+				rows += float64(b.Repeats)
+			}
+		} else if compareValue(v, b.Lower) > 0 {
+			rows += float64(b.Count-b.Repeats) * fraction(b.Lower, b.Upper, v)
+		}
+		break
+	}
+	return rows
+}
+
+// fraction guesses how far v is from lower to upper
+func fraction(lower interface{}, upper interface{}, v interface{}) float64 {
+	l, lNum := toFloat(lower)
+	u, uNum := toFloat(upper)
+	f, fNum := toFloat(v)
+	if lNum && uNum && fNum && u > l {
+		return (f - l) / (u - l)
+	}
+	return 0.5
+}
+
+/*
+ * columnSelectivity gives the part of the rows whose column at pos passes
+ * op v, from the histogram of the column when there is one.
+ */
+func columnSelectivity(table *parser.TableInfo, stats *parser.TableStats, pos int, op string, v interface{}) float64 {
+	cs := columnStats(table, stats, pos)
+	if cs == nil {
+		if op == "=" {
+			return eqSelectivity
+		}
+		if op == "!=" {
+			return 1 - eqSelectivity
+		}
+		return condSelectivity
+	}
+	if stats.Count == 0 {
+		return 0
+	}
+
+	nonNull := float64(stats.Count - cs.Nulls)
+	var rows float64
+	switch op {
+	case "=":
+		rows = eqRows(stats, cs, v)
+	case "!=":
+		rows = nonNull - eqRows(stats, cs, v)
+	case "<":
+		rows = lessRows(cs, v, false)
+	case "<=":
+		rows = lessRows(cs, v, true)
+	case ">":
+		rows = nonNull - lessRows(cs, v, true)
+	case ">=":
+		rows = nonNull - lessRows(cs, v, false)
+	}
+	if rows < 0 {
+		rows = 0
+	}
+	return rows / float64(stats.Count)
+}
+
+var flippedComparisons = map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+/*
+ * selectivity gives the part of the rows of table passing cond, its
+ * columns being those of the table. table is nil when the rows are not
+ * rows of a table.
+ */
+func selectivity(cond *parser.TargetRes, table *parser.TableInfo, stats *parser.TableStats) float64 {
+	if cond.Type != parser.EFUNC {
+		return condSelectivity
+	}
+	switch cond.FuncName {
+	case "and":
+		return selectivity(cond.Args[0], table, stats) * selectivity(cond.Args[1], table, stats)
+	case "or":
+		l, r := selectivity(cond.Args[0], table, stats), selectivity(cond.Args[1], table, stats)
+		return l + r - l*r
+	case "not":
+		return 1 - selectivity(cond.Args[0], table, stats)
+	}
+
+	op, ok := flippedComparisons[cond.FuncName]
+	if !ok || len(cond.Args) != 2 {
+		return condSelectivity
+	}
+	l, r := cond.Args[0], cond.Args[1]
+	if l.Type == parser.EVALUE && r.Type == parser.ETARGET {
+		l, r = r, l
+	} else {
+		op = cond.FuncName
+	}
+	if l.Type != parser.ETARGET || l.Depth != 0 || r.Type != parser.EVALUE {
+		if op == "=" {
+			return eqSelectivity
+		}
+		return condSelectivity
+	}
+	if r.Value == nil {
+		return 0
+	}
+	return columnSelectivity(table, stats, l.FieldID, op, r.Value)
+}
+
+// indexRows gives the number of rows an index lookup of values finds
+func indexRows(table *parser.TableInfo, stats *parser.TableStats, idx *parser.IndexInfo, values []interface{}) float64 {
+	if stats != nil && len(idx.Fields) == 1 {
+		if cs := stats.Column(idx.Fields[0]); cs != nil {
+			return eqRows(stats, cs, values[0])
+		}
+	}
+	if stats != nil {
+		if is := stats.Index(idx.ID); is != nil && is.NDV > 0 {
+			return float64(stats.Count) / float64(is.NDV)
+		}
+	}
+	rows := tableRows(stats)
+	for i := range values {
+		cd := table.ColumnByID(idx.Fields[i])
+		rows *= columnSelectivity(table, stats, cd.Pos, "=", values[i])
+	}
+	return rows
+}
+
+// tableSource gives the table and statistics of the rows of a plan, when
+// they are rows of all the columns of a table
+func tableSource(p Plan) (*parser.TableInfo, *parser.TableStats) {
+	switch n := p.(type) {
+	case *Scan:
+		return n.From, n.Stats
+	case *ScanWithPK:
+		return n.From, n.Stats
+	case *RangeScan:
+		return n.From, n.Stats
+	case *IndexLookup:
+		return n.From, n.Stats
+	case *Selection:
+		return tableSource(n.Children[0])
+	}
+	return nil, nil
+}
+
+// EstimateRows gives the number of rows a plan is expected to return
+func EstimateRows(p Plan) float64 {
+	var child float64
+	if children := p.GetChildren(); len(children) > 0 {
+		child = EstimateRows(children[0])
+	}
+
+	switch n := p.(type) {
+	case *Scan:
+		rows := tableRows(n.Stats)
+		if n.Filter != nil {
+			rows *= columnSelectivity(n.From, n.Stats, n.Filter.Pos, "=", n.Filter.Value)
+		}
+		if n.Limit > 0 && float64(n.Limit) < rows {
+			rows = float64(n.Limit)
+		}
+		return rows
+	case *ScanWithPK:
+		if n.Stats != nil && n.Stats.Count == 0 {
+			return 0
+		}
+		return float64(len(n.Values))
+	case *RangeScan:
+		return rangeRows(n.From, n.Stats, pkPos(n.From), n.Low, n.High)
+	case *IndexLookup:
+		return indexRows(n.From, n.Stats, n.Index, n.Values)
+	case *Simple:
+		return 1
+	case *Selection:
+		table, stats := tableSource(n.Children[0])
+		if n.Filter != nil {
+			return child * columnSelectivity(table, stats, n.Filter.Pos, "=", n.Filter.Value)
+		}
+		for _, cond := range n.Conds {
+			child *= selectivity(cond, table, stats)
+		}
+		return child
+	case *SemiJoin, *Distinct:
+		return child * condSelectivity
+	case *SetOpr:
+		right := EstimateRows(n.Children[1])
+		switch n.Op {
+		case parser.SetUnion:
+			return child + right
+		case parser.SetIntersect:
+			if right < child {
+				return right
+			}
+		}
+		return child
+	case *Limit:
+		if float64(n.Num) < child {
+			return float64(n.Num)
+		}
+		return child
+	case *Show:
+		return PseudoRowCount
+	}
+	return child
+}
+
+// pkPos gives the position of the first primary key column of a table
+func pkPos(table *parser.TableInfo) int {
+	for pos := 1; pos <= len(table.ColumnMap); pos++ {
+		if table.ColumnMap[pos-1].PrimaryKey {
+			return pos
+		}
+	}
+	return 0
+}
+
+// matchesColumn tells whether v is of the kind of the column at pos, as
+// the keys of rows and the entries of indexes hold values of that kind
+func matchesColumn(table *parser.TableInfo, pos int, v interface{}) bool {
+	kind := parser.ColumnKind(table.ColumnMap[pos-1].Type)
+	switch v.(type) {
+	case int64:
+		return kind == util.KindInt64
+	case string:
+		return kind == util.KindString
+	}
+	return false
+}
+
+// equalities gives the value each column of the table is equal to by a
+// condition of conds, at the position of the column
+func equalities(table *parser.TableInfo, conds []*parser.TargetRes) map[int]int {
+	eqs := make(map[int]int)
+	for i, cond := range conds {
+		if cond.Type != parser.EFUNC || cond.FuncName != "=" {
+			continue
+		}
+		l, r := cond.Args[0], cond.Args[1]
+		if l.Type != parser.ETARGET || l.Depth != 0 || r.Type != parser.EVALUE || r.Value == nil {
+			continue
+		}
+		if !matchesColumn(table, l.FieldID, r.Value) {
+			continue
+		}
+		if _, ok := eqs[l.FieldID]; !ok {
+			eqs[l.FieldID] = i
+		}
+	}
+	return eqs
+}
+
+/*
+ * inValues finds a condition of conds of the form column IN (values) on
+ * the column at pos, giving its index and its distinct values. A null
+ * value matches nothing and is dropped.
+ */
+func inValues(table *parser.TableInfo, pos int, conds []*parser.TargetRes) (int, []interface{}) {
+	for i, cond := range conds {
+		if cond.Type != parser.EFUNC || cond.FuncName != "in" {
+			continue
+		}
+		l := cond.Args[0]
+		if l.Type != parser.ETARGET || l.Depth != 0 || l.FieldID != pos {
+			continue
+		}
+		values := []interface{}{}
+		for _, arg := range cond.Args[1:] {
+			if arg.Type != parser.EVALUE {
+				values = nil
+				break
+			}
+			if arg.Value == nil {
+				continue
+			}
+			if !matchesColumn(table, pos, arg.Value) {
+				values = nil
+				break
+			}
+			seen := false
+			for _, v := range values {
+				if v == arg.Value {
+					seen = true
+				}
+			}
+			if !seen {
+				values = append(values, arg.Value)
+			}
+		}
+		if values != nil {
+			return i, values
+		}
+	}
+	return -1, nil
+}
+
+// tighter tells whether b bounds a range tighter than c, b and c being
+// lower bounds or upper bounds as lower tells
+func tighter(b *Bound, c *Bound, lower bool) bool {
+	if c == nil {
+		return true
+	}
+	cmp := compareValue(b.Value, c.Value)
+	if cmp == 0 {
+		return !b.Inclusive
+	}
+	return (cmp > 0) == lower
+}
+
+/*
+ * pkRange finds the range the conditions of the form column op value put
+ * on the column at pos, giving the conditions it comes from. The range
+ * may be empty.
+ */
+func pkRange(table *parser.TableInfo, pos int, conds []*parser.TargetRes) (*Bound, *Bound, map[int]bool) {
+	var low, high *Bound
+	used := make(map[int]bool)
+	for i, cond := range conds {
+		if cond.Type != parser.EFUNC || len(cond.Args) != 2 {
+			continue
+		}
+		op, ok := flippedComparisons[cond.FuncName]
+		if !ok || op == "=" || op == "!=" {
+			continue
+		}
+		l, r := cond.Args[0], cond.Args[1]
+		if l.Type == parser.EVALUE && r.Type == parser.ETARGET {
+			l, r = r, l
+		} else {
+			op = cond.FuncName
+		}
+		if l.Type != parser.ETARGET || l.Depth != 0 || l.FieldID != pos || r.Type != parser.EVALUE {
+			continue
+		}
+		if r.Value == nil || !matchesColumn(table, pos, r.Value) {
+			continue
+		}
+
+		b := &Bound{Value: r.Value, Inclusive: op == ">=" || op == "<="}
+		if op == ">" || op == ">=" {
+			if tighter(b, low, true) {
+				low = b
+			}
+		} else if tighter(b, high, false) {
+			high = b
+		}
+		used[i] = true
+	}
+	return low, high, used
+}
+
+// rangeRows gives the number of rows whose column at pos is in a range
+func rangeRows(table *parser.TableInfo, stats *parser.TableStats, pos int, low *Bound, high *Bound) float64 {
+	sel := 1.0
+	if low != nil {
+		op := ">"
+		if low.Inclusive {
+			op = ">="
+		}
+		sel = columnSelectivity(table, stats, pos, op, low.Value)
+	}
+	if high != nil {
+		op := "<"
+		if high.Inclusive {
+			op = "<="
+		}
+		hsel := columnSelectivity(table, stats, pos, op, high.Value)
+		// from a histogram the two parts of the rows outside the range
+		// are known
+		if low != nil && columnStats(table, stats, pos) != nil {
+			sel = sel + hsel - 1
+		} else {
+			sel *= hsel
+		}
+	}
+	if sel < 0 {
+		sel = 0
+	}
+	return tableRows(stats) * sel
+}
+
+/*
+ * accessPlan chooses how the rows of a data source are read, by its
+ * primary key, by one of its indexes or by a full scan, the one with the
+ * least cost. The conditions not used to read the rows filter them then.
+ * A limit is pushed down into a full scan when the rows are not filtered
+ * by anything but the qual.
+ */
+func accessPlan(ds *DataSource, limit *Limit) Plan {
+	fields := tableFields(ds.From)
+	if parser.IsPKFilter(ds.Qual, ds.From.ColumnMap) {
+		scan := &ScanWithPK{From: ds.From, Stats: ds.Stats, Fields: fields, FieldsNum: len(fields), Columns: ds.Columns}
+		scan.Values = []interface{}{ds.Qual.Right.Value}
+		return withConds(scan, ds.Conds)
+	}
+
+	// column = value of the qual is the first of the conditions
+	var conds []*parser.TargetRes
+	if ds.Qual != nil {
+		conds = append(conds, &parser.TargetRes{
+			Type:     parser.EFUNC,
+			FuncName: "=",
+			Args:     []*parser.TargetRes{ds.Qual.Left, ds.Qual.Right},
+		})
+	}
+	conds = append(conds, ds.Conds...)
+	eqs := equalities(ds.From, conds)
+
+	// rest filters the rows of plan by the conditions not used, the qual
+	// being the filter of a selection
+	rest := func(plan Plan, used map[int]bool) Plan {
+		if ds.Qual != nil && !used[0] {
+			qual := &Qual{Pos: ds.Qual.Left.FieldID, Value: ds.Qual.Right.Value}
+			plan = appendPlan(&Selection{Filter: qual}, plan)
+		}
+		var left []*parser.TargetRes
+		for i, cond := range conds {
+			if !used[i] && (ds.Qual == nil || i > 0) {
+				left = append(left, cond)
+			}
+		}
+		return withConds(plan, left)
+	}
+
+	var pks []int
+	for pos, cd := range ds.From.ColumnMap {
+		if cd.PrimaryKey {
+			pks = append(pks, pos+1)
+		}
+	}
+	if len(pks) == 1 {
+		i, ok := eqs[pks[0]]
+		var values []interface{}
+		if ok {
+			values = []interface{}{conds[i].Args[1].Value}
+		} else {
+			i, values = inValues(ds.From, pks[0], conds)
+		}
+		if values != nil {
+			plan := &ScanWithPK{From: ds.From, Stats: ds.Stats, Values: values, Fields: fields, FieldsNum: len(fields), Columns: ds.Columns}
+			return rest(plan, map[int]bool{i: true})
+		}
+	}
+
+	// the scan stops at the limit when nothing is left above it to filter
+	scan := &Scan{From: ds.From, Stats: ds.Stats, Fields: fields, FieldsNum: len(fields), Columns: ds.Columns}
+	pushLimit := limit != nil && len(ds.Conds) == 0
+	rows := tableRows(ds.Stats)
+	cost := rows * (1 + 1/scanBatch)
+	if pushLimit {
+		scan.Limit = limit.Offset + limit.Num
+		sel := 1.0
+		if ds.Qual != nil {
+			sel = columnSelectivity(ds.From, ds.Stats, ds.Qual.Left.FieldID, "=", ds.Qual.Right.Value)
+		}
+		if sel > 0 && float64(scan.Limit)/sel < rows {
+			cost = float64(scan.Limit) / sel * (1 + 1/scanBatch)
+		}
+	}
+
+	// a range of keys is read as a full scan is, on the rows in it only
+	var best Plan
+	var bestUsed map[int]bool
+	if len(pks) == 1 {
+		low, high, used := pkRange(ds.From, pks[0], conds)
+		if len(used) > 0 {
+			est := rangeRows(ds.From, ds.Stats, pks[0], low, high)
+			if est*(1+1/scanBatch) < cost {
+				best = &RangeScan{From: ds.From, Stats: ds.Stats, Low: low, High: high, Fields: fields, FieldsNum: len(fields), Columns: ds.Columns}
+				bestUsed, cost = used, est*(1+1/scanBatch)
+			}
+		}
+	}
+
+	for _, idx := range ds.Indexes {
+		values := make([]interface{}, 0, len(idx.Fields))
+		used := make(map[int]bool)
+		for _, f := range idx.Fields {
+			cd := ds.From.ColumnByID(f)
+			if cd == nil {
+				break
+			}
+			i, ok := eqs[cd.Pos]
+			if !ok {
+				break
+			}
+			values = append(values, conds[i].Args[1].Value)
+			used[i] = true
+		}
+		if len(values) < len(idx.Fields) {
+			continue
+		}
+
+		lookup := &IndexLookup{From: ds.From, Stats: ds.Stats, Index: idx, Values: values, Fields: fields, FieldsNum: len(fields), Columns: ds.Columns}
+		est := indexRows(ds.From, ds.Stats, idx, values)
+		if pushLimit && float64(scan.Limit) < est {
+			est = float64(scan.Limit)
+		}
+		if 1+est < cost {
+			best, bestUsed, cost = lookup, used, 1+est
+		}
+	}
+	if best != nil {
+		return rest(best, bestUsed)
+	}
+
+	if pushLimit {
+		if ds.Qual != nil {
+			scan.Filter = &Qual{Pos: ds.Qual.Left.FieldID, Value: ds.Qual.Right.Value}
+		}
+		return scan
+	}
+	scan.Limit = 0
+	return rest(scan, nil)
+}
@@ -0,0 +1,59 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+func TestAccessPlan(t *testing.T) {
+	cases := []struct {
+		name  string
+		conds []*parser.TargetRes
+		out   string
+	}{
+		{
+			name:  "primary key equality",
+			conds: []*parser.TargetRes{fn("=", util.KindInt64, col(1), value(int64(7)))},
+			out: `
+PointGet | t | primary key | id = 7
+`,
+		},
+		{
+			name: "primary key in values",
+			conds: []*parser.TargetRes{
+				fn("in", util.KindInt64, col(1), value(int64(1)), value(int64(2)), value(int64(2)), value(nil)),
+				fn("=", util.KindInt64, col(3), value("x")),
+			},
+			out: `
+Selection | (b = 'x')
+  BatchPointGet | t | primary key | id in (1, 2)
+`,
+		},
+		{
+			name:  "primary key in a column",
+			conds: []*parser.TargetRes{fn("in", util.KindInt64, col(1), value(int64(1)), col(2))},
+			out: `
+Selection | id in (1, a)
+  TableScan | t | full scan
+`,
+		},
+		{
+			name:  "no key",
+			conds: []*parser.TargetRes{fn("=", util.KindInt64, col(2), value(int64(1)))},
+			out: `
+Selection | (a = 1)
+  TableScan | t | full scan
+`,
+		},
+	}
+
+	for _, c := range cases {
+		got := planString(accessPlan(&DataSource{From: testTable(), Conds: c.conds}, nil))
+		if want := strings.TrimLeft(c.out, "\n"); got != want {
+			t.Errorf("%s:\ngot:\n%swant:\n%s", c.name, got, want)
+		}
+	}
+}
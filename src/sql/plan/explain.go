@@ -0,0 +1,280 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/castermode/Nesoi/src/sql/parser"
+)
+
+var setOprOperators = []string{parser.SetUnion: "Union", parser.SetIntersect: "Intersect", parser.SetExcept: "Except"}
+
+var infixFuncs = map[string]bool{
+	"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"+": true, "-": true, "*": true, "/": true, "div": true, "mod": true,
+	"and": true, "or": true, "xor": true,
+}
+
+// shortName drops the database from the name of a table or an index
+func shortName(name string) string {
+	st := strings.SplitN(name, ".", 2)
+	return st[len(st)-1]
+}
+
+func tableName(table *parser.TableInfo) string {
+	return shortName(table.Name)
+}
+
+// outputColumns names the columns of the rows a plan returns
+func outputColumns(p Plan) []string {
+	var cols []string
+	switch n := p.(type) {
+	case *DataSource:
+		cols = tableColumns(n.From)
+	case *Scan:
+		cols = tableColumns(n.From)
+	case *ScanWithPK:
+		cols = tableColumns(n.From)
+	case *RangeScan:
+		cols = tableColumns(n.From)
+	case *IndexLookup:
+		cols = tableColumns(n.From)
+	case *Projection:
+		input := inputColumns(p)
+		for _, f := range n.Fields {
+			name := f.Name
+			if name == "" {
+				name = exprString(f, input)
+			}
+			cols = append(cols, name)
+		}
+	case *Simple:
+		for _, f := range n.Fields {
+			cols = append(cols, exprString(f, nil))
+		}
+	case *Selection, *SemiJoin, *Sort, *SetOpr, *Distinct, *Limit:
+		cols = inputColumns(p)
+	}
+	return cols
+}
+
+// inputColumns names the columns of the rows of the first child of a plan
+func inputColumns(p Plan) []string {
+	children := p.GetChildren()
+	if len(children) == 0 {
+		return nil
+	}
+	return outputColumns(children[0])
+}
+
+func tableColumns(table *parser.TableInfo) []string {
+	cols := make([]string, len(table.ColumnMap))
+	for i, cd := range table.ColumnMap {
+		cols[i] = cd.Name
+	}
+	return cols
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + v + "'"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// exprString renders a target, its columns named by cols
+func exprString(t *parser.TargetRes, cols []string) string {
+	switch t.Type {
+	case parser.ETARGET:
+		name := fmt.Sprintf("#%d", t.FieldID)
+		if t.Depth == 0 && t.FieldID >= 1 && t.FieldID <= len(cols) {
+			name = cols[t.FieldID-1]
+		}
+		if t.Depth > 0 {
+			name = "outer." + name
+		}
+		return name
+	case parser.EVALUE:
+		return valueString(t.Value)
+	case parser.ESYSVAR:
+		if t.SysVarGlobal {
+			return "@@global." + t.SysVar
+		}
+		return "@@" + t.SysVar
+	case parser.ESUBQUERY:
+		return "(subquery)"
+	case parser.EEXISTS:
+		return "exists(subquery)"
+	case parser.EINSUBQUERY:
+		return exprString(t.Args[0], cols) + " in (subquery)"
+	case parser.EFUNC:
+		var args []string
+		for _, arg := range t.Args {
+			args = append(args, exprString(arg, cols))
+		}
+		switch {
+		case infixFuncs[t.FuncName] && len(args) == 2:
+			return "(" + args[0] + " " + t.FuncName + " " + args[1] + ")"
+		case t.FuncName == "unaryminus":
+			return "-" + args[0]
+		case t.FuncName == "in":
+			return args[0] + " in (" + strings.Join(args[1:], ", ") + ")"
+		}
+		return t.FuncName + "(" + strings.Join(args, ", ") + ")"
+	}
+	return "?"
+}
+
+func exprsString(ts []*parser.TargetRes, cols []string) string {
+	var strs []string
+	for _, t := range ts {
+		strs = append(strs, exprString(t, cols))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// prunedColumns names the columns a scan decodes when it doesn't decode
+// them all
+func prunedColumns(table *parser.TableInfo, columns []bool) string {
+	if columns == nil {
+		return ""
+	}
+	var cols []string
+	for i, name := range tableColumns(table) {
+		if columns[i] {
+			cols = append(cols, name)
+		}
+	}
+	if len(cols) == 0 {
+		return ", no columns"
+	}
+	return ", columns: " + strings.Join(cols, ", ")
+}
+
+func qualString(q *Qual, cols []string) string {
+	return exprString(&parser.TargetRes{Type: parser.ETARGET, FieldID: q.Pos}, cols) + " = " + valueString(q.Value)
+}
+
+/*
+ * Describe gives what EXPLAIN shows of a plan node: its operator, the
+ * table it reads, how it reads or works on its rows, and the condition
+ * it filters them by.
+ */
+func Describe(p Plan) (operator string, table string, access string, filter string) {
+	input := inputColumns(p)
+	switch n := p.(type) {
+	case *Scan:
+		operator, table, access = "TableScan", tableName(n.From), "full scan"
+		if n.Limit > 0 {
+			access += fmt.Sprintf(", limit %d", n.Limit)
+		}
+		access += prunedColumns(n.From, n.Columns)
+		if n.Filter != nil {
+			filter = qualString(n.Filter, tableColumns(n.From))
+		}
+	case *ScanWithPK:
+		operator, table, access = "PointGet", tableName(n.From), "primary key"
+		if len(n.Values) > 1 {
+			operator = "BatchPointGet"
+		}
+		pk := tableColumns(n.From)[pkPos(n.From)-1]
+		var values []string
+		for _, v := range n.Values {
+			values = append(values, valueString(v))
+		}
+		if len(values) == 1 {
+			filter = pk + " = " + values[0]
+		} else {
+			filter = pk + " in (" + strings.Join(values, ", ") + ")"
+		}
+		access += prunedColumns(n.From, n.Columns)
+	case *RangeScan:
+		operator, table, access = "RangeScan", tableName(n.From), "primary key range"
+		access += prunedColumns(n.From, n.Columns)
+		pk := tableColumns(n.From)[pkPos(n.From)-1]
+		var conds []string
+		if n.Low != nil {
+			op := " > "
+			if n.Low.Inclusive {
+				op = " >= "
+			}
+			conds = append(conds, pk+op+valueString(n.Low.Value))
+		}
+		if n.High != nil {
+			op := " < "
+			if n.High.Inclusive {
+				op = " <= "
+			}
+			conds = append(conds, pk+op+valueString(n.High.Value))
+		}
+		filter = strings.Join(conds, " and ")
+	case *IndexLookup:
+		operator, table, access = "IndexLookup", tableName(n.From), "index "+shortName(n.Index.Name)
+		access += prunedColumns(n.From, n.Columns)
+		cols := tableColumns(n.From)
+		var conds []string
+		for i, f := range n.Index.Fields {
+			cd := n.From.ColumnByID(f)
+			conds = append(conds, cols[cd.Pos-1]+" = "+valueString(n.Values[i]))
+		}
+		filter = strings.Join(conds, " and ")
+	case *Selection:
+		operator = "Selection"
+		if n.Filter != nil {
+			filter = qualString(n.Filter, input)
+		} else {
+			var conds []string
+			for _, cond := range n.Conds {
+				conds = append(conds, exprString(cond, input))
+			}
+			filter = strings.Join(conds, " and ")
+		}
+	case *SemiJoin:
+		operator, access = "SemiJoin", "hash join"
+		if n.Anti {
+			operator = "AntiSemiJoin"
+		}
+		filter = "keys: " + exprsString(n.OuterKeys, input)
+	case *Projection:
+		operator, access = "Projection", "columns: "+strings.Join(outputColumns(p), ", ")
+		if n.Alias != "" {
+			table = n.Alias
+		}
+	case *Sort:
+		operator = "Sort"
+		var keys []string
+		for _, item := range n.ByItems {
+			key := exprString(item.Key, input)
+			if item.Desc {
+				key += " desc"
+			}
+			keys = append(keys, key)
+		}
+		access = "order by: " + strings.Join(keys, ", ")
+	case *SetOpr:
+		operator = setOprOperators[n.Op]
+		if n.All {
+			operator += "All"
+		}
+	case *Distinct:
+		operator, access = "HashDistinct", "hash of the rows"
+	case *Limit:
+		operator, access = "Limit", fmt.Sprintf("offset %d, count %d", n.Offset, n.Num)
+	case *Simple:
+		operator, access = "Simple", "columns: "+strings.Join(outputColumns(p), ", ")
+	case *Show:
+		operator = "Show"
+	case *Update:
+		operator, table = "Update", tableName(n.Table)
+		cols := tableColumns(n.Table)
+		var sets []string
+		for _, a := range n.Assignments {
+			sets = append(sets, cols[a.Pos]+" = "+exprString(a.Value, input))
+		}
+		access = "set: " + strings.Join(sets, ", ")
+	}
+	return
+}
@@ -14,6 +14,11 @@ func Optimize(query parser.Statement) (Plan, error) {
 		return doUpdateOptimize(query)
 	case *parser.Show:
 		return doShowOptimize(query)
+	case *parser.ExplainQuery:
+		return doExplainOptimize(query)
+	case *parser.AnalyzeTableQuery:
+		a := query.(*parser.AnalyzeTableQuery)
+		return &AnalyzeTable{Names: a.Names, Tables: a.Tables}, nil
 	default:
 		return nil, errors.New("unsupport statement " + query.String())
 	}
@@ -25,95 +30,156 @@ func appendPlan(parent Plan, child Plan) Plan {
 	return parent
 }
 
-func doSelectOptimize(query parser.Statement) (Plan, error) {
-	var plan Plan
-	s := query.(*parser.SelectQuery)
-
-	if s.From != nil {
-		// Scan with PK?
-		var fields []*parser.TargetRes
-		var fieldsnum int
-		if s.Fields != nil {
-			fields = s.Fields
-			fieldsnum = s.FieldsNum
+// tableFields gives all columns of the table in order
+func tableFields(table *parser.TableInfo) []*parser.TargetRes {
+	var fields []*parser.TargetRes
+	for i := 1; i <= len(table.ColumnMap); i++ {
+		fields = append(fields, &parser.TargetRes{Type: parser.ETARGET, TargetID: i, FieldID: i})
+	}
+	return fields
+}
+
+// isPKFields tells whether fields are the primary key columns of table,
+// rows of a table never have the same fields then.
+func isPKFields(table *parser.TableInfo, fields []*parser.TargetRes) bool {
+	if table == nil {
+		return false
+	}
+	set := make(map[int]bool)
+	for _, f := range fields {
+		if f.Type != parser.ETARGET || f.Depth != 0 || !table.ColumnMap[f.FieldID-1].PrimaryKey {
+			return false
 		}
+		set[f.FieldID] = true
+	}
+	for pos, cd := range table.ColumnMap {
+		if cd.PrimaryKey && !set[pos+1] {
+			return false
+		}
+	}
+	return true
+}
 
-		if parser.IsPKFilter(s.Qual, s.From.ColumnMap) {
-			plan = &ScanWithPK{
-				From:      s.From,
-				PK:        s.Qual,
-				Fields:    fields,
-				FieldsNum: fieldsnum,
-			}
-		} else {
-			plan = &Scan{
-				From:      s.From,
-				Fields:    fields,
-				FieldsNum: fieldsnum,
+/*
+ * physicalPlan gives every data source under p the access path of least
+ * cost. A limit on the rows of a data source, with nothing between them
+ * but a projection, is pushed down into its scan.
+ */
+func physicalPlan(p Plan) Plan {
+	if ds, ok := p.(*DataSource); ok {
+		return accessPlan(ds, nil)
+	}
+	if l, ok := p.(*Limit); ok {
+		child := l.Children[0]
+		if proj, ok := child.(*Projection); ok {
+			child = proj.Children[0]
+		}
+		if ds, ok := child.(*DataSource); ok {
+			scan := accessPlan(ds, l)
+			if child == l.Children[0] {
+				setChild(l, 0, scan)
+			} else {
+				setChild(l.Children[0], 0, scan)
 			}
+			return l
+		}
+	}
 
-			if s.Qual != nil {
-				qual := &Qual{Pos: s.Qual.Left.TargetID, Value: s.Qual.Right.Value}
-				splan := &Selection{Filter: qual}
-				plan = appendPlan(splan, plan)
+	for i, child := range p.GetChildren() {
+		setChild(p, i, physicalPlan(child))
+	}
+	return p
+}
+
+func optimizePlan(p Plan) Plan {
+	return physicalPlan(ApplyRules(p, LogicalRules...))
+}
+
+func doSelectOptimize(query parser.Statement) (Plan, error) {
+	plan, err := selectPlan(query.(*parser.SelectQuery))
+	if err != nil {
+		return nil, err
+	}
+	return optimizePlan(plan), nil
+}
+
+func selectPlan(s *parser.SelectQuery) (Plan, error) {
+	var plan Plan
+	var err error
+
+	if s.SetOpr != nil {
+		plan = &SetOpr{Op: s.SetOpr.Op, All: s.SetOpr.All, Fields: s.Fields}
+		for _, q := range []*parser.SelectQuery{s.SetOpr.Left, s.SetOpr.Right} {
+			child, err := selectPlan(q)
+			if err != nil {
+				return nil, err
 			}
+			appendPlan(plan, child)
+		}
+	} else if s.From != nil {
+		plan = &DataSource{From: s.From, Stats: s.Stats, Indexes: s.Indexes, Qual: s.Qual}
+	} else if s.FromQuery != nil {
+		plan, err = selectPlan(s.FromQuery)
+		if err != nil {
+			return nil, err
 		}
+	} else {
+		plan = &Simple{Fields: s.Fields}
+	}
 
-		if fieldsnum != len(fields) {
-			pplan := &Projection{FieldsNum: fieldsnum}
-			plan = appendPlan(pplan, plan)
+	if s.Where != nil {
+		plan, err = appendWhere(plan, s.Where)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		if s.Limit != 0 {
-			lplan := &Limit{Num: s.Limit}
-			plan = appendPlan(lplan, plan)
+	// rows are sorted before the projection, the keys may be any column
+	if s.OrderBy != nil && (s.SetOpr != nil || s.From != nil || s.FromQuery != nil) {
+		plan = appendPlan(&Sort{ByItems: s.OrderBy}, plan)
+	}
+
+	if s.From != nil || s.FromQuery != nil {
+		pplan := &Projection{From: s.From, Alias: s.Alias, Fields: s.Fields}
+		plan = appendPlan(pplan, plan)
+
+		if s.Distinct && !isPKFields(s.From, s.Fields) {
+			plan = appendPlan(&Distinct{}, plan)
 		}
-	} else {
-		plan = &Simple{Fields: s.Fields}
+	}
+
+	if s.Limit != nil {
+		lplan := &Limit{Num: s.Limit.Num, Offset: s.Limit.Offset}
+		plan = appendPlan(lplan, plan)
 	}
 
 	return plan, nil
 }
 
 func doUpdateOptimize(query parser.Statement) (Plan, error) {
-	var plan Plan
 	u := query.(*parser.UpdateQuery)
-	
-	var fields []*parser.TargetRes
-	var fieldsnum int
-	if u.Fields != nil {
-		fields = u.Fields
-		fieldsnum = u.FieldsNum
-	}
-
-	if parser.IsPKFilter(u.Qual, u.Table.ColumnMap) {
-		plan = &ScanWithPK{
-			From:      u.Table,
-			PK:        u.Qual,
-			Fields:    fields,
-			FieldsNum: fieldsnum,
-		}
-	} else {
-		plan = &Scan{
-			From:      u.Table,
-			Fields:    fields,
-			FieldsNum: fieldsnum,
-		}
 
-		if u.Qual != nil {
-			qual := &Qual{Pos: u.Qual.Left.TargetID, Value: u.Qual.Right.Value}
-			splan := &Selection{Filter: qual}
-			plan = appendPlan(splan, plan)
-		}
+	plan, err := selectPlan(u.Select)
+	if err != nil {
+		return nil, err
 	}
-	
-	uplan := &Update{Table: u.Table, Values: u.Values, FieldsNum: fieldsnum}
+
+	uplan := &Update{Table: u.Table, Assignments: u.Assignments}
 	plan = appendPlan(uplan, plan)
-	
-	return plan, nil
+
+	return optimizePlan(plan), nil
+}
+
+func doExplainOptimize(query parser.Statement) (Plan, error) {
+	e := query.(*parser.ExplainQuery)
+	target, err := Optimize(e.Query)
+	if err != nil {
+		return nil, err
+	}
+	return &Explain{Target: target, Format: e.Format, Analyze: e.Analyze}, nil
 }
 
 func doShowOptimize(query parser.Statement) (Plan, error) {
 	s := query.(*parser.Show)
-	return &Show{Operator: s.Operator}, nil
+	return &Show{Operator: s.Operator, Full: s.Full, Global: s.Global, Pattern: s.Pattern}, nil
 }
@@ -11,10 +11,54 @@ type Plan interface {
 	GetChildren() []Plan
 }
 
+/*
+ * DataSource is the logical plan of reading the rows of From, which are
+ * to pass Qual and all of Conds. The rules push conditions into it and
+ * prune Columns, the columns of From needed by the plans above it, nil
+ * meaning all. It becomes a Scan, ScanWithPK or IndexLookup once the
+ * logical rules are applied.
+ */
+type DataSource struct {
+	From     *parser.TableInfo
+	Stats    *parser.TableStats
+	Indexes  []*parser.IndexInfo
+	Qual     *parser.ComparisonQual
+	Conds    []*parser.TargetRes
+	Columns  []bool
+	Parents  []Plan
+	Children []Plan
+}
+
+func (plan *DataSource) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *DataSource) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *DataSource) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *DataSource) GetChildren() []Plan {
+	return plan.Children
+}
+
+/*
+ * Scan reads the rows of From. A limit pushed down into the scan moves the
+ * filter of the query into it too, so the scan stops once Limit rows have
+ * passed the filter, 0 means no limit. Only Columns of the rows are
+ * decoded, the others read as null, nil meaning all.
+ */
 type Scan struct {
 	From      *parser.TableInfo
+	Stats     *parser.TableStats
 	Fields    []*parser.TargetRes
 	FieldsNum int
+	Columns   []bool
+	Filter    *Qual
+	Limit     uint64
 	Parents   []Plan
 	Children  []Plan
 }
@@ -35,11 +79,14 @@ func (plan *Scan) GetChildren() []Plan {
 	return plan.Children
 }
 
+// ScanWithPK gets the rows of From whose primary key is one of Values
 type ScanWithPK struct {
 	From      *parser.TableInfo
+	Stats     *parser.TableStats
 	Fields    []*parser.TargetRes
 	FieldsNum int
-	PK        interface{}
+	Columns   []bool
+	Values    []interface{}
 	Parents   []Plan
 	Children  []Plan
 }
@@ -60,13 +107,88 @@ func (plan *ScanWithPK) GetChildren() []Plan {
 	return plan.Children
 }
 
+// Bound is a bound of a range, nil when there is none on that side
+type Bound struct {
+	Value     interface{}
+	Inclusive bool
+}
+
+/*
+ * RangeScan reads the rows of From whose primary key, of a single column,
+ * is between Low and High. The keys of rows are in the order of their
+ * primary keys, so a driver keeping its keys in order reads just the
+ * range, and other drivers only get the rows whose keys are in it.
+ */
+type RangeScan struct {
+	From      *parser.TableInfo
+	Stats     *parser.TableStats
+	Low       *Bound
+	High      *Bound
+	Fields    []*parser.TargetRes
+	FieldsNum int
+	Columns   []bool
+	Parents   []Plan
+	Children  []Plan
+}
+
+func (plan *RangeScan) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *RangeScan) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *RangeScan) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *RangeScan) GetChildren() []Plan {
+	return plan.Children
+}
+
+/*
+ * IndexLookup reads the rows of From whose columns of Index equal Values,
+ * Values[i] being the value of the column Index.Fields[i]. It gets the
+ * entry of the index and then each row it holds.
+ */
+type IndexLookup struct {
+	From      *parser.TableInfo
+	Stats     *parser.TableStats
+	Index     *parser.IndexInfo
+	Values    []interface{}
+	Fields    []*parser.TargetRes
+	FieldsNum int
+	Columns   []bool
+	Parents   []Plan
+	Children  []Plan
+}
+
+func (plan *IndexLookup) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *IndexLookup) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *IndexLookup) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *IndexLookup) GetChildren() []Plan {
+	return plan.Children
+}
+
 type Qual struct {
 	Pos   int
 	Value interface{}
 }
 
+// Selection passes the rows matching Filter, or all of Conds when it is nil
 type Selection struct {
 	Filter   *Qual
+	Conds    []*parser.TargetRes
 	Parents  []Plan
 	Children []Plan
 }
@@ -87,12 +209,45 @@ func (plan *Selection) GetChildren() []Plan {
 	return plan.Children
 }
 
-type Projection struct {
-	FieldsNum int
+/*
+ * SemiJoin passes the rows of its first child whose OuterKeys equal the
+ * row of some row of its second child, with Anti the rows equal to none.
+ * The rows are matched by a hash of the keys and a null key matches
+ * nothing.
+ */
+type SemiJoin struct {
+	Anti      bool
+	OuterKeys []*parser.TargetRes
 	Parents   []Plan
 	Children  []Plan
 }
 
+func (plan *SemiJoin) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *SemiJoin) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *SemiJoin) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *SemiJoin) GetChildren() []Plan {
+	return plan.Children
+}
+
+// Projection evaluates Fields on every row of its child, which gives all
+// columns of From in order, or of the derived table Alias if From is nil.
+type Projection struct {
+	From     *parser.TableInfo
+	Alias    string
+	Fields   []*parser.TargetRes
+	Parents  []Plan
+	Children []Plan
+}
+
 func (plan *Projection) AddParent(parent Plan) {
 	plan.Parents = append(plan.Parents, parent)
 }
@@ -109,8 +264,84 @@ func (plan *Projection) GetChildren() []Plan {
 	return plan.Children
 }
 
+// Sort orders the rows of its child by ByItems, keys of equal rows keep
+// their order.
+type Sort struct {
+	ByItems  []*parser.SortItem
+	Parents  []Plan
+	Children []Plan
+}
+
+func (plan *Sort) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *Sort) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *Sort) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *Sort) GetChildren() []Plan {
+	return plan.Children
+}
+
+/*
+ * SetOpr combines the rows of its two children, whose columns are
+ * converted to the kinds of Fields. UNION ALL streams one child after the
+ * other, the other operations dedup on a hash of the rows.
+ */
+type SetOpr struct {
+	Op       int
+	All      bool
+	Fields   []*parser.TargetRes
+	Parents  []Plan
+	Children []Plan
+}
+
+func (plan *SetOpr) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *SetOpr) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *SetOpr) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *SetOpr) GetChildren() []Plan {
+	return plan.Children
+}
+
+// Distinct passes the first of the rows of its child that are equal
+type Distinct struct {
+	Parents  []Plan
+	Children []Plan
+}
+
+func (plan *Distinct) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *Distinct) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *Distinct) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *Distinct) GetChildren() []Plan {
+	return plan.Children
+}
+
 type Limit struct {
 	Num      uint64
+	Offset   uint64
 	Parents  []Plan
 	Children []Plan
 }
@@ -155,6 +386,9 @@ func (plan *Simple) GetChildren() []Plan {
 
 type Show struct {
 	Operator int
+	Full     bool
+	Global   bool
+	Pattern  string
 	Parents  []Plan
 	Children []Plan
 }
@@ -176,11 +410,10 @@ func (plan *Show) GetChildren() []Plan {
 }
 
 type Update struct {
-	Table     *parser.TableInfo
-	Values    map[int]interface{}
-	FieldsNum int
-	Parents   []Plan
-	Children  []Plan
+	Table       *parser.TableInfo
+	Assignments []*parser.Assignment
+	Parents     []Plan
+	Children    []Plan
 }
 
 func (plan *Update) AddParent(parent Plan) {
@@ -198,3 +431,52 @@ func (plan *Update) GetParents() []Plan {
 func (plan *Update) GetChildren() []Plan {
 	return plan.Children
 }
+
+// Explain shows the plan Target, which runs first with Analyze
+type Explain struct {
+	Target   Plan
+	Format   int
+	Analyze  bool
+	Parents  []Plan
+	Children []Plan
+}
+
+func (plan *Explain) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *Explain) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *Explain) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *Explain) GetChildren() []Plan {
+	return plan.Children
+}
+
+// AnalyzeTable collects the statistics of Tables, nil ones don't exist
+type AnalyzeTable struct {
+	Names    []string
+	Tables   []*parser.TableInfo
+	Parents  []Plan
+	Children []Plan
+}
+
+func (plan *AnalyzeTable) AddParent(parent Plan) {
+	plan.Parents = append(plan.Parents, parent)
+}
+
+func (plan *AnalyzeTable) AddChild(child Plan) {
+	plan.Children = append(plan.Children, child)
+}
+
+func (plan *AnalyzeTable) GetParents() []Plan {
+	return plan.Parents
+}
+
+func (plan *AnalyzeTable) GetChildren() []Plan {
+	return plan.Children
+}
@@ -0,0 +1,405 @@
+package plan
+
+import (
+	"github.com/castermode/Nesoi/src/sql/context"
+	"github.com/castermode/Nesoi/src/sql/expression"
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+/*
+ * the plan built from a query is logical, its tables are read by data
+ * sources. Rules rewrite it one after another, then every data source
+ * is given the access path of least cost. A rule gives the plan it is
+ * applied to rewritten, and doesn't depend on the other rules having
+ * been applied, so each one can be applied on its own.
+ *
+ * the targets of the plans are shared with the query, which may be
+ * planned again, so rules replace them rather than change them.
+ */
+type Rule struct {
+	Name  string
+	Apply func(p Plan) Plan
+}
+
+var (
+	ConstantFolding       = &Rule{"constant_folding", foldConstants}
+	PredicatePushDown     = &Rule{"predicate_push_down", pushDownPredicates}
+	ProjectionElimination = &Rule{"projection_elimination", eliminateProjections}
+	ColumnPruning         = &Rule{"column_pruning", pruneColumns}
+
+	// column pruning goes last, it depends on the plans left above a scan
+	LogicalRules = []*Rule{ConstantFolding, PredicatePushDown, ProjectionElimination, ColumnPruning}
+)
+
+func ApplyRules(p Plan, rules ...*Rule) Plan {
+	for _, rule := range rules {
+		p = rule.Apply(p)
+	}
+	return p
+}
+
+// setChild makes child the i-th child of p
+func setChild(p Plan, i int, child Plan) {
+	children := p.GetChildren()
+	if children[i] != child {
+		children[i] = child
+		child.AddParent(p)
+	}
+}
+
+func valueDatum(v interface{}) (*util.Datum, bool) {
+	d := &util.Datum{}
+	switch v := v.(type) {
+	case nil:
+		d.SetK(util.KindNull)
+	case int64:
+		d.SetK(util.KindInt64)
+		d.SetI(v)
+	case float64:
+		d.SetK(util.KindFloat64)
+		d.SetF(v)
+	case string:
+		d.SetK(util.KindString)
+		d.SetB([]byte(v))
+	default:
+		return nil, false
+	}
+	return d, true
+}
+
+func datumValue(d *util.Datum) (interface{}, bool) {
+	switch d.GetK() {
+	case util.KindNull:
+		return nil, true
+	case util.KindInt64:
+		return d.GetI(), true
+	case util.KindFloat64:
+		return d.GetF(), true
+	case util.KindString:
+		return string(d.GetB()), true
+	}
+	return nil, false
+}
+
+/*
+ * foldTarget evaluates the functions of a target whose arguments are all
+ * values. Functions without arguments depend on the session or the time
+ * and are left alone, as are subqueries and functions giving an error,
+ * which is then returned when the query runs.
+ */
+func foldTarget(t *parser.TargetRes) *parser.TargetRes {
+	if t.Type != parser.EFUNC {
+		return t
+	}
+	ret := t
+	if args, folded := foldAll(t.Args); folded {
+		c := *t
+		c.Args = args
+		ret = &c
+	}
+	if len(ret.Args) == 0 {
+		return ret
+	}
+
+	fn := expression.GetFunc(ret.FuncName)
+	if fn == nil {
+		return ret
+	}
+	var args []*util.Datum
+	for _, arg := range ret.Args {
+		if arg.Type != parser.EVALUE {
+			return ret
+		}
+		d, ok := valueDatum(arg.Value)
+		if !ok {
+			return ret
+		}
+		args = append(args, d)
+	}
+	// a function that warns is left to the execution, which gives the warning
+	ctx := context.NewContext()
+	d, err := fn.Eval(ctx, args)
+	if err != nil || len(ctx.Warnings()) != 0 {
+		return ret
+	}
+	v, ok := datumValue(d.Convert(ret.RetType))
+	if !ok {
+		return ret
+	}
+	return &parser.TargetRes{Type: parser.EVALUE, TargetID: t.TargetID, Name: t.Name, Value: v, RetType: t.RetType}
+}
+
+// foldAll gives ts folded, and whether any of them folded
+func foldAll(ts []*parser.TargetRes) ([]*parser.TargetRes, bool) {
+	var ret []*parser.TargetRes
+	for i, t := range ts {
+		f := foldTarget(t)
+		if f != t && ret == nil {
+			ret = append([]*parser.TargetRes{}, ts[:i]...)
+		}
+		if ret != nil {
+			ret = append(ret, f)
+		}
+	}
+	if ret == nil {
+		return ts, false
+	}
+	return ret, true
+}
+
+func foldTargets(ts []*parser.TargetRes) []*parser.TargetRes {
+	ret, _ := foldAll(ts)
+	return ret
+}
+
+func foldConstants(p Plan) Plan {
+	switch n := p.(type) {
+	case *DataSource:
+		n.Conds = foldTargets(n.Conds)
+	case *Selection:
+		n.Conds = foldTargets(n.Conds)
+	case *SemiJoin:
+		n.OuterKeys = foldTargets(n.OuterKeys)
+	case *Projection:
+		n.Fields = foldTargets(n.Fields)
+	case *Simple:
+		n.Fields = foldTargets(n.Fields)
+	case *Sort:
+		var items []*parser.SortItem
+		for _, item := range n.ByItems {
+			if key := foldTarget(item.Key); key != item.Key {
+				item = &parser.SortItem{Key: key, Desc: item.Desc}
+			}
+			items = append(items, item)
+		}
+		n.ByItems = items
+	case *Update:
+		var assignments []*parser.Assignment
+		for _, a := range n.Assignments {
+			if v := foldTarget(a.Value); v != a.Value {
+				a = &parser.Assignment{Pos: a.Pos, Value: v}
+			}
+			assignments = append(assignments, a)
+		}
+		n.Assignments = assignments
+	}
+
+	for i, child := range p.GetChildren() {
+		setChild(p, i, foldConstants(child))
+	}
+	return p
+}
+
+// isTrueValue tells whether a condition is a value that is true
+func isTrueValue(cond *parser.TargetRes) bool {
+	if cond.Type != parser.EVALUE {
+		return false
+	}
+	d, ok := valueDatum(cond.Value)
+	return ok && expression.IsTrue(d)
+}
+
+// withConds filters the rows of p by conds
+func withConds(p Plan, conds []*parser.TargetRes) Plan {
+	if len(conds) == 0 {
+		return p
+	}
+	return appendPlan(&Selection{Conds: conds}, p)
+}
+
+// pushable tells whether a target may be evaluated on other rows giving
+// its columns, it refers to its own query only and runs no subquery.
+func pushable(t *parser.TargetRes) bool {
+	return isLocal(t) && !hasSubquery(t)
+}
+
+// substitute gives t on the rows fields are evaluated on, t being
+// evaluated on the rows of fields
+func substitute(t *parser.TargetRes, fields []*parser.TargetRes) (*parser.TargetRes, bool) {
+	if t.Type == parser.ETARGET {
+		if t.FieldID < 1 || t.FieldID > len(fields) || !pushable(fields[t.FieldID-1]) {
+			return nil, false
+		}
+		return fields[t.FieldID-1], true
+	}
+	if len(t.Args) == 0 {
+		return t, true
+	}
+	c := *t
+	c.Args = make([]*parser.TargetRes, len(t.Args))
+	for i, arg := range t.Args {
+		a, ok := substitute(arg, fields)
+		if !ok {
+			return nil, false
+		}
+		c.Args[i] = a
+	}
+	return &c, true
+}
+
+/*
+ * pushDownPredicates moves the conditions of selections down to the data
+ * sources, through the plans that pass the rows they get as they are and
+ * through projections, the conditions being rewritten on their input. A
+ * limit or a set operation stops them, as does a projection of a field
+ * with a subquery. Conditions that are always true are dropped.
+ */
+func pushDownPredicates(p Plan) Plan {
+	return pushDown(p, nil)
+}
+
+// pushDown gives p filtered by conds, with them pushed as far down as
+// they go
+func pushDown(p Plan, conds []*parser.TargetRes) Plan {
+	switch n := p.(type) {
+	case *Selection:
+		if n.Filter == nil {
+			all := append([]*parser.TargetRes{}, conds...)
+			for _, cond := range n.Conds {
+				if !isTrueValue(cond) {
+					all = append(all, cond)
+				}
+			}
+			return pushDown(n.Children[0], all)
+		}
+	case *DataSource:
+		n.Conds = append(n.Conds, conds...)
+		return n
+	case *Sort, *Distinct:
+		setChild(p, 0, pushDown(p.GetChildren()[0], conds))
+		return p
+	case *SemiJoin:
+		setChild(p, 0, pushDown(n.Children[0], conds))
+		setChild(p, 1, pushDown(n.Children[1], nil))
+		return p
+	case *Projection:
+		var down, left []*parser.TargetRes
+		for _, cond := range conds {
+			if pushable(cond) {
+				if c, ok := substitute(cond, n.Fields); ok {
+					down = append(down, c)
+					continue
+				}
+			}
+			left = append(left, cond)
+		}
+		setChild(p, 0, pushDown(n.Children[0], down))
+		return withConds(p, left)
+	}
+
+	for i, child := range p.GetChildren() {
+		setChild(p, i, pushDown(child, nil))
+	}
+	return withConds(p, conds)
+}
+
+/*
+ * isIdentity tells whether a projection gives the rows of its table as
+ * they are. They are then described to the client as the scan of the
+ * table describes them.
+ */
+func isIdentity(p *Projection) bool {
+	if p.From == nil || p.Alias != "" || len(p.Fields) != len(p.From.ColumnMap) {
+		return false
+	}
+	for i, f := range p.Fields {
+		if f.Type != parser.ETARGET || f.Depth != 0 || f.FieldID != i+1 || f.Name != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// eliminateProjections removes the projections that change nothing
+func eliminateProjections(p Plan) Plan {
+	for i, child := range p.GetChildren() {
+		setChild(p, i, eliminateProjections(child))
+	}
+	if n, ok := p.(*Projection); ok && isIdentity(n) {
+		return n.Children[0]
+	}
+	return p
+}
+
+/*
+ * addColumns adds the columns of its own rows a target refers to. A
+ * correlated subquery may refer to any of them, so it needs them all and
+ * nil is returned.
+ */
+func addColumns(cols map[int]bool, ts ...*parser.TargetRes) map[int]bool {
+	if cols == nil {
+		return nil
+	}
+	for _, t := range ts {
+		switch t.Type {
+		case parser.ETARGET:
+			if t.Depth == 0 {
+				cols[t.FieldID] = true
+			}
+		case parser.ESUBQUERY, parser.EEXISTS, parser.EINSUBQUERY:
+			if t.Sub.Correlated {
+				return nil
+			}
+		}
+		if cols = addColumns(cols, t.Args...); cols == nil {
+			return nil
+		}
+	}
+	return cols
+}
+
+/*
+ * pruneColumns finds the columns of its table each data source has to
+ * decode, the ones the plans above it refer to before a projection. Plans
+ * that work on whole rows need them all.
+ */
+func pruneColumns(p Plan) Plan {
+	prune(p, nil)
+	return p
+}
+
+// prune prunes the columns under p, of which the plans above it need
+// cols, nil meaning all
+func prune(p Plan, cols map[int]bool) {
+	switch n := p.(type) {
+	case *DataSource:
+		n.Columns = nil
+		if n.Qual != nil && cols != nil {
+			cols[n.Qual.Left.FieldID] = true
+		}
+		if cols = addColumns(cols, n.Conds...); cols == nil || len(cols) == len(n.From.ColumnMap) {
+			return
+		}
+		n.Columns = make([]bool, len(n.From.ColumnMap))
+		for pos := range cols {
+			if pos >= 1 && pos <= len(n.Columns) {
+				n.Columns[pos-1] = true
+			}
+		}
+		return
+	case *Projection:
+		prune(n.Children[0], addColumns(make(map[int]bool), n.Fields...))
+		return
+	case *Selection:
+		if n.Filter != nil && cols != nil {
+			cols[n.Filter.Pos] = true
+		}
+		cols = addColumns(cols, n.Conds...)
+	case *Sort:
+		for _, item := range n.ByItems {
+			cols = addColumns(cols, item.Key)
+		}
+	case *SemiJoin:
+		prune(n.Children[0], addColumns(cols, n.OuterKeys...))
+		prune(n.Children[1], nil)
+		return
+	case *Limit:
+	default:
+		cols = nil
+	}
+
+	for _, child := range p.GetChildren() {
+		prune(child, cols)
+	}
+}
@@ -0,0 +1,348 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// t (id int primary key, a int, b string)
+func testTable() *parser.TableInfo {
+	return &parser.TableInfo{
+		ID:   1,
+		Name: "test.t",
+		ColumnMap: map[int]*parser.ColumnTableDef{
+			0: {ID: 1, Name: "id", Pos: 1, Type: &parser.IntType{}, PrimaryKey: true},
+			1: {ID: 2, Name: "a", Pos: 2, Type: &parser.IntType{}},
+			2: {ID: 3, Name: "b", Pos: 3, Type: &parser.StringType{}},
+		},
+	}
+}
+
+func col(pos int) *parser.TargetRes {
+	return &parser.TargetRes{Type: parser.ETARGET, TargetID: pos, FieldID: pos, RetType: util.KindInt64}
+}
+
+func value(v interface{}) *parser.TargetRes {
+	t := &parser.TargetRes{Type: parser.EVALUE, Value: v}
+	switch v.(type) {
+	case int64:
+		t.RetType = util.KindInt64
+	case float64:
+		t.RetType = util.KindFloat64
+	case string:
+		t.RetType = util.KindString
+	}
+	return t
+}
+
+func fn(name string, ret byte, args ...*parser.TargetRes) *parser.TargetRes {
+	return &parser.TargetRes{Type: parser.EFUNC, FuncName: name, Args: args, RetType: ret}
+}
+
+func named(t *parser.TargetRes, name string) *parser.TargetRes {
+	c := *t
+	c.Name = name
+	return &c
+}
+
+func dataSource() Plan {
+	return &DataSource{From: testTable()}
+}
+
+func over(parent Plan, child Plan) Plan {
+	return appendPlan(parent, child)
+}
+
+// planString shows a plan a node a line, its children indented under it
+func planString(p Plan) string {
+	var b strings.Builder
+	var walk func(p Plan, depth int)
+	walk = func(p Plan, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		if ds, ok := p.(*DataSource); ok {
+			cols := tableColumns(ds.From)
+			fmt.Fprintf(&b, "DataSource %s", tableName(ds.From))
+			if len(ds.Conds) > 0 {
+				var conds []string
+				for _, cond := range ds.Conds {
+					conds = append(conds, exprString(cond, cols))
+				}
+				fmt.Fprintf(&b, " where %s", strings.Join(conds, " and "))
+			}
+			b.WriteString(prunedColumns(ds.From, ds.Columns))
+		} else {
+			operator, table, access, filter := Describe(p)
+			b.WriteString(operator)
+			for _, s := range []string{table, access, filter} {
+				if s != "" {
+					b.WriteString(" | " + s)
+				}
+			}
+		}
+		b.WriteString("\n")
+		for _, child := range p.GetChildren() {
+			walk(child, depth+1)
+		}
+	}
+	walk(p, 0)
+	return b.String()
+}
+
+func testRule(t *testing.T, rule *Rule, cases []struct {
+	name string
+	in   Plan
+	out  string
+}) {
+	for _, c := range cases {
+		got := planString(ApplyRules(c.in, rule))
+		want := strings.TrimLeft(c.out, "\n")
+		if got != want {
+			t.Errorf("%s %s:\ngot:\n%swant:\n%s", rule.Name, c.name, got, want)
+		}
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	testRule(t, ConstantFolding, []struct {
+		name string
+		in   Plan
+		out  string
+	}{
+		{
+			name: "condition",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn("=", util.KindInt64, col(2), fn("+", util.KindInt64, value(int64(1)), value(int64(2)))),
+			}}, dataSource()),
+			out: `
+Selection | (a = 3)
+  DataSource t
+`,
+		},
+		{
+			name: "nested function of values only",
+			in: over(&Projection{From: testTable(), Fields: []*parser.TargetRes{
+				named(fn("abs", util.KindInt64, fn("-", util.KindInt64, value(int64(2)), value(int64(7)))), "x"),
+				named(fn("+", util.KindInt64, col(2), value(int64(1))), "y"),
+			}}, dataSource()),
+			out: `
+Projection | columns: x, y
+  DataSource t
+`,
+		},
+		{
+			name: "error left to the execution",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn("=", util.KindInt64, col(2), fn("div", util.KindInt64, value(int64(-9223372036854775808)), value(int64(-1)))),
+			}}, dataSource()),
+			out: `
+Selection | (a = (-9223372036854775808 div -1))
+  DataSource t
+`,
+		},
+		{
+			name: "warning left to the execution",
+			in: &Simple{Fields: []*parser.TargetRes{
+				fn("format", util.KindString, value(1.5), value(int64(0)), value("xx")),
+			}},
+			out: `
+Simple | columns: format(1.5, 0, 'xx')
+`,
+		},
+		{
+			name: "column not folded",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn(">", util.KindInt64, fn("+", util.KindInt64, col(2), value(int64(1))), value(int64(2))),
+			}}, dataSource()),
+			out: `
+Selection | ((a + 1) > 2)
+  DataSource t
+`,
+		},
+	})
+
+	// the projection keeps the names of the fields it folds
+	p := ApplyRules(over(&Projection{From: testTable(), Fields: []*parser.TargetRes{
+		named(fn("abs", util.KindInt64, value(int64(-5))), "x"),
+	}}, dataSource()), ConstantFolding).(*Projection)
+	if f := p.Fields[0]; f.Type != parser.EVALUE || f.Value != int64(5) || f.Name != "x" {
+		t.Errorf("abs(-5) folded to %+v", f)
+	}
+}
+
+func TestPredicatePushDown(t *testing.T) {
+	testRule(t, PredicatePushDown, []struct {
+		name string
+		in   Plan
+		out  string
+	}{
+		{
+			name: "into the data source",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn("=", util.KindInt64, col(2), value(int64(1))),
+			}}, dataSource()),
+			out: `
+DataSource t where (a = 1)
+`,
+		},
+		{
+			name: "through a projection, rewritten on its input",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn(">", util.KindInt64, col(1), value(int64(2))),
+			}}, over(&Projection{From: testTable(), Fields: []*parser.TargetRes{
+				named(fn("+", util.KindInt64, col(2), value(int64(1))), "x"),
+			}}, dataSource())),
+			out: `
+Projection | columns: x
+  DataSource t where ((a + 1) > 2)
+`,
+		},
+		{
+			name: "through a sort",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn("=", util.KindInt64, col(3), value("x")),
+			}}, over(&Sort{ByItems: []*parser.SortItem{{Key: col(2)}}}, dataSource())),
+			out: `
+Sort | order by: a
+  DataSource t where (b = 'x')
+`,
+		},
+		{
+			name: "stopped by a limit",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn("=", util.KindInt64, col(2), value(int64(1))),
+			}}, over(&Limit{Num: 10}, dataSource())),
+			out: `
+Selection | (a = 1)
+  Limit | offset 0, count 10
+    DataSource t
+`,
+		},
+		{
+			name: "always true dropped",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				value(int64(1)),
+				fn("=", util.KindInt64, col(2), value(int64(1))),
+			}}, dataSource()),
+			out: `
+DataSource t where (a = 1)
+`,
+		},
+		{
+			name: "selections merged",
+			in: over(&Selection{Conds: []*parser.TargetRes{
+				fn("=", util.KindInt64, col(2), value(int64(1))),
+			}}, over(&Selection{Conds: []*parser.TargetRes{
+				fn("<", util.KindInt64, col(1), value(int64(5))),
+			}}, dataSource())),
+			out: `
+DataSource t where (a = 1) and (id < 5)
+`,
+		},
+	})
+}
+
+func TestProjectionElimination(t *testing.T) {
+	testRule(t, ProjectionElimination, []struct {
+		name string
+		in   Plan
+		out  string
+	}{
+		{
+			name: "identity removed",
+			in:   over(&Projection{From: testTable(), Fields: tableFields(testTable())}, dataSource()),
+			out: `
+DataSource t
+`,
+		},
+		{
+			name: "identity under a limit removed",
+			in:   over(&Limit{Num: 1}, over(&Projection{From: testTable(), Fields: tableFields(testTable())}, dataSource())),
+			out: `
+Limit | offset 0, count 1
+  DataSource t
+`,
+		},
+		{
+			name: "reordered columns kept",
+			in:   over(&Projection{From: testTable(), Fields: []*parser.TargetRes{col(2), col(1), col(3)}}, dataSource()),
+			out: `
+Projection | columns: a, id, b
+  DataSource t
+`,
+		},
+		{
+			name: "renamed column kept",
+			in:   over(&Projection{From: testTable(), Fields: []*parser.TargetRes{col(1), named(col(2), "x"), col(3)}}, dataSource()),
+			out: `
+Projection | columns: id, x, b
+  DataSource t
+`,
+		},
+		{
+			name: "derived table kept",
+			in:   over(&Projection{From: testTable(), Alias: "d", Fields: tableFields(testTable())}, dataSource()),
+			out: `
+Projection | d | columns: id, a, b
+  DataSource t
+`,
+		},
+	})
+}
+
+func TestColumnPruning(t *testing.T) {
+	testRule(t, ColumnPruning, []struct {
+		name string
+		in   Plan
+		out  string
+	}{
+		{
+			name: "columns of the projection and the selection",
+			in: over(&Projection{From: testTable(), Fields: []*parser.TargetRes{col(2)}},
+				over(&Selection{Conds: []*parser.TargetRes{fn("=", util.KindInt64, col(3), value("x"))}}, dataSource())),
+			out: `
+Projection | columns: a
+  Selection | (b = 'x')
+    DataSource t, columns: a, b
+`,
+		},
+		{
+			name: "conditions of the data source",
+			in: over(&Projection{From: testTable(), Fields: []*parser.TargetRes{col(1)}},
+				&DataSource{From: testTable(), Conds: []*parser.TargetRes{fn("=", util.KindInt64, col(2), value(int64(1)))}}),
+			out: `
+Projection | columns: id
+  DataSource t where (a = 1), columns: id, a
+`,
+		},
+		{
+			name: "sort keys",
+			in: over(&Projection{From: testTable(), Fields: []*parser.TargetRes{col(3)}},
+				over(&Sort{ByItems: []*parser.SortItem{{Key: col(2), Desc: true}}}, dataSource())),
+			out: `
+Projection | columns: b
+  Sort | order by: a desc
+    DataSource t, columns: a, b
+`,
+		},
+		{
+			name: "all columns needed",
+			in:   over(&Projection{From: testTable(), Fields: []*parser.TargetRes{col(3), col(2), col(1)}}, dataSource()),
+			out: `
+Projection | columns: b, a, id
+  DataSource t
+`,
+		},
+		{
+			name: "whole rows of an update",
+			in:   over(&Update{Table: testTable(), Assignments: []*parser.Assignment{{Pos: 1, Value: value(int64(0))}}}, dataSource()),
+			out: `
+Update | t | set: a = 0
+  DataSource t
+`,
+		},
+	})
+}
@@ -0,0 +1,220 @@
+package plan
+
+import (
+	"github.com/castermode/Nesoi/src/sql/parser"
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+// conjuncts splits a condition on its top level ANDs
+func conjuncts(cond *parser.TargetRes) []*parser.TargetRes {
+	if cond.Type == parser.EFUNC && cond.FuncName == "and" {
+		return append(conjuncts(cond.Args[0]), conjuncts(cond.Args[1])...)
+	}
+	return []*parser.TargetRes{cond}
+}
+
+func andTarget(conds []*parser.TargetRes) *parser.TargetRes {
+	ret := conds[0]
+	for _, cond := range conds[1:] {
+		ret = &parser.TargetRes{
+			Type:     parser.EFUNC,
+			FuncName: "and",
+			Args:     []*parser.TargetRes{ret, cond},
+			RetType:  util.KindInt64,
+		}
+	}
+	return ret
+}
+
+/*
+ * appendWhere filters the rows of plan by a where clause. Its EXISTS and
+ * IN subqueries become semi joins where they can, the other conjuncts are
+ * evaluated on every row, running the subqueries in them again for each
+ * row when they are correlated.
+ */
+func appendWhere(plan Plan, where *parser.TargetRes) (Plan, error) {
+	var conds []*parser.TargetRes
+	var joins []*SemiJoin
+	var inners []Plan
+	for _, cond := range conjuncts(where) {
+		join, inner, err := semiJoin(cond)
+		if err != nil {
+			return nil, err
+		}
+		if join == nil {
+			conds = append(conds, cond)
+			continue
+		}
+		joins = append(joins, join)
+		inners = append(inners, inner)
+	}
+
+	if len(conds) > 0 {
+		plan = appendPlan(&Selection{Conds: conds}, plan)
+	}
+	for i, join := range joins {
+		plan = appendPlan(join, plan)
+		appendPlan(join, inners[i])
+	}
+	return plan, nil
+}
+
+/*
+ * refs tells whether a target refers to columns of its own query and of
+ * the query one level out. ok is false when it refers further out, or
+ * has a correlated subquery whose references are not known here.
+ */
+func refs(t *parser.TargetRes) (local bool, outer bool, ok bool) {
+	ok = true
+	switch t.Type {
+	case parser.ETARGET:
+		switch t.Depth {
+		case 0:
+			local = true
+		case 1:
+			outer = true
+		default:
+			ok = false
+		}
+		return
+	case parser.ESUBQUERY, parser.EEXISTS, parser.EINSUBQUERY:
+		if t.Sub.Correlated {
+			return false, false, false
+		}
+	}
+	for _, arg := range t.Args {
+		l, o, k := refs(arg)
+		local, outer, ok = local || l, outer || o, ok && k
+	}
+	return
+}
+
+func isLocal(t *parser.TargetRes) bool {
+	_, outer, ok := refs(t)
+	return ok && !outer
+}
+
+func hasSubquery(t *parser.TargetRes) bool {
+	switch t.Type {
+	case parser.ESUBQUERY, parser.EEXISTS, parser.EINSUBQUERY:
+		return true
+	}
+	for _, arg := range t.Args {
+		if hasSubquery(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOuter tells whether a target is computed from the outer row alone
+func isOuter(t *parser.TargetRes) bool {
+	local, outer, ok := refs(t)
+	return ok && outer && !local && !hasSubquery(t)
+}
+
+// shiftOut gives a target of the outer row as seen from the outer query
+func shiftOut(t *parser.TargetRes) *parser.TargetRes {
+	c := *t
+	if c.Type == parser.ETARGET {
+		c.Depth--
+	}
+	c.Args = nil
+	for _, arg := range t.Args {
+		c.Args = append(c.Args, shiftOut(arg))
+	}
+	return &c
+}
+
+// keys are hashed as they are, so strings can only match strings
+func sameKind(a byte, b byte) bool {
+	if a == util.KindNull || b == util.KindNull {
+		return false
+	}
+	return (a == util.KindString) == (b == util.KindString)
+}
+
+/*
+ * semiJoin turns a where conjunct of the form [NOT] EXISTS (subquery) or
+ * expr IN (subquery) into a semi or anti join. The subquery may refer to
+ * the outer query in equalities of its own where clause, those become keys
+ * of the join and the rest of the subquery is planned on its own. NOT IN
+ * is left alone, as it is not false when the subquery has a null.
+ */
+func semiJoin(cond *parser.TargetRes) (*SemiJoin, Plan, error) {
+	join := &SemiJoin{}
+	var innerKeys []*parser.TargetRes
+	if cond.Type == parser.EFUNC && cond.FuncName == "not" && cond.Args[0].Type == parser.EEXISTS {
+		join.Anti = true
+		cond = cond.Args[0]
+	}
+	switch cond.Type {
+	case parser.EEXISTS:
+	case parser.EINSUBQUERY:
+		field := cond.Sub.Fields[0]
+		if !isLocal(cond.Args[0]) || !isLocal(field) {
+			return nil, nil, nil
+		}
+		join.OuterKeys = append(join.OuterKeys, cond.Args[0])
+		innerKeys = append(innerKeys, field)
+	default:
+		return nil, nil, nil
+	}
+
+	sub := cond.Sub
+	if sub.Limit != nil || (sub.From == nil && sub.FromQuery == nil) {
+		return nil, nil, nil
+	}
+
+	var rest []*parser.TargetRes
+	if sub.Where != nil {
+		for _, c := range conjuncts(sub.Where) {
+			if isLocal(c) {
+				rest = append(rest, c)
+				continue
+			}
+			if c.Type != parser.EFUNC || c.FuncName != "=" {
+				return nil, nil, nil
+			}
+			inner, outer := c.Args[0], c.Args[1]
+			if !isLocal(inner) {
+				inner, outer = outer, inner
+			}
+			if !isLocal(inner) || !isOuter(outer) {
+				return nil, nil, nil
+			}
+			join.OuterKeys = append(join.OuterKeys, shiftOut(outer))
+			innerKeys = append(innerKeys, inner)
+		}
+	}
+
+	// an uncorrelated EXISTS runs only once anyway
+	if len(join.OuterKeys) == 0 {
+		return nil, nil, nil
+	}
+	for i, key := range join.OuterKeys {
+		if !sameKind(key.RetType, innerKeys[i].RetType) {
+			return nil, nil, nil
+		}
+	}
+
+	query := *sub
+	query.Where = nil
+	if len(rest) > 0 {
+		query.Where = andTarget(rest)
+	}
+	query.Fields = nil
+	for i, key := range innerKeys {
+		f := *key
+		f.TargetID = i + 1
+		f.Name = ""
+		query.Fields = append(query.Fields, &f)
+	}
+	query.Correlated = false
+
+	inner, err := selectPlan(&query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return join, inner, nil
+}
@@ -0,0 +1,243 @@
+package result
+
+import (
+	"strconv"
+
+	"github.com/castermode/Nesoi/src/sql/util"
+)
+
+const (
+	// rows the first chunk of an executor holds, the next ones hold twice
+	// as many up to ChunkRows, so that a query reading a few rows doesn't
+	// read a full chunk
+	InitChunkRows = 32
+	ChunkRows     = 1024
+)
+
+/*
+ * Column is a vector of the values of one column of a chunk. Each value
+ * has its kind, ints and floats are kept unboxed and the bytes of all the
+ * strings in one buffer, so a column is filled and read without a datum
+ * for each value.
+ */
+type Column struct {
+	kinds  []byte
+	ints   []int64
+	floats []float64
+	// the string of row i is data[offsets[i]:offsets[i+1]]
+	offsets []int
+	data    []byte
+}
+
+func NewColumn(capacity int) *Column {
+	return &Column{
+		kinds:   make([]byte, 0, capacity),
+		ints:    make([]int64, 0, capacity),
+		floats:  make([]float64, 0, capacity),
+		offsets: append(make([]int, 0, capacity+1), 0),
+	}
+}
+
+func (c *Column) Len() int {
+	return len(c.kinds)
+}
+
+func (c *Column) Reset() {
+	c.kinds = c.kinds[:0]
+	c.ints = c.ints[:0]
+	c.floats = c.floats[:0]
+	c.offsets = c.offsets[:1]
+	c.data = c.data[:0]
+}
+
+func (c *Column) Kind(i int) byte {
+	return c.kinds[i]
+}
+
+func (c *Column) IsNull(i int) bool {
+	return c.kinds[i] == util.KindNull
+}
+
+func (c *Column) Int(i int) int64 {
+	return c.ints[i]
+}
+
+func (c *Column) Float(i int) float64 {
+	return c.floats[i]
+}
+
+// Bytes gives the string of row i, it is only valid until the column is
+// reset
+func (c *Column) Bytes(i int) []byte {
+	return c.data[c.offsets[i]:c.offsets[i+1]]
+}
+
+func (c *Column) append(k byte, i int64, f float64) {
+	c.kinds = append(c.kinds, k)
+	c.ints = append(c.ints, i)
+	c.floats = append(c.floats, f)
+	c.offsets = append(c.offsets, len(c.data))
+}
+
+func (c *Column) AppendNull() {
+	c.append(util.KindNull, 0, 0)
+}
+
+func (c *Column) AppendInt(i int64) {
+	c.append(util.KindInt64, i, 0)
+}
+
+func (c *Column) AppendFloat(f float64) {
+	c.append(util.KindFloat64, 0, f)
+}
+
+func (c *Column) AppendBytes(b []byte) {
+	c.data = append(c.data, b...)
+	c.append(util.KindString, 0, 0)
+}
+
+func (c *Column) AppendDatum(d *util.Datum) {
+	switch d.GetK() {
+	case util.KindInt64:
+		c.AppendInt(d.GetI())
+	case util.KindFloat64:
+		c.AppendFloat(d.GetF())
+	case util.KindString:
+		c.AppendBytes(d.GetB())
+	default:
+		c.AppendNull()
+	}
+}
+
+// Truncate keeps the first n rows
+func (c *Column) Truncate(n int) {
+	c.kinds = c.kinds[:n]
+	c.ints = c.ints[:n]
+	c.floats = c.floats[:n]
+	c.offsets = c.offsets[:n+1]
+	c.data = c.data[:c.offsets[n]]
+}
+
+// AppendFrom appends the value of row i of src
+func (c *Column) AppendFrom(src *Column, i int) {
+	switch src.kinds[i] {
+	case util.KindString:
+		c.AppendBytes(src.Bytes(i))
+	default:
+		c.append(src.kinds[i], src.ints[i], src.floats[i])
+	}
+}
+
+// Datum gives the value of row i as a datum of its own
+func (c *Column) Datum(i int) *util.Datum {
+	d := &util.Datum{}
+	d.SetK(c.kinds[i])
+	switch c.kinds[i] {
+	case util.KindInt64:
+		d.SetI(c.ints[i])
+	case util.KindFloat64:
+		d.SetF(c.floats[i])
+	case util.KindString:
+		d.SetB(append([]byte(nil), c.Bytes(i)...))
+	}
+	return d
+}
+
+// AppendText appends the value of row i as the text protocol sends it,
+// it is not null
+func (c *Column) AppendText(buf []byte, i int) []byte {
+	switch c.kinds[i] {
+	case util.KindInt64:
+		return strconv.AppendInt(buf, c.ints[i], 10)
+	case util.KindFloat64:
+		d := &util.Datum{}
+		d.SetK(util.KindFloat64)
+		d.SetF(c.floats[i])
+		text, _ := util.DumpValueToText(d)
+		return append(buf, text...)
+	}
+	return append(buf, c.Bytes(i)...)
+}
+
+/*
+ * Chunk holds a batch of rows column by column, every column has a value
+ * for each row. Executors that give chunks fill one and give it again on
+ * the next call, so a chunk is only valid until then.
+ */
+type Chunk struct {
+	Columns  []*Column
+	capacity int
+}
+
+func NewChunk(cols int) *Chunk {
+	chk := &Chunk{Columns: make([]*Column, cols), capacity: InitChunkRows}
+	for i := range chk.Columns {
+		chk.Columns[i] = NewColumn(ChunkRows)
+	}
+	return chk
+}
+
+func (chk *Chunk) NumRows() int {
+	if len(chk.Columns) == 0 {
+		return 0
+	}
+	return chk.Columns[0].Len()
+}
+
+func (chk *Chunk) Reset() {
+	for _, c := range chk.Columns {
+		c.Reset()
+	}
+}
+
+func (chk *Chunk) Truncate(n int) {
+	for _, c := range chk.Columns {
+		c.Truncate(n)
+	}
+}
+
+func (chk *Chunk) IsFull() bool {
+	if chk.capacity == 0 {
+		return chk.NumRows() >= ChunkRows
+	}
+	return chk.NumRows() >= chk.capacity
+}
+
+// Grow doubles the rows the chunk is filled with, up to ChunkRows
+func (chk *Chunk) Grow() {
+	if chk.capacity != 0 && chk.capacity < ChunkRows {
+		chk.capacity *= 2
+	}
+}
+
+// Row gives row i as datums
+func (chk *Chunk) Row(i int) []*util.Datum {
+	row := make([]*util.Datum, len(chk.Columns))
+	for j, c := range chk.Columns {
+		row[j] = c.Datum(i)
+	}
+	return row
+}
+
+func (chk *Chunk) AppendRow(datums []*util.Datum) {
+	for j, c := range chk.Columns {
+		c.AppendDatum(datums[j])
+	}
+}
+
+// AppendRowFrom appends row i of src
+func (chk *Chunk) AppendRowFrom(src *Chunk, i int) {
+	for j, c := range chk.Columns {
+		c.AppendFrom(src.Columns[j], i)
+	}
+}
+
+/*
+ * ChunkResult is implemented by the results that give their rows a chunk
+ * at a time. NextChunk gives nil when there are no more rows, it never
+ * gives an empty chunk. A result is read either by Next or by NextChunk.
+ */
+type ChunkResult interface {
+	Result
+	NextChunk() (*Chunk, error)
+}
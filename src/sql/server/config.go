@@ -11,4 +11,10 @@ type Config struct {
 	//distkv config
 	DistSysAddr  string
 	DistUserAddr string
+
+	// rows read from the storage in one round trip
+	FetchBatchSize int
+	// milliseconds a SELECT may run, 0 for no limit, unless the session
+	// sets max_execution_time
+	MaxExecutionTime int
 }
@@ -2,9 +2,13 @@ package server
 
 import (
 	"bufio"
+	"bytes"
+	goctx "context"
 	"encoding/binary"
 	"io"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/castermode/Nesoi/src/sql/context"
 	"github.com/castermode/Nesoi/src/sql/executor"
@@ -34,6 +38,13 @@ type clientConn struct {
 
 	ctx      *context.Context
 	executor *executor.Executor
+
+	// cancel stops the statement being run, KILL calls it from other
+	// connections, and process is what SHOW PROCESSLIST shows of the
+	// connection to them
+	mu      sync.Mutex
+	cancel  goctx.CancelFunc
+	process executor.ProcessInfo
 }
 
 func (cc *clientConn) Start() {
@@ -65,11 +76,53 @@ func (cc *clientConn) Start() {
 }
 
 func (cc *clientConn) Stop() {
+	cc.executor.Close()
 	cc.svr.rwlock.Lock()
 	delete(cc.svr.clients, cc.connid)
 	cc.svr.rwlock.Unlock()
 }
 
+// kill stops the statement the connection runs, and closes the connection
+// unless query is set
+func (cc *clientConn) kill(query bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.cancel != nil {
+		cc.cancel()
+	}
+	if !query {
+		cc.conn.Close()
+	}
+}
+
+// setCommand records the command the connection starts, info is the
+// statement it runs
+func (cc *clientConn) setCommand(command string, state string, info string) {
+	db := cc.ctx.GetCurrentDB()
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.process.Command = command
+	cc.process.State = state
+	cc.process.Info = info
+	cc.process.DB = db
+	cc.process.Since = time.Now()
+}
+
+// setState records the state of the command being run
+func (cc *clientConn) setState(state string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.process.State = state
+}
+
+// processInfo gives a copy of what the connection is doing
+func (cc *clientConn) processInfo() *executor.ProcessInfo {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	p := cc.process
+	return &p
+}
+
 func (cc *clientConn) readOnePacket() ([]byte, error) {
 	var header [4]byte
 
@@ -160,7 +213,10 @@ func (cc *clientConn) flush() error {
 }
 
 func (cc *clientConn) writeError(e error) error {
-	m := mysql.NewErrf(mysql.ErrUnknown, e.Error())
+	m, ok := e.(*mysql.SQLError)
+	if !ok {
+		m = mysql.NewErrf(mysql.ErrUnknown, e.Error())
+	}
 
 	data := make([]byte, 4, 16+len(m.Message))
 	data = append(data, mysql.ErrHeader)
@@ -249,13 +305,27 @@ func (cc *clientConn) writeInitialHandshake() error {
 
 type handshakeResponse41 struct {
 	capability uint32
+	user       string
 }
 
 func handshakeResponseParse(p *handshakeResponse41, data []byte) error {
+	if len(data) < 4 {
+		return errors.New("malformed handshake response")
+	}
 	// capability
 	capability := binary.LittleEndian.Uint32(data[:4])
 	p.capability = capability
 
+	// max packet size, charset and reserved bytes come before the user name
+	pos := 4 + 4 + 1 + 23
+	if capability&mysql.ClientProtocol41 > 0 && len(data) > pos {
+		user := data[pos:]
+		if end := bytes.IndexByte(user, 0); end >= 0 {
+			user = user[:end]
+		}
+		p.user = string(user)
+	}
+
 	return nil
 }
 
@@ -271,6 +341,16 @@ func (cc *clientConn) readHandshakeResponse() error {
 	}
 	cc.capability = p.capability & defaultCapability
 
+	host, _, err := net.SplitHostPort(cc.conn.RemoteAddr().String())
+	if err != nil {
+		host = cc.conn.RemoteAddr().String()
+	}
+	cc.ctx.SetUser(p.user, host)
+	cc.mu.Lock()
+	cc.process.User = p.user
+	cc.process.Host = host
+	cc.mu.Unlock()
+
 	// @todo: do auth
 	return nil
 }
@@ -327,6 +407,16 @@ func (cc *clientConn) writeResult(r result.Result) error {
 		return nil
 	}
 
+	if cr, ok := r.(result.ChunkResult); ok {
+		if err = cc.writeChunks(cr, data); err != nil {
+			return err
+		}
+		if err = cc.writeEOF(); err != nil {
+			return err
+		}
+		return cc.flush()
+	}
+
 	var rc *result.Record
 	for {
 		rc, err = r.Next()
@@ -365,6 +455,36 @@ func (cc *clientConn) writeResult(r result.Result) error {
 	return cc.flush()
 }
 
+// writeChunks writes the rows of r straight from the columns of its chunks
+func (cc *clientConn) writeChunks(r result.ChunkResult, data []byte) error {
+	var text []byte
+	for {
+		chk, err := r.NextChunk()
+		if err != nil {
+			return err
+		}
+		if chk == nil {
+			return nil
+		}
+
+		for i := 0; i < chk.NumRows(); i++ {
+			data = data[0:4]
+			for _, c := range chk.Columns {
+				if c.IsNull(i) {
+					data = append(data, 0xfb)
+					continue
+				}
+				text = c.AppendText(text[:0], i)
+				data = append(data, util.DumpLengthEncodedInt(uint64(len(text)))...)
+				data = append(data, text...)
+			}
+			if err = cc.writePacket(data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (cc *clientConn) writeMultiResult(rs []result.Result) error {
 	for _, r := range rs {
 		if err := cc.writeResult(r); err != nil {
@@ -393,6 +513,15 @@ func (cc *clientConn) handleRequest(data []byte) error {
 		return cc.handleQuery(util.ToString(data))
 	case mysql.ComPing:
 		return cc.writeOK()
+	case mysql.ComProcessKill:
+		if len(data) < 4 {
+			return mysql.ErrMalformPacket
+		}
+		id := binary.LittleEndian.Uint32(data)
+		if !cc.svr.Kill(id, false) {
+			return mysql.NewErrf(mysql.ErrNoSuchThread, "Unknown thread id: %d", id)
+		}
+		return cc.writeOK()
 	case mysql.ComInitDB:
 		//@TODO
 		return cc.writeOK()
@@ -403,10 +532,25 @@ func (cc *clientConn) handleRequest(data []byte) error {
 
 func (cc *clientConn) handleQuery(sql string) error {
 	glog.Info("Accept sql: ", sql)
-	results, err := cc.execute(sql)
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	cc.mu.Lock()
+	cc.cancel = cancel
+	cc.mu.Unlock()
+	defer func() {
+		cc.mu.Lock()
+		cc.cancel = nil
+		cc.mu.Unlock()
+		cancel()
+		cc.setCommand("Sleep", "", "")
+	}()
+	cc.setCommand("Query", "executing", sql)
+
+	results, err := cc.execute(ctx, sql)
 	if err != nil {
 		return err
 	}
+	// the rows are read as they are written
+	cc.setState("Sending data")
 
 	if results != nil {
 		if len(results) == 1 {
@@ -421,6 +565,6 @@ func (cc *clientConn) handleQuery(sql string) error {
 	return err
 }
 
-func (cc *clientConn) execute(sql string) ([]result.Result, error) {
-	return cc.executor.Execute(sql)
+func (cc *clientConn) execute(ctx goctx.Context, sql string) ([]result.Result, error) {
+	return cc.executor.Execute(ctx, sql)
 }
@@ -5,11 +5,15 @@ import (
 	"errors"
 	"math/rand"
 	"net"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/castermode/Nesoi/src/sql/context"
 	"github.com/castermode/Nesoi/src/sql/executor"
+	"github.com/castermode/Nesoi/src/sql/parser"
 	"github.com/castermode/Nesoi/src/sql/store"
 	"github.com/golang/glog"
 )
@@ -38,6 +42,13 @@ func NewServer(cfg *Config) (*Server, error) {
 		clients: make(map[uint32]*clientConn),
 	}
 
+	if cfg.FetchBatchSize > 0 {
+		executor.FetchBatchSize = cfg.FetchBatchSize
+	}
+	if cfg.MaxExecutionTime > 0 {
+		context.GetSysVar(context.MaxExecutionTime).Value = strconv.Itoa(cfg.MaxExecutionTime)
+	}
+
 	var err error
 	svr.listener, err = net.Listen("tcp", svr.cfg.Addr)
 	if err != nil {
@@ -83,15 +94,25 @@ func (svr *Server) InitNesoiDB() error {
 	// init nesoi db
 	NesoiDB := store.SystemFlag + store.DBFlag + store.NesoiFlag
 	_, err := svr.driver.GetSysRecord(NesoiDB)
-	if err == nil {
-		return nil
+	if err == store.Nil {
+		var id int64
+		id, err = parser.AllocDatabaseID(svr.driver)
+		if err != nil {
+			return err
+		}
+		err = svr.driver.SetSysRecord(NesoiDB, strconv.FormatInt(id, 10), 0)
 	}
-
-	if err != store.Nil {
+	if err != nil {
 		return errors.New("Get kv storage error!")
 	}
 
-	return svr.driver.SetSysRecord(NesoiDB, "", 0)
+	// move data written by older servers to the current key layout
+	return executor.UpgradeStore(svr.driver)
+}
+
+// StartDDLWorker resumes the ddl jobs left behind by stopped nodes.
+func (svr *Server) StartDDLWorker() {
+	executor.StartDDLWorker(svr.driver)
 }
 
 func (svr *Server) newClientConn(c net.Conn) *clientConn {
@@ -105,10 +126,39 @@ func (svr *Server) newClientConn(c net.Conn) *clientConn {
 		ctx:    context.NewContext(),
 	}
 
+	cc.ctx.SetConnectionID(cc.connid)
+	cc.process = executor.ProcessInfo{ID: cc.connid, Command: "Connect", Since: time.Now()}
 	cc.executor = executor.NewExecutor(svr.driver, cc.ctx)
+	cc.executor.SetSessionManager(svr)
 	return cc
 }
 
+// Kill kills the connection connID, or only the statement it runs when
+// query is set
+func (svr *Server) Kill(connID uint32, query bool) bool {
+	svr.rwlock.RLock()
+	cc, ok := svr.clients[connID]
+	svr.rwlock.RUnlock()
+	if !ok {
+		return false
+	}
+	cc.kill(query)
+	return true
+}
+
+// ShowProcessList gives what the connections are doing, in the order of
+// their ids
+func (svr *Server) ShowProcessList() []*executor.ProcessInfo {
+	svr.rwlock.RLock()
+	ps := make([]*executor.ProcessInfo, 0, len(svr.clients))
+	for _, cc := range svr.clients {
+		ps = append(ps, cc.processInfo())
+	}
+	svr.rwlock.RUnlock()
+	sort.Slice(ps, func(i, j int) bool { return ps[i].ID < ps[j].ID })
+	return ps
+}
+
 // Start starts the TCP server, accepting new clients and creating service
 // go-routine for each.
 func (svr *Server) Start() error {
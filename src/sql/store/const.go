@@ -1,10 +1,18 @@
 package store
 
 const (
-	SystemFlag = "SYSTEM/"
-	DBFlag     = "DATABASE/"
-	TableFlag  = "TABLE/"
-	IndexFlag  = "INDEX/"
-	UserFlag   = "USER/"
-	NesoiFlag  = "NESOI"
+	SystemFlag  = "SYSTEM/"
+	DBFlag      = "DATABASE/"
+	TableFlag   = "TABLE/"
+	IndexFlag   = "INDEX/"
+	UserFlag    = "USER/"
+	JobFlag     = "JOB/"
+	OwnerFlag   = "JOBOWNER/"
+	IDFlag      = "ID/"
+	UpgradeFlag = "UPGRADE/"
+	StatsFlag   = "STATS/"
+	SysVarFlag  = "SYSVAR/"
+	VersionFlag = "VERSION"
+	OrderFlag   = "ORDER/"
+	NesoiFlag   = "NESOI"
 )
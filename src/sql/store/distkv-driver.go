@@ -44,15 +44,62 @@ func (dd *DistkvDriver) GetUserRecord(key string) (string, error) {
 	return value, err
 }
 
+// GetUserRecords pipelines GET, the keys may be served by several nodes
+func (dd *DistkvDriver) GetUserRecords(keys []string) ([]string, []bool, error) {
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	if len(keys) == 0 {
+		return values, found, nil
+	}
+	pipe := dd.userClient.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(key)
+	}
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return nil, nil, err
+	}
+	for i, cmd := range cmds {
+		value, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i], found[i] = value, true
+	}
+	return values, found, nil
+}
+
 func (dd *DistkvDriver) SetUserRecord(key string, value string, ttl int64) error {
 	return dd.userClient.Set(key, value, time.Duration(ttl)).Err()
 }
 
+func (dd *DistkvDriver) SetUserRecords(keys []string, values []string) error {
+	pipe := dd.userClient.Pipeline()
+	for i, key := range keys {
+		pipe.Set(key, values[i], 0)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
 func (dd *DistkvDriver) DelUserRecord(key string) error {
 	_, err := dd.userClient.Del(key).Result()
 	return err
 }
 
+// DelUserRecords pipelines DEL, the keys may be served by several nodes
+func (dd *DistkvDriver) DelUserRecords(keys []string) error {
+	pipe := dd.userClient.Pipeline()
+	for _, key := range keys {
+		pipe.Del(key)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
 func (dd *DistkvDriver) ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
 	return dd.userClient.Scan(cursor, match, count).Result()
 }
@@ -78,3 +125,11 @@ func (dd *DistkvDriver) DelSysRecord(key string) error {
 func (dd *DistkvDriver) ScanSysRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
 	return dd.sysClient.Scan(cursor, match, count).Result()
 }
+
+func (dd *DistkvDriver) IncrSysRecord(key string) (int64, error) {
+	return dd.sysClient.Incr(key).Result()
+}
+
+func (dd *DistkvDriver) IncrBySysRecord(key string, n int64) (int64, error) {
+	return dd.sysClient.IncrBy(key, n).Result()
+}
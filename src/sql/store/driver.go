@@ -11,8 +11,34 @@ type Driver interface {
 	SetSysRecord(key string, value string, ttl int64) error
 	DelSysRecord(key string) error
 	ScanSysRecords(cursor uint64, match string, count int64) ([]string, uint64, error)
+	IncrSysRecord(key string) (int64, error)
+	IncrBySysRecord(key string, n int64) (int64, error)
 	GetUserRecord(key string) (string, error)
+	// GetUserRecords reads the records at keys in one round trip, found[i]
+	// tells whether there is one at keys[i]
+	GetUserRecords(keys []string) (values []string, found []bool, err error)
 	SetUserRecord(key string, value string, ttl int64) error
+	// SetUserRecords writes values[i] at keys[i] in one round trip
+	SetUserRecords(keys []string, values []string) error
 	DelUserRecord(key string) error
+	// DelUserRecords deletes the records at keys in one round trip
+	DelUserRecords(keys []string) error
 	ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error)
 }
+
+/*
+ * OrderedDriver is implemented by drivers that keep the rows of a table
+ * in the order of their keys, so a range of rows is read without a scan of
+ * all of them. The ranges are within the rows of a table. The Distkv
+ * driver only hashes its keys.
+ */
+type OrderedDriver interface {
+	Driver
+	// SeekUserRecords gives the keys and values of at most count records
+	// from the first key not less than start, stopping before end
+	SeekUserRecords(start string, end string, count int64) ([]string, []string, error)
+	// DelUserRange deletes the records from start to before end, and what
+	// the driver keeps of their order, whether they are stored or gone
+	// with their ttl
+	DelUserRange(start string, end string) error
+}
@@ -1,11 +1,21 @@
 package store
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
 )
 
+/*
+ * RedisDriver keeps the keys of the rows of each table in a sorted set as
+ * well, /SYSTEM/ORDER/t<id>, all of them with score 0 so the set is in the
+ * order of the keys, and seeks a range of rows with ZRANGEBYLEX. The other
+ * user keys are only hashed. A row and its member are written and deleted
+ * in one transaction. A row gone with its ttl keeps its member until a
+ * seek meets it.
+ */
 type RedisDriver struct {
 	client *redis.Client
 }
@@ -32,15 +42,175 @@ func (rd *RedisDriver) GetUserRecord(key string) (string, error) {
 	return value, err
 }
 
+func (rd *RedisDriver) GetUserRecords(keys []string) ([]string, []bool, error) {
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	if len(keys) == 0 {
+		return values, found, nil
+	}
+	rs, err := rd.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, r := range rs {
+		if v, ok := r.(string); ok {
+			values[i], found[i] = v, true
+		}
+	}
+	return values, found, nil
+}
+
+/*
+ * orderKey gives the sorted set keeping the order of the rows of the table
+ * key is a row of, the rows are the keys USER/t<id>_r... ok is false for
+ * the other keys.
+ */
+func orderKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, UserFlag+"t") {
+		return "", false
+	}
+	rest := key[len(UserFlag):]
+	i := 1
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i == 1 || !strings.HasPrefix(rest[i:], "_r") {
+		return "", false
+	}
+	return SystemFlag + OrderFlag + rest[:i], true
+}
+
+// orderMembers groups the row keys among keys by their sorted sets
+func orderMembers(keys []string) map[string][]interface{} {
+	members := make(map[string][]interface{})
+	for _, key := range keys {
+		if okey, ok := orderKey(key); ok {
+			members[okey] = append(members[okey], key)
+		}
+	}
+	return members
+}
+
 func (rd *RedisDriver) SetUserRecord(key string, value string, ttl int64) error {
-	return rd.client.Set(key, value, time.Duration(ttl)).Err()
+	okey, ok := orderKey(key)
+	if !ok {
+		return rd.client.Set(key, value, time.Duration(ttl)).Err()
+	}
+	pipe := rd.client.TxPipeline()
+	pipe.Set(key, value, time.Duration(ttl))
+	pipe.ZAdd(okey, redis.Z{Member: key})
+	_, err := pipe.Exec()
+	return err
+}
+
+func (rd *RedisDriver) SetUserRecords(keys []string, values []string) error {
+	pipe := rd.client.TxPipeline()
+	for i, key := range keys {
+		pipe.Set(key, values[i], 0)
+	}
+	for okey, members := range orderMembers(keys) {
+		zs := make([]redis.Z, len(members))
+		for i, m := range members {
+			zs[i] = redis.Z{Member: m}
+		}
+		pipe.ZAdd(okey, zs...)
+	}
+	_, err := pipe.Exec()
+	return err
 }
 
 func (rd *RedisDriver) DelUserRecord(key string) error {
-	_, err := rd.client.Del(key).Result()
+	return rd.DelUserRecords([]string{key})
+}
+
+func (rd *RedisDriver) DelUserRecords(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := rd.client.TxPipeline()
+	pipe.Del(keys...)
+	for okey, members := range orderMembers(keys) {
+		pipe.ZRem(okey, members...)
+	}
+	_, err := pipe.Exec()
 	return err
 }
 
+/*
+ * SeekUserRecords gives fewer than count records only at the end of the
+ * range, the members of the rows gone with their ttl are removed.
+ */
+func (rd *RedisDriver) SeekUserRecords(start string, end string, count int64) ([]string, []string, error) {
+	okey, ok := orderKey(start)
+	if !ok {
+		return nil, nil, errors.New("seek out of the rows of a table!")
+	}
+	var keys, vals []string
+	for int64(len(keys)) < count {
+		want := count - int64(len(keys))
+		members, err := rd.client.ZRangeByLex(okey, redis.ZRangeBy{
+			Min:   "[" + start,
+			Max:   "(" + end,
+			Count: want,
+		}).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		values, found, err := rd.GetUserRecords(members)
+		if err != nil {
+			return nil, nil, err
+		}
+		var gone []interface{}
+		for i, key := range members {
+			if found[i] {
+				keys = append(keys, key)
+				vals = append(vals, values[i])
+			} else {
+				gone = append(gone, key)
+			}
+		}
+		if len(gone) > 0 {
+			err = rd.client.ZRem(okey, gone...).Err()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if int64(len(members)) < want {
+			break
+		}
+		start = members[len(members)-1] + "\x00"
+	}
+	return keys, vals, nil
+}
+
+// the rows DelUserRange deletes at a time
+const delRangeCount = 100
+
+// DelUserRange deletes the rows from start to before end with their members
+func (rd *RedisDriver) DelUserRange(start string, end string) error {
+	okey, ok := orderKey(start)
+	if !ok {
+		return errors.New("seek out of the rows of a table!")
+	}
+	for {
+		members, err := rd.client.ZRangeByLex(okey, redis.ZRangeBy{
+			Min:   "[" + start,
+			Max:   "(" + end,
+			Count: delRangeCount,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		err = rd.DelUserRecords(members)
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func (rd *RedisDriver) ScanUserRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
 	return rd.client.Scan(cursor, match, count).Result()
 }
@@ -50,13 +220,22 @@ func (rd *RedisDriver) GetSysRecord(key string) (string, error) {
 }
 
 func (rd *RedisDriver) SetSysRecord(key string, value string, ttl int64) error {
-	return rd.SetUserRecord(key, value, ttl)
+	return rd.client.Set(key, value, time.Duration(ttl)).Err()
 }
 
 func (rd *RedisDriver) DelSysRecord(key string) error {
-	return rd.DelUserRecord(key)
+	_, err := rd.client.Del(key).Result()
+	return err
 }
 
 func (rd *RedisDriver) ScanSysRecords(cursor uint64, match string, count int64) ([]string, uint64, error) {
 	return rd.ScanUserRecords(cursor, match, count)
 }
+
+func (rd *RedisDriver) IncrSysRecord(key string) (int64, error) {
+	return rd.client.Incr(key).Result()
+}
+
+func (rd *RedisDriver) IncrBySysRecord(key string, n int64) (int64, error) {
+	return rd.client.IncrBy(key, n).Result()
+}
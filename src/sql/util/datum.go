@@ -2,18 +2,22 @@ package util
 
 import (
 	"errors"
+	"math"
 	"strconv"
+	"strings"
 )
 
 const (
-	KindNull   byte = 0
-	KindInt64  byte = 1
-	KindString byte = 2
+	KindNull    byte = 0
+	KindInt64   byte = 1
+	KindString  byte = 2
+	KindFloat64 byte = 3
 )
 
 type Datum struct {
 	k byte
 	i int64
+	f float64
 	b []byte
 }
 
@@ -33,6 +37,14 @@ func (d *Datum) GetI() int64 {
 	return d.i
 }
 
+func (d *Datum) SetF(v float64) {
+	d.f = v
+}
+
+func (d *Datum) GetF() float64 {
+	return d.f
+}
+
 func (d *Datum) SetB(v []byte) {
 	d.b = v
 }
@@ -58,9 +70,123 @@ func (d *Datum) Equal(c *Datum) bool {
 		}
 	}
 
+	if d.k == KindFloat64 && c.k == KindFloat64 {
+		if d.f == c.f {
+			return true
+		}
+	}
+
 	return false
 }
 
+// parseNumericPrefix returns the longest prefix of s that is a number,
+// as MySQL does when a string is used in a numeric context.
+func parseNumericPrefix(s string) string {
+	s = strings.TrimSpace(s)
+	end := 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	digits := false
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+		digits = true
+	}
+	if end < len(s) && s[end] == '.' {
+		end++
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+			digits = true
+		}
+	}
+	if !digits {
+		return ""
+	}
+	if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exp := end + 1
+		if exp < len(s) && (s[exp] == '-' || s[exp] == '+') {
+			exp++
+		}
+		if exp < len(s) && s[exp] >= '0' && s[exp] <= '9' {
+			for exp < len(s) && s[exp] >= '0' && s[exp] <= '9' {
+				exp++
+			}
+			end = exp
+		}
+	}
+	return s[:end]
+}
+
+func (d *Datum) ToInt64() int64 {
+	switch d.k {
+	case KindInt64:
+		return d.i
+	case KindFloat64:
+		return int64(math.RoundToEven(d.f))
+	case KindString:
+		s := parseNumericPrefix(ToString(d.b))
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		f, _ := strconv.ParseFloat(s, 64)
+		return int64(math.Trunc(f))
+	}
+	return 0
+}
+
+func (d *Datum) ToFloat64() float64 {
+	switch d.k {
+	case KindInt64:
+		return float64(d.i)
+	case KindFloat64:
+		return d.f
+	case KindString:
+		f, _ := strconv.ParseFloat(parseNumericPrefix(ToString(d.b)), 64)
+		return f
+	}
+	return 0
+}
+
+// large and small floats are written with an exponent like MySQL does
+func appendFloat(b []byte, f float64) []byte {
+	abs := math.Abs(f)
+	if abs != 0 && (abs >= 1e15 || abs < 1e-4) {
+		return strconv.AppendFloat(b, f, 'g', -1, 64)
+	}
+	return strconv.AppendFloat(b, f, 'f', -1, 64)
+}
+
+// ToBytes returns the text form of the datum, nil for null.
+func (d *Datum) ToBytes() []byte {
+	switch d.k {
+	case KindInt64:
+		return strconv.AppendInt(nil, d.i, 10)
+	case KindFloat64:
+		return appendFloat(nil, d.f)
+	case KindString:
+		return d.b
+	}
+	return nil
+}
+
+// Convert returns the datum cast to kind k, null stays null.
+func (d *Datum) Convert(k byte) *Datum {
+	if d.k == k || d.k == KindNull || k == KindNull {
+		return d
+	}
+
+	c := &Datum{k: k}
+	switch k {
+	case KindInt64:
+		c.i = d.ToInt64()
+	case KindFloat64:
+		c.f = d.ToFloat64()
+	case KindString:
+		c.b = d.ToBytes()
+	}
+	return c
+}
+
 func (d *Datum) IsNull() bool {
 	if d.k == KindNull {
 		return true
@@ -75,6 +201,8 @@ func DumpValueToText(v *Datum) ([]byte, error) {
 		return strconv.AppendInt(nil, v.i, 10), nil
 	case KindString:
 		return v.b, nil
+	case KindFloat64:
+		return appendFloat(nil, v.f), nil
 	default:
 		return nil, errors.New("invalid type!")
 	}